@@ -0,0 +1,109 @@
+// Package access decides who may use the bot.
+package access
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var RejectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "messages_rejected_total",
+		Help: "Total number of messages that were not processed.",
+	},
+	[]string{"reason"}, // Reason can be "unauthorized"
+)
+
+// maxNoticed bounds the chats remembered for rate limiting the reply.
+const maxNoticed = 10000
+
+// Allowlist admits messages from listed users or sent in listed chats. An
+// allowlist without any entries admits everyone.
+type Allowlist struct {
+	users          map[int64]bool
+	chats          map[int64]bool
+	noticeInterval time.Duration
+
+	mu      sync.Mutex
+	noticed map[int64]time.Time // When each chat was last told the bot is private
+}
+
+// NewAllowlist returns an allowlist of the given users and chats that
+// tells a rejected chat at most once per noticeInterval.
+func NewAllowlist(users, chats []int64, noticeInterval time.Duration) *Allowlist {
+	a := &Allowlist{
+		users:          make(map[int64]bool),
+		chats:          make(map[int64]bool),
+		noticeInterval: noticeInterval,
+		noticed:        make(map[int64]time.Time),
+	}
+	for _, id := range users {
+		a.users[id] = true
+	}
+	for _, id := range chats {
+		a.chats[id] = true
+	}
+	return a
+}
+
+// ParseIDs reads a comma-separated list of user or chat IDs.
+func ParseIDs(list string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q: %w", field, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Allowed reports whether message may be processed.
+func (a *Allowlist) Allowed(message *tgbotapi.Message) bool {
+	var userID, chatID int64
+	if message.From != nil {
+		userID = message.From.ID
+	}
+	if message.Chat != nil {
+		chatID = message.Chat.ID
+	}
+	return a.AllowedIn(userID, chatID)
+}
+
+// AllowedIn reports whether userID may use the bot in chatID.
+func (a *Allowlist) AllowedIn(userID, chatID int64) bool {
+	if len(a.users) == 0 && len(a.chats) == 0 {
+		return true
+	}
+	return a.chats[chatID] || a.users[userID]
+}
+
+// ShouldNotify reports whether the rejected chat is due a reply, so that
+// repeat offenders are not answered every time.
+func (a *Allowlist) ShouldNotify(chatID int64, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.noticed[chatID]; ok && now.Sub(last) < a.noticeInterval {
+		return false
+	}
+	if len(a.noticed) >= maxNoticed {
+		for id, last := range a.noticed {
+			if now.Sub(last) >= a.noticeInterval {
+				delete(a.noticed, id)
+			}
+		}
+	}
+	a.noticed[chatID] = now
+	return true
+}
@@ -0,0 +1,88 @@
+package access
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestParseIDs(t *testing.T) {
+	ids, err := ParseIDs(" 7, -100123,,42 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 7 || ids[1] != -100123 || ids[2] != 42 {
+		t.Errorf("ParseIDs = %v", ids)
+	}
+	if ids, err := ParseIDs(""); err != nil || len(ids) != 0 {
+		t.Errorf("empty list parsed as %v, %v", ids, err)
+	}
+	if _, err := ParseIDs("7,@someone"); err == nil {
+		t.Error("a username was taken for an ID")
+	}
+}
+
+func TestAllowlistAdmitsListedUsersAndChats(t *testing.T) {
+	a := NewAllowlist([]int64{7}, []int64{-100}, time.Hour)
+	for _, c := range []struct {
+		userID, chatID int64
+		want           bool
+	}{
+		{7, 7, true},
+		// A listed user in any group
+		{7, -200, true},
+		// Anyone in a listed group
+		{8, -100, true},
+		{8, 8, false},
+		{8, -200, false},
+	} {
+		if got := a.AllowedIn(c.userID, c.chatID); got != c.want {
+			t.Errorf("user %d in chat %d allowed = %v, want %v", c.userID, c.chatID, got, c.want)
+		}
+	}
+
+	// Channel posts have no sender
+	if a.Allowed(&tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -200}}) {
+		t.Error("post without a sender allowed in an unlisted chat")
+	}
+	if !a.Allowed(&tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -100}}) {
+		t.Error("post without a sender refused in a listed chat")
+	}
+}
+
+func TestEmptyAllowlistAdmitsEveryone(t *testing.T) {
+	a := NewAllowlist(nil, nil, time.Hour)
+	if !a.Allowed(&tgbotapi.Message{From: &tgbotapi.User{ID: 8}, Chat: &tgbotapi.Chat{ID: 8}}) {
+		t.Error("empty allowlist refused a message")
+	}
+}
+
+func TestShouldNotifyOncePerInterval(t *testing.T) {
+	a := NewAllowlist([]int64{7}, nil, time.Hour)
+	start := time.Unix(1700000000, 0)
+	if !a.ShouldNotify(8, start) {
+		t.Fatal("first rejection not answered")
+	}
+	if a.ShouldNotify(8, start.Add(59*time.Minute)) {
+		t.Error("chat answered twice within the interval")
+	}
+	if !a.ShouldNotify(9, start.Add(59*time.Minute)) {
+		t.Error("another chat not answered")
+	}
+	if !a.ShouldNotify(8, start.Add(time.Hour)) {
+		t.Error("chat not answered again after the interval")
+	}
+}
+
+func TestShouldNotifyForgetsOldChats(t *testing.T) {
+	a := NewAllowlist([]int64{7}, nil, time.Hour)
+	start := time.Unix(1700000000, 0)
+	for id := int64(0); id < maxNoticed; id++ {
+		a.ShouldNotify(id, start)
+	}
+	a.ShouldNotify(maxNoticed, start.Add(2*time.Hour))
+	if len(a.noticed) != 1 {
+		t.Errorf("%d chats remembered, want the old ones forgotten", len(a.noticed))
+	}
+}
@@ -0,0 +1,171 @@
+// Package breaker stops sending work to a recognition backend that keeps
+// failing, so messages are turned away right away instead of being
+// downloaded for an upload that is bound to fail.
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var StateGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "recognition_circuit_state",
+		Help: "State of the recognition circuit breaker: closed (0), half-open (1) or open (2).",
+	},
+)
+
+// State is where the breaker is at.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// HalfOpen lets a single probe through after the cooldown.
+	HalfOpen
+	// Open turns every call away.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "open"
+}
+
+// Outcome is how a call let through by Allow went.
+type Outcome int
+
+const (
+	// Skipped calls never reached the backend, say because the download
+	// failed, and tell nothing about it.
+	Skipped Outcome = iota
+	Success
+	Failure
+)
+
+// Breaker opens after threshold consecutive failures within window and
+// turns calls away for cooldown. Then a single probe decides: its success
+// closes the breaker, its failure opens it for another cooldown. A nil
+// breaker lets everything through. It is safe for concurrent use.
+type Breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu           sync.Mutex
+	state        State
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+	generation   uint64 // Counts the transitions, to tell calls of an earlier state
+}
+
+// Ticket is handed by Allow to a call it lets through, and given back with
+// its outcome to Done.
+type Ticket struct {
+	generation uint64
+}
+
+// New returns a closed breaker.
+func New(threshold int, window, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: max(threshold, 1), window: window, cooldown: cooldown}
+}
+
+// Allow reports whether a call may go ahead at now. Every allowed call must
+// be followed by Done with the ticket returned.
+func (b *Breaker) Allow(now time.Time) (Ticket, bool) {
+	if b == nil {
+		return Ticket{}, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !now.Before(b.openedAt.Add(b.cooldown)) {
+		b.transition(HalfOpen)
+	}
+	ticket := Ticket{generation: b.generation}
+	switch b.state {
+	case Closed:
+		return ticket, true
+	case HalfOpen:
+		if b.probing {
+			return Ticket{}, false
+		}
+		b.probing = true
+		return ticket, true
+	}
+	return Ticket{}, false
+}
+
+// Done records the outcome of the call Allow handed ticket to. Outcomes of
+// calls let through before the last change of state tell nothing about the
+// backend as it is now and are ignored.
+func (b *Breaker) Done(ticket Ticket, outcome Outcome, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ticket.generation != b.generation {
+		return
+	}
+	if b.state == HalfOpen {
+		// Only the probe was let through since the breaker turned half-open
+		b.probing = false
+		switch outcome {
+		case Success:
+			b.failures = 0
+			b.transition(Closed)
+		case Failure:
+			b.openedAt = now
+			b.transition(Open)
+		}
+		return
+	}
+	switch outcome {
+	case Success:
+		b.failures = 0
+	case Failure:
+		if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+			b.failures, b.firstFailure = 0, now
+		}
+		b.failures++
+		if b.state == Closed && b.failures >= b.threshold {
+			b.openedAt = now
+			b.transition(Open)
+		}
+	}
+}
+
+// State returns the state of the breaker, Closed for nil.
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// transition moves to state, logging and updating the gauge. b.mu is held.
+func (b *Breaker) transition(state State) {
+	if state == b.state {
+		return
+	}
+	event := log.Info()
+	if state == Open {
+		event = log.Warn().Int("failures", b.failures).Dur("cooldown", b.cooldown)
+	}
+	event.Str("from", b.state.String()).Str("to", state.String()).Msg("Recognition circuit breaker changed state")
+	b.state = state
+	b.generation++
+	StateGauge.Set(float64(state))
+}
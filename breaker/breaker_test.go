@@ -0,0 +1,121 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// fail lets a call through at now and reports it failed.
+func fail(t *testing.T, b *Breaker, now time.Time) {
+	t.Helper()
+	ticket, ok := b.Allow(now)
+	if !ok {
+		t.Fatalf("call at %s turned away", now.Sub(start))
+	}
+	b.Done(ticket, Failure, now)
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b := New(3, time.Minute, 30*time.Second)
+	fail(t, b, start)
+	fail(t, b, start.Add(time.Second))
+	if b.State() != Closed {
+		t.Fatalf("state = %s after 2 failures, want closed", b.State())
+	}
+	fail(t, b, start.Add(2*time.Second))
+	if b.State() != Open {
+		t.Fatalf("state = %s after 3 failures, want open", b.State())
+	}
+	if _, ok := b.Allow(start.Add(3 * time.Second)); ok {
+		t.Error("open breaker let a call through")
+	}
+}
+
+func TestBreakerForgetsFailuresOutsideTheWindow(t *testing.T) {
+	b := New(2, time.Minute, 30*time.Second)
+	fail(t, b, start)
+	fail(t, b, start.Add(2*time.Minute))
+	if b.State() != Closed {
+		t.Errorf("state = %s, want failures a window apart not to add up", b.State())
+	}
+
+	ticket, _ := b.Allow(start.Add(2 * time.Minute))
+	b.Done(ticket, Success, start.Add(2*time.Minute))
+	fail(t, b, start.Add(2*time.Minute+time.Second))
+	if b.State() != Closed {
+		t.Errorf("state = %s, want a success to reset the failures", b.State())
+	}
+}
+
+func TestBreakerProbesAfterCooldown(t *testing.T) {
+	for _, c := range []struct {
+		outcome Outcome
+		want    State
+	}{
+		{Success, Closed},
+		{Failure, Open},
+		{Skipped, HalfOpen},
+	} {
+		b := New(1, time.Minute, 30*time.Second)
+		fail(t, b, start)
+
+		if _, ok := b.Allow(start.Add(29 * time.Second)); ok {
+			t.Fatal("call let through during the cooldown")
+		}
+		probeAt := start.Add(30 * time.Second)
+		probe, ok := b.Allow(probeAt)
+		if !ok || b.State() != HalfOpen {
+			t.Fatalf("Allow after the cooldown = %v in %s, want a probe", ok, b.State())
+		}
+		if _, ok := b.Allow(probeAt); ok {
+			t.Fatal("second call let through while probing")
+		}
+		b.Done(probe, c.outcome, probeAt)
+		if b.State() != c.want {
+			t.Errorf("state after a probe with outcome %d = %s, want %s", c.outcome, b.State(), c.want)
+		}
+		if c.outcome == Skipped {
+			if _, ok := b.Allow(probeAt); !ok {
+				t.Error("no new probe after a skipped one")
+			}
+		}
+	}
+}
+
+func TestBreakerIgnoresCallsOfAnEarlierState(t *testing.T) {
+	b := New(1, time.Minute, 30*time.Second)
+	// Let through while closed, it is still uploading when the breaker opens
+	slow, _ := b.Allow(start)
+	fail(t, b, start.Add(time.Second))
+
+	probeAt := start.Add(31 * time.Second)
+	probe, ok := b.Allow(probeAt)
+	if !ok {
+		t.Fatal("no probe after the cooldown")
+	}
+	b.Done(slow, Success, probeAt)
+	if b.State() != HalfOpen {
+		t.Fatalf("state = %s, want the slow call not taken for the probe", b.State())
+	}
+	if _, ok := b.Allow(probeAt); ok {
+		t.Error("the slow call freed the probe slot")
+	}
+	b.Done(probe, Failure, probeAt)
+	if b.State() != Open {
+		t.Errorf("state = %s, want the probe to decide", b.State())
+	}
+}
+
+func TestNilBreakerLetsEverythingThrough(t *testing.T) {
+	var b *Breaker
+	ticket, ok := b.Allow(start)
+	if !ok {
+		t.Error("nil breaker turned a call away")
+	}
+	b.Done(ticket, Failure, start)
+	if b.State() != Closed {
+		t.Errorf("nil breaker is %s", b.State())
+	}
+}
@@ -0,0 +1,107 @@
+// Package cache remembers recognition results so that audio forwarded
+// into several chats is only transcribed once.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Result is a cached transcription, before any transforms are applied.
+type Result struct {
+	Language string    `json:"language"`
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Segment is a timed part of a result, in seconds.
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Cache stores results by key. Implementations are safe for concurrent use.
+type Cache interface {
+	// Get returns the result stored under key, reporting false on a miss.
+	Get(ctx context.Context, key string) (Result, bool, error)
+	// Add stores result under key, replacing any previous one.
+	Add(ctx context.Context, key string, result Result) error
+}
+
+// LRU is an in-memory Cache holding up to a fixed number of results, each
+// for at most a fixed time. The least recently used result is evicted
+// first.
+type LRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+	order      *list.List // Most recently used first
+	entries    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	result  Result
+	expires time.Time
+}
+
+// NewLRU returns an empty cache of maxEntries results kept for ttl.
+func NewLRU(maxEntries int, ttl time.Duration) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(_ context.Context, key string) (Result, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return Result{}, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return Result{}, false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.result, true, nil
+}
+
+func (c *LRU) Add(_ context.Context, key string, result Result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.result, entry.expires = result, expires
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, result: result, expires: expires})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of stored results, expired ones included until
+// they are looked up or evicted.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsTheLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2, time.Hour)
+	c.Add(ctx, "a", Result{Text: "a"})
+	c.Add(ctx, "b", Result{Text: "b"})
+	// Looking a up makes b the one to go
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("a missing")
+	}
+	c.Add(ctx, "c", Result{Text: "c"})
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b kept over the recently used a")
+	}
+	for _, key := range []string{"a", "c"} {
+		if result, ok, _ := c.Get(ctx, key); !ok || result.Text != key {
+			t.Errorf("Get(%s) = %+v, %v", key, result, ok)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+}
+
+func TestLRUExpiresResults(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	c := NewLRU(10, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Add(ctx, "a", Result{Text: "first", Segments: []Segment{{Start: 0, End: 1, Text: "first"}}})
+
+	now = now.Add(59 * time.Second)
+	if result, ok, _ := c.Get(ctx, "a"); !ok || len(result.Segments) != 1 {
+		t.Errorf("Get before the TTL = %+v, %v", result, ok)
+	}
+	// Replacing a result renews it
+	c.Add(ctx, "a", Result{Text: "second"})
+	now = now.Add(59 * time.Second)
+	if result, ok, _ := c.Get(ctx, "a"); !ok || result.Text != "second" {
+		t.Errorf("Get of the replaced result = %+v, %v", result, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("expired result returned")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len = %d, want the expired result dropped", c.Len())
+	}
+}
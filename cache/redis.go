@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces the keys of the bot in a shared Redis.
+const keyPrefix = "telegram-sr-bot:recognition:"
+
+// Redis is a Cache shared by all bot instances using the same Redis. Results
+// expire after the TTL; the number of entries is left to the server's
+// maxmemory policy.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedis returns a cache keeping results in client for ttl.
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) (Result, bool, error) {
+	data, err := c.client.Get(ctx, keyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Result{}, false, nil
+	}
+	if err != nil {
+		return Result{}, false, err
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return Result{}, false, err
+	}
+	return result, true, nil
+}
+
+func (c *Redis) Add(ctx context.Context, key string, result Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, keyPrefix+key, data, c.ttl).Err()
+}
@@ -0,0 +1,176 @@
+// Package chaos injects configurable faults into pipeline stages so error
+// handling can be exercised without breaking real dependencies.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var InjectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "chaos_injected_total",
+		Help: "Total number of faults injected by the chaos facility.",
+	},
+	[]string{"stage", "kind"}, // Kind can be "error" or "latency"
+)
+
+// Injector is consulted by pipeline stages before they do their work. A
+// non-nil error must be handled as if the stage itself had failed.
+type Injector interface {
+	Inject(ctx context.Context, stage string) error
+}
+
+// Noop never injects anything.
+type Noop struct{}
+
+func (Noop) Inject(context.Context, string) error { return nil }
+
+// Rule is a fault applied to a stage with the given probability: added
+// latency, an error, or both.
+type Rule struct {
+	Probability float64
+	Latency     time.Duration
+	Error       bool
+	StatusCode  int
+}
+
+// Fault is the error returned for an injected failure.
+type Fault struct {
+	Stage      string
+	StatusCode int
+}
+
+func (f *Fault) Error() string {
+	if f.StatusCode != 0 {
+		return fmt.Sprintf("chaos: injected %d in stage %s", f.StatusCode, f.Stage)
+	}
+	return fmt.Sprintf("chaos: injected error in stage %s", f.Stage)
+}
+
+// Faults injects faults according to per-stage rules until it expires.
+type Faults struct {
+	rules   map[string][]Rule
+	expires time.Time
+	now     func() time.Time
+}
+
+// New returns an injector applying rules for the next ttl.
+func New(rules map[string][]Rule, ttl time.Duration) *Faults {
+	return &Faults{rules: rules, expires: time.Now().Add(ttl), now: time.Now}
+}
+
+// Parse reads rules written as space-separated stage=fault pairs, where a
+// fault is a probability of failing ("0.2"), a forced error with an
+// optional status code ("error", "error:503") or added latency
+// ("latency:5s"). Several faults for one stage are separated by commas, and
+// a fault may carry its own probability after "@", as in "latency:2s@0.5".
+func Parse(spec string) (map[string][]Rule, error) {
+	rules := make(map[string][]Rule)
+	for _, field := range strings.Fields(spec) {
+		stage, faults, ok := strings.Cut(field, "=")
+		if !ok || stage == "" || faults == "" {
+			return nil, fmt.Errorf("invalid chaos rule %q, want stage=fault", field)
+		}
+		for _, fault := range strings.Split(faults, ",") {
+			rule, err := parseRule(fault)
+			if err != nil {
+				return nil, fmt.Errorf("invalid chaos rule %q: %w", field, err)
+			}
+			rules[stage] = append(rules[stage], rule)
+		}
+	}
+	return rules, nil
+}
+
+func parseRule(fault string) (Rule, error) {
+	rule := Rule{Probability: 1}
+	if kind, probability, ok := strings.Cut(fault, "@"); ok {
+		p, err := parseProbability(probability)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.Probability = p
+		fault = kind
+	}
+	kind, arg, _ := strings.Cut(fault, ":")
+	switch kind {
+	case "error":
+		rule.Error = true
+		if arg != "" {
+			code, err := strconv.Atoi(arg)
+			if err != nil || code < 100 || code > 599 {
+				return Rule{}, fmt.Errorf("invalid status code %q", arg)
+			}
+			rule.StatusCode = code
+		}
+	case "latency":
+		latency, err := time.ParseDuration(arg)
+		if err != nil || latency <= 0 {
+			return Rule{}, fmt.Errorf("invalid latency %q", arg)
+		}
+		rule.Latency = latency
+	default:
+		p, err := parseProbability(fault)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.Error = true
+		rule.Probability = p
+	}
+	return rule, nil
+}
+
+func parseProbability(value string) (float64, error) {
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("invalid probability %q", value)
+	}
+	return p, nil
+}
+
+// Inject applies the rules of stage, sleeping for injected latency and
+// returning a *Fault for injected errors. Nothing is injected once the
+// rules have expired.
+func (f *Faults) Inject(ctx context.Context, stage string) error {
+	if f.now().After(f.expires) {
+		return nil
+	}
+	span := trace.SpanFromContext(ctx)
+	for _, rule := range f.rules[stage] {
+		if rand.Float64() >= rule.Probability {
+			continue
+		}
+		if rule.Latency > 0 {
+			injected(span, stage, "latency")
+			select {
+			case <-time.After(rule.Latency):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if rule.Error {
+			injected(span, stage, "error")
+			return &Fault{Stage: stage, StatusCode: rule.StatusCode}
+		}
+	}
+	return nil
+}
+
+func injected(span trace.Span, stage, kind string) {
+	InjectedCounter.With(prometheus.Labels{"stage": stage, "kind": kind}).Inc()
+	log.Warn().Str("stage", stage).Str("kind", kind).Msg("Chaos fault injected")
+	span.AddEvent("Chaos fault injected", trace.WithAttributes(
+		attribute.String("chaos.stage", stage),
+		attribute.String("chaos.kind", kind),
+	))
+}
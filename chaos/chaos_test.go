@@ -0,0 +1,102 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		spec  string
+		rules map[string][]Rule
+	}{
+		{"", map[string][]Rule{}},
+		{"recognize=0.2", map[string][]Rule{"recognize": {{Probability: 0.2, Error: true}}}},
+		{"recognize=error", map[string][]Rule{"recognize": {{Probability: 1, Error: true}}}},
+		{"download=error:503", map[string][]Rule{"download": {{Probability: 1, Error: true, StatusCode: 503}}}},
+		{"download=latency:5s", map[string][]Rule{"download": {{Probability: 1, Latency: 5 * time.Second}}}},
+		{"recognize=latency:2s@0.5,error:500@0.1 send=1", map[string][]Rule{
+			"recognize": {{Probability: 0.5, Latency: 2 * time.Second}, {Probability: 0.1, Error: true, StatusCode: 500}},
+			"send":      {{Probability: 1, Error: true}},
+		}},
+	} {
+		rules, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, c.rules) {
+			t.Errorf("Parse(%q) = %+v, want %+v", c.spec, rules, c.rules)
+		}
+	}
+}
+
+func TestParseRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{
+		"recognize",
+		"=error",
+		"recognize=",
+		"recognize=1.5",
+		"recognize=-0.1",
+		"recognize=often",
+		"recognize=error:99",
+		"recognize=error:600",
+		"recognize=error:bad",
+		"recognize=latency:soon",
+		"recognize=latency:-1s",
+		"recognize=latency:2s@2",
+		"recognize=error,",
+	} {
+		if rules, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", spec, rules)
+		}
+	}
+}
+
+func TestInject(t *testing.T) {
+	f := New(map[string][]Rule{
+		"recognize": {{Probability: 1, Error: true, StatusCode: 503}},
+		"download":  {{Probability: 0, Error: true}},
+	}, time.Hour)
+
+	var fault *Fault
+	if err := f.Inject(context.Background(), "recognize"); !errors.As(err, &fault) || fault.StatusCode != 503 || fault.Stage != "recognize" {
+		t.Errorf("recognize injected %v", err)
+	}
+	if err := f.Inject(context.Background(), "download"); err != nil {
+		t.Errorf("a rule of probability 0 injected %v", err)
+	}
+	if err := f.Inject(context.Background(), "send"); err != nil {
+		t.Errorf("a stage without rules injected %v", err)
+	}
+}
+
+func TestInjectedLatencyHonoursTheContext(t *testing.T) {
+	f := New(map[string][]Rule{"download": {{Probability: 1, Latency: time.Hour}}}, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.Inject(ctx, "download"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Inject = %v, want the deadline", err)
+	}
+}
+
+func TestRulesExpire(t *testing.T) {
+	now := time.Now()
+	f := New(map[string][]Rule{"recognize": {{Probability: 1, Error: true}}}, time.Minute)
+	f.now = func() time.Time { return now }
+
+	if f.Inject(context.Background(), "recognize") == nil {
+		t.Error("nothing injected before expiry")
+	}
+	now = now.Add(59 * time.Second)
+	if f.Inject(context.Background(), "recognize") == nil {
+		t.Error("nothing injected just before expiry")
+	}
+	now = now.Add(2 * time.Second)
+	if err := f.Inject(context.Background(), "recognize"); err != nil {
+		t.Errorf("injected %v after expiry", err)
+	}
+}
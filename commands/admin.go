@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/messages"
+)
+
+// AdminCommand answers "/admin <name> args...", args being the words
+// after the name.
+type AdminCommand func(ctx context.Context, args []string, texts *messages.Bundle) string
+
+// Admin is /admin, under which the operators' commands are grouped.
+type Admin struct {
+	allowed     map[int64]bool
+	subcommands map[string]AdminCommand
+}
+
+// RegisterAdmin adds /admin for the users in admins and returns it for the
+// subcommands to be added to.
+func RegisterAdmin(d *Dispatcher, admins []int64) *Admin {
+	a := &Admin{allowed: make(map[int64]bool), subcommands: make(map[string]AdminCommand)}
+	for _, id := range admins {
+		a.allowed[id] = true
+	}
+	d.Register("admin", messages.CommandAdmin, a.handle)
+	return a
+}
+
+// Handle makes command answer "/admin name".
+func (a *Admin) Handle(name string, command AdminCommand) {
+	a.subcommands[name] = command
+}
+
+func (a *Admin) handle(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+	if message.From == nil || !a.allowed[message.From.ID] {
+		return texts.Get(messages.PermissionDenied)
+	}
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 {
+		if command, ok := a.subcommands[strings.ToLower(args[0])]; ok {
+			return command(ctx, args[1:], texts)
+		}
+	}
+	names := make([]string, 0, len(a.subcommands))
+	for name := range a.subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return texts.Get(messages.AdminUsage, strings.Join(names, ", "))
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+func TestAdminLast(t *testing.T) {
+	recorder := handleAudio.NewFlightRecorder(100)
+	bot := &fakeSender{}
+	d := NewDispatcher(bot, "sr_bot", settings.NewMemory())
+	RegisterLast(RegisterAdmin(d, []int64{1}), recorder)
+	texts := messages.For("en")
+
+	if got := reply(t, d, bot, commandMessage("/admin last", 1, 1)); got != texts.Get(messages.AdminLastEmpty) {
+		t.Errorf("empty recorder answered %q", got)
+	}
+	for id := 1; id <= 12; id++ {
+		recorder.Add(handleAudio.MessageResult{ChatID: 7, MessageID: id, Status: "success"})
+	}
+	for _, c := range []struct {
+		text  string
+		lines int
+		first string
+	}{
+		{"/admin last", 10, "message 12:"},
+		{"/admin LAST 3", 3, "message 12:"},
+		{"/admin last 50", 12, "message 12:"},
+	} {
+		got := reply(t, d, bot, commandMessage(c.text, 1, 1))
+		lines := strings.Split(got, "\n")
+		if len(lines) != c.lines || !strings.Contains(lines[0], c.first) {
+			t.Errorf("%s answered %d lines starting %q", c.text, len(lines), lines[0])
+		}
+	}
+	for _, text := range []string{"/admin last 0", "/admin last 51", "/admin last many", "/admin last 3 4"} {
+		if got := reply(t, d, bot, commandMessage(text, 1, 1)); got != texts.Get(messages.AdminLastUsage, maxLast) {
+			t.Errorf("%s answered %q", text, got)
+		}
+	}
+	if got := reply(t, d, bot, commandMessage("/admin last", 2, 2)); got != texts.Get(messages.PermissionDenied) {
+		t.Errorf("someone else got %q", got)
+	}
+}
+
+func TestAdminLastFitsIntoAMessage(t *testing.T) {
+	recorder := handleAudio.NewFlightRecorder(100)
+	for id := 1; id <= maxLast; id++ {
+		recorder.Add(handleAudio.MessageResult{MessageID: id, Error: strings.Repeat("x", 500)})
+	}
+	bot := &fakeSender{}
+	d := NewDispatcher(bot, "sr_bot", settings.NewMemory())
+	RegisterLast(RegisterAdmin(d, []int64{1}), recorder)
+
+	got := reply(t, d, bot, commandMessage("/admin last 50", 1, 1))
+	if n := len([]rune(got)); n > maxDigestLength || n == 0 {
+		t.Errorf("digest of %d characters", n)
+	}
+}
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"encoding/json"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/sender"
+)
+
+// AdminChecker reports whether userID administers chatID.
+type AdminChecker func(chatID, userID int64) (bool, error)
+
+// ChatAdmins asks Telegram for the administrators of the chat through bot.
+func ChatAdmins(bot sender.Requester) AdminChecker {
+	return func(chatID, userID int64) (bool, error) {
+		resp, err := bot.Request(tgbotapi.ChatAdministratorsConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: chatID}})
+		if err != nil {
+			return false, err
+		}
+		var members []tgbotapi.ChatMember
+		if err := json.Unmarshal(resp.Result, &members); err != nil {
+			return false, err
+		}
+		for _, member := range members {
+			if member.User != nil && member.User.ID == userID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// sentByAdmin reports whether message comes from an administrator of its
+// chat. Everyone administers their private chat with the bot, and anonymous
+// administrators send on behalf of the group itself.
+func sentByAdmin(isAdmin AdminChecker, message *tgbotapi.Message) (bool, error) {
+	if message.Chat.IsPrivate() {
+		return true, nil
+	}
+	if message.SenderChat != nil && message.SenderChat.ID == message.Chat.ID {
+		return true, nil
+	}
+	if message.From == nil {
+		return false, nil
+	}
+	return isAdmin(message.Chat.ID, message.From.ID)
+}
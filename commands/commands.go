@@ -0,0 +1,93 @@
+// Package commands answers the bot commands users send, such as /start and
+// /help.
+package commands
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/settings"
+)
+
+// Handler answers a command, returning the text of the reply in the
+// language of texts, "" for no reply.
+type Handler func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string
+
+type command struct {
+	description messages.Key
+	handle      Handler
+}
+
+// Dispatcher routes commands to the handlers registered for them.
+type Dispatcher struct {
+	bot         sender.Sender
+	botUserName string
+	settings    settings.Store
+	commands    map[string]command
+	order       []string
+}
+
+// NewDispatcher returns a dispatcher replying through bot, in the language
+// store has for the chat or else in the one of the user. Commands addressed
+// to another bot than botUserName are ignored.
+func NewDispatcher(bot sender.Sender, botUserName string, store settings.Store) *Dispatcher {
+	return &Dispatcher{bot: bot, botUserName: botUserName, settings: store, commands: make(map[string]command)}
+}
+
+// Register makes handler answer /name; the description is shown in the
+// command menu of Telegram clients.
+func (d *Dispatcher) Register(name string, description messages.Key, handler Handler) {
+	if _, ok := d.commands[name]; !ok {
+		d.order = append(d.order, name)
+	}
+	d.commands[name] = command{description: description, handle: handler}
+}
+
+// Dispatch answers message if it is a registered command, reporting
+// whether it was one.
+func (d *Dispatcher) Dispatch(ctx context.Context, message *tgbotapi.Message) bool {
+	if message == nil || !message.IsCommand() {
+		return false
+	}
+	// In groups "/help@other_bot" is meant for someone else
+	if _, to, ok := strings.Cut(message.CommandWithAt(), "@"); ok && !strings.EqualFold(to, d.botUserName) {
+		return false
+	}
+	cmd, ok := d.commands[message.Command()]
+	if !ok {
+		return false
+	}
+
+	chat, err := d.settings.Get(message.Chat.ID)
+	if err != nil {
+		log.Warn().Ctx(ctx).Err(err).Int64("chat_id", message.Chat.ID).Msg("Failed to read the chat settings, using the defaults")
+	}
+	texts := messages.For(chat.UILanguage, messages.UserLanguage(message.From))
+	text := cmd.handle(ctx, message, texts)
+	if text == "" {
+		return true
+	}
+	reply := tgbotapi.NewMessage(message.Chat.ID, text)
+	// Replying keeps the answer in the forum topic of the command
+	reply.ReplyToMessageID = message.MessageID
+	reply.AllowSendingWithoutReply = true
+	if _, err := sender.SendMessage(d.bot, reply); err != nil {
+		log.Error().Ctx(ctx).Err(err).Str("command", message.Command()).Int64("chat_id", message.Chat.ID).
+			Msg("Failed to answer command")
+	}
+	return true
+}
+
+// BotCommands lists the registered commands in registration order with
+// their descriptions in the language of texts, for SetMyCommandsConfig.
+func (d *Dispatcher) BotCommands(texts *messages.Bundle) []tgbotapi.BotCommand {
+	commands := make([]tgbotapi.BotCommand, 0, len(d.order))
+	for _, name := range d.order {
+		commands = append(commands, tgbotapi.BotCommand{Command: name, Description: texts.Get(d.commands[name].description)})
+	}
+	return commands
+}
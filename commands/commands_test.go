@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// newEchoDispatcher returns a dispatcher for @sr_bot answering /echo with
+// its arguments, /silent with nothing, and /admin for user 1.
+func newEchoDispatcher(bot *fakeSender) *Dispatcher {
+	d := NewDispatcher(bot, "sr_bot", settings.NewMemory())
+	d.Register("echo", messages.CommandHelp, func(_ context.Context, message *tgbotapi.Message, _ *messages.Bundle) string {
+		return "echo:" + message.CommandArguments()
+	})
+	d.Register("silent", messages.CommandHelp, func(context.Context, *tgbotapi.Message, *messages.Bundle) string {
+		return ""
+	})
+	RegisterLast(RegisterAdmin(d, []int64{1}), nil)
+	return d
+}
+
+func TestDispatch(t *testing.T) {
+	texts := messages.For("en")
+	for _, c := range []struct {
+		name    string
+		message *tgbotapi.Message
+		handled bool
+		reply   string // "" for none
+	}{
+		{"command", commandMessage("/echo hi", 1, 1), true, "echo:hi"},
+		{"no arguments", commandMessage("/echo", 1, 1), true, "echo:"},
+		{"addressed to this bot", commandMessage("/echo@sr_bot hi", 1, 1), true, "echo:hi"},
+		{"bot name in another case", commandMessage("/echo@SR_Bot hi", 1, 1), true, "echo:hi"},
+		{"addressed to another bot", commandMessage("/echo@other_bot hi", 1, 1), false, ""},
+		{"unknown command", commandMessage("/unknown", 1, 1), false, ""},
+		{"not a command", &tgbotapi.Message{From: &tgbotapi.User{ID: 1}, Chat: &tgbotapi.Chat{ID: 1}, Text: "/echo in passing"}, false, ""},
+		{"no message", nil, false, ""},
+		{"no reply", commandMessage("/silent", 1, 1), true, ""},
+		{"admin by someone else", commandMessage("/admin last", 2, 2), true, texts.Get(messages.PermissionDenied)},
+		{"admin without sender", &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "/admin last",
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: len("/admin")}}}, true, texts.Get(messages.PermissionDenied)},
+		{"admin without subcommand", commandMessage("/admin", 1, 1), true, texts.Get(messages.AdminUsage, "last")},
+		{"unknown subcommand", commandMessage("/admin reboot", 1, 1), true, texts.Get(messages.AdminUsage, "last")},
+		{"admin addressed to this bot", commandMessage("/admin@sr_bot", 1, 1), true, texts.Get(messages.AdminUsage, "last")},
+	} {
+		bot := &fakeSender{}
+		d := newEchoDispatcher(bot)
+		if handled := d.Dispatch(context.Background(), c.message); handled != c.handled {
+			t.Errorf("%s: handled = %t", c.name, handled)
+		}
+		switch {
+		case c.reply == "" && len(bot.sent) != 0:
+			t.Errorf("%s: answered %q", c.name, bot.sent[0].Text)
+		case c.reply != "" && len(bot.sent) != 1:
+			t.Errorf("%s: answered %d times", c.name, len(bot.sent))
+		case c.reply != "" && bot.sent[0].Text != c.reply:
+			t.Errorf("%s: answered %q, want %q", c.name, bot.sent[0].Text, c.reply)
+		}
+	}
+}
+
+func TestDispatchRepliesToTheCommand(t *testing.T) {
+	bot := &fakeSender{}
+	newEchoDispatcher(bot).Dispatch(context.Background(), commandMessage("/echo", 1, 5))
+	if len(bot.sent) != 1 || bot.sent[0].ChatID != 5 || bot.sent[0].ReplyToMessageID != 10 || !bot.sent[0].AllowSendingWithoutReply {
+		t.Errorf("answered %+v, want a reply to message 10 in chat 5", bot.sent)
+	}
+}
+
+func TestDispatchAnswersInTheChatLanguage(t *testing.T) {
+	bot := &fakeSender{}
+	store := settings.NewMemory()
+	store.Set(1, settings.Settings{UILanguage: "ru"})
+	d := NewDispatcher(bot, "sr_bot", store)
+	RegisterAdmin(d, nil)
+
+	message := commandMessage("/admin", 2, 1)
+	message.From.LanguageCode = "en"
+	if got := reply(t, d, bot, message); got != messages.For("ru").Get(messages.PermissionDenied) {
+		t.Errorf("answered %q in a Russian chat", got)
+	}
+}
+
+func TestBotCommandsKeepRegistrationOrder(t *testing.T) {
+	d := newEchoDispatcher(&fakeSender{})
+	d.Register("echo", messages.CommandStart, nil)
+	commands := d.BotCommands(messages.For("en"))
+	var names []string
+	for _, command := range commands {
+		names = append(names, command.Command)
+	}
+	if len(names) != 3 || names[0] != "echo" || names[1] != "silent" || names[2] != "admin" {
+		t.Errorf("commands = %v, want echo, silent, admin", names)
+	}
+	if commands[0].Description != messages.For("en").Get(messages.CommandStart) {
+		t.Errorf("re-registering kept the description %q", commands[0].Description)
+	}
+}
+
+// failingStore fails to read or to save settings.
+type failingStore struct {
+	settings.Store
+	failGet bool
+}
+
+func (f failingStore) Get(chatID int64) (settings.Settings, error) {
+	if f.failGet {
+		return settings.Settings{}, errors.New("disk full")
+	}
+	return f.Store.Get(chatID)
+}
+
+func (f failingStore) Set(chatID int64, s settings.Settings) error {
+	return errors.New("disk full")
+}
+
+func TestLang(t *testing.T) {
+	texts := messages.For("en")
+	store := settings.NewMemory()
+	bot := &fakeSender{}
+	d := NewDispatcher(bot, "sr_bot", store)
+	RegisterLang(d, store)
+
+	unknown := func(argument string) string {
+		return texts.Get(messages.LangUnknown, argument, strings.Join(handleAudio.SupportedLanguages, ", "))
+	}
+	for _, c := range []struct {
+		text     string
+		reply    string
+		language string
+	}{
+		{"/lang", texts.Get(messages.LangAuto), ""},
+		{"/lang uk", texts.Get(messages.LangSet, "uk"), "uk"},
+		{"/lang", texts.Get(messages.LangCurrent, "uk"), "uk"},
+		{"/lang RU-ru", texts.Get(messages.LangSet, "ru"), "ru"},
+		{"/lang klingon", unknown("klingon"), "ru"},
+		{"/lang  ", texts.Get(messages.LangCurrent, "ru"), "ru"},
+		{"/lang AUTO", texts.Get(messages.LangCleared), ""},
+		{"/lang", texts.Get(messages.LangAuto), ""},
+	} {
+		if got := reply(t, d, bot, commandMessage(c.text, 1, 1)); got != c.reply {
+			t.Errorf("%q answered %q, want %q", c.text, got, c.reply)
+		}
+		if chat, _ := store.Get(1); chat.Language != c.language {
+			t.Errorf("after %q the language is %q, want %q", c.text, chat.Language, c.language)
+		}
+	}
+	if chat, _ := store.Get(2); chat.Language != "" {
+		t.Errorf("another chat got the language %q", chat.Language)
+	}
+}
+
+func TestLangReportsStoreFailures(t *testing.T) {
+	texts := messages.For("en")
+	for _, c := range []struct {
+		store settings.Store
+		text  string
+		reply string
+	}{
+		{failingStore{Store: settings.NewMemory(), failGet: true}, "/lang", texts.Get(messages.LangReadFailed)},
+		{failingStore{Store: settings.NewMemory(), failGet: true}, "/lang uk", texts.Get(messages.LangSaveFailed)},
+		{failingStore{Store: settings.NewMemory()}, "/lang uk", texts.Get(messages.LangSaveFailed)},
+	} {
+		bot := &fakeSender{}
+		d := NewDispatcher(bot, "sr_bot", c.store)
+		RegisterLang(d, c.store)
+		if got := reply(t, d, bot, commandMessage(c.text, 1, 1)); got != c.reply {
+			t.Errorf("%q answered %q, want %q", c.text, got, c.reply)
+		}
+	}
+}
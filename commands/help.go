@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/messages"
+)
+
+// RegisterHelp adds /start and /help.
+func RegisterHelp(d *Dispatcher) {
+	d.Register("start", messages.CommandStart, func(_ context.Context, _ *tgbotapi.Message, texts *messages.Bundle) string {
+		return texts.Get(messages.Start) + "\n\n" + helpText(texts)
+	})
+	d.Register("help", messages.CommandHelp, func(_ context.Context, _ *tgbotapi.Message, texts *messages.Bundle) string {
+		return helpText(texts)
+	})
+}
+
+// helpText describes the accepted formats and the limits currently in
+// effect.
+func helpText(texts *messages.Bundle) string {
+	lines := []string{
+		texts.Get(messages.HelpFormats),
+		texts.Get(messages.HelpVoice),
+		texts.Get(messages.HelpAudio),
+		texts.Get(messages.HelpVideoNotes),
+	}
+	if handleAudio.Extractor != nil {
+		lines = append(lines, texts.Get(messages.HelpVideos))
+	}
+	if handleAudio.MaxAudioBytes > 0 || handleAudio.MaxAudioDuration > 0 {
+		lines = append(lines, "", texts.Get(messages.HelpLimits))
+		if handleAudio.MaxAudioBytes > 0 {
+			lines = append(lines, texts.Get(messages.HelpMaxSize, handleAudio.MaxAudioBytes>>20))
+		}
+		if handleAudio.MaxAudioDuration > 0 {
+			lines = append(lines, texts.Get(messages.HelpMaxDuration, handleAudio.MaxAudioDuration))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
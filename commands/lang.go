@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// RegisterLang adds /lang, which forces the recognition language of a chat.
+func RegisterLang(d *Dispatcher, store settings.Store) {
+	d.Register("lang", messages.CommandLang, func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		return lang(ctx, store, message, texts)
+	})
+}
+
+func lang(ctx context.Context, store settings.Store, message *tgbotapi.Message, texts *messages.Bundle) string {
+	chatID := message.Chat.ID
+	argument := strings.TrimSpace(message.CommandArguments())
+	if argument == "" {
+		chat, err := store.Get(chatID)
+		if err != nil {
+			log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to read the chat language")
+			return texts.Get(messages.LangReadFailed)
+		}
+		if chat.Language == "" {
+			return texts.Get(messages.LangAuto)
+		}
+		return texts.Get(messages.LangCurrent, chat.Language)
+	}
+
+	code := ""
+	if !strings.EqualFold(argument, "auto") {
+		var ok bool
+		if code, ok = handleAudio.NormalizeLanguage(argument); !ok {
+			return texts.Get(messages.LangUnknown, argument, strings.Join(handleAudio.SupportedLanguages, ", "))
+		}
+	}
+	chat, err := store.Get(chatID)
+	if err == nil {
+		chat.Language = code
+		err = store.Set(chatID, chat)
+	}
+	if err != nil {
+		log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to save the chat language")
+		return texts.Get(messages.LangSaveFailed)
+	}
+	if code == "" {
+		return texts.Get(messages.LangCleared)
+	}
+	return texts.Get(messages.LangSet, code)
+}
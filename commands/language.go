@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// RegisterLanguage adds /language, which chooses the language the bot
+// replies in for a chat. It is independent of /lang, which forces the
+// language audio is recognized in.
+func RegisterLanguage(d *Dispatcher, store settings.Store) {
+	d.Register("language", messages.CommandLanguage, func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		return language(ctx, store, message, texts)
+	})
+}
+
+func language(ctx context.Context, store settings.Store, message *tgbotapi.Message, texts *messages.Bundle) string {
+	chatID := message.Chat.ID
+	available := strings.Join(messages.Languages(), ", ")
+	argument := strings.TrimSpace(message.CommandArguments())
+	chat, err := store.Get(chatID)
+	if err != nil {
+		log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to read the chat settings")
+		return texts.Get(messages.SettingsReadFailed)
+	}
+	if argument == "" {
+		if chat.UILanguage == "" {
+			return texts.Get(messages.LanguageAuto, available)
+		}
+		return texts.Get(messages.LanguageCurrent, chat.UILanguage)
+	}
+
+	chat.UILanguage = ""
+	if !strings.EqualFold(argument, "auto") {
+		bundle, ok := messages.Lookup(argument)
+		if !ok {
+			return texts.Get(messages.LanguageUnknown, argument, available)
+		}
+		chat.UILanguage = bundle.Language()
+		// Confirm in the language just chosen
+		texts = bundle
+	}
+	if err := store.Set(chatID, chat); err != nil {
+		log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to save the reply language")
+		return texts.Get(messages.SettingsSaveFailed)
+	}
+	if chat.UILanguage == "" {
+		return messages.For(messages.UserLanguage(message.From)).Get(messages.LanguageCleared)
+	}
+	return texts.Get(messages.LanguageSet, chat.UILanguage)
+}
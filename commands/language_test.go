@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+func TestLanguageChoosesTheReplyLanguage(t *testing.T) {
+	bot := &fakeSender{}
+	store := settings.NewMemory()
+	d := NewDispatcher(bot, "sr_bot", store)
+	RegisterLanguage(d, store)
+	RegisterHelp(d)
+	en, ru := messages.For("en"), messages.For("ru")
+
+	if got := reply(t, d, bot, commandMessage("/language", 7, 7)); got != en.Get(messages.LanguageAuto, "en, ru") {
+		t.Errorf("/language answered %q", got)
+	}
+	if got := reply(t, d, bot, commandMessage("/language de", 7, 7)); got != en.Get(messages.LanguageUnknown, "de", "en, ru") {
+		t.Errorf("/language de answered %q", got)
+	}
+	// Confirmed in the language chosen
+	if got := reply(t, d, bot, commandMessage("/language RU", 7, 7)); got != ru.Get(messages.LanguageSet, "ru") {
+		t.Errorf("/language RU answered %q", got)
+	}
+	if chat, _ := store.Get(7); chat.UILanguage != "ru" {
+		t.Errorf("reply language stored as %q", chat.UILanguage)
+	}
+	if got := reply(t, d, bot, commandMessage("/language", 7, 7)); got != ru.Get(messages.LanguageCurrent, "ru") {
+		t.Errorf("/language answered %q after choosing Russian", got)
+	}
+	// Other commands follow the chat's choice over the user's app
+	help := commandMessage("/help", 7, 7)
+	help.From.LanguageCode = "en"
+	if got := reply(t, d, bot, help); !strings.Contains(got, ru.Get(messages.HelpVoice)) {
+		t.Errorf("/help answered %q, want Russian", got)
+	}
+
+	auto := commandMessage("/language auto", 7, 7)
+	auto.From.LanguageCode = "en"
+	if got := reply(t, d, bot, auto); got != en.Get(messages.LanguageCleared) {
+		t.Errorf("/language auto answered %q", got)
+	}
+	if chat, _ := store.Get(7); chat.UILanguage != "" {
+		t.Errorf("reply language %q left after auto", chat.UILanguage)
+	}
+}
+
+func TestBotCommandsAreTranslated(t *testing.T) {
+	d := NewDispatcher(&fakeSender{}, "sr_bot", settings.NewMemory())
+	RegisterHelp(d)
+	RegisterLanguage(d, settings.NewMemory())
+	ru := messages.For("ru")
+
+	commands := d.BotCommands(ru)
+	if len(commands) != 3 {
+		t.Fatalf("commands %v", commands)
+	}
+	for i, want := range []messages.Key{messages.CommandStart, messages.CommandHelp, messages.CommandLanguage} {
+		if commands[i].Description != ru.Get(want) {
+			t.Errorf("/%s described as %q, want %q", commands[i].Command, commands[i].Description, ru.Get(want))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/messages"
+)
+
+const (
+	// defaultLast is how many records "/admin last" shows without N.
+	defaultLast = 10
+	// maxLast bounds N, more would not fit into a message anyway.
+	maxLast = 50
+	// maxDigestLength keeps the digest within a single message.
+	maxDigestLength = 4000
+)
+
+// RegisterLast adds "/admin last [N]", which shows the N most recent
+// records of recorder, newest first.
+func RegisterLast(a *Admin, recorder *handleAudio.FlightRecorder) {
+	a.Handle("last", func(_ context.Context, args []string, texts *messages.Bundle) string {
+		n := defaultLast
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 || n > maxLast || len(args) > 1 {
+				return texts.Get(messages.AdminLastUsage, maxLast)
+			}
+		}
+		records := recorder.Last(n)
+		if len(records) == 0 {
+			return texts.Get(messages.AdminLastEmpty)
+		}
+		var lines []string
+		length := 0
+		for _, record := range records {
+			line := record.Digest()
+			if length += utf8.RuneCountInString(line) + 1; length > maxDigestLength {
+				break
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n")
+	})
+}
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"telegram-sr-bot/maintenance"
+	"telegram-sr-bot/messages"
+)
+
+// RegisterMaintenance adds "/admin maintenance <duration> <reason>", which
+// starts a maintenance window of window lasting duration right away.
+func RegisterMaintenance(a *Admin, window *maintenance.Window) {
+	a.Handle("maintenance", func(_ context.Context, args []string, texts *messages.Bundle) string {
+		if len(args) < 2 {
+			return texts.Get(messages.AdminMaintenanceUsage)
+		}
+		duration, err := time.ParseDuration(args[0])
+		if err != nil || duration <= 0 {
+			return texts.Get(messages.AdminMaintenanceUsage)
+		}
+		reason := strings.Trim(strings.Join(args[1:], " "), `"`)
+		start := time.Now()
+		window.Schedule(start, start.Add(duration), reason)
+		window.Active(start)
+		return texts.Get(messages.AdminMaintenanceStarted, start.Add(duration).UTC().Format("15:04 MST"), reason)
+	})
+}
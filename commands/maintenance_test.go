@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/maintenance"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+func TestAdminMaintenance(t *testing.T) {
+	window := &maintenance.Window{}
+	bot := &fakeSender{}
+	d := NewDispatcher(bot, "sr_bot", settings.NewMemory())
+	RegisterMaintenance(RegisterAdmin(d, []int64{1}), window)
+	texts := messages.For("en")
+
+	for _, text := range []string{"/admin maintenance", "/admin maintenance 30m", "/admin maintenance soon upgrade", "/admin maintenance -5m upgrade"} {
+		if got := reply(t, d, bot, commandMessage(text, 1, 1)); got != texts.Get(messages.AdminMaintenanceUsage) {
+			t.Errorf("%s answered %q", text, got)
+		}
+	}
+	if window.Active(time.Now()) {
+		t.Fatal("a rejected command started maintenance")
+	}
+	if got := reply(t, d, bot, commandMessage("/admin maintenance 30m upgrade", 2, 2)); got != texts.Get(messages.PermissionDenied) {
+		t.Errorf("someone else got %q", got)
+	}
+
+	got := reply(t, d, bot, commandMessage(`/admin maintenance 30m "backend upgrade"`, 1, 1))
+	if !strings.HasSuffix(got, ": backend upgrade.") {
+		t.Errorf("answered %q", got)
+	}
+	if !window.Active(time.Now()) || !window.Active(time.Now().Add(29*time.Minute)) || window.Active(time.Now().Add(31*time.Minute)) {
+		t.Error("maintenance does not last the next 30 minutes")
+	}
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/quota"
+)
+
+// RegisterQuota adds /quota, which shows the sender how much of the daily
+// quota they have left.
+func RegisterQuota(d *Dispatcher, q *quota.Quota) {
+	d.Register("quota", messages.CommandQuota, func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		if message.From == nil {
+			return texts.Get(messages.PermissionDenied)
+		}
+		now := time.Now()
+		decision, err := q.Check(message.From.ID, now)
+		if err != nil {
+			log.Error().Ctx(ctx).Err(err).Int64("user_id", message.From.ID).Msg("Failed to read the quota")
+			return texts.Get(messages.QuotaReadFailed)
+		}
+		if decision.Unlimited {
+			return texts.Get(messages.QuotaUnlimited)
+		}
+		hours, minutes := decision.ResetsIn(now)
+		return texts.Get(messages.QuotaRemaining, decision.RemainingSeconds(), int(q.Daily()/time.Second), hours, minutes)
+	})
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// RegisterSettings adds /settings, which shows the settings of a chat and
+// changes the ones without a command of their own. Only administrators,
+// as isAdmin tells, change the transcription mode of a group.
+func RegisterSettings(d *Dispatcher, store settings.Store, isAdmin AdminChecker) {
+	d.Register("settings", messages.CommandSettings, func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		chatID := message.Chat.ID
+		chat, err := store.Get(chatID)
+		if err != nil {
+			log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to read the chat settings")
+			return texts.Get(messages.SettingsReadFailed)
+		}
+		group := !message.Chat.IsPrivate()
+		arguments := strings.Fields(strings.ToLower(message.CommandArguments()))
+		if len(arguments) == 0 {
+			return describeSettings(chat, group, texts)
+		}
+		if len(arguments) != 2 || !applySetting(&chat, arguments[0], arguments[1]) {
+			return texts.Get(messages.SettingsUsage)
+		}
+		if arguments[0] == "mode" {
+			admin, err := sentByAdmin(isAdmin, message)
+			if err != nil {
+				log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to get the chat administrators")
+				return texts.Get(messages.AdminCheckFailed)
+			}
+			if !admin {
+				return texts.Get(messages.SettingsAdminsOnly)
+			}
+		}
+		if err := store.Set(chatID, chat); err != nil {
+			log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to save the chat settings")
+			return texts.Get(messages.SettingsSaveFailed)
+		}
+		return describeSettings(chat, group, texts)
+	})
+}
+
+func describeSettings(chat settings.Settings, group bool, texts *messages.Bundle) string {
+	language := chat.Language
+	if language == "" {
+		language = texts.Get(messages.Auto)
+	}
+	uiLanguage := chat.UILanguage
+	if uiLanguage == "" {
+		uiLanguage = texts.Get(messages.Auto)
+	}
+	placeholders := handleAudio.PlaceholdersEnabled
+	if chat.Placeholders != nil {
+		placeholders = *chat.Placeholders
+	}
+	threshold := handleAudio.DocumentThreshold
+	if chat.DocumentThreshold != nil {
+		threshold = *chat.DocumentThreshold
+	}
+	documents := texts.Get(messages.Off)
+	if threshold > 0 {
+		documents = texts.Get(messages.SettingsDocumentsAbove, threshold)
+	}
+	return texts.Get(messages.SettingsSummary,
+		language, uiLanguage, onOff(texts, placeholders), onOff(texts, chat.SRT), documents, chat.TranscriptionMode(group))
+}
+
+// applySetting sets name to value in chat, reporting false if either is
+// not understood.
+func applySetting(chat *settings.Settings, name, value string) bool {
+	switch name {
+	case "placeholders":
+		switch value {
+		case "default":
+			chat.Placeholders = nil
+		case "on", "off":
+			enabled := value == "on"
+			chat.Placeholders = &enabled
+		default:
+			return false
+		}
+	case "txt":
+		switch value {
+		case "default":
+			chat.DocumentThreshold = nil
+		case "off":
+			off := 0
+			chat.DocumentThreshold = &off
+		default:
+			threshold, err := strconv.Atoi(value)
+			if err != nil || threshold <= 0 {
+				return false
+			}
+			chat.DocumentThreshold = &threshold
+		}
+	case "mode":
+		switch {
+		case value == "default":
+			chat.Mode = ""
+		case slices.Contains(settings.Modes, value):
+			chat.Mode = value
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func onOff(texts *messages.Bundle, enabled bool) string {
+	if enabled {
+		return texts.Get(messages.On)
+	}
+	return texts.Get(messages.Off)
+}
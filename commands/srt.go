@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// RegisterSRT adds /srt. Sent in reply to an audio message it has that
+// message transcribed as subtitles through transcribe, at the request of
+// the /srt message, which reports false for messages without audio; "/srt
+// on" and "/srt off" choose whether the chat gets subtitles for every
+// message.
+func RegisterSRT(d *Dispatcher, store settings.Store, transcribe func(request, audio *tgbotapi.Message) bool) {
+	d.Register("srt", messages.CommandSRT, func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		return srt(ctx, store, transcribe, message, texts)
+	})
+}
+
+func srt(ctx context.Context, store settings.Store, transcribe func(request, audio *tgbotapi.Message) bool, message *tgbotapi.Message, texts *messages.Bundle) string {
+	argument := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	chatID := message.Chat.ID
+	chat, err := store.Get(chatID)
+	if err != nil {
+		log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to read the chat settings")
+		return texts.Get(messages.SettingsReadFailed)
+	}
+	if argument == "" && message.ReplyToMessage != nil {
+		if chat.TranscriptionMode(!message.Chat.IsPrivate()) == settings.ModeOff {
+			return texts.Get(messages.TranscriptionOff)
+		}
+		if !transcribe(message, message.ReplyToMessage) {
+			return texts.Get(messages.SRTNoAudio)
+		}
+		return texts.Get(messages.SRTPreparing)
+	}
+
+	switch argument {
+	case "":
+		if chat.SRT {
+			return texts.Get(messages.SRTEnabled)
+		}
+		return texts.Get(messages.SRTDisabled)
+	case "on", "off":
+		chat.SRT = argument == "on"
+	default:
+		return texts.Get(messages.SRTUsage)
+	}
+	if err := store.Set(chatID, chat); err != nil {
+		log.Error().Ctx(ctx).Err(err).Int64("chat_id", chatID).Msg("Failed to save the subtitle setting")
+		return texts.Get(messages.SettingsSaveFailed)
+	}
+	if chat.SRT {
+		return texts.Get(messages.SRTTurnedOn)
+	}
+	return texts.Get(messages.SRTTurnedOff)
+}
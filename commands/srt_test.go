@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+func TestSRTTurnsSubtitlesOnAndOff(t *testing.T) {
+	bot := &fakeSender{}
+	store := settings.NewMemory()
+	d := NewDispatcher(bot, "sr_bot", store)
+	RegisterSRT(d, store, func(request, audio *tgbotapi.Message) bool {
+		t.Error("transcribe called without a replied-to message")
+		return true
+	})
+	texts := messages.For("en")
+
+	for _, c := range []struct {
+		text string
+		want messages.Key
+		srt  bool
+	}{
+		{"/srt", messages.SRTDisabled, false},
+		{"/srt ON", messages.SRTTurnedOn, true},
+		{"/srt", messages.SRTEnabled, true},
+		{"/srt maybe", messages.SRTUsage, true},
+		{"/srt off", messages.SRTTurnedOff, false},
+	} {
+		if got := reply(t, d, bot, commandMessage(c.text, 7, 7)); got != texts.Get(c.want) {
+			t.Errorf("%s answered %q, want %q", c.text, got, texts.Get(c.want))
+		}
+		if chat, _ := store.Get(7); chat.SRT != c.srt {
+			t.Errorf("after %s subtitles on = %v", c.text, chat.SRT)
+		}
+	}
+}
+
+func TestSRTInReplyTranscribesTheAudio(t *testing.T) {
+	bot := &fakeSender{}
+	store := settings.NewMemory()
+	d := NewDispatcher(bot, "sr_bot", store)
+	var requested []*tgbotapi.Message
+	hasAudio := true
+	RegisterSRT(d, store, func(request, audio *tgbotapi.Message) bool {
+		requested = append(requested, audio)
+		return hasAudio
+	})
+	texts := messages.For("en")
+
+	voice := &tgbotapi.Message{MessageID: 3, Chat: &tgbotapi.Chat{ID: 7, Type: "private"}}
+	message := commandMessage("/srt", 7, 7)
+	message.Chat.Type = "private"
+	message.ReplyToMessage = voice
+	if got := reply(t, d, bot, message); got != texts.Get(messages.SRTPreparing) {
+		t.Errorf("answered %q, want %q", got, texts.Get(messages.SRTPreparing))
+	}
+	if len(requested) != 1 || requested[0] != voice {
+		t.Errorf("transcribed %v, want the replied-to message", requested)
+	}
+
+	hasAudio = false
+	if got := reply(t, d, bot, message); got != texts.Get(messages.SRTNoAudio) {
+		t.Errorf("reply to a message without audio answered %q", got)
+	}
+
+	if err := store.Set(7, settings.Settings{Mode: settings.ModeOff}); err != nil {
+		t.Fatal(err)
+	}
+	if got := reply(t, d, bot, message); got != texts.Get(messages.TranscriptionOff) || len(requested) != 2 {
+		t.Errorf("chat with transcription off answered %q", got)
+	}
+}
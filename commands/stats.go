@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/status"
+)
+
+// RegisterStats adds /stats, which shows the status of the bot to the
+// admins.
+func RegisterStats(d *Dispatcher, reporter *status.Reporter, admins []int64) {
+	allowed := make(map[int64]bool)
+	for _, id := range admins {
+		allowed[id] = true
+	}
+	d.Register("stats", messages.CommandStats, func(_ context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		if message.From == nil || !allowed[message.From.ID] {
+			return texts.Get(messages.PermissionDenied)
+		}
+		return reporter.Snapshot(time.Now()).String()
+	})
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+	"telegram-sr-bot/status"
+)
+
+// fakeSender records the messages sent.
+type fakeSender struct {
+	sent []tgbotapi.MessageConfig
+}
+
+func (f *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if message, ok := c.(tgbotapi.MessageConfig); ok {
+		f.sent = append(f.sent, message)
+	}
+	return tgbotapi.Message{}, nil
+}
+
+// commandMessage returns the message /text sent by userID in chatID.
+func commandMessage(text string, userID, chatID int64) *tgbotapi.Message {
+	name, _, _ := strings.Cut(text, " ")
+	return &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: userID},
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	}
+}
+
+// reply dispatches message and returns the text answered.
+func reply(t *testing.T, d *Dispatcher, bot *fakeSender, message *tgbotapi.Message) string {
+	t.Helper()
+	sent := len(bot.sent)
+	if !d.Dispatch(context.Background(), message) {
+		t.Fatalf("%q not taken for a command", message.Text)
+	}
+	if len(bot.sent) != sent+1 {
+		t.Fatalf("%q answered %d times", message.Text, len(bot.sent)-sent)
+	}
+	return bot.sent[len(bot.sent)-1].Text
+}
+
+func TestStatsOnlyForAdmins(t *testing.T) {
+	messagesCounter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "messages"}, []string{"status"})
+	messagesCounter.WithLabelValues("success").Add(2)
+	unused := prometheus.NewCounter(prometheus.CounterOpts{Name: "unused"})
+	reporter := status.NewReporter(time.Now(), "http://backend", messagesCounter, unused, unused, unused)
+
+	bot := &fakeSender{}
+	d := NewDispatcher(bot, "sr_bot", settings.NewMemory())
+	RegisterStats(d, reporter, []int64{1})
+
+	if got := reply(t, d, bot, commandMessage("/stats", 1, 7)); !strings.Contains(got, "Messages processed: 2") || !strings.Contains(got, "http://backend") {
+		t.Errorf("admin got\n%s", got)
+	}
+	if got := reply(t, d, bot, commandMessage("/stats", 2, 7)); got != messages.For("en").Get(messages.PermissionDenied) {
+		t.Errorf("someone else got\n%s", got)
+	}
+	channelPost := commandMessage("/stats", 0, -100)
+	channelPost.From = nil
+	if got := reply(t, d, bot, channelPost); strings.Contains(got, "Messages processed") {
+		t.Errorf("post without a sender got the status\n%s", got)
+	}
+}
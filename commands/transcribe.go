@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// RegisterTranscribe adds /transcribe. Sent in reply to an audio message, it
+// has transcribe handle that message as if it had just arrived, which
+// reports false for messages without audio. It works in every mode but
+// off, so audio sent before the bot joined or in on_command chats can be
+// transcribed after all.
+func RegisterTranscribe(d *Dispatcher, store settings.Store, transcribe func(request, audio *tgbotapi.Message) bool) {
+	d.Register("transcribe", messages.CommandTranscribe, func(ctx context.Context, message *tgbotapi.Message, texts *messages.Bundle) string {
+		if message.ReplyToMessage == nil {
+			return texts.Get(messages.TranscribeUsage)
+		}
+		chat, err := store.Get(message.Chat.ID)
+		if err != nil {
+			log.Error().Ctx(ctx).Err(err).Int64("chat_id", message.Chat.ID).Msg("Failed to read the chat settings")
+			return texts.Get(messages.SettingsReadFailed)
+		}
+		if chat.TranscriptionMode(!message.Chat.IsPrivate()) == settings.ModeOff {
+			return texts.Get(messages.TranscriptionOff)
+		}
+		if !transcribe(message, message.ReplyToMessage) {
+			return texts.Get(messages.TranscribeUsage)
+		}
+		// The transcription is the answer
+		return ""
+	})
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+func TestTranscribeHandsOverTheRepliedToAudio(t *testing.T) {
+	bot := &fakeSender{}
+	store := settings.NewMemory()
+	d := NewDispatcher(bot, "sr_bot", store)
+	var requests, audios []*tgbotapi.Message
+	hasAudio := true
+	RegisterTranscribe(d, store, func(request, audio *tgbotapi.Message) bool {
+		requests, audios = append(requests, request), append(audios, audio)
+		return hasAudio
+	})
+	texts := messages.For("en")
+
+	voice := &tgbotapi.Message{MessageID: 3, Chat: &tgbotapi.Chat{ID: -100, Type: "supergroup"}}
+	message := commandMessage("/transcribe@sr_bot", 7, -100)
+	message.Chat.Type = "supergroup"
+	message.ReplyToMessage = voice
+	// The transcription is the only answer
+	if !d.Dispatch(context.Background(), message) || len(bot.sent) != 0 {
+		t.Fatalf("answered %v, want nothing but the transcription", bot.sent)
+	}
+	if len(audios) != 1 || audios[0] != voice || requests[0] != message {
+		t.Errorf("transcribed %v at the request of %v", audios, requests)
+	}
+
+	hasAudio = false
+	if got := reply(t, d, bot, message); got != texts.Get(messages.TranscribeUsage) {
+		t.Errorf("reply to a message without audio answered %q", got)
+	}
+	message.ReplyToMessage = nil
+	if got := reply(t, d, bot, message); got != texts.Get(messages.TranscribeUsage) || len(audios) != 2 {
+		t.Errorf("/transcribe without a reply answered %q", got)
+	}
+}
+
+func TestTranscribeRespectsTheChatMode(t *testing.T) {
+	bot := &fakeSender{}
+	store := settings.NewMemory()
+	d := NewDispatcher(bot, "sr_bot", store)
+	transcribed := 0
+	RegisterTranscribe(d, store, func(request, audio *tgbotapi.Message) bool {
+		transcribed++
+		return true
+	})
+
+	message := commandMessage("/transcribe", 7, -100)
+	message.Chat.Type = "group"
+	message.ReplyToMessage = &tgbotapi.Message{MessageID: 3, Chat: message.Chat}
+	if err := store.Set(-100, settings.Settings{Mode: settings.ModeOnCommand}); err != nil {
+		t.Fatal(err)
+	}
+	d.Dispatch(context.Background(), message)
+	if transcribed != 1 {
+		t.Error("audio not transcribed on command in an on_command chat")
+	}
+
+	if err := store.Set(-100, settings.Settings{Mode: settings.ModeOff}); err != nil {
+		t.Fatal(err)
+	}
+	if got := reply(t, d, bot, message); got != messages.For("en").Get(messages.TranscriptionOff) || transcribed != 1 {
+		t.Errorf("chat with transcription off answered %q", got)
+	}
+}
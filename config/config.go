@@ -0,0 +1,477 @@
+// Package config reads the settings of the bot from environment variables.
+// Everything but the bot token has a default, and Load checks every value,
+// reporting all the problems at once so a bad deployment is fixed in one
+// go.
+package config
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"telegram-sr-bot/chaos"
+	"telegram-sr-bot/failover"
+	"telegram-sr-bot/maintenance"
+)
+
+// DefaultEndpoint is the recognition API used when API_ENDPOINT is unset.
+const DefaultEndpoint = "http://127.0.0.1:8787/upload"
+
+// Config is the whole configuration of the bot.
+type Config struct {
+	// Token is the Telegram bot token, TELEGRAM_BOT_TOKEN.
+	Token string
+
+	Log         Log
+	Telemetry   Telemetry
+	Recognition Recognition
+	Upload      Upload
+	Telegram    Telegram
+	Limits      Limits
+	Cache       Cache
+	Access      Access
+	Concurrency Concurrency
+	Network     Network
+	Debug       Debug
+	Chaos       Chaos
+	Health      Health
+
+	// MetricsAddr is where /metrics and the other operator endpoints are
+	// served, METRICS_ADDR.
+	MetricsAddr string
+	// TransformsPath is the transcript transforms file, TRANSFORMS_CONFIG.
+	TransformsPath string
+	// SettingsDBPath is the SQLite file of chat settings and pending jobs,
+	// SETTINGS_DB_PATH; "" keeps them in memory.
+	SettingsDBPath string
+	// SettingsFile is the JSON settings file of older releases, SETTINGS_FILE,
+	// imported into the database on start.
+	SettingsFile string
+	// Maintenance is the scheduled maintenance window, nil if none.
+	Maintenance *maintenance.Window
+	// ShutdownGracePeriod is how long in-flight messages are waited for.
+	ShutdownGracePeriod time.Duration
+
+	// Warnings are notable defaults in effect, for the log.
+	Warnings []string
+}
+
+// Log configures the logger.
+type Log struct {
+	Level  zerolog.Level // LOG_LEVEL
+	Format string        // LOG_FORMAT, "console" or "json"
+	// SpanEvents mirrors warnings and errors onto spans, OTEL_LOGS.
+	SpanEvents bool
+}
+
+// Telemetry configures trace export.
+type Telemetry struct {
+	GRPCTarget  string  // TELEMETRY_GRPC_TARGET, "" exports nothing
+	Insecure    bool    // TELEMETRY_INSECURE
+	DebugStdout bool    // TELEMETRY_DEBUG_STDOUT
+	SampleRatio float64 // TELEMETRY_SAMPLE_RATIO
+}
+
+// Recognition configures the recognition backend.
+type Recognition struct {
+	Endpoints         []string // API_ENDPOINT, comma-separated
+	Strategy          failover.Strategy
+	FailureThreshold  int
+	UnhealthyCooldown time.Duration
+	Protocol          string // API_PROTOCOL, "http" or "grpc"
+	GRPCTarget        string
+	GRPCInsecure      bool
+	Mode              string // API_MODE, "sync", "async" or "callback"
+	AsyncPollInterval time.Duration
+	AsyncTimeout      time.Duration
+	CallbackURL       string
+	CallbackSecret    string
+	CallbackTTL       time.Duration
+	CallbackAddr      string // CALLBACK_ADDR, a listener apart from METRICS_ADDR
+	AuthToken         string
+	AuthHeader        string
+	ResponseMaxBytes  int64
+	// Timeout bounds the whole handling of a message, RECOGNITION_TIMEOUT.
+	Timeout           time.Duration
+	TranslateEndpoint string
+	// CircuitFailures opens the circuit breaker, 0 disables it.
+	CircuitFailures int
+	CircuitWindow   time.Duration
+	CircuitCooldown time.Duration
+	// HealthPath is what health checks get, API_HEALTH_PATH; "" sends a
+	// HEAD to the upload endpoint.
+	HealthPath string
+	// StrictStartup refuses to start when the backend does not answer,
+	// API_STRICT_STARTUP.
+	StrictStartup bool
+	// EmptyFillers are what the backend writes for audio without speech,
+	// EMPTY_RESULT_FILLERS, comma-separated.
+	EmptyFillers []string
+}
+
+// Upload configures the deadlines and retries of recognition uploads.
+type Upload struct {
+	TimeoutBase      time.Duration
+	TimeoutFactor    float64
+	TimeoutMin       time.Duration
+	TimeoutMax       time.Duration
+	MaxAttempts      int
+	RetryBackoff     time.Duration
+	InMemoryMaxBytes int64
+}
+
+// Telegram configures the Bot API side.
+type Telegram struct {
+	DownloadTimeout  time.Duration
+	SendMaxAttempts  int
+	SendsPerSecond   int
+	ChatSendInterval time.Duration
+	// EditInterval is the least time between two edits of a message.
+	EditInterval  time.Duration
+	UpdatesBuffer int
+	// PollTimeout is how long getUpdates waits for updates,
+	// TELEGRAM_POLL_TIMEOUT.
+	PollTimeout time.Duration
+	// Debug logs every Bot API request and response, BOT_DEBUG.
+	Debug bool
+	// OffsetFlushInterval is how often the update offset is saved,
+	// OFFSET_FLUSH_INTERVAL.
+	OffsetFlushInterval time.Duration
+	// WebhookURL receives updates by webhook instead of long polling.
+	WebhookURL    string
+	WebhookSecret string // "" generates one
+	WebhookPort   string
+	// APIURL is the base URL of a self-hosted Bot API server,
+	// TELEGRAM_API_URL; "" uses api.telegram.org.
+	APIURL string
+	// LocalFileMount is where a local Bot API server stores the files.
+	LocalFileMount string
+	// LocalPathPrefix is the directory of the local Bot API server that
+	// LocalFileMount stands for, TELEGRAM_LOCAL_PATH_PREFIX.
+	LocalPathPrefix string
+}
+
+// APIEndpoint is the Bot API method endpoint, as tgbotapi.APIEndpoint.
+func (t Telegram) APIEndpoint() string {
+	if t.APIURL == "" {
+		return tgbotapi.APIEndpoint
+	}
+	return strings.TrimRight(t.APIURL, "/") + "/bot%s/%s"
+}
+
+// FileEndpoint is the file download endpoint, as tgbotapi.FileEndpoint.
+func (t Telegram) FileEndpoint() string {
+	if t.APIURL == "" {
+		return tgbotapi.FileEndpoint
+	}
+	return strings.TrimRight(t.APIURL, "/") + "/file/bot%s/%s"
+}
+
+// Limits configures what is transcribed.
+type Limits struct {
+	MaxAudioBytes        int64
+	MaxAudioDuration     time.Duration // 0 is unlimited
+	VideoNoteMaxDuration time.Duration
+	VideoEnabled         bool
+	FFmpegPath           string
+	// TranscodeEnabled converts every upload to 16 kHz mono WAV with ffmpeg.
+	TranscodeEnabled bool
+	VideoMaxBytes    int64
+	VideoMaxDuration time.Duration
+	// DocumentThreshold sends longer transcripts as a file, 0 never does.
+	DocumentThreshold   int
+	PlaceholderMessages bool
+	// Reactions marks transcribed messages with emoji reactions.
+	Reactions bool
+}
+
+// Cache configures the recognition cache.
+type Cache struct {
+	TTL        time.Duration
+	RedisAddr  string // "" keeps the cache in memory
+	MaxEntries int    // 0 disables the in-memory cache
+}
+
+// Access configures who may use the bot and how much.
+type Access struct {
+	AllowedUsers   []int64
+	AllowedChats   []int64
+	Admins         []int64
+	NoticeInterval time.Duration
+	// RateLimitMessages per RateLimitWindow and user, 0 disables the limit.
+	RateLimitMessages int
+	RateLimitWindow   time.Duration
+	// DailyQuota is the audio every user may have transcribed a day,
+	// DAILY_QUOTA_SECONDS; 0 disables the quota.
+	DailyQuota time.Duration
+}
+
+// Concurrency configures the worker pool.
+type Concurrency struct {
+	Workers   int
+	MaxQueued int
+}
+
+// Network configures outgoing connections.
+type Network struct {
+	DNSCacheTTL         time.Duration
+	DNSNegativeCacheTTL time.Duration
+	DialFallbackDelay   time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int // 0 is unlimited
+	IdleConnTimeout     time.Duration
+	TLSHandshakeTimeout time.Duration
+}
+
+// Debug configures the flight recorder.
+type Debug struct {
+	FlightRecorderSize int    // 0 disables it
+	Token              string // DEBUG_TOKEN, "" does not serve it
+	IncludeText        bool
+}
+
+// Chaos configures fault injection.
+type Chaos struct {
+	Enabled         bool
+	Rules           map[string][]chaos.Rule
+	Duration        time.Duration
+	DeployEnv       string
+	AllowProduction bool
+}
+
+// Health configures the readiness checks of the recognition backend.
+type Health struct {
+	Interval time.Duration // HEALTH_CHECK_INTERVAL
+	Timeout  time.Duration // HEALTH_CHECK_TIMEOUT
+	// MaxAge is how long a successful check keeps the bot ready,
+	// READINESS_MAX_AGE.
+	MaxAge time.Duration
+}
+
+// Load reads the configuration from the environment. The error lists every
+// invalid setting; the configuration returned along with it uses the
+// defaults in their place, enough to set up logging.
+func Load() (Config, error) {
+	l := &loader{}
+	var c Config
+
+	c.Log.Level = zerolog.DebugLevel
+	if value := l.string("LOG_LEVEL", ""); value != "" {
+		level, err := zerolog.ParseLevel(value)
+		if err != nil {
+			l.fail("LOG_LEVEL: %w", err)
+		} else {
+			c.Log.Level = level
+		}
+	}
+	c.Log.Format = l.oneOf("LOG_FORMAT", "console", "json")
+	c.Log.SpanEvents = l.bool("OTEL_LOGS", false)
+
+	c.Token = l.string("TELEGRAM_BOT_TOKEN", "")
+	if c.Token == "" {
+		l.fail("TELEGRAM_BOT_TOKEN is not set")
+	}
+
+	c.Telemetry = Telemetry{
+		GRPCTarget:  l.string("TELEMETRY_GRPC_TARGET", ""),
+		Insecure:    l.bool("TELEMETRY_INSECURE", true),
+		DebugStdout: l.bool("TELEMETRY_DEBUG_STDOUT", false),
+		SampleRatio: l.float("TELEMETRY_SAMPLE_RATIO", 1),
+	}
+	if c.Telemetry.SampleRatio > 1 {
+		l.fail("TELEMETRY_SAMPLE_RATIO must not be greater than 1")
+	}
+
+	r := &c.Recognition
+	if l.string("API_ENDPOINT", "") == "" {
+		c.Warnings = append(c.Warnings, "API_ENDPOINT environment variable is not set, using default value: \""+DefaultEndpoint+"\"")
+	}
+	r.Endpoints = l.list("API_ENDPOINT", DefaultEndpoint)
+	if len(r.Endpoints) == 0 {
+		l.fail("API_ENDPOINT lists no endpoint")
+	}
+	strategy, err := failover.ParseStrategy(l.string("API_LB_STRATEGY", ""))
+	if err != nil {
+		l.fail("API_LB_STRATEGY: %w", err)
+	}
+	r.Strategy = strategy
+	r.FailureThreshold = l.positive("API_FAILURE_THRESHOLD", 3)
+	r.UnhealthyCooldown = l.duration("API_UNHEALTHY_COOLDOWN", 30*time.Second)
+	r.Mode = l.oneOf("API_MODE", "sync", "async", "callback")
+	r.AsyncPollInterval = l.duration("ASYNC_POLL_INTERVAL", 2*time.Second)
+	r.AsyncTimeout = l.duration("ASYNC_TIMEOUT", 10*time.Minute)
+	r.Protocol = l.oneOf("API_PROTOCOL", "http", "grpc")
+	r.GRPCTarget = l.string("API_GRPC_TARGET", "")
+	r.GRPCInsecure = l.bool("API_GRPC_INSECURE", true)
+	if r.Protocol == "grpc" {
+		if r.GRPCTarget == "" {
+			l.fail("API_GRPC_TARGET is not set, API_PROTOCOL=grpc needs it")
+		}
+		if r.Mode != "sync" {
+			l.fail("API_MODE must be sync with API_PROTOCOL=grpc")
+		}
+	}
+	r.CallbackURL = l.string("CALLBACK_URL", "")
+	r.CallbackSecret = l.string("CALLBACK_SECRET", "")
+	r.CallbackTTL = l.duration("CALLBACK_TTL", 30*time.Minute)
+	r.CallbackAddr = l.string("CALLBACK_ADDR", ":8081")
+	if r.Mode == "callback" {
+		if u, err := url.Parse(r.CallbackURL); err != nil || !u.IsAbs() {
+			l.fail("CALLBACK_URL must be an absolute URL with API_MODE=callback")
+		}
+		if r.CallbackSecret == "" {
+			l.fail("CALLBACK_SECRET is not set, API_MODE=callback needs it")
+		}
+	}
+	r.AuthToken = l.string("API_AUTH_TOKEN", "")
+	r.AuthHeader = l.string("API_AUTH_HEADER", "")
+	r.ResponseMaxBytes = int64(l.positive("RECOGNITION_RESPONSE_MAX_BYTES", 10<<20))
+	r.Timeout = l.duration("RECOGNITION_TIMEOUT", 120*time.Second)
+	r.TranslateEndpoint = l.string("TRANSLATE_ENDPOINT", "")
+	r.CircuitFailures = l.int("CIRCUIT_BREAKER_FAILURES", 5)
+	r.CircuitWindow = l.duration("CIRCUIT_BREAKER_WINDOW", time.Minute)
+	r.CircuitCooldown = l.duration("CIRCUIT_BREAKER_COOLDOWN", 30*time.Second)
+	r.HealthPath = l.string("API_HEALTH_PATH", "")
+	if r.HealthPath != "" && !strings.HasPrefix(r.HealthPath, "/") {
+		l.fail("API_HEALTH_PATH must start with /, got %q", r.HealthPath)
+	}
+	r.StrictStartup = l.bool("API_STRICT_STARTUP", false)
+	r.EmptyFillers = l.list("EMPTY_RESULT_FILLERS", "[BLANK_AUDIO],[MUSIC],[SILENCE],♪")
+
+	c.Upload = Upload{
+		TimeoutBase:      l.duration("UPLOAD_TIMEOUT_BASE", 10*time.Second),
+		TimeoutFactor:    l.float("UPLOAD_TIMEOUT_FACTOR", 1),
+		TimeoutMin:       l.duration("UPLOAD_TIMEOUT_MIN", 15*time.Second),
+		TimeoutMax:       l.duration("UPLOAD_TIMEOUT_MAX", r.Timeout),
+		MaxAttempts:      l.positive("UPLOAD_MAX_ATTEMPTS", 3),
+		RetryBackoff:     l.duration("UPLOAD_RETRY_BACKOFF", time.Second),
+		InMemoryMaxBytes: int64(l.int("UPLOAD_IN_MEMORY_MAX_BYTES", 1<<20)),
+	}
+	if c.Upload.TimeoutMin > c.Upload.TimeoutMax {
+		l.fail("UPLOAD_TIMEOUT_MIN must not be greater than UPLOAD_TIMEOUT_MAX")
+	}
+	// The handling of the message ends at RECOGNITION_TIMEOUT whatever the upload deadline
+	if c.Upload.TimeoutMax > r.Timeout {
+		l.fail("UPLOAD_TIMEOUT_MAX must not be greater than RECOGNITION_TIMEOUT")
+	}
+
+	c.Telegram = Telegram{
+		DownloadTimeout:     l.duration("TELEGRAM_DOWNLOAD_TIMEOUT", 30*time.Second),
+		SendMaxAttempts:     l.positive("TELEGRAM_SEND_MAX_ATTEMPTS", 3),
+		SendsPerSecond:      l.positive("TELEGRAM_SENDS_PER_SECOND", 30),
+		ChatSendInterval:    l.duration("TELEGRAM_CHAT_SEND_INTERVAL", time.Second),
+		EditInterval:        l.duration("TELEGRAM_EDIT_INTERVAL", 3*time.Second),
+		UpdatesBuffer:       l.int("UPDATES_BUFFER", 100),
+		PollTimeout:         l.duration("TELEGRAM_POLL_TIMEOUT", 60*time.Second),
+		Debug:               l.bool("BOT_DEBUG", false),
+		OffsetFlushInterval: l.duration("OFFSET_FLUSH_INTERVAL", time.Second),
+		WebhookURL:          l.string("WEBHOOK_URL", ""),
+		WebhookSecret:       l.string("WEBHOOK_SECRET", ""),
+		WebhookPort:         l.string("WEBHOOK_PORT", "8443"),
+		APIURL:              l.string("TELEGRAM_API_URL", ""),
+		LocalFileMount:      l.string("LOCAL_FILE_MOUNT", ""),
+		LocalPathPrefix:     l.string("TELEGRAM_LOCAL_PATH_PREFIX", ""),
+	}
+	if c.Telegram.APIURL != "" {
+		if u, err := url.Parse(c.Telegram.APIURL); err != nil || !u.IsAbs() {
+			l.fail("TELEGRAM_API_URL must be an absolute URL, got %q", c.Telegram.APIURL)
+		}
+	}
+	// The hosted Bot API serves files of up to 20 MB, a local one up to 2000 MB
+	maxAudioBytes := 20 << 20
+	if c.Telegram.LocalFileMount != "" {
+		maxAudioBytes = 2000 << 20
+	}
+
+	c.Limits = Limits{
+		MaxAudioBytes:        int64(l.int("MAX_AUDIO_SIZE_BYTES", maxAudioBytes)),
+		MaxAudioDuration:     time.Duration(l.int("MAX_AUDIO_DURATION_SECONDS", 0)) * time.Second,
+		VideoNoteMaxDuration: l.duration("VIDEO_NOTE_MAX_DURATION", time.Minute),
+		VideoEnabled:         l.bool("VIDEO_TRANSCRIPTION_ENABLED", false),
+		FFmpegPath:           l.string("FFMPEG_PATH", "ffmpeg"),
+		TranscodeEnabled:     l.bool("TRANSCODE_ENABLED", false),
+		VideoMaxBytes:        int64(l.int("VIDEO_MAX_BYTES", 200<<20)),
+		VideoMaxDuration:     l.duration("VIDEO_MAX_DURATION", 2*time.Hour),
+		DocumentThreshold:    l.int("DOCUMENT_THRESHOLD_CHARS", 3000),
+		PlaceholderMessages:  l.bool("PLACEHOLDER_MESSAGES", false),
+		Reactions:            l.bool("REACTIONS_ENABLED", false),
+	}
+
+	c.Cache = Cache{
+		TTL:        l.duration("CACHE_TTL", 24*time.Hour),
+		RedisAddr:  l.string("CACHE_REDIS_ADDR", ""),
+		MaxEntries: l.int("CACHE_MAX_ENTRIES", 10000),
+	}
+
+	c.Access = Access{
+		AllowedUsers:      l.ids("ALLOWED_USER_IDS"),
+		AllowedChats:      l.ids("ALLOWED_CHAT_IDS"),
+		Admins:            l.ids("ADMIN_USER_IDS"),
+		NoticeInterval:    l.duration("ALLOWLIST_NOTICE_INTERVAL", time.Hour),
+		RateLimitMessages: l.int("RATE_LIMIT_MESSAGES", 5),
+		RateLimitWindow:   l.duration("RATE_LIMIT_WINDOW", 10*time.Minute),
+		DailyQuota:        time.Duration(l.int("DAILY_QUOTA_SECONDS", 0)) * time.Second,
+	}
+
+	c.Concurrency.Workers = l.positive("MAX_CONCURRENT_HANDLERS", 4)
+	// The queue holds two updates per worker unless told otherwise
+	c.Concurrency.MaxQueued = l.int("MAX_QUEUED_UPDATES", 2*c.Concurrency.Workers)
+
+	c.Network = Network{
+		DNSCacheTTL:         l.duration("DNS_CACHE_TTL", 30*time.Second),
+		DNSNegativeCacheTTL: l.duration("DNS_NEGATIVE_CACHE_TTL", 5*time.Second),
+		DialFallbackDelay:   l.duration("DIAL_FALLBACK_DELAY", 150*time.Millisecond),
+		MaxIdleConns:        l.int("HTTP_MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost: l.int("HTTP_MAX_IDLE_CONNS_PER_HOST", 16),
+		MaxConnsPerHost:     l.int("HTTP_MAX_CONNS_PER_HOST", 0),
+		IdleConnTimeout:     l.duration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+		TLSHandshakeTimeout: l.duration("HTTP_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+	}
+
+	c.Debug = Debug{
+		FlightRecorderSize: l.int("FLIGHT_RECORDER_SIZE", 100),
+		Token:              l.string("DEBUG_TOKEN", ""),
+		IncludeText:        l.bool("DEBUG_INCLUDE_TEXT", false),
+	}
+
+	c.Chaos = Chaos{
+		Enabled:         l.bool("CHAOS_ENABLED", false),
+		Duration:        l.duration("CHAOS_DURATION", 15*time.Minute),
+		DeployEnv:       l.string("DEPLOY_ENV", ""),
+		AllowProduction: l.bool("CHAOS_ALLOW_PRODUCTION", false),
+	}
+	if c.Chaos.Enabled {
+		if c.Chaos.Rules, err = chaos.Parse(l.string("CHAOS_RULES", "")); err != nil {
+			l.fail("CHAOS_RULES: %w", err)
+		}
+	}
+
+	c.Health = Health{
+		Interval: l.duration("HEALTH_CHECK_INTERVAL", 15*time.Second),
+		Timeout:  l.duration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
+		MaxAge:   l.duration("READINESS_MAX_AGE", time.Minute),
+	}
+
+	c.MetricsAddr = l.string("METRICS_ADDR", ":2112")
+	if c.Recognition.Mode == "callback" && c.Recognition.CallbackAddr == c.MetricsAddr {
+		l.fail("CALLBACK_ADDR must differ from METRICS_ADDR, callbacks are served on their own listener")
+	}
+	c.TransformsPath = l.string("TRANSFORMS_CONFIG", "")
+	c.SettingsDBPath = l.string("SETTINGS_DB_PATH", "")
+	if c.SettingsDBPath == "" {
+		c.Warnings = append(c.Warnings, "SETTINGS_DB_PATH environment variable is not set, chat settings are lost on restart")
+	}
+	c.SettingsFile = l.string("SETTINGS_FILE", "")
+	if c.SettingsFile != "" && c.SettingsDBPath == "" {
+		l.fail("SETTINGS_FILE is only imported into SETTINGS_DB_PATH, set it as well")
+	}
+	if c.Maintenance, err = maintenance.FromEnv(); err != nil {
+		l.fail("maintenance window: %w", err)
+	}
+	c.ShutdownGracePeriod = l.duration("SHUTDOWN_GRACE_PERIOD", 30*time.Second)
+
+	return c, l.err()
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestLoadUploadTimeoutDefaultsToRecognitionTimeout(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("RECOGNITION_TIMEOUT", "5m")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Upload.TimeoutMax != 5*time.Minute {
+		t.Errorf("Upload.TimeoutMax = %s, want RECOGNITION_TIMEOUT", c.Upload.TimeoutMax)
+	}
+}
+
+func TestLoadRejectsUploadTimeoutBeyondRecognitionTimeout(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("RECOGNITION_TIMEOUT", "2m")
+	t.Setenv("UPLOAD_TIMEOUT_MAX", "10m")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "UPLOAD_TIMEOUT_MAX") {
+		t.Errorf("Load = %v, want UPLOAD_TIMEOUT_MAX rejected", err)
+	}
+}
+
+func TestLoadServesCallbacksApartFromMetrics(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("API_MODE", "callback")
+	t.Setenv("CALLBACK_URL", "https://bot.example/callback")
+	t.Setenv("CALLBACK_SECRET", "secret")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Recognition.CallbackAddr == c.MetricsAddr {
+		t.Errorf("callbacks served on METRICS_ADDR %s by default", c.MetricsAddr)
+	}
+
+	t.Setenv("CALLBACK_ADDR", ":9000")
+	t.Setenv("METRICS_ADDR", ":9000")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "CALLBACK_ADDR") {
+		t.Errorf("Load = %v, want CALLBACK_ADDR on METRICS_ADDR rejected", err)
+	}
+}
+
+// warned reports whether a warning of c mentions name.
+func warned(c Config, name string) bool {
+	for _, warning := range c.Warnings {
+		if strings.Contains(warning, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Recognition.Endpoints) != 1 || c.Recognition.Endpoints[0] != DefaultEndpoint {
+		t.Errorf("Recognition.Endpoints = %v, want the default endpoint", c.Recognition.Endpoints)
+	}
+	if !warned(c, "API_ENDPOINT") {
+		t.Errorf("Warnings = %q, want the default endpoint pointed out", c.Warnings)
+	}
+	if c.Recognition.Mode != "sync" || c.Recognition.Protocol != "http" {
+		t.Errorf("mode %s over %s, want sync over http", c.Recognition.Mode, c.Recognition.Protocol)
+	}
+	if c.Concurrency.Workers != 4 || c.Concurrency.MaxQueued != 8 {
+		t.Errorf("%d workers with %d queued, want 4 and twice as many", c.Concurrency.Workers, c.Concurrency.MaxQueued)
+	}
+	if c.Recognition.Timeout != 2*time.Minute || c.Recognition.CircuitFailures != 5 {
+		t.Errorf("timeout %s, %d failures to open the circuit", c.Recognition.Timeout, c.Recognition.CircuitFailures)
+	}
+}
+
+func TestLoadReadsLists(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("API_ENDPOINT", " http://a/recognize, ,http://b/recognize ")
+	t.Setenv("ALLOWED_USER_IDS", "7, 8")
+	t.Setenv("API_LB_STRATEGY", "round-robin")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Recognition.Endpoints; len(got) != 2 || got[0] != "http://a/recognize" || got[1] != "http://b/recognize" {
+		t.Errorf("Recognition.Endpoints = %q", got)
+	}
+	if got := c.Access.AllowedUsers; len(got) != 2 || got[0] != 7 || got[1] != 8 {
+		t.Errorf("Access.AllowedUsers = %v", got)
+	}
+	if warned(c, "API_ENDPOINT") {
+		t.Errorf("Warnings = %q, want the endpoints taken as set", c.Warnings)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("RECOGNITION_TIMEOUT", "soon")
+	t.Setenv("MAX_CONCURRENT_HANDLERS", "0")
+	t.Setenv("CACHE_MAX_ENTRIES", "-1")
+	t.Setenv("BOT_DEBUG", "maybe")
+	t.Setenv("LOG_FORMAT", "xml")
+	t.Setenv("API_LB_STRATEGY", "random")
+	t.Setenv("ALLOWED_CHAT_IDS", "@group")
+	t.Setenv("API_PROTOCOL", "grpc")
+	t.Setenv("API_MODE", "async")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load succeeded")
+	}
+	for _, name := range []string{
+		"TELEGRAM_BOT_TOKEN", "RECOGNITION_TIMEOUT", "MAX_CONCURRENT_HANDLERS", "CACHE_MAX_ENTRIES", "BOT_DEBUG",
+		"LOG_FORMAT", "API_LB_STRATEGY", "ALLOWED_CHAT_IDS", "API_GRPC_TARGET", "API_MODE",
+	} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("%s not reported in\n%v", name, err)
+		}
+	}
+}
+
+func TestLoadChecksURLs(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("TELEGRAM_API_URL", "/bot-api")
+	t.Setenv("API_MODE", "callback")
+	t.Setenv("CALLBACK_URL", "/callback")
+
+	_, err := Load()
+	for _, name := range []string{"TELEGRAM_API_URL", "CALLBACK_URL", "CALLBACK_SECRET"} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Load = %v, want %s reported", err, name)
+		}
+	}
+}
+
+func TestLoadLocalBotAPIServer(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Telegram.APIEndpoint() != tgbotapi.APIEndpoint || c.Telegram.FileEndpoint() != tgbotapi.FileEndpoint || c.Limits.MaxAudioBytes != 20<<20 {
+		t.Errorf("hosted Bot API: %s, %s, %d bytes", c.Telegram.APIEndpoint(), c.Telegram.FileEndpoint(), c.Limits.MaxAudioBytes)
+	}
+
+	t.Setenv("TELEGRAM_API_URL", "http://bot-api:8081/")
+	t.Setenv("LOCAL_FILE_MOUNT", "/mnt/bot-api")
+	t.Setenv("TELEGRAM_LOCAL_PATH_PREFIX", "/var/lib/telegram-bot-api")
+	if c, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Telegram.APIEndpoint(); got != "http://bot-api:8081/bot%s/%s" {
+		t.Errorf("API endpoint %s", got)
+	}
+	if got := c.Telegram.FileEndpoint(); got != "http://bot-api:8081/file/bot%s/%s" {
+		t.Errorf("file endpoint %s", got)
+	}
+	if c.Telegram.LocalFileMount != "/mnt/bot-api" || c.Telegram.LocalPathPrefix != "/var/lib/telegram-bot-api" {
+		t.Errorf("mount %s for %s", c.Telegram.LocalFileMount, c.Telegram.LocalPathPrefix)
+	}
+	if c.Limits.MaxAudioBytes != 2000<<20 {
+		t.Errorf("local mode accepts %d bytes, want the local server's 2000 MB", c.Limits.MaxAudioBytes)
+	}
+
+	t.Setenv("MAX_AUDIO_SIZE_BYTES", "1048576")
+	if c, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Limits.MaxAudioBytes != 1<<20 {
+		t.Errorf("explicit limit read as %d bytes", c.Limits.MaxAudioBytes)
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-sr-bot/access"
+)
+
+// loader reads environment variables, collecting every problem instead of
+// stopping at the first one. Invalid values read as their default.
+type loader struct {
+	errs []error
+}
+
+func (l *loader) fail(format string, args ...any) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+func (l *loader) err() error {
+	return errors.Join(l.errs...)
+}
+
+// string reads the named variable, def when it is unset.
+func (l *loader) string(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// duration reads a positive time.Duration, def when it is unset.
+func (l *loader) duration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		l.fail("%s must be a positive duration, got %q", name, value)
+		return def
+	}
+	return d
+}
+
+// float reads a positive number, def when it is unset.
+func (l *loader) float(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		l.fail("%s must be a positive number, got %q", name, value)
+		return def
+	}
+	return f
+}
+
+// int reads a non-negative integer, def when it is unset.
+func (l *loader) int(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		l.fail("%s must be a non-negative integer, got %q", name, value)
+		return def
+	}
+	return i
+}
+
+// positive reads an integer of at least 1, def when it is unset.
+func (l *loader) positive(name string, def int) int {
+	i := l.int(name, def)
+	if i == 0 {
+		l.fail("%s must be at least 1", name)
+		return def
+	}
+	return i
+}
+
+// bool reads a boolean as strconv.ParseBool does, def when it is unset.
+func (l *loader) bool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.fail("%s must be true or false, got %q", name, value)
+		return def
+	}
+	return b
+}
+
+// oneOf reads a value out of allowed, the first of which is the default.
+func (l *loader) oneOf(name string, allowed ...string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return allowed[0]
+	}
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	l.fail("%s must be one of %s, got %q", name, strings.Join(allowed, ", "), value)
+	return allowed[0]
+}
+
+// list reads a comma-separated list, leaving out empty items.
+func (l *loader) list(name, def string) []string {
+	var items []string
+	for _, item := range strings.Split(l.string(name, def), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ids reads a comma-separated list of user or chat IDs.
+func (l *loader) ids(name string) []int64 {
+	ids, err := access.ParseIDs(os.Getenv(name))
+	if err != nil {
+		l.fail("%s: %w", name, err)
+	}
+	return ids
+}
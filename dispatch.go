@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"telegram-sr-bot/access"
+	"telegram-sr-bot/commands"
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/maintenance"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/offset"
+	"telegram-sr-bot/ratelimit"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/settings"
+	"telegram-sr-bot/workerpool"
+)
+
+var handlerPanicsCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "handler_panics_total",
+		Help: "Total number of panics recovered while handling updates.",
+	},
+)
+
+// router hands every update to whatever handles it, however the update was
+// received.
+type router struct {
+	bot        sender.Bot
+	dispatcher *commands.Dispatcher
+	handler    *handleAudio.Handler
+	pool       *workerpool.Pool
+	window     *maintenance.Window
+	allowlist  *access.Allowlist
+	limiter    *ratelimit.Limiter // nil lets everyone send as much as they like
+	settings   settings.Store
+	offsets    *offset.Tracker
+	// botUserName is mentioned in replies asking for a transcription.
+	botUserName string
+
+	// updateID is the update being dispatched. Updates are dispatched one
+	// at a time, by the update loop.
+	updateID int
+}
+
+// dispatch handles a single update. Audio is transcribed on the worker
+// pool, everything else is answered right away.
+func (r *router) dispatch(ctx context.Context, update tgbotapi.Update) {
+	// Telegram delivers what it did not see confirmed again after a restart
+	if !r.offsets.Begin(update.UpdateID, time.Now()) {
+		log.Debug().Int("update_id", update.UpdateID).Msg("Skipping an update handled before")
+		return
+	}
+	r.updateID = update.UpdateID
+	defer r.offsets.Done(update.UpdateID)
+	defer r.recoverPanic(ctx, update.Message)
+	if update.Message != nil && update.Message.MigrateToChatID != 0 {
+		sender.ChatMigrated(update.Message.Chat.ID, update.Message.MigrateToChatID)
+		return
+	}
+	if query := update.CallbackQuery; query != nil {
+		r.dispatchCallback(query)
+		return
+	}
+	// Keep strangers away before anything is downloaded or answered
+	if update.Message != nil && !r.allowlist.Allowed(update.Message) {
+		r.reject(update.Message)
+		return
+	}
+	if r.dispatcher.Dispatch(ctx, update.Message) {
+		return
+	}
+	if _, ok := handleAudio.ExtractAudioSource(update.Message); ok {
+		// Busy groups only get the transcriptions someone asks for
+		if mode := r.mode(update.Message); mode != settings.ModeAlways {
+			log.Debug().Int64("chat_id", update.Message.Chat.ID).Str("mode", mode).Msg("Audio message not transcribed in this chat's mode")
+			return
+		}
+		r.transcribe(update.Message, update.Message)
+	} else if audio := r.mentionedAudio(update.Message); audio != nil {
+		if r.mode(update.Message) == settings.ModeOff {
+			return
+		}
+		r.transcribe(update.Message, audio)
+	} else if handleAudio.IsUnsupportedDocument(update.Message) {
+		log.Info().Msg("Unsupported document received")
+		// Groups sharing files are only told off where audio is transcribed
+		// unasked, and no more often than audio is answered
+		if r.mode(update.Message) != settings.ModeAlways || !r.admitReply(update.Message) {
+			return
+		}
+		r.handler.RejectUnsupportedDocument(update.Message)
+	}
+}
+
+// transcribe queues audio to be transcribed at the request of request,
+// which is audio itself unless someone asked for it in a reply.
+func (r *router) transcribe(request, audio *tgbotapi.Message) {
+	if !r.admit(request, audio) {
+		return
+	}
+	r.submit(func(ctx context.Context) {
+		ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "processMessage")
+		defer span.End()
+		// Workers run on their own goroutines, each needs its own recover
+		defer r.recoverPanic(ctx, audio)
+		span.SetAttributes(attribute.String("type", "audioMessage"))
+
+		r.handler.Handle(ctx, request, audio)
+		span.SetStatus(codes.Ok, "Processing succeeded")
+	})
+}
+
+// admit reports whether audio may be transcribed at the request of request.
+// The requester is told about maintenance, then held to the rate limit; the
+// daily quota is up to the handler, which knows whether anything was
+// transcribed.
+func (r *router) admit(request, audio *tgbotapi.Message) bool {
+	source, _ := handleAudio.ExtractAudioSource(audio)
+	log.Info().Str("source", source.Kind).Bool("on_request", request != audio).Msg("Audio message received")
+	return r.admitReply(request)
+}
+
+// admitReply reports whether message may be answered: outside maintenance,
+// of which its sender is told, and within the rate limit.
+func (r *router) admitReply(message *tgbotapi.Message) bool {
+	if r.window.Active(time.Now()) {
+		lang := ""
+		if message.From != nil {
+			lang = message.From.LanguageCode
+		}
+		text := r.window.Message(lang)
+		if text == "" {
+			text = r.texts(message.Chat.ID, message.From).Get(messages.Maintenance)
+		}
+		notice := tgbotapi.NewMessage(message.Chat.ID, text)
+		notice.ReplyToMessageID = message.MessageID
+		notice.AllowSendingWithoutReply = true
+		if _, err := sender.SendMessage(r.bot, notice); err != nil {
+			log.Error().Err(err).Msg("Failed to send maintenance notice")
+		}
+		return false
+	}
+	return r.allowRate(message)
+}
+
+// transcribeOnRequest queues audio to be transcribed because request asked
+// for it, reporting false when audio has none.
+func (r *router) transcribeOnRequest(request, audio *tgbotapi.Message) bool {
+	if _, ok := handleAudio.ExtractAudioSource(audio); !ok {
+		return false
+	}
+	r.transcribe(request, audio)
+	return true
+}
+
+// mode returns the transcription mode of the chat of message.
+func (r *router) mode(message *tgbotapi.Message) string {
+	chat, err := r.settings.Get(message.Chat.ID)
+	if err != nil {
+		log.Warn().Err(err).Int64("chat_id", message.Chat.ID).Msg("Failed to read the chat settings, using the defaults")
+	}
+	return chat.TranscriptionMode(!message.Chat.IsPrivate())
+}
+
+// mentionedAudio returns the audio message that message replies to while
+// mentioning the bot, nil if message is no such request.
+func (r *router) mentionedAudio(message *tgbotapi.Message) *tgbotapi.Message {
+	if message == nil || message.ReplyToMessage == nil {
+		return nil
+	}
+	if _, ok := handleAudio.ExtractAudioSource(message.ReplyToMessage); !ok {
+		return nil
+	}
+	text := utf16.Encode([]rune(message.Text))
+	for _, entity := range message.Entities {
+		// Entity offsets count UTF-16 code units
+		if entity.Offset < 0 || entity.Offset+entity.Length > len(text) {
+			continue
+		}
+		switch entity.Type {
+		case "mention":
+			mention := string(utf16.Decode(text[entity.Offset : entity.Offset+entity.Length]))
+			if strings.EqualFold(mention, "@"+r.botUserName) {
+				return message.ReplyToMessage
+			}
+		case "text_mention":
+			if entity.User != nil && strings.EqualFold(entity.User.UserName, r.botUserName) {
+				return message.ReplyToMessage
+			}
+		}
+	}
+	return nil
+}
+
+// transcribeSRT queues audio to be answered with subtitles because request
+// asked for it, through the same checks as transcribe. It reports false
+// when audio has none.
+func (r *router) transcribeSRT(request, audio *tgbotapi.Message) bool {
+	if _, ok := handleAudio.ExtractAudioSource(audio); !ok {
+		return false
+	}
+	if !r.admit(request, audio) {
+		return true
+	}
+	r.submit(func(ctx context.Context) {
+		ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "processMessage")
+		defer span.End()
+		defer r.recoverPanic(ctx, audio)
+		span.SetAttributes(attribute.String("type", "srtRequest"))
+
+		r.handler.HandleSRT(ctx, request, audio)
+	})
+	return true
+}
+
+// submit runs job on the worker pool, the update being dispatched counts as
+// handled once job returns.
+func (r *router) submit(job workerpool.Job) {
+	updateID := r.updateID
+	r.offsets.Hold(updateID)
+	r.pool.Submit(func(ctx context.Context) {
+		defer r.offsets.Done(updateID)
+		job(ctx)
+	})
+}
+
+// dispatchCallback acts on a pressed button on the worker pool, retrying
+// and translating both call the backends.
+func (r *router) dispatchCallback(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil || query.Message.Chat == nil || query.From == nil {
+		return
+	}
+	if !r.allowlist.AllowedIn(query.From.ID, query.Message.Chat.ID) {
+		access.RejectedCounter.With(prometheus.Labels{"reason": "unauthorized"}).Inc()
+		if _, err := r.bot.Request(tgbotapi.NewCallback(query.ID, r.texts(query.Message.Chat.ID, query.From).Get(messages.Private))); err != nil {
+			log.Warn().Err(err).Msg("Failed to answer the callback query")
+		}
+		return
+	}
+	r.submit(func(ctx context.Context) {
+		ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "processCallback")
+		defer span.End()
+		defer r.recoverPanic(ctx, query.Message)
+		span.SetAttributes(attribute.String("type", "callbackQuery"))
+
+		r.handler.HandleCallback(ctx, query)
+	})
+}
+
+// reject drops a message from someone not on the allowlist, telling the
+// chat the bot is private unless it was told recently.
+func (r *router) reject(message *tgbotapi.Message) {
+	access.RejectedCounter.With(prometheus.Labels{"reason": "unauthorized"}).Inc()
+	logger := log.With().Int64("chat_id", message.Chat.ID).Logger()
+	if message.From != nil {
+		logger = logger.With().Int64("user_id", message.From.ID).Logger()
+	}
+	logger.Info().Msg("Message from outside the allowlist ignored")
+	if !r.allowlist.ShouldNotify(message.Chat.ID, time.Now()) {
+		return
+	}
+	reply := tgbotapi.NewMessage(message.Chat.ID, r.texts(message.Chat.ID, message.From).Get(messages.Private))
+	reply.ReplyToMessageID = message.MessageID
+	reply.AllowSendingWithoutReply = true
+	if _, err := sender.SendMessage(r.bot, reply); err != nil {
+		logger.Error().Err(err).Msg("Failed to tell the chat that the bot is private")
+	}
+}
+
+// allowRate reports whether the sender of message is within the rate
+// limit, telling them once when they are not.
+func (r *router) allowRate(message *tgbotapi.Message) bool {
+	if r.limiter == nil || message.From == nil {
+		return true
+	}
+	decision := r.limiter.Allow(message.From.ID, time.Now())
+	if decision.Allowed {
+		return true
+	}
+	ratelimit.LimitedCounter.Inc()
+	logger := log.With().Int64("chat_id", message.Chat.ID).Int64("user_id", message.From.ID).Logger()
+	logger.Info().Dur("retry_after", decision.RetryAfter).Msg("Message dropped by the rate limit")
+	if decision.Notify {
+		reply := tgbotapi.NewMessage(message.Chat.ID, r.texts(message.Chat.ID, message.From).Get(messages.RateLimited, decision.RetryMinutes()))
+		reply.ReplyToMessageID = message.MessageID
+		reply.AllowSendingWithoutReply = true
+		if _, err := sender.SendMessage(r.bot, reply); err != nil {
+			logger.Error().Err(err).Msg("Failed to tell the user about the rate limit")
+		}
+	}
+	return false
+}
+
+// recoverPanic keeps a panic while handling message from taking down the
+// whole bot: it is logged and recorded on the span, and the user is told
+// that something went wrong. It must be deferred directly.
+func (r *router) recoverPanic(ctx context.Context, message *tgbotapi.Message) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	handlerPanicsCounter.Inc()
+	err := fmt.Errorf("panic: %v", p)
+	logger := log.With().Ctx(ctx).Logger()
+	// Whatever panicked may have been the message itself
+	if message != nil && message.Chat != nil {
+		logger = logger.With().Int64("chat_id", message.Chat.ID).Int("message_id", message.MessageID).Logger()
+	}
+	logger.Error().Err(err).Str("stack", string(debug.Stack())).Msg("Recovered from a panic while handling an update")
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "Handler panicked")
+
+	if message == nil || message.Chat == nil {
+		return
+	}
+	reply := tgbotapi.NewMessage(message.Chat.ID, r.texts(message.Chat.ID, message.From).Get(messages.Panic))
+	reply.ReplyToMessageID = message.MessageID
+	reply.AllowSendingWithoutReply = true
+	if _, err := sender.SendMessage(r.bot, reply); err != nil {
+		logger.Error().Err(err).Msg("Failed to tell the user about the failure")
+	}
+}
+
+// texts returns the replies for user in chatID, in the language the chat
+// chose or else in the language of user's Telegram app.
+func (r *router) texts(chatID int64, user *tgbotapi.User) *messages.Bundle {
+	chat, err := r.settings.Get(chatID)
+	if err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("Failed to read the chat settings, using the defaults")
+	}
+	return messages.For(chat.UILanguage, messages.UserLanguage(user))
+}
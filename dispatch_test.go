@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"telegram-sr-bot/access"
+	"telegram-sr-bot/commands"
+	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/maintenance"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/offset"
+	"telegram-sr-bot/ratelimit"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/settings"
+	"telegram-sr-bot/workerpool"
+)
+
+// recordingBot records the texts of the messages sent.
+type recordingBot struct {
+	texts []string
+}
+
+func (b *recordingBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if message, ok := c.(tgbotapi.MessageConfig); ok {
+		b.texts = append(b.texts, message.Text)
+	}
+	return tgbotapi.Message{MessageID: 99}, nil
+}
+
+func (b *recordingBot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+// failingFetcher cannot download anything.
+type failingFetcher struct{}
+
+func (failingFetcher) Fetch(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return nil, errors.New("file gone")
+}
+
+// panickingFetcher panics instead of downloading anything.
+type panickingFetcher struct{}
+
+func (panickingFetcher) Fetch(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	panic("fetcher bug")
+}
+
+// unusedRecognizer is a backend the audio never gets to.
+type unusedRecognizer struct{}
+
+func (unusedRecognizer) Recognize(ctx context.Context, audio io.Reader, req handleAudio.RecognitionRequest) (handleAudio.RecognitionResult, error) {
+	return handleAudio.RecognitionResult{}, errors.New("not reached")
+}
+
+func (unusedRecognizer) Endpoint() string { return "http://backend" }
+
+func (unusedRecognizer) Probe(ctx context.Context) error { return nil }
+
+// newTestRouter returns a router sending through the returned bot and
+// transcribing what fetcher downloads on a single worker the test shuts
+// down.
+func newTestRouter(t *testing.T, fetcher handleAudio.TelegramFileFetcher) (*router, *recordingBot) {
+	t.Helper()
+	tracker, err := offset.NewTracker(offset.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := &recordingBot{}
+	store := settings.NewMemory()
+	return &router{
+		bot:        bot,
+		dispatcher: commands.NewDispatcher(bot, "sr_bot", store),
+		handler:    handleAudio.NewHandler(fetcher, unusedRecognizer{}, bot, sender.NewEditThrottler(bot, 0), store),
+		pool:       workerpool.New(context.Background(), 1, 1),
+		allowlist:  access.NewAllowlist(nil, nil, time.Hour),
+		settings:   store,
+		offsets:    tracker,
+	}, bot
+}
+
+func TestDispatchRecoversFromACommandPanic(t *testing.T) {
+	r, bot := newTestRouter(t, panickingFetcher{})
+	r.dispatcher.Register("boom", messages.CommandHelp, func(context.Context, *tgbotapi.Message, *messages.Bundle) string {
+		panic("command bug")
+	})
+	panics := testutil.ToFloat64(handlerPanicsCounter)
+
+	r.dispatch(context.Background(), tgbotapi.Update{UpdateID: 1, Message: &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: 7},
+		Chat:      &tgbotapi.Chat{ID: 7, Type: "private"},
+		Text:      "/boom",
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Length: len("/boom")}},
+	}})
+	r.pool.Shutdown(context.Background())
+
+	if got := testutil.ToFloat64(handlerPanicsCounter) - panics; got != 1 {
+		t.Errorf("%v panics counted, want 1", got)
+	}
+	if len(bot.texts) != 1 || bot.texts[0] != messages.For("en").Get(messages.Panic) {
+		t.Errorf("user told %q, want the failure reply", bot.texts)
+	}
+	// The update counts as handled, the bot does not stall on it
+	if r.offsets.Begin(1, time.Now()) {
+		t.Error("update not marked handled after the panic")
+	}
+}
+
+func TestWorkerRecoversFromAHandlerPanic(t *testing.T) {
+	r, bot := newTestRouter(t, panickingFetcher{})
+	panics := testutil.ToFloat64(handlerPanicsCounter)
+
+	r.dispatch(context.Background(), tgbotapi.Update{UpdateID: 1, Message: &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: 7},
+		Chat:      &tgbotapi.Chat{ID: 7, Type: "private"},
+		Voice:     &tgbotapi.Voice{FileID: "file", FileUniqueID: "unique", Duration: 5, FileSize: 100},
+	}})
+	// The worker goes on with the next job after the panic
+	ran := false
+	r.submit(func(context.Context) { ran = true })
+	r.pool.Shutdown(context.Background())
+
+	if got := testutil.ToFloat64(handlerPanicsCounter) - panics; got != 1 {
+		t.Errorf("%v panics counted, want 1", got)
+	}
+	if !ran {
+		t.Error("job after the panic never ran")
+	}
+	if n := len(bot.texts); n == 0 || bot.texts[n-1] != messages.For("en").Get(messages.Panic) {
+		t.Errorf("user told %q, want the failure reply last", bot.texts)
+	}
+}
+
+func TestTranscribeOnRequestNeedsAudio(t *testing.T) {
+	r, bot := newTestRouter(t, failingFetcher{})
+	request := &tgbotapi.Message{MessageID: 11, From: &tgbotapi.User{ID: 7}, Chat: &tgbotapi.Chat{ID: -100, Type: "group"}}
+
+	text := &tgbotapi.Message{MessageID: 3, Chat: request.Chat, Text: "no audio here"}
+	if r.transcribeOnRequest(request, text) {
+		t.Error("message without audio taken for transcription")
+	}
+	voice := &tgbotapi.Message{MessageID: 3, Chat: request.Chat,
+		Voice: &tgbotapi.Voice{FileID: "file", FileUniqueID: "unique", Duration: 5, FileSize: 100}}
+	if !r.transcribeOnRequest(request, voice) {
+		t.Error("voice message not taken for transcription")
+	}
+	r.pool.Shutdown(context.Background())
+
+	// The download was attempted, and its failure reported
+	want := messages.For("en").Get(messages.DownloadFailed)
+	if n := len(bot.texts); n == 0 || bot.texts[n-1] != want {
+		t.Errorf("user told %q, want %q", bot.texts, want)
+	}
+}
+
+func TestUnsupportedDocumentsFollowTheChatMode(t *testing.T) {
+	updateID := 0
+	document := func(chatID int64, chatType string) tgbotapi.Update {
+		updateID++
+		return tgbotapi.Update{UpdateID: updateID, Message: &tgbotapi.Message{
+			MessageID: 10,
+			From:      &tgbotapi.User{ID: 7},
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: chatType},
+			Document:  &tgbotapi.Document{FileID: "file", FileName: "report.pdf", MimeType: "application/pdf"},
+		}}
+	}
+	r, bot := newTestRouter(t, failingFetcher{})
+	defer r.pool.Shutdown(context.Background())
+	if err := r.settings.Set(-200, settings.Settings{Mode: settings.ModeAlways}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.settings.Set(-300, settings.Settings{Mode: settings.ModeOff}); err != nil {
+		t.Fatal(err)
+	}
+
+	// On command by default in groups
+	r.dispatch(context.Background(), document(-100, "group"))
+	r.dispatch(context.Background(), document(-300, "supergroup"))
+	if len(bot.texts) != 0 {
+		t.Errorf("groups not transcribing everything told %q", bot.texts)
+	}
+
+	want := messages.For("en").Get(messages.UnsupportedDocument)
+	r.dispatch(context.Background(), document(-200, "group"))
+	r.dispatch(context.Background(), document(-7, "private"))
+	if len(bot.texts) != 2 || bot.texts[0] != want || bot.texts[1] != want {
+		t.Errorf("told %q, want the group transcribing everything and the private chat told off", bot.texts)
+	}
+}
+
+func TestUnsupportedDocumentsAreRateLimited(t *testing.T) {
+	r, bot := newTestRouter(t, failingFetcher{})
+	defer r.pool.Shutdown(context.Background())
+	r.limiter = ratelimit.New(1, time.Hour, nil)
+
+	for id := 1; id <= 3; id++ {
+		r.dispatch(context.Background(), tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{
+			MessageID: id,
+			From:      &tgbotapi.User{ID: 7},
+			Chat:      &tgbotapi.Chat{ID: 7, Type: "private"},
+			Document:  &tgbotapi.Document{FileID: "file", FileName: "report.pdf", MimeType: "application/pdf"},
+		}})
+	}
+	if len(bot.texts) != 2 || bot.texts[0] != messages.For("en").Get(messages.UnsupportedDocument) {
+		t.Errorf("told %q, want one reply and one rate limit notice", bot.texts)
+	}
+}
+
+func TestRecoverPanicCopesWithMessagesWithoutChat(t *testing.T) {
+	r, bot := newTestRouter(t, panickingFetcher{})
+	defer r.pool.Shutdown(context.Background())
+	commands.RegisterHelp(r.dispatcher)
+	panics := testutil.ToFloat64(handlerPanicsCounter)
+
+	// Reading the settings of the missing chat panics
+	r.dispatch(context.Background(), tgbotapi.Update{UpdateID: 1, Message: &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: 7},
+		Text:      "/help",
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Length: len("/help")}},
+	}})
+
+	if got := testutil.ToFloat64(handlerPanicsCounter) - panics; got != 1 {
+		t.Errorf("%v panics counted, want 1", got)
+	}
+	if len(bot.texts) != 0 {
+		t.Errorf("told %q with no chat to tell", bot.texts)
+	}
+}
+
+func TestMaintenanceNoticeIsTranslated(t *testing.T) {
+	r, bot := newTestRouter(t, failingFetcher{})
+	defer r.pool.Shutdown(context.Background())
+	now := time.Now()
+	r.window = &maintenance.Window{Start: now.Add(-time.Minute), End: now.Add(time.Hour), Messages: map[string]string{"de": "Wartung"}}
+	// Leave the window again, the gauge is shared with the other tests
+	defer r.window.Active(time.Time{})
+
+	for id, lang := range []string{"ru", "en", "de"} {
+		r.dispatch(context.Background(), tgbotapi.Update{UpdateID: id + 1, Message: &tgbotapi.Message{
+			MessageID: id + 1,
+			From:      &tgbotapi.User{ID: 7, LanguageCode: lang},
+			Chat:      &tgbotapi.Chat{ID: 7, Type: "private"},
+			Voice:     &tgbotapi.Voice{FileID: "file", Duration: 5},
+		}})
+	}
+	want := []string{messages.For("ru").Get(messages.Maintenance), messages.For("en").Get(messages.Maintenance), "Wartung"}
+	if len(bot.texts) != len(want) {
+		t.Fatalf("told %q, want %q", bot.texts, want)
+	}
+	for i := range want {
+		if bot.texts[i] != want[i] {
+			t.Errorf("told %q, want %q", bot.texts[i], want[i])
+		}
+	}
+}
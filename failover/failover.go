@@ -0,0 +1,155 @@
+// Package failover spreads recognition uploads over several backends and
+// steers clear of the ones that keep failing.
+package failover
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var HealthyGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "recognition_backend_healthy",
+		Help: "Whether the recognition backend is considered healthy (1) or not (0).",
+	},
+	[]string{"endpoint"},
+)
+
+// Strategy chooses which healthy backend is tried first.
+type Strategy int
+
+const (
+	// InOrder tries the backends in the order they are configured, the
+	// first one takes all the load while it is healthy.
+	InOrder Strategy = iota
+	// RoundRobin starts every upload at the next backend.
+	RoundRobin
+)
+
+// ParseStrategy reads a strategy by name, "" is InOrder.
+func ParseStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", "failover":
+		return InOrder, nil
+	case "round-robin":
+		return RoundRobin, nil
+	}
+	return 0, fmt.Errorf("unknown strategy %q, want failover or round-robin", name)
+}
+
+// Pool tracks the health of a set of backends. A backend failing
+// threshold times in a row is unhealthy and skipped for cooldown, after
+// which it is tried again: a success makes it healthy, another failure
+// starts a new cooldown.
+type Pool struct {
+	strategy  Strategy
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	backends []*backend
+	next     int
+}
+
+type backend struct {
+	endpoint string
+	failures int // In a row
+	until    time.Time
+}
+
+func (b *backend) healthy() bool {
+	return b.until.IsZero()
+}
+
+// New returns a pool of endpoints, all healthy to begin with.
+func New(endpoints []string, strategy Strategy, threshold int, cooldown time.Duration) *Pool {
+	p := &Pool{strategy: strategy, threshold: max(threshold, 1), cooldown: cooldown}
+	for _, endpoint := range endpoints {
+		p.backends = append(p.backends, &backend{endpoint: endpoint})
+		HealthyGauge.With(prometheus.Labels{"endpoint": endpoint}).Set(1)
+	}
+	return p
+}
+
+// Endpoints lists the endpoints of the pool as configured.
+func (p *Pool) Endpoints() []string {
+	endpoints := make([]string, len(p.backends))
+	for i, b := range p.backends {
+		endpoints[i] = b.endpoint
+	}
+	return endpoints
+}
+
+// Order returns the endpoints to try for one upload as of now, leaving out
+// those cooling down. When every backend is cooling down all of them are
+// returned, a long shot beats not trying.
+func (p *Pool) Order(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var order []string
+	for _, b := range p.backends {
+		if b.healthy() || !now.Before(b.until) {
+			order = append(order, b.endpoint)
+		}
+	}
+	if len(order) == 0 {
+		order = p.Endpoints()
+	}
+	if p.strategy == RoundRobin {
+		// Rotate among the backends in use, so each gets its share
+		start := p.next % len(order)
+		p.next++
+		order = append(order[start:], order[:start]...)
+	}
+	return order
+}
+
+// Report records how an upload to endpoint went at now.
+func (p *Pool) Report(endpoint string, ok bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.endpoint != endpoint {
+			continue
+		}
+		if ok {
+			b.failures, b.until = 0, time.Time{}
+		} else if b.failures++; b.failures >= p.threshold {
+			b.until = now.Add(p.cooldown)
+		}
+		b.observe()
+		return
+	}
+}
+
+// Probed records the outcome of a health check of endpoint at now. Unlike
+// a failed upload, a single failed check makes the backend unhealthy: it
+// was asked about nothing else.
+func (p *Pool) Probed(endpoint string, ok bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.endpoint != endpoint {
+			continue
+		}
+		if ok {
+			b.failures, b.until = 0, time.Time{}
+		} else {
+			b.failures, b.until = p.threshold, now.Add(p.cooldown)
+		}
+		b.observe()
+		return
+	}
+}
+
+// observe exports the health of b.
+func (b *backend) observe() {
+	healthy := 0.0
+	if b.healthy() {
+		healthy = 1
+	}
+	HealthyGauge.With(prometheus.Labels{"endpoint": b.endpoint}).Set(healthy)
+}
@@ -0,0 +1,101 @@
+package failover
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var start = time.Unix(1700000000, 0)
+
+func TestParseStrategy(t *testing.T) {
+	for name, want := range map[string]Strategy{"": InOrder, "failover": InOrder, "round-robin": RoundRobin} {
+		if got, err := ParseStrategy(name); err != nil || got != want {
+			t.Errorf("ParseStrategy(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Error("unknown strategy accepted")
+	}
+}
+
+func TestInOrderSkipsUnhealthyBackends(t *testing.T) {
+	p := New([]string{"http://pool-a", "http://pool-b"}, InOrder, 2, time.Minute)
+	if got := p.Order(start); !slices.Equal(got, []string{"http://pool-a", "http://pool-b"}) {
+		t.Fatalf("order %v", got)
+	}
+	p.Report("http://pool-a", false, start)
+	if got := p.Order(start); got[0] != "http://pool-a" {
+		t.Errorf("order %v after one failure, want a still first", got)
+	}
+	p.Report("http://pool-a", false, start)
+	if got := p.Order(start.Add(time.Second)); !slices.Equal(got, []string{"http://pool-b"}) {
+		t.Errorf("order %v during the cooldown, want b alone", got)
+	}
+	if got := testutil.ToFloat64(HealthyGauge.WithLabelValues("http://pool-a")); got != 0 {
+		t.Errorf("a exported as healthy = %v", got)
+	}
+
+	// Tried again after the cooldown, healthy again once it succeeds
+	if got := p.Order(start.Add(time.Minute)); got[0] != "http://pool-a" {
+		t.Errorf("order %v after the cooldown, want a back", got)
+	}
+	p.Report("http://pool-a", true, start.Add(time.Minute))
+	if got := testutil.ToFloat64(HealthyGauge.WithLabelValues("http://pool-a")); got != 1 {
+		t.Errorf("a exported as healthy = %v after a success", got)
+	}
+}
+
+func TestFailureAfterCooldownStartsAnother(t *testing.T) {
+	p := New([]string{"http://retry-a", "http://retry-b"}, InOrder, 3, time.Minute)
+	for i := 0; i < 3; i++ {
+		p.Report("http://retry-a", false, start)
+	}
+	p.Report("http://retry-a", false, start.Add(time.Minute))
+	if got := p.Order(start.Add(90 * time.Second)); slices.Contains(got, "http://retry-a") {
+		t.Errorf("order %v, want a cooling down again after one more failure", got)
+	}
+}
+
+func TestEveryBackendDownTriesThemAll(t *testing.T) {
+	p := New([]string{"http://down-a", "http://down-b"}, InOrder, 1, time.Minute)
+	p.Report("http://down-a", false, start)
+	p.Report("http://down-b", false, start)
+	if got := p.Order(start); !slices.Equal(got, []string{"http://down-a", "http://down-b"}) {
+		t.Errorf("order %v, want every backend", got)
+	}
+}
+
+func TestRoundRobinRotates(t *testing.T) {
+	p := New([]string{"http://rr-a", "http://rr-b", "http://rr-c"}, RoundRobin, 1, time.Minute)
+	var firsts []string
+	for i := 0; i < 4; i++ {
+		firsts = append(firsts, p.Order(start)[0])
+	}
+	if !slices.Equal(firsts, []string{"http://rr-a", "http://rr-b", "http://rr-c", "http://rr-a"}) {
+		t.Errorf("first backends %v", firsts)
+	}
+	p.Report("http://rr-b", false, start)
+	if got := p.Order(start); len(got) != 2 || slices.Contains(got, "http://rr-b") {
+		t.Errorf("order %v, want b left out", got)
+	}
+}
+
+func TestProbeFailureMakesUnhealthyAtOnce(t *testing.T) {
+	p := New([]string{"http://probe-a", "http://probe-b"}, InOrder, 5, time.Minute)
+	p.Probed("http://probe-a", false, start)
+	if got := p.Order(start); !slices.Equal(got, []string{"http://probe-b"}) {
+		t.Errorf("order %v after a failed check", got)
+	}
+	p.Probed("http://probe-a", true, start)
+	if got := p.Order(start); len(got) != 2 {
+		t.Errorf("order %v after a passed check", got)
+	}
+	// Reports on endpoints outside the pool are ignored
+	p.Report("http://elsewhere", false, start)
+	if got := p.Endpoints(); !slices.Equal(got, []string{"http://probe-a", "http://probe-b"}) {
+		t.Errorf("endpoints %v", got)
+	}
+}
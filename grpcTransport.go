@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"telegram-sr-bot/netdial"
+)
+
+// newGRPCConn returns a connection to target dialing through dialer, in
+// plaintext if plaintext is set and over TLS otherwise. It connects lazily
+// and reconnects on its own.
+func newGRPCConn(target string, plaintext bool, dialer *netdial.Dialer) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if !plaintext {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	return grpc.Dial(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", address)
+		}),
+	)
+}
@@ -0,0 +1,338 @@
+package handleAudio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"telegram-sr-bot/breaker"
+	"telegram-sr-bot/cache"
+	"telegram-sr-bot/chaos"
+	"telegram-sr-bot/failover"
+	"telegram-sr-bot/pending"
+	"telegram-sr-bot/quota"
+	"telegram-sr-bot/workerpool"
+)
+
+// messagesCounted returns the number of messages AudioMessageCounter
+// counted, whatever their labels.
+func messagesCounted(t *testing.T) float64 {
+	t.Helper()
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		AudioMessageCounter.Collect(metrics)
+		close(metrics)
+	}()
+	total := 0.0
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		total += m.GetCounter().GetValue()
+	}
+	return total
+}
+
+// fakeExtractor fails every extraction with err.
+type fakeExtractor struct {
+	err error
+}
+
+func (e fakeExtractor) ExtractAudio(ctx context.Context, videoPath string) (string, error) {
+	return "", e.err
+}
+
+// failingJobs is a pending job store that cannot store anything.
+type failingJobs struct {
+	pending.Store
+}
+
+func (failingJobs) Add(job pending.Job) error { return errBackend }
+
+// mountedFetcher serves a file of the local Bot API volume.
+type mountedFetcher struct {
+	path string
+}
+
+func (f mountedFetcher) Fetch(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return os.Open(f.path)
+}
+
+// videoMessage returns a video of duration, or a video note if note is set.
+func videoMessage(duration time.Duration, note bool) *tgbotapi.Message {
+	message := voiceMessage(duration)
+	message.Voice = nil
+	if note {
+		message.VideoNote = &tgbotapi.VideoNote{FileID: "file", FileUniqueID: "unique", Duration: int(duration / time.Second), FileSize: len(oggHead)}
+	} else {
+		message.Video = &tgbotapi.Video{FileID: "file", FileUniqueID: "unique", Duration: int(duration / time.Second), FileSize: len(oggHead)}
+	}
+	return message
+}
+
+// TestHandlerAccountsForEveryMessage drives the handler down each of its
+// return paths and checks that the message is counted exactly once, under
+// the outcome of that path, and that the worker running it is released.
+func TestHandlerAccountsForEveryMessage(t *testing.T) {
+	mountedFile := filepath.Join(t.TempDir(), "voice.ogg")
+	if err := os.WriteFile(mountedFile, oggHead, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Telegram reports a size within the limit the download exceeds
+	underreported := voiceMessage(5 * time.Second)
+	underreported.Voice.FileSize = len(oggHead) - 1
+
+	cases := []struct {
+		name       string
+		setup      func(t *testing.T)
+		fetcher    TelegramFileFetcher
+		recognizer *fakeRecognizer
+		message    *tgbotapi.Message
+		status     string
+	}{
+		{
+			name:       "transcribed",
+			recognizer: &fakeRecognizer{result: recognized("hello")},
+			status:     "success",
+		},
+		{
+			name:       "transcribed from a mounted file",
+			fetcher:    mountedFetcher{mountedFile},
+			recognizer: &fakeRecognizer{result: recognized("hello")},
+			status:     "success",
+		},
+		{
+			name: "answered from the cache",
+			setup: func(t *testing.T) {
+				lru := cache.NewLRU(10, time.Hour)
+				if err := lru.Add(context.Background(), "unique/", cache.Result{Language: "en", Text: "cached"}); err != nil {
+					t.Fatal(err)
+				}
+				setVar(t, &Cache, cache.Cache(lru))
+			},
+			recognizer: &fakeRecognizer{},
+			status:     "success",
+		},
+		{
+			name:       "no speech",
+			recognizer: &fakeRecognizer{result: recognized("[SILENCE]")},
+			status:     "empty_result",
+		},
+		{
+			name:       "no audio",
+			recognizer: &fakeRecognizer{},
+			message:    &tgbotapi.Message{MessageID: 10, From: &tgbotapi.User{ID: 7}, Chat: &tgbotapi.Chat{ID: 7, Type: "private"}},
+			status:     "error",
+		},
+		{
+			name:       "video note too long",
+			recognizer: &fakeRecognizer{},
+			message:    videoMessage(2*time.Minute, true),
+			status:     "rejected_too_large",
+		},
+		{
+			name:       "videos disabled",
+			setup:      func(t *testing.T) { setVar(t, &Extractor, AudioExtractor(nil)) },
+			recognizer: &fakeRecognizer{},
+			message:    videoMessage(time.Minute, false),
+			status:     "error",
+		},
+		{
+			name:       "reported too large",
+			setup:      func(t *testing.T) { setVar(t, &MaxAudioBytes, 1) },
+			recognizer: &fakeRecognizer{},
+			status:     "rejected_too_large",
+		},
+		{
+			name:       "too long",
+			setup:      func(t *testing.T) { setVar(t, &MaxAudioDuration, time.Second) },
+			recognizer: &fakeRecognizer{},
+			status:     "rejected_too_large",
+		},
+		{
+			name: "circuit open",
+			setup: func(t *testing.T) {
+				circuit := breaker.New(1, time.Minute, time.Hour)
+				ticket, _ := circuit.Allow(time.Now())
+				circuit.Done(ticket, breaker.Failure, time.Now())
+				setVar(t, &Circuit, circuit)
+			},
+			recognizer: &fakeRecognizer{},
+			status:     "circuit_open",
+		},
+		{
+			name:       "over quota",
+			setup:      func(t *testing.T) { setVar(t, &Quota, quota.New(quota.NewMemory(), time.Second, nil)) },
+			recognizer: &fakeRecognizer{},
+			status:     "quota_exceeded",
+		},
+		{
+			name:       "download failed",
+			fetcher:    fakeFetcher{err: errBackend},
+			recognizer: &fakeRecognizer{},
+			status:     "error",
+		},
+		{
+			name:       "downloaded too large",
+			setup:      func(t *testing.T) { setVar(t, &MaxAudioBytes, int64(len(oggHead)-1)) },
+			recognizer: &fakeRecognizer{},
+			message:    underreported,
+			status:     "rejected_too_large",
+		},
+		{
+			name: "no temp file",
+			setup: func(t *testing.T) {
+				setVar(t, &InMemoryUploadLimit, 0)
+				t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+			},
+			recognizer: &fakeRecognizer{},
+			status:     "error",
+		},
+		{
+			name:       "extraction failed",
+			setup:      func(t *testing.T) { setVar(t, &Extractor, AudioExtractor(fakeExtractor{errBackend})) },
+			recognizer: &fakeRecognizer{},
+			message:    videoMessage(time.Minute, false),
+			status:     "error",
+		},
+		{
+			name: "job not stored",
+			setup: func(t *testing.T) {
+				receiver, err := NewCallbackReceiver("https://bot.example/callback", "secret", failingJobs{}, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				setVar(t, &Callbacks, receiver)
+			},
+			recognizer: &fakeRecognizer{},
+			status:     "error",
+		},
+		{
+			name: "accepted",
+			setup: func(t *testing.T) {
+				receiver, err := NewCallbackReceiver("https://bot.example/callback", "secret", pending.NewMemory(), time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				setVar(t, &Callbacks, receiver)
+			},
+			recognizer: &fakeRecognizer{result: RecognitionResult{Accepted: true}},
+			status:     "accepted",
+		},
+		{
+			name:       "bad response",
+			recognizer: &fakeRecognizer{err: fmt.Errorf("%w: truncated", errBadResponse)},
+			status:     "error",
+		},
+		{
+			name:       "credentials refused",
+			recognizer: &fakeRecognizer{err: &statusError{code: http.StatusUnauthorized, status: "401 Unauthorized"}},
+			status:     "auth_failed",
+		},
+		{
+			name:       "rejected by the backend",
+			recognizer: &fakeRecognizer{err: &statusError{code: http.StatusUnprocessableEntity, status: "422 Unprocessable Entity", message: "corrupt audio"}},
+			status:     "error",
+		},
+		{
+			name:       "backend down",
+			recognizer: &fakeRecognizer{err: errBackend},
+			status:     "error",
+		},
+		{
+			name:       "timed out",
+			recognizer: &fakeRecognizer{err: context.DeadlineExceeded},
+			status:     "timeout",
+		},
+		{
+			name:       "cancelled",
+			recognizer: &fakeRecognizer{err: context.Canceled},
+			status:     "error",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.setup != nil {
+				c.setup(t)
+			}
+			fetcher := c.fetcher
+			if fetcher == nil {
+				fetcher = fakeFetcher{audio: oggHead}
+			}
+			message := c.message
+			if message == nil {
+				message = voiceMessage(5 * time.Second)
+			}
+			source := "unknown"
+			if s, ok := ExtractAudioSource(message); ok {
+				source = s.Kind
+			}
+			handler, _ := newTestHandler(fetcher, c.recognizer)
+
+			total, outcome := messagesCounted(t), countOf(c.status, source)
+			pool := workerpool.New(context.Background(), 1, 1)
+			pool.Submit(func(ctx context.Context) { handler.Handle(ctx, message, message) })
+			pool.Shutdown(context.Background())
+
+			if got := messagesCounted(t) - total; got != 1 {
+				t.Errorf("message counted %v times, want once", got)
+			}
+			if got := countOf(c.status, source) - outcome; got != 1 {
+				t.Errorf("message not counted as %s", c.status)
+			}
+			if got := testutil.ToFloat64(workerpool.InFlight); got != 0 {
+				t.Errorf("%v handlers still in flight", got)
+			}
+			if got := testutil.ToFloat64(workerpool.QueueDepth); got != 0 {
+				t.Errorf("%v handlers still queued", got)
+			}
+		})
+	}
+}
+
+// TestHandlerAccountsForInjectedFaults fails the real recognizer at each of
+// its chaos injection points, checking that the message is counted once.
+func TestHandlerAccountsForInjectedFaults(t *testing.T) {
+	setVar(t, &UploadAttempts, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"recognized_text": "hello", "detected_language": "en"}`)
+	}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		stage  string
+		status string
+	}{
+		{"none", "success"},
+		{"upload", "error"},
+		{"decode", "error"},
+	} {
+		t.Run(c.stage, func(t *testing.T) {
+			setVar(t, &Chaos, chaos.Injector(chaos.New(map[string][]chaos.Rule{c.stage: {{Probability: 1, Error: true, StatusCode: 500}}}, time.Hour)))
+			backends := failover.New([]string{server.URL}, failover.InOrder, 100, time.Minute)
+			handler, _ := newTestHandler(fakeFetcher{audio: oggHead}, NewHTTPRecognizer(backends, server.Client()))
+			message := voiceMessage(5 * time.Second)
+
+			total, outcome := messagesCounted(t), countOf(c.status, "voice")
+			handler.Handle(context.Background(), message, message)
+			if got := messagesCounted(t) - total; got != 1 {
+				t.Errorf("message counted %v times, want once", got)
+			}
+			if got := countOf(c.status, "voice") - outcome; got != 1 {
+				t.Errorf("message not counted as %s", c.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package handleAudio
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	latencySamplesPerBucket = 100
+	minSamplesForTuning     = 20
+	// latencyHeadroom is how far above the observed p95 latency the
+	// timeout of a bucket is tuned to sit.
+	latencyHeadroom = 1.5
+)
+
+// durationBuckets are the upper bounds of the audio duration buckets used to
+// group latency samples; the last bucket is open-ended.
+var durationBuckets = []struct {
+	name  string
+	upper time.Duration
+}{
+	{"lt_30s", 30 * time.Second},
+	{"lt_2m", 2 * time.Minute},
+	{"lt_10m", 10 * time.Minute},
+	{"ge_10m", time.Duration(math.MaxInt64)},
+}
+
+func durationBucket(duration time.Duration) int {
+	for i, b := range durationBuckets {
+		if duration < b.upper {
+			return i
+		}
+	}
+	return len(durationBuckets) - 1
+}
+
+type latencySample struct {
+	duration time.Duration
+	latency  time.Duration
+}
+
+// AdaptiveTimeout derives the recognition upload timeout from the declared
+// audio duration as base + factor × duration, clamped to [min, max]. The
+// factor is tuned from the p95 backend latency observed per duration
+// bucket and kept within [factor/2, factor×4] of its configured value.
+type AdaptiveTimeout struct {
+	base, min, max       time.Duration
+	minFactor, maxFactor float64
+
+	mu      sync.Mutex
+	factor  float64
+	samples [][]latencySample
+	next    []int
+}
+
+func NewAdaptiveTimeout(base time.Duration, factor float64, min, max time.Duration) *AdaptiveTimeout {
+	return &AdaptiveTimeout{
+		base:      base,
+		min:       min,
+		max:       max,
+		factor:    factor,
+		minFactor: factor / 2,
+		maxFactor: factor * 4,
+		samples:   make([][]latencySample, len(durationBuckets)),
+		next:      make([]int, len(durationBuckets)),
+	}
+}
+
+// Timeout returns the upload timeout for audio of the given declared
+// duration and the name of its duration bucket. Unknown (zero) durations get
+// the maximum timeout.
+func (a *AdaptiveTimeout) Timeout(duration time.Duration) (time.Duration, string) {
+	bucket := durationBuckets[durationBucket(duration)].name
+	if duration <= 0 {
+		return a.max, bucket
+	}
+	a.mu.Lock()
+	factor := a.factor
+	a.mu.Unlock()
+	return a.clamp(a.base + time.Duration(factor*float64(duration))), bucket
+}
+
+func (a *AdaptiveTimeout) clamp(timeout time.Duration) time.Duration {
+	return min(max(timeout, a.min), a.max)
+}
+
+// Observe records the backend latency of a successful upload and retunes
+// the factor.
+func (a *AdaptiveTimeout) Observe(duration, latency time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := durationBucket(duration)
+	sample := latencySample{duration, latency}
+	if len(a.samples[i]) < latencySamplesPerBucket {
+		a.samples[i] = append(a.samples[i], sample)
+	} else {
+		a.samples[i][a.next[i]] = sample
+		a.next[i] = (a.next[i] + 1) % latencySamplesPerBucket
+	}
+
+	factor := a.tunedFactor()
+	if factor == 0 || math.Abs(factor-a.factor)/a.factor < 0.05 {
+		return
+	}
+	log.Info().Float64("previous_factor", a.factor).Float64("factor", factor).Msg("Adjusted upload timeout factor")
+	a.factor = factor
+}
+
+// tunedFactor returns the smallest factor that keeps the timeout of every
+// sufficiently sampled bucket at latencyHeadroom × its p95 latency, or 0
+// when no bucket has enough samples yet.
+func (a *AdaptiveTimeout) tunedFactor() float64 {
+	var factor float64
+	tuned := false
+	for _, samples := range a.samples {
+		if len(samples) < minSamplesForTuning {
+			continue
+		}
+		latencies := make([]time.Duration, len(samples))
+		var totalDuration time.Duration
+		for i, s := range samples {
+			latencies[i] = s.latency
+			totalDuration += s.duration
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		p95 := latencies[int(math.Ceil(0.95*float64(len(latencies))))-1]
+		meanDuration := totalDuration / time.Duration(len(samples))
+
+		needed := (latencyHeadroom*float64(p95) - float64(a.base)) / float64(meanDuration)
+		factor = max(factor, needed)
+		tuned = true
+	}
+	if !tuned {
+		return 0
+	}
+	return min(max(factor, a.minFactor), a.maxFactor)
+}
@@ -0,0 +1,64 @@
+package handleAudio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveTimeoutFollowsTheDeclaredDuration(t *testing.T) {
+	timeouts := NewAdaptiveTimeout(10*time.Second, 1, 15*time.Second, 10*time.Minute)
+	for _, c := range []struct {
+		duration time.Duration
+		timeout  time.Duration
+		bucket   string
+	}{
+		{2 * time.Second, 15 * time.Second, "lt_30s"},
+		{20 * time.Second, 30 * time.Second, "lt_30s"},
+		{time.Minute, 70 * time.Second, "lt_2m"},
+		{5 * time.Minute, 310 * time.Second, "lt_10m"},
+		{time.Hour, 10 * time.Minute, "ge_10m"},
+		// Without a declared duration only the maximum is safe
+		{0, 10 * time.Minute, "lt_30s"},
+	} {
+		timeout, bucket := timeouts.Timeout(c.duration)
+		if timeout != c.timeout || bucket != c.bucket {
+			t.Errorf("Timeout(%s) = %s, %s; want %s, %s", c.duration, timeout, bucket, c.timeout, c.bucket)
+		}
+	}
+}
+
+func TestAdaptiveTimeoutTunesTheFactorToTheLatency(t *testing.T) {
+	timeouts := NewAdaptiveTimeout(10*time.Second, 1, 15*time.Second, 10*time.Minute)
+	for i := 0; i < minSamplesForTuning-1; i++ {
+		timeouts.Observe(time.Minute, 30*time.Second)
+	}
+	if timeout, _ := timeouts.Timeout(time.Minute); timeout != 70*time.Second {
+		t.Fatalf("Timeout = %s tuned before enough samples", timeout)
+	}
+
+	timeouts.Observe(time.Minute, 30*time.Second)
+	// 1.5 × the 30 s p95, so a factor of 35/60
+	if timeout, _ := timeouts.Timeout(time.Minute); timeout < 44*time.Second || timeout > 46*time.Second {
+		t.Errorf("Timeout = %s, want about 45s once tuned", timeout)
+	}
+}
+
+func TestAdaptiveTimeoutKeepsTheFactorInBounds(t *testing.T) {
+	for _, c := range []struct {
+		latency time.Duration
+		timeout time.Duration
+	}{
+		// A factor of 4 at most
+		{time.Hour, 250 * time.Second},
+		// And of 1/2 at least
+		{time.Millisecond, 40 * time.Second},
+	} {
+		timeouts := NewAdaptiveTimeout(10*time.Second, 1, 15*time.Second, 10*time.Minute)
+		for i := 0; i < minSamplesForTuning; i++ {
+			timeouts.Observe(time.Minute, c.latency)
+		}
+		if timeout, _ := timeouts.Timeout(time.Minute); timeout != c.timeout {
+			t.Errorf("latency %s: Timeout = %s, want %s", c.latency, timeout, c.timeout)
+		}
+	}
+}
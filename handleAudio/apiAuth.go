@@ -0,0 +1,51 @@
+package handleAudio
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// APIAuth, when set, authenticates every request to the recognition
+// backend; nil sends no credentials.
+var APIAuth *Credentials
+
+// Credentials is the header carrying the API token. The token is kept out
+// of logs and spans, it only ever goes into the request.
+type Credentials struct {
+	header string
+	value  string
+}
+
+// NewCredentials sends token in header, as "Bearer <token>" when header is
+// Authorization or empty and as is otherwise.
+func NewCredentials(token, header string) *Credentials {
+	if header == "" || strings.EqualFold(header, "Authorization") {
+		return &Credentials{header: "Authorization", value: "Bearer " + token}
+	}
+	return &Credentials{header: header, value: token}
+}
+
+// apply sets the credentials on h, a nil c leaves it alone.
+func (c *Credentials) apply(h http.Header) {
+	if c != nil {
+		h.Set(c.header, c.value)
+	}
+}
+
+// applyMetadata sets the credentials on the metadata of a gRPC call, a nil
+// c leaves it alone.
+func (c *Credentials) applyMetadata(md metadata.MD) {
+	if c != nil {
+		md.Set(c.header, c.value)
+	}
+}
+
+// authFailed reports whether the backend, or the proxy in front of it,
+// turned the credentials down.
+func authFailed(err error) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && (statusErr.code == http.StatusUnauthorized || statusErr.code == http.StatusForbidden)
+}
@@ -0,0 +1,89 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"telegram-sr-bot/failover"
+	"telegram-sr-bot/messages"
+)
+
+func TestNewCredentials(t *testing.T) {
+	for _, c := range []struct {
+		header, wantHeader, wantValue string
+	}{
+		{"", "Authorization", "Bearer secret"},
+		{"authorization", "Authorization", "Bearer secret"},
+		{"X-API-Key", "X-Api-Key", "secret"},
+	} {
+		h := make(http.Header)
+		NewCredentials("secret", c.header).apply(h)
+		if got := h.Get(c.wantHeader); got != c.wantValue || len(h) != 1 {
+			t.Errorf("header %q: sent %v, want %s: %s", c.header, h, c.wantHeader, c.wantValue)
+		}
+	}
+
+	md := metadata.MD{}
+	NewCredentials("secret", "").applyMetadata(md)
+	if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer secret" {
+		t.Errorf("metadata %v", md)
+	}
+
+	var none *Credentials
+	h, md := make(http.Header), metadata.MD{}
+	none.apply(h)
+	none.applyMetadata(md)
+	if len(h) != 0 || len(md) != 0 {
+		t.Errorf("no credentials sent %v and %v", h, md)
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	for err, want := range map[error]bool{
+		&statusError{code: http.StatusUnauthorized}:                        true,
+		fmt.Errorf("upload: %w", &statusError{code: http.StatusForbidden}): true,
+		&statusError{code: http.StatusUnprocessableEntity}:                 false,
+		errBackend: false,
+	} {
+		if got := authFailed(err); got != want {
+			t.Errorf("authFailed(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestRecognizeSendsTheCredentials(t *testing.T) {
+	setVar(t, &APIAuth, NewCredentials("secret", ""))
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"recognized_text": "hello", "detected_language": "en"}`)
+	}))
+	defer server.Close()
+
+	backends := failover.New([]string{server.URL}, failover.InOrder, 100, time.Minute)
+	if _, err := NewHTTPRecognizer(backends, server.Client()).Recognize(context.Background(), bytes.NewReader(oggHead), RecognitionRequest{Filename: "voice.ogg"}); err != nil {
+		t.Fatal(err)
+	}
+	if got != "Bearer secret" {
+		t.Errorf("backend got Authorization %q", got)
+	}
+}
+
+func TestRefusedCredentialsAreNotTheUsersFault(t *testing.T) {
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{err: &statusError{code: http.StatusForbidden, status: "403 Forbidden"}})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	want := messages.For("en").Get(messages.ServiceUnavailable)
+	if texts := bot.texts(); len(texts) != 1 || texts[0] != want {
+		t.Errorf("user told %q, want %q", texts, want)
+	}
+}
@@ -0,0 +1,209 @@
+package handleAudio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"telegram-sr-bot/sanitize"
+)
+
+// AsyncMode makes the recognizer accept a job ID in place of the
+// transcription: the backend answers the upload with 202 and the result is
+// polled from the result URL next to the upload endpoint.
+var AsyncMode bool
+
+// AsyncPollInterval is how often a job is polled.
+var AsyncPollInterval = 2 * time.Second
+
+// AsyncTimeout bounds how long a job is waited for once it was accepted.
+var AsyncTimeout = 10 * time.Minute
+
+// asyncProgressInterval is how often the time spent waiting is reported.
+const asyncProgressInterval = 15 * time.Second
+
+var AsyncJobCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "recognition_async_jobs_total",
+		Help: "Total number of awaited asynchronous recognition jobs.",
+	},
+	[]string{"outcome"}, // Outcome can be "success", "failed", "not_found", "timeout", "canceled" or "error"
+)
+
+// recognitionTimeout bounds the handling of a message, jobs get to wait on
+// top of the usual deadline.
+func recognitionTimeout() time.Duration {
+	if AsyncMode {
+		return RecognitionTimeout + AsyncTimeout
+	}
+	return RecognitionTimeout
+}
+
+// acceptedJob is the body of a 202 answer to an upload.
+type acceptedJob struct {
+	ID string `json:"job_id"`
+}
+
+// jobStatus is the body of a result poll. The transcription is only set
+// once the job is done.
+type jobStatus struct {
+	Status string `json:"status"` // "queued", "processing", "done" or "failed"
+	Error  string `json:"error"`
+	RecognitionSuccess
+}
+
+// jobError is a job that ended without a transcription, with the sanitized
+// explanation of the backend if it gave one.
+type jobError struct {
+	id      string
+	state   string // "failed" or "not_found"
+	message string
+}
+
+func (e *jobError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("recognition job %s %s: %s", e.id, e.state, e.message)
+	}
+	return fmt.Sprintf("recognition job %s %s", e.id, e.state)
+}
+
+// awaitJob polls the job accepted answers until it is done, filling in
+// result. req.Progress, if set, is told how long it has been every
+// asyncProgressInterval.
+func (r *HTTPRecognizer) awaitJob(ctx context.Context, accepted *http.Response, req RecognitionRequest, result *RecognitionResult) error {
+	var job acceptedJob
+	if err := decodeRecognitionResponse(accepted, &job); err != nil {
+		AsyncJobCounter.With(prometheus.Labels{"outcome": "error"}).Inc()
+		return fmt.Errorf("%w: %w", errBadResponse, err)
+	}
+	if job.ID == "" {
+		AsyncJobCounter.With(prometheus.Labels{"outcome": "error"}).Inc()
+		return fmt.Errorf("%w: no job ID", errBadResponse)
+	}
+	resultURL, err := r.resultURL(result.Endpoint, job.ID)
+	if err != nil {
+		AsyncJobCounter.With(prometheus.Labels{"outcome": "error"}).Inc()
+		return err
+	}
+
+	ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "await recognition job",
+		trace.WithAttributes(attribute.String("job.id", job.ID)))
+	defer span.End()
+	pollCtx, cancel := context.WithTimeout(ctx, AsyncTimeout)
+	defer cancel()
+
+	start := time.Now()
+	poll := time.NewTicker(AsyncPollInterval)
+	defer poll.Stop()
+	progress := time.NewTicker(asyncProgressInterval)
+	defer progress.Stop()
+	// expired gives up on the job once time is up
+	expired := func() error {
+		outcome := "timeout"
+		err := fmt.Errorf("recognition job %s not done after %s: %w", job.ID, AsyncTimeout, context.DeadlineExceeded)
+		if ctx.Err() != nil {
+			// Shutting down, or the handler ran out of time
+			outcome, err = "canceled", fmt.Errorf("waiting for recognition job %s: %w", job.ID, ctx.Err())
+		}
+		AsyncJobCounter.With(prometheus.Labels{"outcome": outcome}).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Job not done")
+		return err
+	}
+	for polls := 1; ; {
+		select {
+		case <-pollCtx.Done():
+			return expired()
+		case <-progress.C:
+			if req.Progress != nil {
+				req.Progress(time.Since(start))
+			}
+		case <-poll.C:
+			done, err := r.pollJob(pollCtx, resultURL, job.ID, result)
+			span.SetAttributes(attribute.Int("job.polls", polls))
+			polls++
+			if err != nil && pollCtx.Err() != nil {
+				return expired()
+			}
+			if !done {
+				if err != nil {
+					// Transient, the job itself may still finish
+					span.AddEvent("poll failed", trace.WithAttributes(attribute.String("error", err.Error())))
+				}
+				continue
+			}
+			outcome := "success"
+			var jobErr *jobError
+			switch {
+			case errors.As(err, &jobErr):
+				outcome = jobErr.state
+			case err != nil:
+				outcome = "error"
+			}
+			AsyncJobCounter.With(prometheus.Labels{"outcome": outcome}).Inc()
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "Job failed")
+			}
+			return err
+		}
+	}
+}
+
+// resultURL is where the result of job id is polled, "result/<id>" next to
+// the upload endpoint that accepted it.
+func (r *HTTPRecognizer) resultURL(uploadEndpoint, id string) (string, error) {
+	endpoint, err := url.Parse(uploadEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("parse recognition endpoint: %w", err)
+	}
+	return endpoint.ResolveReference(&url.URL{Path: "result/" + url.PathEscape(id)}).String(), nil
+}
+
+// pollJob asks for the state of job id once, reporting whether the job is
+// over. Errors of unfinished polls are transient.
+func (r *HTTPRecognizer) pollJob(ctx context.Context, resultURL, id string, result *RecognitionResult) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resultURL, nil)
+	if err != nil {
+		return true, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	APIAuth.apply(req.Header)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		_, retryable := retryReason(err)
+		return !retryable, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return true, &jobError{id: id, state: "not_found"}
+	case resp.StatusCode != http.StatusOK:
+		return !retryableStatus(resp.StatusCode), newStatusError(resp)
+	}
+
+	var status jobStatus
+	if err := decodeRecognitionResponse(resp, &status); err != nil {
+		return true, fmt.Errorf("%w: %w", errBadResponse, err)
+	}
+	switch status.Status {
+	case "done":
+		result.RecognitionSuccess = status.RecognitionSuccess
+		if model := modelInfoFromHeader(resp.Header); model.Name != unknownModel {
+			result.Model = model
+		}
+		return true, nil
+	case "failed":
+		return true, &jobError{id: id, state: "failed", message: sanitize.String(status.Error, sanitize.LogField)}
+	}
+	return false, nil
+}
@@ -0,0 +1,127 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/failover"
+)
+
+// jobBackend accepts uploads as job "j1" and answers its polls with the
+// given statuses and bodies in turn, repeating the last one.
+type jobBackend struct {
+	mu      sync.Mutex
+	answers []jobAnswer
+	polls   int
+}
+
+type jobAnswer struct {
+	status int
+	body   string
+}
+
+func (b *jobBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost && r.URL.Path == "/recognize" {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"job_id": "j1"}`)
+		return
+	}
+	if r.URL.Path != "/result/j1" {
+		http.NotFound(w, r)
+		return
+	}
+	b.mu.Lock()
+	answer := b.answers[min(b.polls, len(b.answers)-1)]
+	b.polls++
+	b.mu.Unlock()
+	w.WriteHeader(answer.status)
+	io.WriteString(w, answer.body)
+}
+
+// recognizeJob uploads to a backend answering polls with answers,
+// returning the result and how often the job was polled.
+func recognizeJob(t *testing.T, answers ...jobAnswer) (RecognitionResult, int, error) {
+	t.Helper()
+	setVar(t, &AsyncMode, true)
+	setVar(t, &AsyncPollInterval, time.Millisecond)
+	backend := &jobBackend{answers: answers}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	backends := failover.New([]string{server.URL + "/recognize"}, failover.InOrder, 100, time.Minute)
+	result, err := NewHTTPRecognizer(backends, server.Client()).Recognize(context.Background(), bytes.NewReader(oggHead), RecognitionRequest{Filename: "voice.ogg"})
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	return result, backend.polls, err
+}
+
+func TestAwaitJobPollsUntilDone(t *testing.T) {
+	result, polls, err := recognizeJob(t,
+		jobAnswer{http.StatusOK, `{"status": "queued"}`},
+		jobAnswer{http.StatusServiceUnavailable, `overloaded`},
+		jobAnswer{http.StatusOK, `{"status": "processing"}`},
+		jobAnswer{http.StatusOK, `{"status": "done", "recognized_text": "hello", "detected_language": "en"}`},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RecognizedText != "hello" || result.DetectedLang != "en" {
+		t.Errorf("recognized %+v", result)
+	}
+	if polls != 4 {
+		t.Errorf("%d polls, want 4 with the transient failure retried", polls)
+	}
+}
+
+func TestAwaitJobReportsFailedJobs(t *testing.T) {
+	_, _, err := recognizeJob(t, jobAnswer{http.StatusOK, `{"status": "failed", "error": "bad audio\nat line 2"}`})
+	var jobErr *jobError
+	if !errors.As(err, &jobErr) || jobErr.state != "failed" {
+		t.Fatalf("err = %v, want the job failed", err)
+	}
+	if jobErr.message != "bad audio at line 2" {
+		t.Errorf("message %q not sanitized for the log", jobErr.message)
+	}
+
+	_, polls, err := recognizeJob(t, jobAnswer{http.StatusNotFound, `{}`})
+	if !errors.As(err, &jobErr) || jobErr.state != "not_found" || polls != 1 {
+		t.Errorf("err = %v after %d polls, want the job not found at once", err, polls)
+	}
+
+	_, polls, err = recognizeJob(t, jobAnswer{http.StatusBadRequest, `bad request`})
+	if err == nil || polls != 1 {
+		t.Errorf("err = %v after %d polls, want a permanent failure ending the poll", err, polls)
+	}
+}
+
+func TestAwaitJobGivesUp(t *testing.T) {
+	setVar(t, &AsyncTimeout, 20*time.Millisecond)
+	_, polls, err := recognizeJob(t, jobAnswer{http.StatusOK, `{"status": "processing"}`})
+	if !errors.Is(err, context.DeadlineExceeded) || polls == 0 {
+		t.Errorf("err = %v after %d polls, want a timeout", err, polls)
+	}
+}
+
+func TestAwaitJobNeedsAJobID(t *testing.T) {
+	setVar(t, &AsyncMode, true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	backends := failover.New([]string{server.URL}, failover.InOrder, 100, time.Minute)
+	_, err := NewHTTPRecognizer(backends, server.Client()).Recognize(context.Background(), bytes.NewReader(oggHead), RecognitionRequest{Filename: "voice.ogg"})
+	if !errors.Is(err, errBadResponse) {
+		t.Errorf("err = %v, want a bad response", err)
+	}
+}
@@ -0,0 +1,231 @@
+package handleAudio
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/sanitize"
+)
+
+// AudioSource is the normalized description of the audio carried by a
+// message, whatever Telegram attachment type it arrived as. Its
+// user-controlled strings are sanitized once extracted.
+type AudioSource struct {
+	Kind           string
+	FileID         string
+	FileUniqueID   string
+	FileName       string
+	MimeType       string
+	FileSize       int64
+	Duration       time.Duration
+	Caption        string
+	NeedsTranscode bool
+}
+
+// sourceExtractor builds the AudioSource of a message it knows how to
+// handle, reporting false for any other message.
+type sourceExtractor func(message *tgbotapi.Message) (AudioSource, bool)
+
+// sourceExtractors are consulted in order; the first match wins.
+var sourceExtractors = []sourceExtractor{
+	voiceSource,
+	audioFileSource,
+	videoNoteSource,
+	videoSource,
+	documentSource,
+}
+
+// MaxAudioBytes and MaxAudioDuration bound the audio that is accepted, zero
+// leaves the limit off.
+var (
+	MaxAudioBytes    int64 = 20 << 20
+	MaxAudioDuration time.Duration
+)
+
+// limits returns the largest size and duration accepted for s. Only videos
+// are downloaded for their audio to be extracted; video notes and audio
+// documents are uploaded as they are, like audio, so its limits apply to
+// them, video notes being capped by MaxVideoNoteDuration besides.
+func (s AudioSource) limits() (int64, time.Duration) {
+	switch s.Kind {
+	case "video":
+		return MaxVideoBytes, MaxVideoDuration
+	default: // "voice", "audio", "video_note" and "document"
+		return MaxAudioBytes, MaxAudioDuration
+	}
+}
+
+// defaultUploadExt is used when the extension of the audio is unknown, voice
+// notes are always Ogg Opus.
+const defaultUploadExt = ".ogg"
+
+// ExtractAudioSource returns the audio carried by message, if any.
+func ExtractAudioSource(message *tgbotapi.Message) (AudioSource, bool) {
+	if message == nil {
+		return AudioSource{}, false
+	}
+	for _, extract := range sourceExtractors {
+		if source, ok := extract(message); ok {
+			source.FileName = sanitize.String(source.FileName, sanitize.FormField)
+			source.MimeType = sanitize.String(source.MimeType, sanitize.LogField)
+			source.Caption = sanitize.String(source.Caption, sanitize.Text)
+			return source, true
+		}
+	}
+	return AudioSource{}, false
+}
+
+func voiceSource(message *tgbotapi.Message) (AudioSource, bool) {
+	voice := message.Voice
+	if voice == nil || voice.FileID == "" {
+		return AudioSource{}, false
+	}
+	return AudioSource{
+		Kind:         "voice",
+		FileID:       voice.FileID,
+		FileUniqueID: voice.FileUniqueID,
+		MimeType:     voice.MimeType,
+		FileSize:     int64(voice.FileSize),
+		Duration:     time.Duration(voice.Duration) * time.Second,
+		Caption:      message.Caption,
+	}, true
+}
+
+func audioFileSource(message *tgbotapi.Message) (AudioSource, bool) {
+	audio := message.Audio
+	if audio == nil || audio.FileID == "" {
+		return AudioSource{}, false
+	}
+	return AudioSource{
+		Kind:         "audio",
+		FileID:       audio.FileID,
+		FileUniqueID: audio.FileUniqueID,
+		FileName:     audio.FileName,
+		MimeType:     audio.MimeType,
+		FileSize:     int64(audio.FileSize),
+		Duration:     time.Duration(audio.Duration) * time.Second,
+		Caption:      message.Caption,
+	}, true
+}
+
+// videoNoteSource uploads round video messages as they are, the recognition
+// backend extracts their audio track.
+func videoNoteSource(message *tgbotapi.Message) (AudioSource, bool) {
+	videoNote := message.VideoNote
+	if videoNote == nil || videoNote.FileID == "" {
+		return AudioSource{}, false
+	}
+	return AudioSource{
+		Kind:         "video_note",
+		FileID:       videoNote.FileID,
+		FileUniqueID: videoNote.FileUniqueID,
+		MimeType:     "video/mp4",
+		FileSize:     int64(videoNote.FileSize),
+		Duration:     time.Duration(videoNote.Duration) * time.Second,
+		Caption:      message.Caption,
+	}, true
+}
+
+// videoSource needs its audio extracted first, regular videos are too large
+// to upload as they are.
+func videoSource(message *tgbotapi.Message) (AudioSource, bool) {
+	video := message.Video
+	if video == nil || video.FileID == "" {
+		return AudioSource{}, false
+	}
+	return AudioSource{
+		Kind:           "video",
+		FileID:         video.FileID,
+		FileUniqueID:   video.FileUniqueID,
+		FileName:       video.FileName,
+		MimeType:       video.MimeType,
+		FileSize:       int64(video.FileSize),
+		Duration:       time.Duration(video.Duration) * time.Second,
+		Caption:        message.Caption,
+		NeedsTranscode: true,
+	}, true
+}
+
+func documentSource(message *tgbotapi.Message) (AudioSource, bool) {
+	document := message.Document
+	if document == nil || document.FileID == "" || !isAudioMimeType(document.MimeType) {
+		return AudioSource{}, false
+	}
+	return AudioSource{
+		Kind:         "document",
+		FileID:       document.FileID,
+		FileUniqueID: document.FileUniqueID,
+		FileName:     document.FileName,
+		MimeType:     document.MimeType,
+		FileSize:     int64(document.FileSize),
+		Caption:      message.Caption,
+	}, true
+}
+
+func isAudioMimeType(mimeType string) bool {
+	return strings.HasPrefix(strings.ToLower(mimeType), "audio/")
+}
+
+// IsUnsupportedDocument reports whether message carries a document that is
+// not audio, which the bot declines instead of ignoring.
+func IsUnsupportedDocument(message *tgbotapi.Message) bool {
+	return message != nil && message.Document != nil && !isAudioMimeType(message.Document.MimeType)
+}
+
+// audioExtensions maps the audio MIME types Telegram clients commonly send
+// to extensions, mime.ExtensionsByType depends on the host's mime.types.
+var audioExtensions = map[string]string{
+	"audio/ogg":   ".ogg",
+	"audio/opus":  ".opus",
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/aac":   ".aac",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+	"audio/flac":  ".flac",
+	"audio/webm":  ".webm",
+	"video/mp4":   ".mp4",
+
+	// Types http.DetectContentType reports
+	"application/ogg": ".ogg",
+	"audio/wave":      ".wav",
+	"audio/aiff":      ".aiff",
+}
+
+// UploadName is the file name the audio is uploaded under. The recognition
+// backend picks a decoder by its extension, so the original one is kept and
+// otherwise derived from the MIME type.
+func (s AudioSource) UploadName() string {
+	name := strings.TrimSuffix(path.Base(strings.ReplaceAll(s.FileName, "\\", "/")), "/")
+	if name == "." || name == "" {
+		name = "audio"
+	}
+	if path.Ext(name) != "" {
+		return name
+	}
+	mimeType, _, _ := mime.ParseMediaType(s.MimeType)
+	if ext, ok := audioExtensions[mimeType]; ok {
+		return name + ext
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return name + exts[0]
+	}
+	return name + defaultUploadExt
+}
+
+// uploadFormat returns the file name and Content-Type the audio is uploaded
+// with. Without a MIME type from Telegram both are derived from head, the
+// start of the file, as sniffed by http.DetectContentType.
+func (s AudioSource) uploadFormat(head []byte) (string, string) {
+	if contentType, _, err := mime.ParseMediaType(s.MimeType); err == nil {
+		return s.UploadName(), contentType
+	}
+	s.MimeType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	return s.UploadName(), s.MimeType
+}
@@ -0,0 +1,136 @@
+package handleAudio
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/sanitize"
+)
+
+func TestExtractAudioSource(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		message *tgbotapi.Message
+		want    AudioSource
+	}{
+		{
+			name:    "voice",
+			message: &tgbotapi.Message{Caption: "note", Voice: &tgbotapi.Voice{FileID: "v", FileUniqueID: "uv", MimeType: "audio/ogg", FileSize: 100, Duration: 5}},
+			want:    AudioSource{Kind: "voice", FileID: "v", FileUniqueID: "uv", MimeType: "audio/ogg", FileSize: 100, Duration: 5 * time.Second, Caption: "note"},
+		},
+		{
+			name:    "audio file",
+			message: &tgbotapi.Message{Audio: &tgbotapi.Audio{FileID: "a", FileUniqueID: "ua", FileName: "talk.mp3", MimeType: "audio/mpeg", FileSize: 200, Duration: 60}},
+			want:    AudioSource{Kind: "audio", FileID: "a", FileUniqueID: "ua", FileName: "talk.mp3", MimeType: "audio/mpeg", FileSize: 200, Duration: time.Minute},
+		},
+		{
+			name:    "video note",
+			message: &tgbotapi.Message{VideoNote: &tgbotapi.VideoNote{FileID: "n", FileUniqueID: "un", FileSize: 300, Duration: 10}},
+			want:    AudioSource{Kind: "video_note", FileID: "n", FileUniqueID: "un", MimeType: "video/mp4", FileSize: 300, Duration: 10 * time.Second},
+		},
+		{
+			name:    "video",
+			message: &tgbotapi.Message{Video: &tgbotapi.Video{FileID: "m", FileUniqueID: "um", FileName: "clip.mp4", MimeType: "video/mp4", FileSize: 400, Duration: 30}},
+			want:    AudioSource{Kind: "video", FileID: "m", FileUniqueID: "um", FileName: "clip.mp4", MimeType: "video/mp4", FileSize: 400, Duration: 30 * time.Second, NeedsTranscode: true},
+		},
+		{
+			name:    "audio document",
+			message: &tgbotapi.Message{Document: &tgbotapi.Document{FileID: "d", FileUniqueID: "ud", FileName: "memo.m4a", MimeType: "Audio/MP4", FileSize: 500}},
+			want:    AudioSource{Kind: "document", FileID: "d", FileUniqueID: "ud", FileName: "memo.m4a", MimeType: "Audio/MP4", FileSize: 500},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := ExtractAudioSource(c.message)
+			if !ok || got != c.want {
+				t.Errorf("ExtractAudioSource = %+v, %v; want %+v", got, ok, c.want)
+			}
+		})
+	}
+}
+
+func TestExtractAudioSourceIgnoresOtherMessages(t *testing.T) {
+	pdf := &tgbotapi.Message{Document: &tgbotapi.Document{FileID: "d", MimeType: "application/pdf"}}
+	for name, message := range map[string]*tgbotapi.Message{
+		"nil":          nil,
+		"text":         {Text: "hello"},
+		"no file":      {Voice: &tgbotapi.Voice{}},
+		"pdf document": pdf,
+	} {
+		if source, ok := ExtractAudioSource(message); ok {
+			t.Errorf("%s: extracted %+v", name, source)
+		}
+	}
+	if !IsUnsupportedDocument(pdf) {
+		t.Error("pdf not taken for an unsupported document")
+	}
+	if IsUnsupportedDocument(&tgbotapi.Message{Document: &tgbotapi.Document{MimeType: "audio/ogg"}}) {
+		t.Error("audio document taken for an unsupported one")
+	}
+}
+
+func TestLimitsFollowTheKind(t *testing.T) {
+	setVar(t, &MaxAudioBytes, 20<<20)
+	setVar(t, &MaxAudioDuration, time.Hour)
+	setVar(t, &MaxVideoBytes, 200<<20)
+	setVar(t, &MaxVideoDuration, 2*time.Hour)
+	for kind, want := range map[string][2]int64{
+		"voice":      {20 << 20, int64(time.Hour)},
+		"audio":      {20 << 20, int64(time.Hour)},
+		"video_note": {20 << 20, int64(time.Hour)},
+		"document":   {20 << 20, int64(time.Hour)},
+		"video":      {200 << 20, int64(2 * time.Hour)},
+	} {
+		if bytes, duration := (AudioSource{Kind: kind}).limits(); bytes != want[0] || int64(duration) != want[1] {
+			t.Errorf("%s limited to %d bytes and %s", kind, bytes, duration)
+		}
+	}
+}
+
+func TestExtractAudioSourceSanitizesUserStrings(t *testing.T) {
+	message := &tgbotapi.Message{
+		Caption: "first\nsecond\x1b[2J",
+		Audio: &tgbotapi.Audio{
+			FileID:   "a",
+			FileName: "talk\x00‮.mp3" + strings.Repeat("x", 2000),
+			MimeType: "audio/mpeg\r\n",
+		},
+	}
+	source, _ := ExtractAudioSource(message)
+	if !strings.HasPrefix(source.FileName, "talk.mp3") || !strings.HasSuffix(source.FileName, sanitize.TruncationMarker) {
+		t.Errorf("file name %q is not sanitized", source.FileName)
+	}
+	if source.MimeType != "audio/mpeg " {
+		t.Errorf("MIME type %q is not sanitized", source.MimeType)
+	}
+	if source.Caption != "first\nsecond" {
+		t.Errorf("caption %q is not sanitized", source.Caption)
+	}
+}
+
+func TestUploadFormat(t *testing.T) {
+	mp3Head := append([]byte("ID3\x03\x00\x00\x00"), make([]byte, 32)...)
+	for _, c := range []struct {
+		name        string
+		source      AudioSource
+		head        []byte
+		filename    string
+		contentType string
+	}{
+		{"voice", AudioSource{Kind: "voice", MimeType: "audio/ogg"}, oggHead, "audio.ogg", "audio/ogg"},
+		{"named file", AudioSource{FileName: "talk.MP3", MimeType: "audio/mpeg"}, mp3Head, "talk.MP3", "audio/mpeg"},
+		{"parameters dropped", AudioSource{FileName: "memo", MimeType: "audio/ogg; codecs=opus"}, oggHead, "memo.ogg", "audio/ogg"},
+		{"path in the name", AudioSource{FileName: `C:\Users\me\rec.m4a`, MimeType: "audio/mp4"}, nil, "rec.m4a", "audio/mp4"},
+		// Without a MIME type from Telegram the content decides
+		{"sniffed ogg", AudioSource{}, oggHead, "audio.ogg", "application/ogg"},
+		{"sniffed mp3", AudioSource{FileName: "memo"}, mp3Head, "memo.mp3", "audio/mpeg"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			filename, contentType := c.source.uploadFormat(c.head)
+			if filename != c.filename || contentType != c.contentType {
+				t.Errorf("uploadFormat = %s, %s; want %s, %s", filename, contentType, c.filename, c.contentType)
+			}
+		})
+	}
+}
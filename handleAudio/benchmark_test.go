@@ -0,0 +1,160 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/failover"
+)
+
+// The payload sizes every stage is benchmarked with, named the way
+// benchstat groups them.
+var benchmarkSizes = []struct {
+	name string
+	size int
+}{
+	{"size=100KB", 100 << 10},
+	{"size=5MB", 5 << 20},
+	{"size=50MB", 50 << 20},
+}
+
+// payload returns size bytes of synthetic audio.
+func payload(size int) []byte {
+	data := bytes.Repeat([]byte{0x5a}, size)
+	copy(data, oggHead)
+	return data
+}
+
+// download hides bytes.Reader's WriterTo, so it is copied like a response
+// body.
+type download struct {
+	io.Reader
+}
+
+// liveHeap returns the bytes reachable on the heap. The first collection
+// runs the finalizers of garbage, the second one frees it.
+func liveHeap() int64 {
+	runtime.GC()
+	runtime.GC()
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	return int64(sample[0].Value.Uint64())
+}
+
+// reportLive runs stage once more outside the timing and reports as live-B
+// how much of the heap the value it returns keeps alive, the buffer the
+// stage holds on to for the rest of the handling.
+func reportLive(b *testing.B, stage func() any) {
+	b.StopTimer()
+	before := liveHeap()
+	kept := stage()
+	live := liveHeap() - before
+	if closer, ok := kept.(io.Closer); ok {
+		closer.Close()
+	}
+	// The payload stage closes over must not be freed while measuring
+	runtime.KeepAlive(stage)
+	runtime.KeepAlive(kept)
+	b.ReportMetric(float64(max(live, 0)), "live-B")
+}
+
+func BenchmarkStageAudio(b *testing.B) {
+	for _, bm := range benchmarkSizes {
+		b.Run(bm.name, func(b *testing.B) {
+			data := payload(bm.size)
+			inMemory := int64(bm.size) <= InMemoryUploadLimit
+			stage := func() any {
+				staged, err := stageAudio(download{bytes.NewReader(data)}, inMemory, ".ogg", 0)
+				if err != nil {
+					b.Fatal(err)
+				}
+				return staged
+			}
+			b.SetBytes(int64(bm.size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stage().(stagedAudio).Close()
+			}
+			reportLive(b, stage)
+		})
+	}
+}
+
+func BenchmarkMultipartBody(b *testing.B) {
+	req := RecognitionRequest{Filename: "voice.ogg", ContentType: "audio/ogg", Language: "en"}
+	for _, bm := range benchmarkSizes {
+		b.Run(bm.name, func(b *testing.B) {
+			audio := bytes.NewReader(payload(bm.size))
+			build := func() any {
+				body, length, _, err := multipartBody(audio, audio.Size(), req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n, err := io.Copy(io.Discard, body); err != nil || n != length {
+					b.Fatalf("body of %d bytes, %v, want %d", n, err, length)
+				}
+				return body
+			}
+			b.SetBytes(int64(bm.size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				build()
+			}
+			reportLive(b, build)
+		})
+	}
+}
+
+// drainingTransport answers every upload with a transcription after
+// reading the whole body, like a backend would.
+type drainingTransport struct{}
+
+func (drainingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, err := io.Copy(io.Discard, req.Body); err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"detected_language":"en","recognized_text":"hello"}`)),
+		Request:    req,
+	}, nil
+}
+
+func BenchmarkRecognizeRequest(b *testing.B) {
+	backends := failover.New([]string{"http://backend.invalid/recognize"}, failover.InOrder, 3, time.Minute)
+	recognizer := NewHTTPRecognizer(backends, &http.Client{Transport: drainingTransport{}})
+	req := RecognitionRequest{Filename: "voice.ogg", ContentType: "audio/ogg", Duration: time.Minute}
+	for _, bm := range benchmarkSizes {
+		b.Run(bm.name, func(b *testing.B) {
+			data := payload(bm.size)
+			recognize := func() any {
+				result, err := recognizer.Recognize(context.Background(), bytes.NewReader(data), req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if result.BytesUploaded <= int64(bm.size) {
+					b.Fatalf("uploaded %d bytes of %d", result.BytesUploaded, bm.size)
+				}
+				return result
+			}
+			b.SetBytes(int64(bm.size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				recognize()
+			}
+			reportLive(b, recognize)
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package handleAudio
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/pending"
+	"telegram-sr-bot/sanitize"
+)
+
+// Callbacks, when set, has the backend post results back to the bot
+// instead of answering the upload with them; nil waits for the answer.
+var Callbacks *CallbackReceiver
+
+// CallbackSecretHeader carries the secret shared with the backend on every
+// callback.
+const CallbackSecretHeader = "X-Callback-Secret"
+
+// defaultCallbackPath is served when the callback URL has no path.
+const defaultCallbackPath = "/recognition-callback"
+
+// callbackExpiryInterval is how often expired jobs are looked for.
+const callbackExpiryInterval = time.Minute
+
+var CallbackCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "recognition_callbacks_total",
+		Help: "Total number of recognition results delivered by callback, or given up on.",
+	},
+	[]string{"outcome"}, // Outcome can be "success", "failed", "duplicate", "expired", "unauthorized" or "invalid"
+)
+
+// CallbackReceiver is where the backend delivers results: the URL it is
+// given and the jobs waiting there.
+type CallbackReceiver struct {
+	url    *url.URL
+	secret string
+	jobs   pending.Store
+	ttl    time.Duration
+}
+
+// NewCallbackReceiver has results posted to callbackURL with secret in the
+// CallbackSecretHeader. Jobs are kept in jobs and given up on after ttl.
+func NewCallbackReceiver(callbackURL, secret string, jobs pending.Store, ttl time.Duration) (*CallbackReceiver, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse callback URL: %w", err)
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("callback URL %q is not absolute", callbackURL)
+	}
+	if secret == "" {
+		return nil, errors.New("the callback secret is empty")
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultCallbackPath
+	}
+	return &CallbackReceiver{url: u, secret: secret, jobs: jobs, ttl: ttl}, nil
+}
+
+// Path is the path the callback endpoint must be served at.
+func (c *CallbackReceiver) Path() string {
+	return c.url.Path
+}
+
+// urlFor is the callback URL of the job with token.
+func (c *CallbackReceiver) urlFor(token string) string {
+	u := *c.url
+	query := u.Query()
+	query.Set("job", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func newJobToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return hex.EncodeToString(token)
+}
+
+// callbackResult is the body of a callback, a transcription or why there
+// is none.
+type callbackResult struct {
+	RecognitionSuccess
+	Error string `json:"error"`
+}
+
+// CallbackHandler serves the callback endpoint of Callbacks. Every job is
+// completed once, results delivered again are acknowledged and dropped.
+func (h *Handler) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(CallbackSecretHeader)), []byte(Callbacks.secret)) != 1 {
+			CallbackCounter.With(prometheus.Labels{"outcome": "unauthorized"}).Inc()
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Decode before taking the job, a garbled delivery can be sent again
+		var body callbackResult
+		if err := decodeRecognitionBody(r.Header, r.Body, false, &body); err != nil {
+			CallbackCounter.With(prometheus.Labels{"outcome": "invalid"}).Inc()
+			log.Warn().Ctx(r.Context()).Err(err).Msg("Invalid recognition callback")
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		job, ok, err := Callbacks.jobs.Take(r.URL.Query().Get("job"))
+		if err != nil {
+			log.Error().Ctx(r.Context()).Err(err).Msg("Failed to read the pending job")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			CallbackCounter.With(prometheus.Labels{"outcome": "duplicate"}).Inc()
+			log.Info().Ctx(r.Context()).Msg("Callback for a job that is already completed or expired")
+			return
+		}
+		// The reply is completed even if the backend hangs up meanwhile
+		h.complete(context.WithoutCancel(r.Context()), job, body)
+	})
+}
+
+// complete sends the result of job delivered by the backend.
+func (h *Handler) complete(ctx context.Context, job pending.Job, body callbackResult) {
+	logger := log.With().Ctx(ctx).Int64("chat_id", job.ChatID).Int("message_id", job.MessageID).Logger()
+	texts := messages.For(job.Language)
+	replies := h.resume(job, logger)
+	if body.Error != "" {
+		CallbackCounter.With(prometheus.Labels{"outcome": "failed"}).Inc()
+		message := sanitize.String(body.Error, sanitize.LogField)
+		logger.Error().Str("error", message).Msg("Recognition failed")
+		if err := replies.send(texts.Get(messages.Rejected, message)); err != nil {
+			logger.Error().Err(err).Msg("Failed to send error reply to the Telegram user")
+		}
+		countJob(job, "error")
+		refundQuota(logger, job.Charge)
+		Reactions.react(logger, job.ChatID, job.MessageID, ReactionFailed)
+		return
+	}
+
+	CallbackCounter.With(prometheus.Labels{"outcome": "success"}).Inc()
+	recognition := body.RecognitionSuccess
+	if emptyTranscript(recognition.RecognizedText, Fillers) {
+		logger.Info().Msg("No speech detected in the audio")
+		countJob(job, "empty_result")
+		refundQuota(logger, job.Charge)
+		if err := replies.send(texts.Get(messages.NoSpeech)); err != nil {
+			logger.Error().Err(err).Msg("Failed to send recognition response to the Telegram user")
+		}
+		Reactions.react(logger, job.ChatID, job.MessageID, ReactionFailed)
+		return
+	}
+	if Cache != nil && job.CacheKey != "" {
+		if err := Cache.Add(ctx, job.CacheKey, toCache(recognition)); err != nil {
+			logger.Warn().Err(err).Msg("Failed to cache the recognition result")
+		}
+	}
+	recognition.RecognizedText = Transforms.Apply(ctx, recognition.RecognizedText, recognition.DetectedLang)
+	RecognitionsByLanguage.With(prometheus.Labels{"language": languageLabel(recognition.DetectedLang)}).Inc()
+	chat, err := h.settings.Get(job.ChatID)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to read the chat settings, using the defaults")
+	}
+	countJob(job, "success")
+	source := AudioSource{FileName: job.FileName, Duration: job.Duration}
+	// The message is gone since, without its audio there is nothing to retry
+	if err := h.sendTranscript(logger, replies, texts, chat, job.SRT, source, replies.message, recognition, false); err != nil {
+		logger.Error().Err(err).Msg("Failed to send recognition response to the Telegram user")
+		Reactions.react(logger, job.ChatID, job.MessageID, ReactionFailed)
+		return
+	}
+	Reactions.react(logger, job.ChatID, job.MessageID, ReactionDone)
+}
+
+// ExpireCallbacks tells the chats of jobs whose result did not arrive in
+// time that transcription timed out, until ctx is done.
+func (h *Handler) ExpireCallbacks(ctx context.Context) {
+	ticker := time.NewTicker(callbackExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := Callbacks.jobs.TakeExpired(now)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read expired pending jobs")
+			}
+			for _, job := range expired {
+				CallbackCounter.With(prometheus.Labels{"outcome": "expired"}).Inc()
+				logger := log.With().Int64("chat_id", job.ChatID).Int("message_id", job.MessageID).Logger()
+				logger.Warn().Msg("No recognition result arrived in time")
+				if err := h.resume(job, logger).send(messages.For(job.Language).Get(messages.TimedOut)); err != nil {
+					logger.Error().Err(err).Msg("Failed to tell the user that transcription timed out")
+				}
+				countJob(job, "timeout")
+				refundQuota(logger, job.Charge)
+				Reactions.react(logger, job.ChatID, job.MessageID, ReactionFailed)
+			}
+		}
+	}
+}
+
+// countJob counts the message of job with its final status, the handler
+// only counted it as accepted.
+func countJob(job pending.Job, status string) {
+	source := job.Source
+	if source == "" {
+		source = "unknown" // Accepted before jobs knew their source
+	}
+	AudioMessageCounter.With(prometheus.Labels{"status": status, "source": source}).Inc()
+}
+
+// resume returns a replier for the message of job, which replaces its
+// placeholder if there is one.
+func (h *Handler) resume(job pending.Job, logger zerolog.Logger) *replier {
+	message := &tgbotapi.Message{MessageID: job.MessageID, Chat: &tgbotapi.Chat{ID: job.ChatID}, Date: int(job.Sent.Unix())}
+	return &replier{bot: h.sender, edits: h.edits, message: message, logger: logger, chatID: job.ChatID, placeholderID: job.PlaceholderID}
+}
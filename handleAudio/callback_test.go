@@ -0,0 +1,47 @@
+package handleAudio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"telegram-sr-bot/pending"
+)
+
+func countOf(status, source string) float64 {
+	return testutil.ToFloat64(AudioMessageCounter.With(prometheus.Labels{"status": status, "source": source}))
+}
+
+func TestAcceptedJobsAreCountedOnceSettled(t *testing.T) {
+	receiver, err := NewCallbackReceiver("https://bot.example/callback", "secret", pending.NewMemory(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVar(t, &Callbacks, receiver)
+	recognizer := &fakeRecognizer{result: RecognitionResult{Accepted: true}}
+	handler, _ := newTestHandler(fakeFetcher{audio: oggHead}, recognizer)
+
+	successes, accepted, failures := countOf("success", "voice"), countOf("accepted", "voice"), countOf("error", "voice")
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+	if got := countOf("success", "voice") - successes; got != 0 {
+		t.Errorf("accepted job counted as %v successes before its result", got)
+	}
+	if got := countOf("accepted", "voice") - accepted; got != 1 {
+		t.Errorf("accepted = %v, want 1", got)
+	}
+
+	jobs, err := receiver.jobs.TakeExpired(time.Now().Add(2 * time.Hour))
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("pending jobs = %v, %v; want the accepted one", jobs, err)
+	}
+	handler.complete(context.Background(), jobs[0], callbackResult{Error: "cannot decode"})
+	if got := countOf("error", "voice") - failures; got != 1 {
+		t.Errorf("failed callback counted %v errors, want 1", got)
+	}
+	if got := countOf("success", "voice") - successes; got != 0 {
+		t.Errorf("failed callback counted %v successes", got)
+	}
+}
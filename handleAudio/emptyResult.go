@@ -0,0 +1,22 @@
+package handleAudio
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Fillers are what models write for audio without speech, a transcript of
+// nothing but fillers is taken for silence.
+var Fillers = []string{"[BLANK_AUDIO]", "[MUSIC]", "[SILENCE]", "♪"}
+
+// emptyTranscript reports whether text holds no speech: once fillers are
+// left out, not a single letter or digit remains. Whitespace, punctuation
+// and symbols alone are what noise comes out as.
+func emptyTranscript(text string, fillers []string) bool {
+	for _, filler := range fillers {
+		text = strings.ReplaceAll(text, filler, " ")
+	}
+	return strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	}) < 0
+}
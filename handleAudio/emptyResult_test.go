@@ -0,0 +1,72 @@
+package handleAudio
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/pending"
+)
+
+func TestEmptyTranscript(t *testing.T) {
+	for text, empty := range map[string]bool{
+		"":                       true,
+		" \n\t ":                 true,
+		"...":                    true,
+		"[BLANK_AUDIO]":          true,
+		"♪ ♪ ♪":                  true,
+		"[MUSIC] - [SILENCE]":    true,
+		"hello":                  false,
+		"42":                     false,
+		"[MUSIC] привет [MUSIC]": false,
+	} {
+		if got := emptyTranscript(text, Fillers); got != empty {
+			t.Errorf("emptyTranscript(%q) = %v, want %v", text, got, empty)
+		}
+	}
+	if emptyTranscript("(silence)", nil) {
+		t.Error("(silence) taken for a filler without being one")
+	}
+}
+
+func TestNoSpeechIsReportedInsteadOfABlankTranscript(t *testing.T) {
+	noSpeech := messages.For("en").Get(messages.NoSpeech)
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: recognized(" [BLANK_AUDIO] ")})
+	empty := countOf("empty_result", "voice")
+
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	if texts := bot.texts(); !slices.Contains(texts, noSpeech) || slices.Contains(texts, "[BLANK_AUDIO]") {
+		t.Errorf("replies %q, want only that no speech was found", texts)
+	}
+	if got := countOf("empty_result", "voice") - empty; got != 1 {
+		t.Errorf("empty results counted %v times, want once", got)
+	}
+}
+
+func TestNoSpeechInACallbackResult(t *testing.T) {
+	receiver, err := NewCallbackReceiver("https://bot.example/callback", "secret", pending.NewMemory(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVar(t, &Callbacks, receiver)
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: RecognitionResult{Accepted: true}})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+	jobs, err := receiver.jobs.TakeExpired(time.Now().Add(2 * time.Hour))
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("pending jobs = %v, %v; want the accepted one", jobs, err)
+	}
+
+	empty := countOf("empty_result", "voice")
+	handler.complete(context.Background(), jobs[0], callbackResult{RecognitionSuccess: RecognitionSuccess{DetectedLang: "en", RecognizedText: "♪"}})
+	if texts := bot.texts(); !slices.Contains(texts, messages.For("en").Get(messages.NoSpeech)) {
+		t.Errorf("replies %q, want that no speech was found", texts)
+	}
+	if got := countOf("empty_result", "voice") - empty; got != 1 {
+		t.Errorf("empty results counted %v times, want once", got)
+	}
+}
@@ -0,0 +1,58 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AudioExtractor pulls the audio track out of a video file so only the audio
+// is uploaded for recognition.
+type AudioExtractor interface {
+	// ExtractAudio writes the audio of videoPath to a new file and returns
+	// its path, the caller removes it when done.
+	ExtractAudio(ctx context.Context, videoPath string) (string, error)
+}
+
+// Extractor handles videos; nil disables video transcription.
+var Extractor AudioExtractor
+
+// MaxVideoBytes and MaxVideoDuration bound the videos that are downloaded
+// for extraction instead of MaxAudioBytes and MaxAudioDuration, zero leaves
+// the limit off.
+var (
+	MaxVideoBytes    int64 = 200 << 20
+	MaxVideoDuration       = 2 * time.Hour
+)
+
+// FFmpegContentType is the type of the audio FFmpegExtractor produces.
+const FFmpegContentType = "audio/ogg"
+
+// FFmpegExtractor extracts audio by running the ffmpeg binary at Path.
+type FFmpegExtractor struct {
+	Path string
+}
+
+// ExtractAudio re-encodes the first audio track of videoPath as mono Ogg
+// Opus, the format of Telegram voice messages.
+func (e FFmpegExtractor) ExtractAudio(ctx context.Context, videoPath string) (string, error) {
+	out, err := os.CreateTemp("", "audio-*.ogg")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path, "-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", videoPath, "-map", "0:a:0", "-vn", "-ac", "1", "-c:a", "libopus", "-f", "ogg", out.Name())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,80 @@
+package handleAudio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/sanitize"
+)
+
+// TelegramFileFetcher retrieves the files users send to the bot.
+type TelegramFileFetcher interface {
+	// Fetch returns the content of the file, which the caller closes. Files
+	// that are available locally are returned as *os.File.
+	Fetch(ctx context.Context, fileID string) (io.ReadCloser, error)
+}
+
+// BotFileFetcher reads files from the local Bot API mount when configured
+// and downloads them from the Bot API server otherwise.
+type BotFileFetcher struct {
+	bot          *tgbotapi.BotAPI
+	client       *http.Client
+	fileEndpoint string
+	mounted      *MountedFileFetcher
+	redactor     *sanitize.Redactor
+}
+
+// NewBotFileFetcher returns a fetcher downloading through client from
+// fileEndpoint, a format like tgbotapi.FileEndpoint taking the token and
+// the file path. Files are read from mounted instead when it is not nil.
+func NewBotFileFetcher(bot *tgbotapi.BotAPI, client *http.Client, fileEndpoint string, mounted *MountedFileFetcher) *BotFileFetcher {
+	return &BotFileFetcher{bot: bot, client: client, fileEndpoint: fileEndpoint, mounted: mounted, redactor: sanitize.NewRedactor(bot.Token)}
+}
+
+// Fetch opens the mounted file or downloads it within DownloadTimeout. The
+// bot token is redacted from the errors it returns.
+func (f *BotFileFetcher) Fetch(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	file, err := f.bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", f.redactor.Error(err))
+	}
+	// Read the file straight from the local Bot API volume when one is mounted
+	if f.mounted != nil {
+		mounted, err := f.mounted.open(file.FilePath)
+		if err == nil {
+			return mounted, nil
+		}
+		// The server may not have stored the file on the volume, downloading it is expected then
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Ctx(ctx).Err(f.redactor.Error(err)).Str("file_id", fileID).
+				Msg("Failed to open the audio file from the local mount, downloading it instead")
+		}
+	}
+
+	fileURL := fmt.Sprintf(f.fileEndpoint, f.bot.Token, file.FilePath)
+	ctx, cancel := context.WithTimeout(ctx, DownloadTimeout)
+	var resp *http.Response
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err == nil {
+		err = Chaos.Inject(ctx, "download")
+	}
+	if err == nil {
+		resp, err = f.client.Do(req)
+	}
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err != nil {
+		cancel()
+		return nil, f.redactor.Error(err)
+	}
+	// The deadline covers reading the body, release it once that is closed
+	return cancelOnClose{ReadCloser: resp.Body, cancel: cancel}, nil
+}
@@ -0,0 +1,124 @@
+package handleAudio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const botToken = "123456:secret"
+
+// failingTransport fails every request, as a dropped connection would.
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+// testBotAPI returns a bot talking to a Bot API server that knows every
+// file.
+func testBotAPI(t *testing.T) *tgbotapi.BotAPI {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			fmt.Fprint(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "bot"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok": true, "result": {"file_id": "file", "file_path": "voice/file_1.oga"}}`)
+	}))
+	t.Cleanup(server.Close)
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(botToken, server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+func TestBotFileFetcherKeepsTheTokenOutOfErrors(t *testing.T) {
+	bot := testBotAPI(t)
+	fetcher := NewBotFileFetcher(bot, &http.Client{Transport: failingTransport{}}, tgbotapi.FileEndpoint, nil)
+
+	_, err := fetcher.Fetch(context.Background(), "file")
+	if err == nil {
+		t.Fatal("download through a failing connection succeeded")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q has the token", err)
+	}
+	if !strings.Contains(err.Error(), "bot<redacted>/voice/file_1.oga") {
+		t.Errorf("error %q lost the file URL", err)
+	}
+}
+
+// localBotAPI returns a bot talking to a local Bot API server that stores
+// every file at /var/lib/telegram-bot-api/<token>/voice/file_1.oga and also
+// serves it for download, counting the downloads.
+func localBotAPI(t *testing.T, downloads *int) (*tgbotapi.BotAPI, string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			fmt.Fprint(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "bot"}}`)
+		case strings.HasSuffix(r.URL.Path, "/getFile"):
+			fmt.Fprint(w, `{"ok": true, "result": {"file_id": "file", "file_path": "/var/lib/telegram-bot-api/123456:secret/voice/file_1.oga"}}`)
+		case strings.HasPrefix(r.URL.Path, "/file/bot"+botToken+"/") && strings.HasSuffix(r.URL.Path, "/voice/file_1.oga"):
+			*downloads++
+			w.Write(oggHead)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(botToken, server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, server.URL + "/file/bot%s/%s"
+}
+
+func TestBotFileFetcherPrefersTheMount(t *testing.T) {
+	mount := t.TempDir()
+	dir := filepath.Join(mount, botToken, "voice")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file_1.oga"), oggHead, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	downloads := 0
+	bot, fileEndpoint := localBotAPI(t, &downloads)
+	fetcher := NewBotFileFetcher(bot, http.DefaultClient, fileEndpoint, NewMountedFileFetcher(bot, mount, "/var/lib/telegram-bot-api"))
+
+	file, err := fetcher.Fetch(context.Background(), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, ok := file.(*os.File); !ok || downloads != 0 {
+		t.Errorf("got a %T after %d downloads, want the mounted file", file, downloads)
+	}
+}
+
+func TestBotFileFetcherDownloadsWhatTheMountLacks(t *testing.T) {
+	downloads := 0
+	bot, fileEndpoint := localBotAPI(t, &downloads)
+	fetcher := NewBotFileFetcher(bot, http.DefaultClient, fileEndpoint, NewMountedFileFetcher(bot, t.TempDir(), "/var/lib/telegram-bot-api"))
+
+	file, err := fetcher.Fetch(context.Background(), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if data, _ := io.ReadAll(file); string(data) != string(oggHead) || downloads != 1 {
+		t.Errorf("read %q after %d downloads, want it downloaded from the local server", data, downloads)
+	}
+}
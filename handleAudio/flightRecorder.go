@@ -0,0 +1,123 @@
+package handleAudio
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/sanitize"
+)
+
+// Recorder keeps the most recent message results for debugging; nil
+// disables recording.
+var Recorder *FlightRecorder
+
+// RecordTranscripts controls whether recorded results keep the transcript
+// text.
+var RecordTranscripts bool
+
+// FlightRecorder is a fixed-size ring buffer of the most recent message
+// results. It is safe for concurrent use.
+type FlightRecorder struct {
+	mu      sync.RWMutex
+	records []MessageResult
+	next    int
+	full    bool
+}
+
+func NewFlightRecorder(size int) *FlightRecorder {
+	return &FlightRecorder{records: make([]MessageResult, size)}
+}
+
+// Add stores r, overwriting the oldest record once the buffer is full.
+func (f *FlightRecorder) Add(r MessageResult) {
+	if f == nil || len(f.records) == 0 {
+		return
+	}
+	if RecordTranscripts {
+		r.Transcript = sanitize.String(r.Transcript, sanitize.Text)
+	} else {
+		r.Transcript = ""
+	}
+	r.Stages = append([]StageTiming(nil), r.Stages...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records[f.next] = r
+	f.next = (f.next + 1) % len(f.records)
+	if f.next == 0 {
+		f.full = true
+	}
+}
+
+// Last returns up to n of the most recent records, newest first.
+func (f *FlightRecorder) Last(n int) []MessageResult {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	count := f.next
+	if f.full {
+		count = len(f.records)
+	}
+	n = min(n, count)
+	last := make([]MessageResult, 0, n)
+	for i := 1; i <= n; i++ {
+		last = append(last, f.records[(f.next-i+len(f.records))%len(f.records)])
+	}
+	return last
+}
+
+// Digest sums r up on one line for operators reading it in a chat.
+func (r MessageResult) Digest() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s chat %d message %d: %s %s, %s in %s",
+		r.ReceivedAt.UTC().Format(time.TimeOnly), r.ChatID, r.MessageID, r.SourceType,
+		r.AudioDuration.Round(time.Second), r.Status, r.Duration.Round(time.Millisecond))
+	if r.DetectedLang != "" {
+		fmt.Fprintf(&b, ", %s, %d characters", r.DetectedLang, r.TranscriptLen)
+	}
+	if r.CacheHit {
+		b.WriteString(", cached")
+	}
+	if r.Retries > 0 {
+		fmt.Fprintf(&b, ", %d retries", r.Retries)
+	}
+	if r.Endpoint != "" {
+		fmt.Fprintf(&b, ", %s", r.Endpoint)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(&b, ", error: %s", sanitize.String(r.Error, sanitize.LogField))
+	}
+	return b.String()
+}
+
+// Handler serves the most recent records as JSON to requests carrying
+// "Authorization: Bearer <token>". The optional n query parameter limits how
+// many are returned.
+func (f *FlightRecorder) Handler(token string) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		n := len(f.records)
+		if value := r.URL.Query().Get("n"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, "n must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			n = parsed
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(f.Last(n)); err != nil {
+			log.Error().Err(err).Msg("Failed to write flight recorder records")
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package handleAudio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlightRecorderWrapsAround(t *testing.T) {
+	f := NewFlightRecorder(3)
+	if got := f.Last(10); len(got) != 0 {
+		t.Errorf("empty recorder returned %v", got)
+	}
+	for id := 1; id <= 2; id++ {
+		f.Add(MessageResult{MessageID: id})
+	}
+	if got := ids(f.Last(10)); got != "2,1" {
+		t.Errorf("records %s before wrapping, want 2,1", got)
+	}
+	for id := 3; id <= 7; id++ {
+		f.Add(MessageResult{MessageID: id})
+	}
+	if got := ids(f.Last(10)); got != "7,6,5" {
+		t.Errorf("records %s after wrapping, want the newest three", got)
+	}
+	if got := ids(f.Last(2)); got != "7,6" {
+		t.Errorf("last 2 = %s", got)
+	}
+	if got := f.Last(0); len(got) != 0 {
+		t.Errorf("last 0 = %v", got)
+	}
+}
+
+// ids lists the message IDs of records.
+func ids(records []MessageResult) string {
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, strconv.Itoa(r.MessageID))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestFlightRecorderKeepsTranscriptsOnlyWhenAsked(t *testing.T) {
+	f := NewFlightRecorder(2)
+	f.Add(MessageResult{MessageID: 1, Transcript: "secret"})
+	setVar(t, &RecordTranscripts, true)
+	f.Add(MessageResult{MessageID: 2, Transcript: "kept\x1b[31m"})
+	last := f.Last(2)
+	if last[1].Transcript != "" {
+		t.Errorf("transcript %q recorded without DEBUG_INCLUDE_TEXT", last[1].Transcript)
+	}
+	if last[0].Transcript != "kept" {
+		t.Errorf("transcript %q recorded, want it sanitized", last[0].Transcript)
+	}
+}
+
+func TestFlightRecorderReadWhileWriting(t *testing.T) {
+	f := NewFlightRecorder(16)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				f.Add(MessageResult{MessageID: i, Stages: []StageTiming{{Name: "upload"}}})
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				for _, record := range f.Last(16) {
+					if len(record.Stages) != 1 {
+						t.Errorf("record with %d stages", len(record.Stages))
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(f.Last(100)); got != 16 {
+		t.Errorf("%d records kept, want 16", got)
+	}
+}
+
+func TestFlightRecorderHandler(t *testing.T) {
+	f := NewFlightRecorder(4)
+	for id := 1; id <= 3; id++ {
+		f.Add(MessageResult{MessageID: id})
+	}
+	handler := f.Handler("token")
+	get := func(authorization, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/recent"+query, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, authorization := range []string{"", "Bearer other", "token"} {
+		if rec := get(authorization, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d", authorization, rec.Code)
+		}
+	}
+	if rec := get("Bearer token", "?n=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative n: status %d", rec.Code)
+	}
+	rec := get("Bearer token", "?n=2")
+	var records []MessageResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || ids(records) != "3,2" {
+		t.Errorf("status %d with records %s", rec.Code, ids(records))
+	}
+}
+
+func TestDigest(t *testing.T) {
+	r := MessageResult{
+		ChatID:        7,
+		MessageID:     10,
+		ReceivedAt:    time.Date(2026, 1, 2, 14, 32, 5, 0, time.UTC),
+		SourceType:    "voice",
+		AudioDuration: 5 * time.Second,
+		Endpoint:      "http://backend",
+		DetectedLang:  "en",
+		TranscriptLen: 42,
+		CacheHit:      true,
+		Retries:       1,
+		Duration:      1234 * time.Millisecond,
+		Status:        "success",
+		Error:         "line one\nline two",
+	}
+	want := "14:32:05 chat 7 message 10: voice 5s, success in 1.234s, en, 42 characters, cached, 1 retries, http://backend, error: line one line two"
+	if got := r.Digest(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
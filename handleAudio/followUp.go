@@ -0,0 +1,197 @@
+package handleAudio
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/sender"
+)
+
+// FollowUpTTL is how long the buttons under a transcription keep working.
+var FollowUpTTL = 24 * time.Hour
+
+// maxFollowUps bounds the transcriptions remembered for their buttons.
+const maxFollowUps = 10000
+
+// Button actions, sent back as "<action>:<follow-up ID>" in the callback
+// data, which Telegram limits to 64 bytes.
+const (
+	actionRetry     = "retry"
+	actionTranslate = "translate"
+)
+
+// translateTarget is the language the translate button translates into.
+const translateTarget = "en"
+
+// followUp is what the buttons under a transcription need to act on it.
+type followUp struct {
+	message  *tgbotapi.Message // The transcribed message
+	text     string
+	language string
+	reply    formattedReply // The message carrying the buttons
+	expires  time.Time
+}
+
+// followUps keeps the transcriptions that have buttons, by a short random
+// ID.
+type followUps struct {
+	mu      sync.Mutex
+	entries map[string]*followUp
+}
+
+func newFollowUps() *followUps {
+	return &followUps{entries: make(map[string]*followUp)}
+}
+
+func (f *followUps) add(entry *followUp) string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	key := hex.EncodeToString(id)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	if len(f.entries) >= maxFollowUps {
+		var oldest string
+		for key, e := range f.entries {
+			if now.After(e.expires) {
+				delete(f.entries, key)
+			} else if oldest == "" || e.expires.Before(f.entries[oldest].expires) {
+				oldest = key
+			}
+		}
+		if len(f.entries) >= maxFollowUps {
+			delete(f.entries, oldest)
+		}
+	}
+	f.entries[key] = entry
+	return key
+}
+
+func (f *followUps) get(key string) (*followUp, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(f.entries, key)
+		return nil, false
+	}
+	return entry, ok
+}
+
+// keyboard returns the buttons offered under a transcription in language,
+// labelled from texts.
+func keyboard(texts *messages.Bundle, key, language string) *tgbotapi.InlineKeyboardMarkup {
+	buttons := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(texts.Get(messages.RetryButton), actionRetry+":"+key),
+	}
+	if Translate != nil && !strings.EqualFold(language, translateTarget) {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(texts.Get(messages.TranslateButton), actionTranslate+":"+key))
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(buttons)
+	return &markup
+}
+
+// HandleCallback acts on a button pressed under a transcription. Only the
+// chat the transcription was sent to can use its buttons; anyone who can
+// press them there can see the transcription anyway.
+func (h *Handler) HandleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	logger := log.With().Ctx(ctx).Str("callback_data", query.Data).Logger()
+	if query.From != nil {
+		logger = logger.With().Int64("user_id", query.From.ID).Logger()
+	}
+	if query.Message == nil || query.Message.Chat == nil {
+		h.answerCallback(query, messages.For(messages.UserLanguage(query.From)).Get(messages.ButtonExpired), logger)
+		return
+	}
+	texts := h.texts(query.Message.Chat.ID, query.From)
+	action, key, _ := strings.Cut(query.Data, ":")
+	entry, ok := h.followUps.get(key)
+	if !ok || query.Message.Chat.ID != entry.message.Chat.ID {
+		h.answerCallback(query, texts.Get(messages.ButtonExpired), logger)
+		return
+	}
+
+	switch action {
+	case actionRetry:
+		h.answerCallback(query, texts.Get(messages.Retrying), logger)
+		h.handle(ctx, entry.message, handleOptions{retry: true})
+	case actionTranslate:
+		if Translate == nil {
+			h.answerCallback(query, texts.Get(messages.ButtonExpired), logger)
+			return
+		}
+		h.answerCallback(query, texts.Get(messages.Translating), logger)
+		h.translate(ctx, query.Message, entry, key, texts, logger)
+	default:
+		h.answerCallback(query, texts.Get(messages.ButtonExpired), logger)
+	}
+}
+
+// translate appends the translation of entry to msg, the message carrying
+// the buttons, or replies with it when it does not fit.
+func (h *Handler) translate(ctx context.Context, msg *tgbotapi.Message, entry *followUp, key string, texts *messages.Bundle, logger zerolog.Logger) {
+	translated, err := Translate.Translate(ctx, entry.text, entry.language, translateTarget)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to translate the transcription")
+		reply := tgbotapi.NewMessage(msg.Chat.ID, texts.Get(messages.TranslateFailed))
+		reply.ReplyToMessageID = msg.MessageID
+		reply.AllowSendingWithoutReply = true
+		if _, err := sender.SendMessage(h.sender, reply); err != nil {
+			logger.Error().Err(err).Msg("Failed to report the failed translation")
+		}
+		return
+	}
+
+	// Once translated only the retry button is left
+	retryOnly := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(texts.Get(messages.RetryButton), actionRetry+":"+key)))
+	translation := texts.Get(messages.Translation, strings.ToUpper(translateTarget), translated)
+	edited := formattedReply{
+		markdown: entry.reply.markdown + "\n\n" + escapeMarkdown(translation),
+		plain:    entry.reply.plain + "\n\n" + translation,
+	}
+	if utf8.RuneCountInString(edited.markdown) <= maxMessageLength {
+		_, err := withMarkup(logger, edited, func(text, parseMode string) (tgbotapi.Message, error) {
+			edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
+			edit.ParseMode = parseMode
+			edit.ReplyMarkup = &retryOnly
+			return tgbotapi.Message{}, h.edits.Edit(edit)
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to add the translation to the transcription")
+		}
+		return
+	}
+
+	if _, err := h.sender.Request(tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, retryOnly)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to remove the translate button")
+	}
+	for _, text := range splitTranscript("", translation, maxMessageLength) {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+		reply.ReplyToMessageID = msg.MessageID
+		reply.AllowSendingWithoutReply = true
+		if _, err := sender.SendMessage(h.sender, reply); err != nil {
+			logger.Error().Err(err).Msg("Failed to send the translation")
+			return
+		}
+	}
+}
+
+// answerCallback stops the spinner on the pressed button, showing text.
+func (h *Handler) answerCallback(query *tgbotapi.CallbackQuery, text string, logger zerolog.Logger) {
+	if _, err := h.sender.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to answer the callback query")
+	}
+}
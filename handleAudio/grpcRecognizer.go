@@ -0,0 +1,219 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"telegram-sr-bot/proto/recognitionpb"
+	"telegram-sr-bot/sanitize"
+)
+
+// GRPCChunkSize is how much audio every streamed chunk carries.
+var GRPCChunkSize = 64 << 10
+
+// GRPCRecognizer is a Recognizer streaming audio to the Recognize RPC of
+// the recognition service.
+type GRPCRecognizer struct {
+	target string
+	client recognitionpb.RecognizerClient
+	health healthpb.HealthClient
+}
+
+// NewGRPCRecognizer returns a recognizer calling the service at target
+// over conn.
+func NewGRPCRecognizer(target string, conn grpc.ClientConnInterface) *GRPCRecognizer {
+	return &GRPCRecognizer{target: target, client: recognitionpb.NewRecognizerClient(conn), health: healthpb.NewHealthClient(conn)}
+}
+
+func (r *GRPCRecognizer) Endpoint() string {
+	return r.target
+}
+
+// Probe calls the standard gRPC health check. A service not implementing
+// it still answered, which is all the probe is after.
+func (r *GRPCRecognizer) Probe(ctx context.Context) error {
+	md := metadata.MD{}
+	APIAuth.applyMetadata(md)
+	resp, err := r.health.Check(metadata.NewOutgoingContext(ctx, md), &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("service is %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// Recognize streams audio as described by req in chunks of GRPCChunkSize
+// and returns the transcription. Failures are retried like the HTTP
+// uploads, with the gRPC status mapped to its HTTP status code.
+func (r *GRPCRecognizer) Recognize(ctx context.Context, audio io.Reader, req RecognitionRequest) (RecognitionResult, error) {
+	result := RecognitionResult{Model: ModelInfo{Name: unknownModel, Version: unknownModel}, Endpoint: r.target}
+	sized, ok := audio.(sizedReaderAt)
+	if !ok {
+		data, err := io.ReadAll(audio)
+		if err != nil {
+			return result, fmt.Errorf("read audio: %w", err)
+		}
+		sized = bytes.NewReader(data)
+	}
+
+	start := time.Now()
+	var recognition *recognitionpb.RecognitionResult
+	err := withRetries(ctx, req, &result, func(ctx context.Context, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		var err error
+		if err = Chaos.Inject(ctx, "upload"); err == nil {
+			recognition, err = r.stream(ctx, sized, req, &result)
+		}
+		return grpcStatusError(err)
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Model = modelInfo(recognition.GetModelName(), recognition.GetModelVersion())
+	observeModel(result.Model)
+	if err := Chaos.Inject(ctx, "decode"); err != nil {
+		return result, fmt.Errorf("%w: %w", errBadResponse, err)
+	}
+	result.DetectedLang = recognition.GetDetectedLanguage()
+	result.RecognizedText = recognition.GetRecognizedText()
+	for _, segment := range recognition.GetSegments() {
+		result.Segments = append(result.Segments, Segment{Start: segment.GetStart(), End: segment.GetEnd(), Text: segment.GetText()})
+	}
+	UploadTimeout.Observe(req.Duration, time.Since(start))
+	return result, nil
+}
+
+// stream makes a single call, sending the metadata with the first chunk.
+func (r *GRPCRecognizer) stream(ctx context.Context, audio sizedReaderAt, req RecognitionRequest, result *RecognitionResult) (*recognitionpb.RecognitionResult, error) {
+	// Let the recognition service join the trace
+	md := metadata.MD{}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	APIAuth.applyMetadata(md)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	stream, err := r.client.Recognize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunk := &recognitionpb.AudioChunk{Metadata: &recognitionpb.AudioMetadata{
+		Filename:        req.Filename,
+		ContentType:     req.ContentType,
+		Language:        req.Language,
+		DurationSeconds: req.Duration.Seconds(),
+	}}
+	result.BytesUploaded = 0
+	buf := make([]byte, GRPCChunkSize)
+	reader := io.NewSectionReader(audio, 0, audio.Size())
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 || chunk.Metadata != nil {
+			chunk.Data = buf[:n]
+			if err := stream.Send(chunk); err != nil {
+				// The real error comes with the status, from CloseAndRecv
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+			result.BytesUploaded += int64(n)
+			chunk = &recognitionpb.AudioChunk{}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			stream.CloseSend()
+			return nil, fmt.Errorf("read audio: %w", err)
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// grpcStatusError turns a gRPC status into the *statusError of the HTTP
+// status code it stands for, so retries and replies treat it the same.
+// Context errors are left alone.
+func grpcStatusError(err error) error {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch s.Code() {
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %w", err, context.DeadlineExceeded)
+	case codes.Canceled:
+		return fmt.Errorf("%w: %w", err, context.Canceled)
+	}
+	return &statusError{
+		code:    grpcHTTPStatus(s.Code()),
+		status:  s.Code().String(),
+		message: sanitize.String(s.Message(), sanitize.LogField),
+	}
+}
+
+// grpcHTTPStatus maps gRPC codes to HTTP status codes as grpc-gateway does.
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// metadataCarrier lets the OTel propagator write into gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
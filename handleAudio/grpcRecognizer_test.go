@@ -0,0 +1,208 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"telegram-sr-bot/proto/recognitionpb"
+)
+
+// fakeRecognitionService records the audio streamed to it and answers with
+// errs in turn, then with result.
+type fakeRecognitionService struct {
+	recognitionpb.UnimplementedRecognizerServer
+
+	mu       sync.Mutex
+	errs     []error
+	calls    int
+	metadata *recognitionpb.AudioMetadata
+	chunks   int
+	audio    []byte
+}
+
+func (s *fakeRecognitionService) Recognize(stream recognitionpb.Recognizer_RecognizeServer) error {
+	var audio []byte
+	var metadata *recognitionpb.AudioMetadata
+	chunks := 0
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if chunk.GetMetadata() != nil {
+			metadata = chunk.GetMetadata()
+		}
+		audio = append(audio, chunk.GetData()...)
+		chunks++
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.metadata, s.chunks, s.audio = metadata, chunks, audio
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return stream.SendAndClose(&recognitionpb.RecognitionResult{
+		DetectedLanguage: "en",
+		RecognizedText:   "hello there",
+		Segments:         []*recognitionpb.Segment{{Start: 0, End: 1.5, Text: "hello there"}},
+		ModelName:        "whisper",
+		ModelVersion:     "3",
+	})
+}
+
+// newGRPCTestRecognizer serves service, and health if not nil, in memory
+// and returns a recognizer calling it.
+func newGRPCTestRecognizer(t *testing.T, service *fakeRecognitionService, healthServer *health.Server) *GRPCRecognizer {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	recognitionpb.RegisterRecognizerServer(server, service)
+	if healthServer != nil {
+		healthpb.RegisterHealthServer(server, healthServer)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewGRPCRecognizer("bufnet", conn)
+}
+
+func TestGRPCRecognizeStreamsTheAudio(t *testing.T) {
+	setVar(t, &GRPCChunkSize, 16)
+	service := &fakeRecognitionService{}
+	recognizer := newGRPCTestRecognizer(t, service, nil)
+
+	audio := bytes.Repeat(oggHead, 10)
+	result, err := recognizer.Recognize(context.Background(), bytes.NewReader(audio),
+		RecognitionRequest{Filename: "voice.ogg", ContentType: "audio/ogg", Language: "uk", Duration: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RecognizedText != "hello there" || result.DetectedLang != "en" || len(result.Segments) != 1 || result.Segments[0].End != 1.5 {
+		t.Errorf("recognized %+v", result)
+	}
+	if result.Model.Name != "whisper" || result.Endpoint != "bufnet" || result.BytesUploaded != int64(len(audio)) {
+		t.Errorf("model %+v from %s after %d bytes", result.Model, result.Endpoint, result.BytesUploaded)
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if !bytes.Equal(service.audio, audio) {
+		t.Errorf("service got %d bytes of audio, want %d", len(service.audio), len(audio))
+	}
+	if want := (len(audio) + 15) / 16; service.chunks != want {
+		t.Errorf("streamed in %d chunks, want %d", service.chunks, want)
+	}
+	if m := service.metadata; m.GetFilename() != "voice.ogg" || m.GetContentType() != "audio/ogg" || m.GetLanguage() != "uk" || m.GetDurationSeconds() != 5 {
+		t.Errorf("metadata %+v", m)
+	}
+}
+
+func TestGRPCRecognizeSendsMetadataWithoutAudio(t *testing.T) {
+	service := &fakeRecognitionService{}
+	recognizer := newGRPCTestRecognizer(t, service, nil)
+	if _, err := recognizer.Recognize(context.Background(), bytes.NewReader(nil), RecognitionRequest{Filename: "empty.ogg"}); err != nil {
+		t.Fatal(err)
+	}
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if service.chunks != 1 || service.metadata.GetFilename() != "empty.ogg" {
+		t.Errorf("%d chunks with metadata %+v, want the metadata alone", service.chunks, service.metadata)
+	}
+}
+
+func TestGRPCRecognizeMapsTheStatus(t *testing.T) {
+	setVar(t, &UploadAttempts, 3)
+	setVar(t, &UploadRetryBackoff, time.Millisecond)
+	for _, c := range []struct {
+		errs  []error
+		code  int // 0 for success
+		calls int
+	}{
+		{[]error{status.Error(codes.Unavailable, "restarting")}, 0, 2},
+		{[]error{status.Error(codes.ResourceExhausted, "busy"), status.Error(codes.Unavailable, "restarting")}, 0, 3},
+		{[]error{status.Error(codes.InvalidArgument, "not audio\nat all")}, http.StatusBadRequest, 1},
+		{[]error{status.Error(codes.Unauthenticated, "no key")}, http.StatusUnauthorized, 1},
+		{[]error{status.Error(codes.Internal, "crashed")}, http.StatusInternalServerError, 1},
+	} {
+		service := &fakeRecognitionService{errs: c.errs}
+		recognizer := newGRPCTestRecognizer(t, service, nil)
+		_, err := recognizer.Recognize(context.Background(), bytes.NewReader(oggHead), RecognitionRequest{Filename: "voice.ogg"})
+		var statusErr *statusError
+		switch {
+		case c.code == 0 && err != nil:
+			t.Errorf("%v: %v, want it retried until it succeeds", c.errs, err)
+		case c.code != 0 && (!errors.As(err, &statusErr) || statusErr.code != c.code):
+			t.Errorf("%v: err = %v, want status %d", c.errs, err, c.code)
+		}
+		if statusErr != nil && strings.ContainsRune(statusErr.message, '\n') {
+			t.Errorf("message %q not sanitized for the log", statusErr.message)
+		}
+		service.mu.Lock()
+		if service.calls != c.calls {
+			t.Errorf("%v: %d calls, want %d", c.errs, service.calls, c.calls)
+		}
+		service.mu.Unlock()
+	}
+}
+
+func TestGRPCStatusErrorKeepsContextErrors(t *testing.T) {
+	if err := grpcStatusError(status.Error(codes.DeadlineExceeded, "slow")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deadline mapped to %v", err)
+	}
+	if err := grpcStatusError(status.Error(codes.Canceled, "gone")); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancellation mapped to %v", err)
+	}
+	plain := errors.New("read audio: broken")
+	if err := grpcStatusError(plain); err != plain {
+		t.Errorf("non-status error mapped to %v", err)
+	}
+}
+
+func TestGRPCProbe(t *testing.T) {
+	healthServer := health.NewServer()
+	recognizer := newGRPCTestRecognizer(t, &fakeRecognitionService{}, healthServer)
+	if err := recognizer.Probe(context.Background()); err != nil {
+		t.Errorf("serving service probed as %v", err)
+	}
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := recognizer.Probe(context.Background()); err == nil {
+		t.Error("service not serving probed as healthy")
+	}
+
+	// Without a health service any answer will do
+	if err := newGRPCTestRecognizer(t, &fakeRecognitionService{}, nil).Probe(context.Background()); err != nil {
+		t.Errorf("service without health checks probed as %v", err)
+	}
+}
@@ -1,169 +1,610 @@
 package handleAudio
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
+	"path"
+	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"telegram-sr-bot/breaker"
+	"telegram-sr-bot/cache"
+	"telegram-sr-bot/chaos"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/pending"
+	"telegram-sr-bot/quota"
+	"telegram-sr-bot/sanitize"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/settings"
+	"telegram-sr-bot/transform"
 )
 
+// Transforms post-processes every transcript before it is sent; nil leaves
+// transcripts untouched.
+var Transforms *transform.Chain
+
+// Cache answers audio that was transcribed before, in this chat or another
+// one; nil transcribes every message.
+var Cache cache.Cache
+
+// Chaos is consulted by every stage and may inject faults for testing.
+var Chaos chaos.Injector = chaos.Noop{}
+
+// Circuit turns messages away while the recognition backend keeps failing,
+// before their audio is downloaded; nil always tries.
+var Circuit *breaker.Breaker
+
+// MaxVideoNoteDuration caps the length of video notes that are transcribed,
+// zero accepts any length.
+var MaxVideoNoteDuration = time.Minute
+
+// RecognitionTimeout bounds the whole handling of a message, download,
+// upload and decode share it.
+var RecognitionTimeout = 120 * time.Second
+
+// DownloadTimeout bounds the download of the file from Telegram.
+var DownloadTimeout = 30 * time.Second
+
+// UploadTimeout chooses the deadline of the recognition upload.
+var UploadTimeout = NewAdaptiveTimeout(10*time.Second, 1, 15*time.Second, 10*time.Minute)
+
 var AudioMessageCounter = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "audio_messages_processed_total",
 		Help: "Total number of processed audio messages.",
 	},
-	[]string{"status"}, // Status can be "success" or "error"
+	[]string{"status", "source"}, // Status can be "success", "error", "timeout", "rejected_too_large", "circuit_open", "auth_failed", "quota_exceeded", "empty_result" or "accepted", source is the AudioSource kind
 )
 
-func AudioMessageHandle(bot *tgbotapi.BotAPI, message *tgbotapi.Message, endpoint string) {
-	ctx, span := otel.Tracer("telegram-sr-bot").Start(context.Background(), "handleAudioMessage")
-	defer span.End()
+// MessageSender delivers messages and other requests to Telegram, as
+// *tgbotapi.BotAPI does.
+type MessageSender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
 
-	var fileID string
-	var processStatus = "success" // Initially assume success, update to "error" as needed
+// Handler transcribes audio messages: it fetches the file, has it
+// recognized and replies with the transcription.
+type Handler struct {
+	fetcher    TelegramFileFetcher
+	recognizer Recognizer
+	sender     MessageSender
+	edits      *sender.EditThrottler // Every edit of a reply goes through it
+	settings   settings.Store
+	followUps  *followUps
+}
 
-	if message.Voice != nil {
-		fileID = message.Voice.FileID
-	} else if message.Audio != nil {
-		fileID = message.Audio.FileID
-	} else {
-		log.Error().Msg("No audio or voice message found.")
-		processStatus = "error"
-		span.RecordError(errors.New("no audio or voice message found"))
-		span.SetStatus(codes.Error, "No audio or voice message found")
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
-		return
+// NewHandler returns a handler built from its dependencies.
+func NewHandler(fetcher TelegramFileFetcher, recognizer Recognizer, sender MessageSender, edits *sender.EditThrottler, store settings.Store) *Handler {
+	return &Handler{fetcher: fetcher, recognizer: recognizer, sender: sender, edits: edits, settings: store, followUps: newFollowUps()}
+}
+
+// Handle processes a single audio message, transcribed at the request of
+// request, and replies to it, reporting any failure to the user. The
+// requester is charged against the daily quota.
+func (h *Handler) Handle(ctx context.Context, request, message *tgbotapi.Message) {
+	h.handle(ctx, message, handleOptions{requester: request})
+}
+
+// HandleSRT is Handle replying with subtitles whatever the chat settings
+// say, as long as the backend returns timestamps.
+func (h *Handler) HandleSRT(ctx context.Context, request, message *tgbotapi.Message) {
+	h.handle(ctx, message, handleOptions{requester: request, srt: true})
+}
+
+// handleOptions adjust the handling of a single message.
+type handleOptions struct {
+	// retry transcribes the message again rather than answering it from the
+	// cache.
+	retry bool
+	// srt replies with subtitles even if the chat did not ask for them.
+	srt bool
+	// requester asked for the transcription and pays for it, nil charges
+	// nobody.
+	requester *tgbotapi.Message
+}
+
+func (h *Handler) handle(ctx context.Context, message *tgbotapi.Message, options handleOptions) {
+	ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "handleAudioMessage")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, recognitionTimeout())
+	defer cancel()
+	// Every log line of the message carries who sent it and its trace
+	logContext := log.With().Ctx(ctx).
+		Int64("chat_id", message.Chat.ID).
+		Int("message_id", message.MessageID).
+		Str("trace_id", span.SpanContext().TraceID().String())
+	if message.From != nil {
+		logContext = logContext.Int64("user_id", message.From.ID)
 	}
+	logger := logContext.Logger()
 
-	fileURL, err := bot.GetFileDirectURL(fileID)
+	start := time.Now()
+	result := &MessageResult{
+		ChatID:     message.Chat.ID,
+		MessageID:  message.MessageID,
+		ReceivedAt: start,
+		Endpoint:   h.recognizer.Endpoint(),
+		Model:      ModelInfo{Name: unknownModel, Version: unknownModel},
+		SourceType: "unknown",
+		Status:     "success", // Initially assume success, fail updates it to "error"
+		Delivery:   "none",
+	}
+	// Account for the message exactly once, however the handler returns
+	defer func() {
+		result.Duration = time.Since(start)
+		span.AddEvent("summary", trace.WithAttributes(result.attributes()...))
+		AudioMessageCounter.With(prometheus.Labels{"status": result.Status, "source": result.SourceType}).Inc()
+		observeMetrics(result)
+		Recorder.Add(*result)
+		switch {
+		case result.Delivery == "pending":
+			// The callback settles it
+		case result.Status == "success" && result.Delivery == "sent":
+			Reactions.react(logger, message.Chat.ID, message.MessageID, ReactionDone)
+		default:
+			Reactions.react(logger, message.Chat.ID, message.MessageID, ReactionFailed)
+		}
+	}()
+	Reactions.react(logger, message.Chat.ID, message.MessageID, ReactionWorking)
+	chat, err := h.settings.Get(message.Chat.ID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get file URL")
-		processStatus = "error"
+		logger.Warn().Err(err).Msg("Failed to read the chat settings, using the defaults")
+	}
+	texts := messages.For(chat.UILanguage, messages.UserLanguage(message.From))
+	placeholder := ""
+	if placeholdersEnabled(chat) {
+		placeholder = texts.Get(messages.Placeholder)
+	}
+	replies := newReplier(ctx, h.sender, h.edits, message, logger, placeholder)
+	defer replies.close()
+	// fail records why the message could not be processed and tells the user
+	fail := func(err error, msg, userReply string) {
+		logger.Error().Err(err).Msg(msg)
+		result.Status = "error"
+		result.Error = msg
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Status = "timeout"
+			userReply = texts.Get(messages.TimedOut)
+		}
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to get file URL")
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+		span.SetStatus(codes.Error, msg)
+
+		if err := replies.send(userReply); err != nil {
+			logger.Error().Err(err).Msg("Failed to send error reply to the Telegram user")
+			result.Delivery = "failed"
+		} else {
+			result.Delivery = "error_reply"
+		}
+	}
+
+	// reject declines audio beyond the configured limits
+	reject := func(err error, msg, userReply string) {
+		fail(err, msg, userReply)
+		result.Status = "rejected_too_large"
+	}
+
+	// deliver transforms a transcription and replies with it
+	deliver := func(source AudioSource, recognition RecognitionSuccess) {
+		if emptyTranscript(recognition.RecognizedText, Fillers) {
+			// A blank transcript looks like the bot broke, say what happened
+			logger.Info().Msg("No speech detected in the audio")
+			result.Status = "empty_result"
+			if err := replies.send(texts.Get(messages.NoSpeech)); err != nil {
+				logger.Error().Err(err).Msg("Failed to send recognition response to the Telegram user")
+				result.Delivery = "failed"
+			} else {
+				result.Delivery = "sent"
+			}
+			return
+		}
+		recognition.RecognizedText = Transforms.Apply(ctx, recognition.RecognizedText, recognition.DetectedLang)
+		result.DetectedLang = recognition.DetectedLang
+		detected := languageLabel(recognition.DetectedLang)
+		RecognitionsByLanguage.With(prometheus.Labels{"language": detected}).Inc()
+		span.SetAttributes(attribute.String("recognition.language", detected))
+		result.TranscriptLen = utf8.RuneCountInString(recognition.RecognizedText)
+		if RecordTranscripts {
+			result.Transcript = recognition.RecognizedText
+		}
+
+		// Send the response back to the user
+		sendStart := time.Now()
+		sendCtx, sendSpan := otel.Tracer("telegram-sr-bot").Start(ctx, "send reply")
+		err := Chaos.Inject(sendCtx, "send")
+		if err == nil {
+			err = h.sendTranscript(logger, replies, texts, chat, options.srt || chat.SRT, source, message, recognition, true)
+		}
+		if err != nil {
+			sendSpan.RecordError(err)
+			sendSpan.SetStatus(codes.Error, "Failed to send reply")
+		}
+		sendSpan.End()
+		result.stage("send", sendStart)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to send recognition response to the Telegram user")
+			result.Delivery = "failed"
+		} else {
+			result.Delivery = "sent"
+		}
+	}
+
+	source, ok := ExtractAudioSource(message)
+	if !ok {
+		fail(errors.New("no audio or voice message found"), "No audio or voice message found", texts.Get(messages.InternalError))
+		return
+	}
+	result.SourceType = source.Kind
+	result.AudioDuration = source.Duration
+	logger = logger.With().Str("source", source.Kind).Str("file_id", source.FileID).Logger()
+	span.SetAttributes(
+		attribute.String("audio.source", source.Kind),
+		attribute.Float64("audio.duration_seconds", result.AudioDuration.Seconds()),
+	)
+	if source.Kind == "video_note" && MaxVideoNoteDuration > 0 && source.Duration > MaxVideoNoteDuration {
+		reject(fmt.Errorf("video note is %s long, the limit is %s", source.Duration, MaxVideoNoteDuration),
+			"Video note is too long", texts.Get(messages.VideoNoteTooLong, MaxVideoNoteDuration))
+		return
+	}
+	if source.NeedsTranscode && Extractor == nil {
+		fail(errors.New("video transcription is disabled"), "Video transcription is disabled", texts.Get(messages.VideoDisabled))
+		return
+	}
+	// Check the sizes Telegram reports before downloading anything
+	maxBytes, maxDuration := source.limits()
+	if maxBytes > 0 && source.FileSize > maxBytes {
+		reject(fmt.Errorf("file of %d bytes exceeds the limit of %d bytes", source.FileSize, maxBytes),
+			"Audio file is too large", texts.Get(messages.TooLarge, maxBytes>>20))
+		return
+	}
+	if maxDuration > 0 && source.Duration > maxDuration {
+		reject(fmt.Errorf("audio of %s exceeds the limit of %s", source.Duration, maxDuration),
+			"Audio is too long", texts.Get(messages.TooLong, maxDuration))
 		return
 	}
 
-	// Download the audio file
-	resp, err := http.Get(fileURL)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Error().Err(err).Msg("Failed to download the audio file")
-		processStatus = "error"
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to download the audio file")
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+	// Forwarded audio keeps its FileUniqueID, a forced language changes the result
+	cacheKey := source.FileUniqueID + "/" + chat.Language
+	if cached, ok := lookupCache(ctx, logger, source, cacheKey); ok && !options.retry {
+		result.CacheHit = true
+		span.SetAttributes(attribute.Bool("recognition.cache_hit", true))
+		CacheHitCounter.With(prometheus.Labels{"source": source.Kind}).Inc()
+		deliver(source, fromCache(cached))
+		logger.Info().Msg("Answered from the recognition cache")
 		return
 	}
-	defer resp.Body.Close()
 
-	// Create a temporary file to save the downloaded audio
-	tempFile, err := os.CreateTemp("", "audio-*.ogg")
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create a temporary file")
-		processStatus = "error"
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to create a temporary file")
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+	// Spare the download while the backend is known to be down
+	ticket, allowed := Circuit.Allow(time.Now())
+	if !allowed {
+		fail(errors.New("recognition circuit breaker is open"), "Recognition service unavailable", texts.Get(messages.ServiceUnavailable))
+		result.Status = "circuit_open"
 		return
 	}
-	defer tempFile.Close()
-	defer os.Remove(tempFile.Name()) // Ensure the temp file is removed after execution
+	circuitOutcome := breaker.Skipped
+	defer func() { Circuit.Done(ticket, circuitOutcome, time.Now()) }()
 
-	// Write the downloaded content to the temp file
-	if _, err := io.Copy(tempFile, resp.Body); err != nil {
-		log.Error().Err(err).Msg("Failed to save the audio file to a temp file")
-		processStatus = "error"
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to save the audio file to a temp file")
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+	// The quota comes last, whatever was turned down before costs nothing
+	decision := reserveQuota(logger, options.requester, source)
+	if !decision.Allowed {
+		quota.ExceededCounter.Inc()
+		logger.Info().Dur("remaining", decision.Remaining).Msg("Message refused by the daily quota")
+		result.Status = "quota_exceeded"
+		hours, minutes := decision.ResetsIn(time.Now())
+		if err := replies.send(texts.Get(messages.QuotaExceeded, decision.RemainingSeconds(), hours, minutes)); err != nil {
+			logger.Error().Err(err).Msg("Failed to tell the user about the daily quota")
+			result.Delivery = "failed"
+		} else {
+			result.Delivery = "error_reply"
+		}
 		return
 	}
+	charge := decision.Charge
+	defer func() {
+		// Only transcripts count, a pending job settles its charge itself
+		if result.Status != "success" && result.Delivery != "pending" {
+			refundQuota(logger, charge)
+		}
+	}()
 
-	// Prepare the request with the temp file for uploading
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	_, err = tempFile.Seek(0, io.SeekStart) // Rewind the temp file to read from the beginning
+	downloadStart := time.Now()
+	downloadCtx, downloadSpan := otel.Tracer("telegram-sr-bot").Start(ctx, "download from Telegram")
+	defer downloadSpan.End()
+	content, err := h.fetcher.Fetch(downloadCtx, source.FileID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to rewind temp file")
-		processStatus = "error"
-		span.RecordError(err)
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+		fail(err, "Failed to download the audio file", texts.Get(messages.DownloadFailed))
 		return
 	}
-	part, err := writer.CreateFormFile("file", "audio.ogg") // Adjusted form field name to "file"
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create form file for upload")
-		processStatus = "error"
-		span.RecordError(err)
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+	defer content.Close()
+
+	var audio io.ReaderAt // Small downloads stay in memory, anything else is a file
+	audioFile, mounted := content.(*os.File)
+	if mounted {
+		info, err := audioFile.Stat()
+		if err != nil {
+			fail(err, "Failed to read the audio file from the local mount", texts.Get(messages.DownloadFailed))
+			return
+		}
+		result.BytesDownloaded = info.Size()
+	} else {
+		// Whatever ffmpeg reads has to be a file
+		inMemory := !source.NeedsTranscode && Transcoder == nil && source.FileSize > 0 && source.FileSize <= InMemoryUploadLimit
+		staged, err := stageAudio(content, inMemory, path.Ext(source.UploadName()), maxBytes)
+		switch {
+		case errors.Is(err, errStageCreate):
+			fail(err, "Failed to create a temporary file", texts.Get(messages.InternalError))
+			return
+		case errors.Is(err, errStageWrite):
+			fail(err, "Failed to save the audio file to a temp file", texts.Get(messages.DownloadFailed))
+			return
+		case err != nil:
+			fail(err, "Failed to download the audio file", texts.Get(messages.DownloadFailed))
+			return
+		}
+		defer staged.Close()
+		audio, audioFile, result.BytesDownloaded = staged.audio, staged.file, staged.size
+	}
+	// The reported size can be wrong, check what actually arrived
+	if maxBytes > 0 && result.BytesDownloaded > maxBytes {
+		reject(fmt.Errorf("downloaded file exceeds the limit of %d bytes", maxBytes),
+			"Audio file is too large", texts.Get(messages.TooLarge, maxBytes>>20))
 		return
 	}
-	if _, err = io.Copy(part, tempFile); err != nil {
-		log.Error().Err(err).Msg("Failed to copy temp file content to form file")
-		processStatus = "error"
-		span.RecordError(err)
-		AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+	result.stage("download", downloadStart)
+	downloadSpan.SetAttributes(attribute.Int64("download.bytes", result.BytesDownloaded))
+	span.SetAttributes(attribute.Int64("audio.size_bytes", result.BytesDownloaded))
+	downloadSpan.End()
+	audioSize := result.BytesDownloaded
+	if audio == nil {
+		audio = audioFile
+	}
+
+	// Name and type the upload after the real format, the backend picks its decoder by them
+	head := make([]byte, 512)
+	n, _ := audio.ReadAt(head, 0)
+	uploadName, uploadType := source.uploadFormat(head[:n])
+	if source.NeedsTranscode {
+		extractStart := time.Now()
+		audioPath, err := Extractor.ExtractAudio(ctx, audioFile.Name())
+		if err != nil {
+			fail(err, "Failed to extract the audio track", texts.Get(messages.ExtractFailed))
+			return
+		}
+		defer os.Remove(audioPath)
+		if audioFile, err = os.Open(audioPath); err != nil {
+			fail(err, "Failed to open the extracted audio", texts.Get(messages.InternalError))
+			return
+		}
+		defer audioFile.Close()
+		info, err := audioFile.Stat()
+		if err != nil {
+			fail(err, "Failed to open the extracted audio", texts.Get(messages.InternalError))
+			return
+		}
+		audio, audioSize = audioFile, info.Size()
+		uploadName, uploadType = "audio"+path.Ext(audioPath), FFmpegContentType
+		result.stage("extract", extractStart)
+	}
+	if Transcoder != nil {
+		transcodeStart := time.Now()
+		// The backend decodes the original too, just slower, so a failure here is no reason to give up
+		if transcoded, size, err := transcode(ctx, audioFile.Name()); err != nil {
+			logger.Warn().Err(err).Msg("Failed to transcode the audio, uploading it as it was sent")
+		} else {
+			defer os.Remove(transcoded.Name())
+			defer transcoded.Close()
+			audio, audioSize = transcoded, size
+			uploadName, uploadType = "audio.wav", TranscodeContentType
+			result.stage("transcode", transcodeStart)
+		}
+	}
+
+	// The job is stored before the upload, the result may come back before the upload returns
+	var job pending.Job
+	callbackURL := ""
+	if Callbacks != nil {
+		job = pending.Job{
+			Token:         newJobToken(),
+			ChatID:        message.Chat.ID,
+			MessageID:     message.MessageID,
+			PlaceholderID: replies.placeholderID,
+			Language:      texts.Language(),
+			FileName:      source.FileName,
+			Source:        source.Kind,
+			Duration:      source.Duration,
+			Sent:          message.Time(),
+			SRT:           options.srt || chat.SRT,
+			Expires:       time.Now().Add(Callbacks.ttl),
+			Charge:        charge,
+		}
+		if source.FileUniqueID != "" {
+			job.CacheKey = cacheKey
+		}
+		if err := Callbacks.jobs.Add(job); err != nil {
+			fail(err, "Failed to store the pending job", texts.Get(messages.InternalError))
+			return
+		}
+		callbackURL = Callbacks.urlFor(job.Token)
+	}
+
+	uploadStart := time.Now()
+	recognition, err := h.recognizer.Recognize(ctx, io.NewSectionReader(audio, 0, audioSize), RecognitionRequest{
+		Filename:    uploadName,
+		ContentType: uploadType,
+		Duration:    source.Duration,
+		Language:    chat.Language, // A language forced for the chat overrides detection
+		Progress: func(elapsed time.Duration) {
+			replies.progress(texts.Get(messages.PlaceholderElapsed, elapsed.Round(time.Second)))
+		},
+		CallbackURL: callbackURL,
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+	case backendFailed(err):
+		circuitOutcome = breaker.Failure
+	default:
+		circuitOutcome = breaker.Success
+	}
+	if recognition.Accepted {
+		// Counted once the result arrives, or does not
+		result.Status = "accepted"
+		result.Delivery = "pending"
+		logger.Info().Msg("Recognition accepted, the result is delivered by callback")
 		return
 	}
-	err = writer.Close()
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to close writer")
-		log.Error().Err(err).Msg("Failed to close writer")
+	if Callbacks != nil {
+		// Answered right away or failed, nothing is coming back
+		if _, _, err := Callbacks.jobs.Take(job.Token); err != nil {
+			logger.Warn().Err(err).Msg("Failed to remove the pending job")
+		}
+	}
+	result.stage("upload", uploadStart) // Failed uploads count towards the backend latency too
+	result.Model = recognition.Model
+	result.BytesUploaded = recognition.BytesUploaded
+	result.Retries = recognition.Retries
+	if recognition.Endpoint != "" {
+		result.Endpoint = recognition.Endpoint
+	}
+	span.SetAttributes(
+		attribute.String("recognition.model_name", recognition.Model.Name),
+		attribute.String("recognition.model_version", recognition.Model.Version),
+	)
+	if errors.Is(err, errBadResponse) {
+		fail(err, "Failed to decode recognition response", texts.Get(messages.UnexpectedResponse))
+		return
+	}
+	if authFailed(err) {
+		// Nothing the user can fix, the operators have to
+		fail(err, "Authentication with the recognition service failed", texts.Get(messages.ServiceUnavailable))
+		result.Status = "auth_failed"
 		return
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create a new request for uploading temp file")
-		processStatus = "error"
-		span.RecordError(err)
+		userReply := texts.Get(messages.ServiceUnavailable)
+		var statusErr *statusError
+		var jobErr *jobError
+		if errors.As(err, &statusErr) && statusErr.permanent() && statusErr.message != "" {
+			userReply = texts.Get(messages.Rejected, statusErr.message)
+		} else if errors.As(err, &jobErr) && jobErr.message != "" {
+			userReply = texts.Get(messages.Rejected, jobErr.message)
+		}
+		fail(err, "Failed to upload the temp file", userReply)
 		return
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if Cache != nil && source.FileUniqueID != "" {
+		if err := Cache.Add(ctx, cacheKey, toCache(recognition.RecognitionSuccess)); err != nil {
+			logger.Warn().Err(err).Msg("Failed to cache the recognition result")
+		}
+	}
+	deliver(source, recognition.RecognitionSuccess)
 
-	client := &http.Client{}
-	resp, err = client.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Error().Err(err).Msg("Failed to upload the temp file")
-		processStatus = "error"
-		span.RecordError(err)
-		return
+	logger.Info().Msg("Temporary audio file successfully uploaded")
+	span.AddEvent("Temporary audio file uploaded", trace.WithAttributes(attribute.String("filename", sanitize.String(uploadName, sanitize.LogField))))
+}
+
+// sendTranscript replies with recognition of source, sent in message. It is
+// sent as subtitles if srt asks for them and there are timestamps to build
+// them from, as a text file if it is longer than the chat's threshold and
+// as messages otherwise. buttons offers retrying and translating, retrying
+// needs message to still carry its audio.
+func (h *Handler) sendTranscript(logger zerolog.Logger, replies *replier, texts *messages.Bundle, chat settings.Settings, srt bool,
+	source AudioSource, message *tgbotapi.Message, recognition RecognitionSuccess, buttons bool) error {
+	// Subtitles replace the text when asked for
+	var subtitles string
+	if srt {
+		if subtitles = formatSRT(recognition.Segments); subtitles == "" {
+			logger.Info().Msg("No segments to build subtitles from, replying with text")
+		}
 	}
-	defer resp.Body.Close()
-	// Parse the response
-	var recognition RecognitionSuccess
-	if err := json.NewDecoder(resp.Body).Decode(&recognition); err != nil {
-		log.Error().Err(err).Msg("Failed to decode recognition response")
-		processStatus = "error"
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to decode recognition response")
-		return
+	if subtitles != "" {
+		doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: srtFileName, Bytes: []byte(subtitles)})
+		doc.Caption = texts.Get(messages.SubtitlesCaption, recognition.DetectedLang)
+		return replies.sendDocument(doc)
 	}
-	// Construct the response message
-	responseMsg := fmt.Sprintf("Detected language: %s\nRecognized text: %s", recognition.DetectedLang, recognition.RecognizedText)
+	if threshold := documentThreshold(chat); threshold > 0 && utf8.RuneCountInString(recognition.RecognizedText) > threshold {
+		// Long transcripts are easier to read as one file than as a dozen messages
+		doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+			Name:  documentName(source, message),
+			Bytes: []byte(recognition.RecognizedText),
+		})
+		doc.Caption = documentSummary(texts, source.Duration, recognition.DetectedLang)
+		return replies.sendDocument(doc)
+	}
+	// Long transcriptions take several messages
+	layout := layoutTranscript(texts, recognition.DetectedLang, recognition.RecognizedText, maxMessageLength)
+	if !buttons {
+		return replies.sendFormatted(nil, layout...)
+	}
+	key := h.followUps.add(&followUp{
+		message:  message,
+		text:     recognition.RecognizedText,
+		language: recognition.DetectedLang,
+		reply:    layout[len(layout)-1],
+		expires:  time.Now().Add(FollowUpTTL),
+	})
+	return replies.sendFormatted(keyboard(texts, key, recognition.DetectedLang), layout...)
+}
 
-	// Send the response back to the user
-	msg := tgbotapi.NewMessage(message.Chat.ID, responseMsg)
-	if _, err := bot.Send(msg); err != nil {
-		log.Error().Err(err).Msg("Failed to send recognition response to the Telegram user")
+// toCache and fromCache convert recognitions to and from cached results.
+func toCache(recognition RecognitionSuccess) cache.Result {
+	result := cache.Result{Language: recognition.DetectedLang, Text: recognition.RecognizedText}
+	for _, segment := range recognition.Segments {
+		result.Segments = append(result.Segments, cache.Segment(segment))
 	}
+	return result
+}
 
-	log.Info().Msg("Temporary audio file successfully uploaded")
-	span.AddEvent("Temporary audio file uploaded", trace.WithAttributes(attribute.String("filename", tempFile.Name())))
-	AudioMessageCounter.With(prometheus.Labels{"status": processStatus}).Inc()
+func fromCache(result cache.Result) RecognitionSuccess {
+	recognition := RecognitionSuccess{DetectedLang: result.Language, RecognizedText: result.Text}
+	for _, segment := range result.Segments {
+		recognition.Segments = append(recognition.Segments, Segment(segment))
+	}
+	return recognition
+}
+
+// lookupCache returns the cached result of source, if any. A failing cache
+// counts as a miss, the audio is then transcribed as usual.
+func lookupCache(ctx context.Context, logger zerolog.Logger, source AudioSource, key string) (cache.Result, bool) {
+	if Cache == nil || source.FileUniqueID == "" {
+		return cache.Result{}, false
+	}
+	cached, ok, err := Cache.Get(ctx, key)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to read the recognition cache")
+		return cache.Result{}, false
+	}
+	return cached, ok
+}
+
+// RejectUnsupportedDocument politely tells the user that a document which is
+// not audio cannot be transcribed.
+func (h *Handler) RejectUnsupportedDocument(message *tgbotapi.Message) {
+	reply := tgbotapi.NewMessage(message.Chat.ID, h.texts(message.Chat.ID, message.From).Get(messages.UnsupportedDocument))
+	reply.ReplyToMessageID = message.MessageID
+	reply.AllowSendingWithoutReply = true
+	if _, err := sender.SendMessage(h.sender, reply); err != nil {
+		log.Error().Err(err).Int64("chat_id", message.Chat.ID).Int("message_id", message.MessageID).
+			Msg("Failed to reply to an unsupported document")
+	}
+}
+
+// texts returns the replies for user in chatID, in the language the chat
+// chose or else in the language of user's Telegram app.
+func (h *Handler) texts(chatID int64, user *tgbotapi.User) *messages.Bundle {
+	chat, err := h.settings.Get(chatID)
+	if err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("Failed to read the chat settings, using the defaults")
+	}
+	return messages.For(chat.UILanguage, messages.UserLanguage(user))
 }
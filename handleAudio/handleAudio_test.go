@@ -0,0 +1,248 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"telegram-sr-bot/cache"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/settings"
+)
+
+// oggHead is the start of an Ogg Opus file, enough for the format sniffing.
+var oggHead = append([]byte("OggS\x00\x02"), make([]byte, 64)...)
+
+// fakeFetcher serves the same audio for every file, or fails with err.
+type fakeFetcher struct {
+	audio []byte
+	err   error
+}
+
+func (f fakeFetcher) Fetch(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return io.NopCloser(bytes.NewReader(f.audio)), nil
+}
+
+// fakeRecognizer answers every upload with result and err, recording what
+// it was sent.
+type fakeRecognizer struct {
+	result RecognitionResult
+	err    error
+
+	mu       sync.Mutex
+	requests []RecognitionRequest
+	uploads  [][]byte
+}
+
+func (f *fakeRecognizer) Recognize(ctx context.Context, audio io.Reader, req RecognitionRequest) (RecognitionResult, error) {
+	data, err := io.ReadAll(audio)
+	if err != nil {
+		return RecognitionResult{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	f.uploads = append(f.uploads, data)
+	return f.result, f.err
+}
+
+func (f *fakeRecognizer) Endpoint() string                { return "fake" }
+func (f *fakeRecognizer) Probe(ctx context.Context) error { return nil }
+
+// sentRequest is a request made to fakeBot, and the endpoint for raw ones.
+type sentRequest struct {
+	endpoint  string
+	chattable tgbotapi.Chattable
+	params    tgbotapi.Params
+}
+
+// fakeBot stands in for Telegram, accepting every request.
+type fakeBot struct {
+	mu       sync.Mutex
+	requests []sentRequest
+	nextID   int
+}
+
+func (b *fakeBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, sentRequest{chattable: c})
+	b.nextID++
+	var chatID int64
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		chatID = c.ChatID
+	case tgbotapi.DocumentConfig:
+		chatID = c.ChatID
+	}
+	return tgbotapi.Message{MessageID: 1000 + b.nextID, Chat: &tgbotapi.Chat{ID: chatID}}, nil
+}
+
+func (b *fakeBot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, sentRequest{chattable: c})
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (b *fakeBot) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, sentRequest{endpoint: endpoint, params: params})
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+// texts returns the texts of the messages sent.
+// snapshot returns a copy of the requests made so far.
+func (b *fakeBot) snapshot() []sentRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]sentRequest(nil), b.requests...)
+}
+
+func (b *fakeBot) texts() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var texts []string
+	for _, r := range b.requests {
+		if msg, ok := r.chattable.(tgbotapi.MessageConfig); ok {
+			texts = append(texts, msg.Text)
+		}
+	}
+	return texts
+}
+
+// raw returns the raw requests made to endpoint.
+func (b *fakeBot) raw(endpoint string) []tgbotapi.Params {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var params []tgbotapi.Params
+	for _, r := range b.requests {
+		if r.endpoint == endpoint {
+			params = append(params, r.params)
+		}
+	}
+	return params
+}
+
+// newTestHandler returns a handler fetching from fetcher and recognizing
+// with recognizer, talking to the returned fake Telegram.
+func newTestHandler(fetcher TelegramFileFetcher, recognizer Recognizer) (*Handler, *fakeBot) {
+	bot := &fakeBot{}
+	return NewHandler(fetcher, recognizer, bot, sender.NewEditThrottler(bot, 0), settings.NewMemory()), bot
+}
+
+// voiceMessage returns a voice message of duration sent by user 7 in a
+// private chat.
+func voiceMessage(duration time.Duration) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: 7, LanguageCode: "en"},
+		Chat:      &tgbotapi.Chat{ID: 7, Type: "private"},
+		Voice:     &tgbotapi.Voice{FileID: "file", FileUniqueID: "unique", Duration: int(duration / time.Second), FileSize: len(oggHead)},
+	}
+}
+
+// recognized returns a successful recognition of text in English.
+func recognized(text string) RecognitionResult {
+	return RecognitionResult{RecognitionSuccess: RecognitionSuccess{DetectedLang: "en", RecognizedText: text}}
+}
+
+// errBackend is what a failing fake backend answers with.
+var errBackend = errors.New("backend down")
+
+// setVar sets *v to value for the rest of the test.
+func setVar[T any](t *testing.T, v *T, value T) {
+	t.Helper()
+	old := *v
+	*v = value
+	t.Cleanup(func() { *v = old })
+}
+
+func TestHandlerTranscribesThroughItsParts(t *testing.T) {
+	recognizer := &fakeRecognizer{result: recognized("hello there")}
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, recognizer)
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	if len(recognizer.uploads) != 1 || !bytes.Equal(recognizer.uploads[0], oggHead) {
+		t.Fatalf("recognizer got %d uploads, want the fetched audio once", len(recognizer.uploads))
+	}
+	if req := recognizer.requests[0]; req.Duration != 5*time.Second {
+		t.Errorf("upload declared %s, want the voice duration", req.Duration)
+	}
+	var reply *tgbotapi.MessageConfig
+	for _, r := range bot.snapshot() {
+		if msg, ok := r.chattable.(tgbotapi.MessageConfig); ok && strings.Contains(msg.Text, "hello there") {
+			reply = &msg
+		}
+	}
+	if reply == nil {
+		t.Fatalf("no reply with the transcript among %q", bot.texts())
+	}
+	if reply.ChatID != message.Chat.ID || reply.ReplyToMessageID != message.MessageID {
+		t.Errorf("transcript sent to message %d in chat %d, want a reply to the voice message", reply.ReplyToMessageID, reply.ChatID)
+	}
+}
+
+func TestHandlerReportsFailuresToTheUser(t *testing.T) {
+	for name, c := range map[string]struct {
+		fetcher    TelegramFileFetcher
+		recognizer *fakeRecognizer
+		reply      messages.Key
+	}{
+		"download": {fakeFetcher{err: errBackend}, &fakeRecognizer{}, messages.DownloadFailed},
+		"backend":  {fakeFetcher{audio: oggHead}, &fakeRecognizer{err: errBackend}, messages.ServiceUnavailable},
+	} {
+		t.Run(name, func(t *testing.T) {
+			handler, bot := newTestHandler(c.fetcher, c.recognizer)
+			message := voiceMessage(5 * time.Second)
+			handler.Handle(context.Background(), message, message)
+			if texts, want := bot.texts(), messages.For("en").Get(c.reply); len(texts) != 1 || texts[0] != want {
+				t.Errorf("replies %q, want %q", texts, want)
+			}
+		})
+	}
+}
+
+func TestHandlerTranscribesForwardedAudioOnce(t *testing.T) {
+	setVar(t, &Cache, cache.Cache(cache.NewLRU(10, time.Hour)))
+	recognizer := &fakeRecognizer{result: recognized("hello there")}
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, recognizer)
+	hits := testutil.ToFloat64(CacheHitCounter.With(prometheus.Labels{"source": "voice"}))
+
+	first := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), first, first)
+	// The same file forwarded into another chat
+	forwarded := voiceMessage(5 * time.Second)
+	forwarded.Chat = &tgbotapi.Chat{ID: 8, Type: "private"}
+	handler.Handle(context.Background(), forwarded, forwarded)
+
+	if len(recognizer.uploads) != 1 {
+		t.Errorf("%d uploads, want the forwarded copy answered from the cache", len(recognizer.uploads))
+	}
+	if got := testutil.ToFloat64(CacheHitCounter.With(prometheus.Labels{"source": "voice"})) - hits; got != 1 {
+		t.Errorf("%v cache hits, want 1", got)
+	}
+	transcripts := 0
+	for _, text := range bot.texts() {
+		if strings.Contains(text, "hello there") {
+			transcripts++
+		}
+	}
+	if transcripts != 2 {
+		t.Errorf("%d transcripts sent, want one per chat", transcripts)
+	}
+}
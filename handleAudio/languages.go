@@ -0,0 +1,44 @@
+package handleAudio
+
+import (
+	"sort"
+	"strings"
+)
+
+// SupportedLanguages are the ISO 639-1 codes the recognition model can
+// detect and be asked to use, sorted.
+var SupportedLanguages = strings.Fields(`
+	af am ar as az ba be bg bn bo br bs ca cs cy da de el en es et eu fa fi fo fr gl gu ha
+	he hi hr ht hu hy id is it ja jw ka kk km kn ko la lb ln lo lt lv mg mi mk ml mn mr ms
+	mt my ne nl nn no oc pa pl ps pt ro ru sa sd si sk sl sn so sq sr su sv sw ta te tg th
+	tk tl tr tt uk ur uz vi yi yo yue zh`)
+
+// knownLanguages indexes SupportedLanguages, it also bounds the cardinality
+// of the language metric label.
+var knownLanguages = map[string]bool{}
+
+func init() {
+	sort.Strings(SupportedLanguages)
+	for _, code := range SupportedLanguages {
+		knownLanguages[code] = true
+	}
+}
+
+// NormalizeLanguage maps lang to a supported code, "en-US" becomes "en".
+// It reports false for languages the model does not know.
+func NormalizeLanguage(lang string) (string, bool) {
+	code := strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	return code, knownLanguages[code]
+}
+
+// languageLabel is the metric label for a detected language, "other" for
+// anything unknown.
+func languageLabel(lang string) string {
+	if code, ok := NormalizeLanguage(lang); ok {
+		return code
+	}
+	return "other"
+}
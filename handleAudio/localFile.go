@@ -0,0 +1,81 @@
+package handleAudio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// FileLocator looks up where the Bot API keeps a file, as *tgbotapi.BotAPI
+// does.
+type FileLocator interface {
+	GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error)
+}
+
+// MountedFileFetcher is a TelegramFileFetcher reading files from a volume
+// shared with a local Bot API server. In local mode the server reports
+// file_path as an absolute path of its own, such as
+// /var/lib/telegram-bot-api/<token>/voice/file_0.oga; prefix is the part
+// of it the volume is mounted in place of, in that example
+// /var/lib/telegram-bot-api. Relative paths are taken relative to mount.
+type MountedFileFetcher struct {
+	files  FileLocator
+	mount  string
+	prefix string
+}
+
+// NewMountedFileFetcher returns a fetcher looking files up with files and
+// reading them from mount.
+func NewMountedFileFetcher(files FileLocator, mount, prefix string) *MountedFileFetcher {
+	return &MountedFileFetcher{files: files, mount: mount, prefix: prefix}
+}
+
+// Fetch opens the file behind fileID, an *os.File. A file missing from the
+// mount is an fs.ErrNotExist.
+func (f *MountedFileFetcher) Fetch(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	file, err := f.files.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	return f.open(file.FilePath)
+}
+
+// open opens filePath as the Bot API reported it.
+func (f *MountedFileFetcher) open(filePath string) (*os.File, error) {
+	path, err := resolveMountedPath(f.mount, f.prefix, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// resolveMountedPath maps a file_path reported by the Bot API onto the mount
+// directory, replacing prefix when filePath starts with it. The result is
+// guaranteed to stay inside the mount whatever the file_path contains.
+func resolveMountedPath(mount, prefix, filePath string) (string, error) {
+	if filePath == "" {
+		return "", errors.New("empty file path")
+	}
+	root, err := filepath.Abs(mount)
+	if err != nil {
+		return "", err
+	}
+	if prefix != "" {
+		cleanPrefix := filepath.Clean(prefix)
+		if rest, ok := strings.CutPrefix(filepath.Clean(filePath), cleanPrefix); ok && (rest == "" || rest[0] == filepath.Separator || cleanPrefix == string(filepath.Separator)) {
+			filePath = rest
+		}
+	}
+	path := filepath.Join(root, filepath.Clean(string(filepath.Separator)+filePath))
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file path %q escapes the local file mount", filePath)
+	}
+	return path, nil
+}
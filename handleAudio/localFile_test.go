@@ -0,0 +1,81 @@
+package handleAudio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestResolveMountedPath(t *testing.T) {
+	mount := t.TempDir()
+	for _, c := range []struct {
+		prefix, filePath string
+		want             string // "" for a rejected path
+	}{
+		{"/var/lib/telegram-bot-api", "/var/lib/telegram-bot-api/token/voice/file_0.oga", "token/voice/file_0.oga"},
+		{"/var/lib/telegram-bot-api/", "/var/lib/telegram-bot-api/token/voice/file_0.oga", "token/voice/file_0.oga"},
+		{"", "voice/file_0.oga", "voice/file_0.oga"},
+		{"/", "/token/voice/file_0.oga", "token/voice/file_0.oga"},
+		// Only whole directories are cut off
+		{"/var/lib/telegram", "/var/lib/telegram-bot-api/file.oga", "var/lib/telegram-bot-api/file.oga"},
+		// Whatever the path holds, it stays inside the mount
+		{"/var/lib/telegram-bot-api", "/var/lib/telegram-bot-api/../../etc/passwd", "var/etc/passwd"},
+		{"", "../../etc/passwd", "etc/passwd"},
+		{"/var/lib/telegram-bot-api", "/var/lib/telegram-bot-api", ""},
+		{"", "", ""},
+	} {
+		got, err := resolveMountedPath(mount, c.prefix, c.filePath)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("resolveMountedPath(%q, %q) = %s, want it rejected", c.prefix, c.filePath, got)
+			}
+			continue
+		}
+		if want := filepath.Join(mount, c.want); err != nil || got != want {
+			t.Errorf("resolveMountedPath(%q, %q) = %s, %v; want %s", c.prefix, c.filePath, got, err, want)
+		}
+	}
+}
+
+// fakeLocator reports every file at filePath.
+type fakeLocator struct {
+	filePath string
+}
+
+func (l fakeLocator) GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error) {
+	return tgbotapi.File{FileID: config.FileID, FilePath: l.filePath}, nil
+}
+
+func TestMountedFileFetcherOpensTheServersFile(t *testing.T) {
+	mount := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(mount, "token", "voice"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mount, "token", "voice", "file_0.oga"), oggHead, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := NewMountedFileFetcher(fakeLocator{"/var/lib/telegram-bot-api/token/voice/file_0.oga"}, mount, "/var/lib/telegram-bot-api")
+	file, err := fetcher.Fetch(context.Background(), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, ok := file.(*os.File); !ok {
+		t.Errorf("mounted file is a %T, want an *os.File", file)
+	}
+	if data, _ := io.ReadAll(file); string(data) != string(oggHead) {
+		t.Errorf("read %q from the mount", data)
+	}
+
+	missing := NewMountedFileFetcher(fakeLocator{"/var/lib/telegram-bot-api/token/voice/file_1.oga"}, mount, "/var/lib/telegram-bot-api")
+	if _, err := missing.Fetch(context.Background(), "file"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Fetch of a file missing from the mount = %v, want fs.ErrNotExist", err)
+	}
+}
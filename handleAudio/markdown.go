@@ -0,0 +1,122 @@
+package handleAudio
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"telegram-sr-bot/messages"
+)
+
+// markdownReserved are the characters MarkdownV2 requires to be escaped
+// outside of entities, plus the backslash that escapes them.
+const markdownReserved = "_*[]()~`>#+-=|{}.!\\"
+
+// escapeMarkdown makes text safe to embed in a MarkdownV2 message.
+func escapeMarkdown(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range text {
+		if strings.ContainsRune(markdownReserved, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// languageCountries maps languages to the country whose flag stands for
+// them; it only has to cover languages whose code is not a country code.
+var languageCountries = map[string]string{
+	"en": "gb", "uk": "ua", "zh": "cn", "ja": "jp", "ko": "kr", "ar": "sa", "he": "il",
+	"hi": "in", "cs": "cz", "sv": "se", "da": "dk", "el": "gr", "sr": "rs", "sl": "si",
+	"et": "ee", "kk": "kz", "be": "by", "ka": "ge", "hy": "am", "fa": "ir", "vi": "vn",
+	"ms": "my", "yue": "hk", "ur": "pk", "bn": "bd", "sq": "al", "bs": "ba", "ca": "ad",
+	"gl": "es", "eu": "es", "cy": "gb", "ga": "ie", "nn": "no", "sw": "ke", "tl": "ph",
+	"jw": "id", "km": "kh", "lo": "la", "my": "mm", "ne": "np", "si": "lk", "ta": "lk",
+	"te": "in", "tg": "tj", "tk": "tm", "yi": "il", "af": "za", "am": "et", "ps": "af",
+}
+
+// languageFlag returns the flag emoji of a language, a globe for languages
+// without one.
+func languageFlag(lang string) string {
+	code, ok := NormalizeLanguage(lang)
+	if !ok {
+		return "🌐"
+	}
+	country, ok := languageCountries[code]
+	if !ok {
+		country = code
+	}
+	if len(country) != 2 {
+		return "🌐"
+	}
+	// Flags are pairs of regional indicator symbols spelling the country code
+	var flag strings.Builder
+	for _, letter := range country {
+		flag.WriteRune('🇦' + letter - 'a')
+	}
+	return flag.String()
+}
+
+// formattedReply is one message of a transcription, as MarkdownV2 and as
+// the plain text sent when Telegram rejects the markup.
+type formattedReply struct {
+	markdown string
+	plain    string
+}
+
+// formatReply lays out part of parts of a transcription in language. The
+// first part carries the language, every part of a split transcription a
+// "(i/n)" counter, and the text itself is quoted. The plain text header is
+// taken from texts.
+func formatReply(texts *messages.Bundle, language, chunk string, part, parts int) formattedReply {
+	var markdown, plain strings.Builder
+	if parts > 1 {
+		counter := fmt.Sprintf("(%d/%d)", part, parts)
+		markdown.WriteString(escapeMarkdown(counter))
+		plain.WriteString(counter + " ")
+	}
+	if part == 1 {
+		if parts > 1 {
+			markdown.WriteString(" ")
+		}
+		fmt.Fprintf(&markdown, "*%s %s*\n", languageFlag(language), escapeMarkdown(strings.ToUpper(language)))
+		plain.WriteString(texts.Get(messages.TranscriptHeader, language))
+	} else {
+		markdown.WriteString("\n")
+	}
+	plain.WriteString(chunk)
+	if chunk != "" {
+		for i, line := range strings.Split(chunk, "\n") {
+			if i > 0 {
+				markdown.WriteString("\n")
+			}
+			markdown.WriteString(">" + escapeMarkdown(line))
+		}
+	}
+	return formattedReply{markdown: strings.TrimSuffix(markdown.String(), "\n"), plain: plain.String()}
+}
+
+// layoutTranscript splits text into replies that fit into limit characters
+// both with and without markup. Escaping grows the text by an amount that
+// depends on it, so the chunks shrink until every reply fits.
+func layoutTranscript(texts *messages.Bundle, language, text string, limit int) []formattedReply {
+	// Room for the counter and the language header
+	const overhead = 64
+	for chunkLimit := limit - overhead; ; chunkLimit = chunkLimit * 3 / 4 {
+		chunks := splitText(text, chunkLimit, chunkLimit)
+		if len(chunks) == 0 {
+			chunks = []string{""}
+		}
+		replies := make([]formattedReply, len(chunks))
+		fits := true
+		for i, chunk := range chunks {
+			replies[i] = formatReply(texts, language, chunk, i+1, len(chunks))
+			fits = fits && utf8.RuneCountInString(replies[i].markdown) <= limit && utf8.RuneCountInString(replies[i].plain) <= limit
+		}
+		if fits || chunkLimit <= overhead {
+			return replies
+		}
+	}
+}
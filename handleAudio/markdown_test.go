@@ -0,0 +1,118 @@
+package handleAudio
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"telegram-sr-bot/messages"
+)
+
+func TestEscapeMarkdown(t *testing.T) {
+	for text, want := range map[string]string{
+		"plain words":      "plain words",
+		"1+1=2. Really!":   `1\+1\=2\. Really\!`,
+		`a_b*c[d](e)~f`:    `a\_b\*c\[d\]\(e\)\~f`,
+		"`code` > #tag":    "\\`code\\` \\> \\#tag",
+		`back\slash {x|y}`: `back\\slash \{x\|y\}`,
+		"привет-мир":       `привет\-мир`,
+	} {
+		if got := escapeMarkdown(text); got != want {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestLanguageFlag(t *testing.T) {
+	for lang, want := range map[string]string{
+		"ru":  "🇷🇺",
+		"en":  "🇬🇧",
+		"uk":  "🇺🇦",
+		"":    "🌐",
+		"xx?": "🌐",
+	} {
+		if got := languageFlag(lang); got != want {
+			t.Errorf("languageFlag(%q) = %s, want %s", lang, got, want)
+		}
+	}
+}
+
+func TestFormatReply(t *testing.T) {
+	texts := messages.For("en")
+	single := formatReply(texts, "en", "Hi.\nBye!", 1, 1)
+	if want := "*🇬🇧 EN*\n>Hi\\.\n>Bye\\!"; single.markdown != want {
+		t.Errorf("markdown %q, want %q", single.markdown, want)
+	}
+	if want := texts.Get(messages.TranscriptHeader, "en") + "Hi.\nBye!"; single.plain != want {
+		t.Errorf("plain %q, want %q", single.plain, want)
+	}
+
+	first := formatReply(texts, "en", "one", 1, 2)
+	if !strings.HasPrefix(first.markdown, `\(1/2\) *🇬🇧 EN*`) || !strings.HasPrefix(first.plain, "(1/2) ") {
+		t.Errorf("first part %+v", first)
+	}
+	second := formatReply(texts, "en", "two", 2, 2)
+	if second.markdown != "\\(2/2\\)\n>two" || second.plain != "(2/2) two" {
+		t.Errorf("second part %+v", second)
+	}
+}
+
+func TestLayoutTranscriptFitsEscapedText(t *testing.T) {
+	// Every character doubles when escaped
+	text := strings.Repeat("1.", 3000)
+	texts := messages.For("en")
+	replies := layoutTranscript(texts, "en", text, maxMessageLength)
+	if len(replies) < 2 {
+		t.Fatalf("%d replies, want the text split", len(replies))
+	}
+	var plain strings.Builder
+	for i, reply := range replies {
+		if n := utf8.RuneCountInString(reply.markdown); n > maxMessageLength {
+			t.Errorf("reply %d is %d characters marked up", i+1, n)
+		}
+		if n := utf8.RuneCountInString(reply.plain); n > maxMessageLength {
+			t.Errorf("reply %d is %d characters plain", i+1, n)
+		}
+		// Past the "(i/n)" counter and the header of the first part
+		_, chunk, _ := strings.Cut(reply.plain, " ")
+		if i == 0 {
+			chunk = strings.TrimPrefix(chunk, texts.Get(messages.TranscriptHeader, "en"))
+		}
+		plain.WriteString(chunk)
+	}
+	if plain.String() != text {
+		t.Error("the replies do not add up to the transcription")
+	}
+}
+
+func TestWithMarkupFallsBackToPlainText(t *testing.T) {
+	reply := formattedReply{markdown: "*bold*", plain: "bold"}
+	for _, c := range []struct {
+		name  string
+		err   error
+		sends []string
+	}{
+		{"accepted", nil, []string{tgbotapi.ModeMarkdownV2}},
+		{"rejected markup", &tgbotapi.Error{Code: http.StatusBadRequest, Message: "can't parse entities"}, []string{tgbotapi.ModeMarkdownV2, ""}},
+		{"other failure", errors.New("network down"), []string{tgbotapi.ModeMarkdownV2}},
+	} {
+		var sends []string
+		withMarkup(zerolog.Nop(), reply, func(text, parseMode string) (tgbotapi.Message, error) {
+			sends = append(sends, parseMode)
+			if parseMode == "" {
+				if text != "bold" {
+					t.Errorf("%s: plain text %q", c.name, text)
+				}
+				return tgbotapi.Message{}, nil
+			}
+			return tgbotapi.Message{}, c.err
+		})
+		if strings.Join(sends, ",") != strings.Join(c.sends, ",") {
+			t.Errorf("%s: sent with parse modes %q, want %q", c.name, sends, c.sends)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handleAudio
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MessageResult collects the outcome of handling a single audio message.
+// Pipeline stages fill it in as they run; once the message is done it is
+// summarized on the handler span and kept by the flight recorder.
+type MessageResult struct {
+	ChatID          int64         `json:"chat_id"`
+	MessageID       int           `json:"message_id"`
+	ReceivedAt      time.Time     `json:"received_at"`
+	SourceType      string        `json:"source_type"`
+	AudioDuration   time.Duration `json:"audio_duration_ns"`
+	BytesDownloaded int64         `json:"bytes_downloaded"`
+	BytesUploaded   int64         `json:"bytes_uploaded"`
+	Endpoint        string        `json:"endpoint"`
+	Model           ModelInfo     `json:"model"`
+	DetectedLang    string        `json:"detected_language"`
+	TranscriptLen   int           `json:"transcript_length"`
+	Transcript      string        `json:"transcript,omitempty"`
+	CacheHit        bool          `json:"cache_hit"`
+	Retries         int           `json:"retries"`
+	Stages          []StageTiming `json:"stages"`
+	Duration        time.Duration `json:"duration_ns"`
+	Status          string        `json:"status"`
+	Error           string        `json:"error,omitempty"`
+	Delivery        string        `json:"delivery"`
+}
+
+// StageTiming is the time spent in one pipeline stage.
+type StageTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+func (r *MessageResult) stage(name string, start time.Time) {
+	r.Stages = append(r.Stages, StageTiming{Name: name, Duration: time.Since(start)})
+}
+
+func (r *MessageResult) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("source_type", r.SourceType),
+		attribute.Float64("audio_duration_seconds", r.AudioDuration.Seconds()),
+		attribute.Int64("bytes_downloaded", r.BytesDownloaded),
+		attribute.Int64("bytes_uploaded", r.BytesUploaded),
+		attribute.String("endpoint", r.Endpoint),
+		attribute.String("model_name", r.Model.Name),
+		attribute.String("model_version", r.Model.Version),
+		attribute.String("detected_language", r.DetectedLang),
+		attribute.Int("transcript_length", r.TranscriptLen),
+		attribute.Bool("cache_hit", r.CacheHit),
+		attribute.Int("retries", r.Retries),
+		attribute.Float64("duration_seconds", r.Duration.Seconds()),
+		attribute.String("status", r.Status),
+		attribute.String("delivery", r.Delivery),
+	}
+}
@@ -0,0 +1,86 @@
+package handleAudio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans records the spans ended for the rest of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return recorder
+}
+
+// summaryOf returns the attributes of the summary event of the handler
+// span.
+func summaryOf(t *testing.T, recorder *tracetest.SpanRecorder) map[attribute.Key]attribute.Value {
+	t.Helper()
+	for _, span := range recorder.Ended() {
+		if span.Name() != "handleAudioMessage" {
+			continue
+		}
+		for _, event := range span.Events() {
+			if event.Name == "summary" {
+				summary := make(map[attribute.Key]attribute.Value)
+				for _, kv := range event.Attributes {
+					summary[kv.Key] = kv.Value
+				}
+				return summary
+			}
+		}
+	}
+	t.Fatal("no summary event on the handler span")
+	return nil
+}
+
+func TestHandlerSummarizesTheMessageOnItsSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	handler, _ := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: recognized("hello")})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	summary := summaryOf(t, recorder)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"status":                 attribute.StringValue("success"),
+		"delivery":               attribute.StringValue("sent"),
+		"source_type":            attribute.StringValue("voice"),
+		"endpoint":               attribute.StringValue("fake"),
+		"detected_language":      attribute.StringValue("en"),
+		"transcript_length":      attribute.IntValue(len("hello")),
+		"cache_hit":              attribute.BoolValue(false),
+		"audio_duration_seconds": attribute.Float64Value(5),
+		"bytes_downloaded":       attribute.Int64Value(int64(len(oggHead))),
+	} {
+		if got := summary[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if summary["duration_seconds"].AsFloat64() <= 0 {
+		t.Errorf("duration_seconds = %v", summary["duration_seconds"].Emit())
+	}
+}
+
+func TestHandlerSummarizesFailures(t *testing.T) {
+	recorder := recordSpans(t)
+	handler, _ := newTestHandler(fakeFetcher{err: errBackend}, &fakeRecognizer{})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	summary := summaryOf(t, recorder)
+	if got := summary["status"].AsString(); got != "error" {
+		t.Errorf("status = %s, want error", got)
+	}
+	if got := summary["bytes_uploaded"].AsInt64(); got != 0 {
+		t.Errorf("bytes_uploaded = %d with nothing downloaded", got)
+	}
+}
@@ -0,0 +1,89 @@
+package handleAudio
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets span 0.1s to 300s, long recordings take minutes.
+var latencyBuckets = prometheus.ExponentialBucketsRange(0.1, 300, 12)
+
+var ProcessingDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "audio_processing_duration_seconds",
+		Help:    "End-to-end time spent handling an audio message.",
+		Buckets: latencyBuckets,
+	},
+	[]string{"status", "source"},
+)
+
+var DownloadDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "telegram_download_duration_seconds",
+		Help:    "Time spent fetching the audio file from Telegram.",
+		Buckets: latencyBuckets,
+	},
+	[]string{"source"},
+)
+
+var RecognitionDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "recognition_request_duration_seconds",
+		Help:    "Round-trip time of the recognition API upload, retries included.",
+		Buckets: latencyBuckets,
+	},
+	[]string{"source"},
+)
+
+var AudioSizeBytes = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "audio_size_bytes",
+		Help:    "Size of the received audio files.",
+		Buckets: prometheus.ExponentialBuckets(16<<10, 4, 8), // 16KiB to 256MiB
+	},
+	[]string{"source"},
+)
+
+var AudioDurationSeconds = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "audio_duration_seconds",
+		Help:    "Duration of the received audio as declared by Telegram.",
+		Buckets: prometheus.ExponentialBucketsRange(1, 4*3600, 12),
+	},
+	[]string{"source"},
+)
+
+// observeMetrics records the workload profile and durations of a finished
+// message.
+func observeMetrics(result *MessageResult) {
+	if result.BytesDownloaded > 0 {
+		AudioSizeBytes.With(prometheus.Labels{"source": result.SourceType}).Observe(float64(result.BytesDownloaded))
+	}
+	if result.AudioDuration > 0 {
+		AudioDurationSeconds.With(prometheus.Labels{"source": result.SourceType}).Observe(result.AudioDuration.Seconds())
+	}
+	ProcessingDuration.With(prometheus.Labels{"status": result.Status, "source": result.SourceType}).Observe(result.Duration.Seconds())
+	for _, stage := range result.Stages {
+		switch stage.Name {
+		case "download":
+			DownloadDuration.With(prometheus.Labels{"source": result.SourceType}).Observe(stage.Duration.Seconds())
+		case "upload":
+			RecognitionDuration.With(prometheus.Labels{"source": result.SourceType}).Observe(stage.Duration.Seconds())
+		}
+	}
+}
+
+var RecognitionsByLanguage = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "recognitions_by_language_total",
+		Help: "Total number of successful recognitions by detected language.",
+	},
+	[]string{"language"}, // Language is a lowercase ISO 639-1 code or "other"
+)
+
+var CacheHitCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "recognition_cache_hits_total",
+		Help: "Total number of messages answered from the recognition cache.",
+	},
+	[]string{"source"},
+)
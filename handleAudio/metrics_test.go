@@ -0,0 +1,68 @@
+package handleAudio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// samples returns how many values the histogram with labels observed.
+func samples(t *testing.T, histogram *prometheus.HistogramVec, labels prometheus.Labels) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := histogram.With(labels).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestHandlerObservesTheLatencyOfEveryStage(t *testing.T) {
+	voice := prometheus.Labels{"source": "voice"}
+	histograms := map[string]struct {
+		histogram *prometheus.HistogramVec
+		labels    prometheus.Labels
+	}{
+		"processing":  {ProcessingDuration, prometheus.Labels{"status": "success", "source": "voice"}},
+		"download":    {DownloadDuration, voice},
+		"recognition": {RecognitionDuration, voice},
+		"size":        {AudioSizeBytes, voice},
+		"duration":    {AudioDurationSeconds, voice},
+	}
+	before := make(map[string]uint64)
+	for name, h := range histograms {
+		before[name] = samples(t, h.histogram, h.labels)
+	}
+
+	handler, _ := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: recognized("hello")})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	for name, h := range histograms {
+		if got := samples(t, h.histogram, h.labels) - before[name]; got != 1 {
+			t.Errorf("%s observed %d times, want once", name, got)
+		}
+	}
+}
+
+func TestFailedDownloadsObserveNoUpload(t *testing.T) {
+	voice := prometheus.Labels{"source": "voice"}
+	uploads, sizes := samples(t, RecognitionDuration, voice), samples(t, AudioSizeBytes, voice)
+	failures := samples(t, ProcessingDuration, prometheus.Labels{"status": "error", "source": "voice"})
+
+	handler, _ := newTestHandler(fakeFetcher{err: errBackend}, &fakeRecognizer{})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	if got := samples(t, RecognitionDuration, voice) - uploads; got != 0 {
+		t.Errorf("recognition observed %d times without an upload", got)
+	}
+	if got := samples(t, AudioSizeBytes, voice) - sizes; got != 0 {
+		t.Errorf("size observed %d times without a download", got)
+	}
+	if got := samples(t, ProcessingDuration, prometheus.Labels{"status": "error", "source": "voice"}) - failures; got != 1 {
+		t.Errorf("failed processing observed %d times, want once", got)
+	}
+}
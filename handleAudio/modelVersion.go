@@ -0,0 +1,56 @@
+package handleAudio
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/sanitize"
+)
+
+const unknownModel = "unknown"
+
+// ModelInfo identifies the recognition model that produced a result, as
+// reported by the backend in the X-Model-Name and X-Model-Version headers.
+type ModelInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func modelInfoFromHeader(h http.Header) ModelInfo {
+	return modelInfo(h.Get("X-Model-Name"), h.Get("X-Model-Version"))
+}
+
+// modelInfo sanitizes the model name and version the backend reported,
+// either may be empty.
+func modelInfo(name, version string) ModelInfo {
+	info := ModelInfo{
+		Name:    sanitize.String(name, sanitize.Label),
+		Version: sanitize.String(version, sanitize.Label),
+	}
+	if info.Name == "" {
+		info.Name = unknownModel
+	}
+	if info.Version == "" {
+		info.Version = unknownModel
+	}
+	return info
+}
+
+var lastModel struct {
+	sync.Mutex
+	info ModelInfo
+}
+
+// observeModel logs once whenever the backend starts answering with a
+// different model version, so deploy boundaries are visible in the logs.
+func observeModel(info ModelInfo) {
+	lastModel.Lock()
+	defer lastModel.Unlock()
+	if lastModel.info == info {
+		return
+	}
+	log.Info().Str("model_name", info.Name).Str("model_version", info.Version).
+		Str("previous_model_version", lastModel.info.Version).Msg("Recognition model changed")
+	lastModel.info = info
+}
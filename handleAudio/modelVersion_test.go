@@ -0,0 +1,26 @@
+package handleAudio
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"telegram-sr-bot/sanitize"
+)
+
+func TestModelInfoFromHeaderIsSafeForLabels(t *testing.T) {
+	info := modelInfoFromHeader(http.Header{
+		"X-Model-Name":    {"whisper\x1b[31m-large\n"},
+		"X-Model-Version": {strings.Repeat("v", 100)},
+	})
+	if info.Name != "whisper-large " {
+		t.Errorf("model name %q is not sanitized", info.Name)
+	}
+	if want := strings.Repeat("v", sanitize.Label.MaxRunes) + sanitize.TruncationMarker; info.Version != want {
+		t.Errorf("model version %q is not cut to a label", info.Version)
+	}
+
+	if info := modelInfoFromHeader(http.Header{}); info != (ModelInfo{Name: unknownModel, Version: unknownModel}) {
+		t.Errorf("model without headers = %+v, want unknown", info)
+	}
+}
@@ -0,0 +1,35 @@
+package handleAudio
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"telegram-sr-bot/quota"
+)
+
+// Quota caps the audio every user has transcribed a day; nil leaves it
+// unlimited.
+var Quota *quota.Quota
+
+// reserveQuota charges the sender of request for the declared duration of
+// source. A failing store lets the message through uncharged.
+func reserveQuota(logger zerolog.Logger, request *tgbotapi.Message, source AudioSource) quota.Decision {
+	if Quota == nil || request == nil || request.From == nil {
+		return quota.Decision{Allowed: true}
+	}
+	decision, err := Quota.Take(request.From.ID, source.Duration, time.Now())
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to charge the daily quota")
+		return quota.Decision{Allowed: true}
+	}
+	return decision
+}
+
+// refundQuota gives charge back, the message it paid for was not
+// transcribed.
+func refundQuota(logger zerolog.Logger, charge quota.Charge) {
+	if err := Quota.Refund(charge); err != nil {
+		logger.Error().Err(err).Msg("Failed to refund the daily quota")
+	}
+}
@@ -0,0 +1,107 @@
+package handleAudio
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/pending"
+	"telegram-sr-bot/quota"
+)
+
+func TestHandlerChargesOnlyTranscribedAudio(t *testing.T) {
+	cases := []struct {
+		name          string
+		recognizer    *fakeRecognizer
+		fetcher       fakeFetcher
+		limit         int64
+		wantRemaining time.Duration
+	}{
+		{"transcribed", &fakeRecognizer{result: recognized("hello")}, fakeFetcher{audio: oggHead}, 0, 30 * time.Second},
+		{"backend failed", &fakeRecognizer{err: errBackend}, fakeFetcher{audio: oggHead}, 0, time.Minute},
+		{"download failed", &fakeRecognizer{}, fakeFetcher{err: errBackend}, 0, time.Minute},
+		{"too large", &fakeRecognizer{}, fakeFetcher{audio: oggHead}, 1, time.Minute},
+		{"no speech", &fakeRecognizer{result: recognized(" [BLANK_AUDIO] ")}, fakeFetcher{audio: oggHead}, 0, time.Minute},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := quota.New(quota.NewMemory(), time.Minute, nil)
+			setVar(t, &Quota, q)
+			if c.limit > 0 {
+				setVar(t, &MaxAudioBytes, c.limit)
+			}
+			handler, _ := newTestHandler(c.fetcher, c.recognizer)
+			message := voiceMessage(30 * time.Second)
+			handler.Handle(context.Background(), message, message)
+
+			decision, err := q.Check(message.From.ID, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Remaining != c.wantRemaining {
+				t.Errorf("Remaining = %s, want %s", decision.Remaining, c.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestHandlerRefusesOverQuota(t *testing.T) {
+	q := quota.New(quota.NewMemory(), 20*time.Second, nil)
+	setVar(t, &Quota, q)
+	recognizer := &fakeRecognizer{result: recognized("hello")}
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, recognizer)
+	message := voiceMessage(30 * time.Second)
+	handler.Handle(context.Background(), message, message)
+
+	if len(recognizer.uploads) != 0 {
+		t.Error("audio over the quota was uploaded")
+	}
+	texts := bot.texts()
+	if len(texts) != 1 || !strings.Contains(texts[0], "20 s") {
+		t.Errorf("replies = %q, want the remaining allowance", texts)
+	}
+}
+
+func TestHandlerChargesRequester(t *testing.T) {
+	q := quota.New(quota.NewMemory(), time.Minute, nil)
+	setVar(t, &Quota, q)
+	handler, _ := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: recognized("hello")})
+	audio := voiceMessage(30 * time.Second)
+	request := voiceMessage(0)
+	request.From.ID = 8
+	handler.Handle(context.Background(), request, audio)
+
+	if decision, _ := q.Check(audio.From.ID, time.Now()); decision.Remaining != time.Minute {
+		t.Errorf("the sender of the audio was charged, %s left", decision.Remaining)
+	}
+	if decision, _ := q.Check(8, time.Now()); decision.Remaining != 30*time.Second {
+		t.Errorf("the requester has %s left, want 30s", decision.Remaining)
+	}
+}
+
+func TestCallbackRefundsFailedJobs(t *testing.T) {
+	cases := []struct {
+		name          string
+		body          callbackResult
+		wantRemaining time.Duration
+	}{
+		{"transcribed", callbackResult{RecognitionSuccess: recognized("hello").RecognitionSuccess}, 30 * time.Second},
+		{"failed", callbackResult{Error: "cannot decode"}, time.Minute},
+		{"no speech", callbackResult{RecognitionSuccess: recognized("").RecognitionSuccess}, time.Minute},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := quota.New(quota.NewMemory(), time.Minute, nil)
+			setVar(t, &Quota, q)
+			decision, _ := q.Take(7, 30*time.Second, time.Now())
+			handler, _ := newTestHandler(fakeFetcher{}, &fakeRecognizer{})
+			job := pending.Job{Token: "token", ChatID: 7, MessageID: 10, Language: "en", Charge: decision.Charge}
+			handler.complete(context.Background(), job, c.body)
+
+			if decision, _ := q.Check(7, time.Now()); decision.Remaining != c.wantRemaining {
+				t.Errorf("Remaining = %s, want %s", decision.Remaining, c.wantRemaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handleAudio
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+)
+
+// Emoji reacted with while a message is processed and once it is done.
+// Bots may only react with the emoji Telegram lists for reactions, which
+// leaves out check marks and warning signs.
+const (
+	ReactionWorking = "👀"
+	ReactionDone    = "👌"
+	ReactionFailed  = "🤷"
+)
+
+// RawRequester calls Bot API methods by name, as *tgbotapi.BotAPI does.
+type RawRequester interface {
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+}
+
+// Reactions marks the messages being transcribed with emoji reactions; nil
+// does not react.
+var Reactions *Reactor
+
+// Reactor sets the reaction of the bot on messages. The library predates
+// setMessageReaction, so the request is made by hand.
+type Reactor struct {
+	bot RawRequester
+}
+
+// NewReactor returns a reactor calling the Bot API through bot.
+func NewReactor(bot RawRequester) *Reactor {
+	return &Reactor{bot: bot}
+}
+
+// react replaces the reaction of the bot on a message with emoji. Chats may
+// forbid reactions and old messages cannot be reacted to, neither is worth
+// more than a debug line.
+func (r *Reactor) react(logger zerolog.Logger, chatID int64, messageID int, emoji string) {
+	if r == nil {
+		return
+	}
+	params, err := reactionParams(chatID, messageID, emoji)
+	if err == nil {
+		_, err = r.bot.MakeRequest("setMessageReaction", params)
+	}
+	if err != nil {
+		logger.Debug().Err(err).Str("reaction", emoji).Msg("Failed to set the reaction")
+	}
+}
+
+// reactionParams builds the parameters of setMessageReaction.
+func reactionParams(chatID int64, messageID int, emoji string) (tgbotapi.Params, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero("message_id", messageID)
+	type reaction struct {
+		Type  string `json:"type"`
+		Emoji string `json:"emoji"`
+	}
+	err := params.AddInterface("reaction", []reaction{{Type: "emoji", Emoji: emoji}})
+	return params, err
+}
@@ -0,0 +1,61 @@
+package handleAudio
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// reactions returns the emoji the bot reacted with, in order.
+func (b *fakeBot) reactions(t *testing.T) []string {
+	t.Helper()
+	var emoji []string
+	for _, params := range b.raw("setMessageReaction") {
+		if params["chat_id"] != "7" || params["message_id"] != "10" {
+			t.Errorf("reacted to message %s in chat %s, want message 10 in chat 7", params["message_id"], params["chat_id"])
+		}
+		var reaction []struct {
+			Type  string `json:"type"`
+			Emoji string `json:"emoji"`
+		}
+		if err := json.Unmarshal([]byte(params["reaction"]), &reaction); err != nil || len(reaction) != 1 || reaction[0].Type != "emoji" {
+			t.Fatalf("reaction %s, %v; want a single emoji", params["reaction"], err)
+		}
+		emoji = append(emoji, reaction[0].Emoji)
+	}
+	return emoji
+}
+
+func TestReactionsFollowTheTranscription(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		recognizer *fakeRecognizer
+		want       string
+	}{
+		{"transcribed", &fakeRecognizer{result: recognized("hello")}, ReactionDone},
+		{"no speech", &fakeRecognizer{result: recognized("")}, ReactionFailed},
+		{"backend down", &fakeRecognizer{err: errBackend}, ReactionFailed},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, c.recognizer)
+			setVar(t, &Reactions, NewReactor(bot))
+
+			message := voiceMessage(5 * time.Second)
+			handler.Handle(context.Background(), message, message)
+			got := bot.reactions(t)
+			if len(got) != 2 || got[0] != ReactionWorking || got[1] != c.want {
+				t.Errorf("reactions %q, want %s then %s", got, ReactionWorking, c.want)
+			}
+		})
+	}
+}
+
+func TestNoReactionsUnlessEnabled(t *testing.T) {
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: recognized("hello")})
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+	if got := bot.raw("setMessageReaction"); len(got) != 0 {
+		t.Errorf("reacted with %v while reactions are off", got)
+	}
+}
@@ -0,0 +1,495 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"telegram-sr-bot/chaos"
+	"telegram-sr-bot/failover"
+)
+
+// UploadAttempts is how often the upload is tried before giving up.
+var UploadAttempts = 3
+
+// UploadRetryBackoff is the delay before the first retry, it doubles with
+// every further attempt.
+var UploadRetryBackoff = time.Second
+
+// HealthPath is the path on the recognition API host that health checks
+// get, "" sends a HEAD to the upload endpoint instead.
+var HealthPath string
+
+// InMemoryUploadLimit is the largest download kept in memory, bigger files
+// go through a temp file and are streamed from there.
+var InMemoryUploadLimit int64 = 1 << 20
+
+// maxRetryDelay caps the backoff and any Retry-After the backend asks for.
+const maxRetryDelay = 30 * time.Second
+
+var UploadRetryCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "recognition_upload_retries_total",
+		Help: "Total number of retried recognition uploads.",
+	},
+	[]string{"reason"}, // Reason can be "connection" or the HTTP status code
+)
+
+// statusError is a failed answer of the recognition backend, with the
+// sanitized explanation it gave if any. gRPC statuses are mapped to the
+// HTTP status codes they stand for, so both transports fail alike.
+type statusError struct {
+	code       int    // HTTP status code
+	status     string // As the transport reports it, e.g. "503 Service Unavailable"
+	retryAfter string // Retry-After header, if any
+	message    string
+}
+
+// newStatusError describes a non-200 HTTP response, whose body it reads.
+func newStatusError(resp *http.Response) *statusError {
+	return &statusError{
+		code:       resp.StatusCode,
+		status:     resp.Status,
+		retryAfter: resp.Header.Get("Retry-After"),
+		message:    recognitionErrorMessage(resp),
+	}
+}
+
+func (e *statusError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("unexpected status %s: %s", e.status, e.message)
+	}
+	return fmt.Sprintf("unexpected status %s", e.status)
+}
+
+// permanent reports whether the backend rejected the request itself, so
+// sending it again will not help.
+func (e *statusError) permanent() bool {
+	return e.code >= 400 && e.code < 500 && e.code != http.StatusTooManyRequests
+}
+
+// errBadResponse marks recognition responses that could not be decoded.
+var errBadResponse = errors.New("invalid recognition response")
+
+// Recognizer transcribes audio with a recognition backend.
+type Recognizer interface {
+	// Recognize transcribes audio as described by req.
+	Recognize(ctx context.Context, audio io.Reader, req RecognitionRequest) (RecognitionResult, error)
+	// Endpoint identifies the backend in logs and reports.
+	Endpoint() string
+	// Probe checks that the backend answers, without recognizing anything.
+	Probe(ctx context.Context) error
+}
+
+// HTTPRecognizer is a Recognizer posting multipart uploads to the
+// recognition API at one of its backends.
+type HTTPRecognizer struct {
+	backends *failover.Pool
+	client   *http.Client
+}
+
+// RecognitionResult is a transcription along with how it was obtained. The
+// upload details are filled in even when recognition fails.
+type RecognitionResult struct {
+	RecognitionSuccess
+	Model         ModelInfo
+	BytesUploaded int64
+	Retries       int
+	// Endpoint is the backend the last attempt went to, if known.
+	Endpoint string
+	// Accepted is set when the result is posted to the callback URL of the
+	// request instead.
+	Accepted bool
+}
+
+// NewHTTPRecognizer returns a recognizer posting to the backends through
+// client.
+func NewHTTPRecognizer(backends *failover.Pool, client *http.Client) *HTTPRecognizer {
+	return &HTTPRecognizer{backends: backends, client: client}
+}
+
+func (r *HTTPRecognizer) Endpoint() string {
+	return strings.Join(r.backends.Endpoints(), ",")
+}
+
+// Probe asks all the backends at once and succeeds if any of them answers,
+// telling the pool how each one did. A backend answers to a GET of
+// HealthPath with a 2xx status, or when HealthPath is unset to a HEAD of
+// its upload endpoint with any status short of a server error.
+func (r *HTTPRecognizer) Probe(ctx context.Context) error {
+	endpoints := r.backends.Endpoints()
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			err := r.probe(ctx, endpoint)
+			// A timeout is the backend's fault, being cancelled is not
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				r.backends.Probed(endpoint, err == nil, time.Now())
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", endpoint, err)
+			}
+		}(i, endpoint)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *HTTPRecognizer) probe(ctx context.Context, endpoint string) error {
+	target, method := endpoint, http.MethodHead
+	if HealthPath != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		target, method = u.ResolveReference(&url.URL{Path: HealthPath}).String(), http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+	APIAuth.apply(req.Header)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError || (HealthPath != "" && resp.StatusCode/100 != 2) {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// RecognitionRequest describes the audio handed to Recognize.
+type RecognitionRequest struct {
+	Filename    string
+	ContentType string
+	// Duration chooses the upload deadline.
+	Duration time.Duration
+	// Language forces the recognition language, "" detects it.
+	Language string
+	// Progress, if set, is told how long an asynchronous job has been
+	// waited for every now and then.
+	Progress func(elapsed time.Duration)
+	// CallbackURL, if set, is where the backend may post the result later
+	// on, answering the upload with 202.
+	CallbackURL string
+}
+
+// Recognize uploads audio as described by req and decodes the
+// transcription. Connection errors, 429, 502, 503 and 504 are retried with
+// exponential backoff, the multipart body is streamed from audio anew for
+// every attempt, so audio should implement io.ReaderAt and Size like
+// *bytes.Reader and *io.SectionReader do; other readers are buffered in
+// memory first. In AsyncMode the backend may accept the audio as a job
+// instead, which is then polled from the backend that accepted it until it
+// is done.
+func (r *HTTPRecognizer) Recognize(ctx context.Context, audio io.Reader, req RecognitionRequest) (RecognitionResult, error) {
+	result := RecognitionResult{Model: ModelInfo{Name: unknownModel, Version: unknownModel}}
+	sized, ok := audio.(sizedReaderAt)
+	if !ok {
+		data, err := io.ReadAll(audio)
+		if err != nil {
+			return result, fmt.Errorf("read audio: %w", err)
+		}
+		sized = bytes.NewReader(data)
+	}
+
+	start := time.Now()
+	resp, err := r.upload(ctx, sized, req, &result)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	result.Model = modelInfoFromHeader(resp.Header)
+	if resp.StatusCode == http.StatusAccepted && req.CallbackURL != "" {
+		UploadTimeout.Observe(req.Duration, time.Since(start))
+		result.Accepted = true
+		return result, nil
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		// Only the upload teaches the adaptive timeout, the job takes as long as the queue
+		UploadTimeout.Observe(req.Duration, time.Since(start))
+		if err := r.awaitJob(ctx, resp, req, &result); err != nil {
+			return result, err
+		}
+		observeModel(result.Model)
+		return result, nil
+	}
+	observeModel(result.Model)
+
+	if err = Chaos.Inject(ctx, "decode"); err == nil {
+		err = decodeRecognitionResponse(resp, &result.RecognitionSuccess)
+	}
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", errBadResponse, err)
+	}
+	UploadTimeout.Observe(req.Duration, time.Since(start))
+	return result, nil
+}
+
+// sizedReaderAt is audio that can be read again for every upload attempt.
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// upload posts audio, retrying transient failures. Every retry goes to the
+// next backend in line, which is told how the attempt went.
+func (r *HTTPRecognizer) upload(ctx context.Context, audio sizedReaderAt, req RecognitionRequest, result *RecognitionResult) (*http.Response, error) {
+	endpoints := r.backends.Order(time.Now())
+	attempts := 0
+	var resp *http.Response
+	err := withRetries(ctx, req, result, func(ctx context.Context, timeout time.Duration) error {
+		endpoint := endpoints[attempts%len(endpoints)]
+		attempts++
+		result.Endpoint = endpoint
+		var err error
+		resp, err = r.uploadOnce(ctx, endpoint, audio, req, timeout, result)
+		// Giving up on the message is no fault of the backend
+		if ctx.Err() == nil {
+			r.backends.Report(endpoint, !backendFailed(err), time.Now())
+		}
+		return err
+	})
+	return resp, err
+}
+
+// backendFailed tells whether err counts against the health of the backend:
+// it could not be reached, was overloaded, broke down or did not answer in
+// time.
+func backendFailed(err error) bool {
+	if _, retryable := retryReason(err); retryable {
+		return true
+	}
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.code >= 500 || errors.Is(err, context.DeadlineExceeded)
+}
+
+// withRetries makes attempts at uploading the audio of req, each with the
+// adaptive upload timeout, until one succeeds, fails for good or
+// UploadAttempts are used up. Connection errors, 429, 502, 503 and 504 are
+// retried with exponential backoff.
+func withRetries(ctx context.Context, req RecognitionRequest, result *RecognitionResult, try func(ctx context.Context, timeout time.Duration) error) error {
+	ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "upload to recognition API")
+	defer span.End()
+	timeout, bucket := UploadTimeout.Timeout(req.Duration)
+	span.SetAttributes(
+		attribute.Float64("upload.timeout_seconds", timeout.Seconds()),
+		attribute.String("upload.duration_bucket", bucket),
+	)
+
+	for attempt := 1; ; attempt++ {
+		err := try(ctx, timeout)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("upload timed out after %s (duration bucket %s): %w", timeout, bucket, err)
+		}
+		reason, retryable := retryReason(err)
+		if !retryable || attempt >= UploadAttempts {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "Upload failed")
+			}
+			var statusErr *statusError
+			if errors.As(err, &statusErr) && statusErr.message != "" {
+				span.SetAttributes(attribute.String("recognition.error", statusErr.message))
+			}
+			return err
+		}
+
+		delay := retryDelay(attempt, err)
+		UploadRetryCounter.With(prometheus.Labels{"reason": reason}).Inc()
+		span.AddEvent("upload retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("reason", reason),
+			attribute.Float64("delay_seconds", delay.Seconds()),
+		))
+		result.Retries++
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, gave up retrying: %w", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// uploadOnce makes a single upload attempt. A non-200 answer, other than a
+// 202 in AsyncMode or with a callback URL, is returned as a *statusError
+// with its body already closed.
+func (r *HTTPRecognizer) uploadOnce(ctx context.Context, endpoint string, audio sizedReaderAt, recognition RecognitionRequest, timeout time.Duration, result *RecognitionResult) (*http.Response, error) {
+	body, length, contentType, err := multipartBody(audio, audio.Size(), recognition)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadCtx, cancel := context.WithTimeout(ctx, timeout)
+	req, err := http.NewRequestWithContext(uploadCtx, http.MethodPost, endpoint, body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The length is known up front, so the backend can reject oversized uploads early
+	req.ContentLength = length
+	result.BytesUploaded = length
+	req.Header.Set("Content-Type", contentType)
+	// Let the recognition service join the trace
+	otel.GetTextMapPropagator().Inject(uploadCtx, propagation.HeaderCarrier(req.Header))
+	APIAuth.apply(req.Header)
+
+	var resp *http.Response
+	if err = Chaos.Inject(uploadCtx, "upload"); err == nil {
+		resp, err = r.client.Do(req)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && !((AsyncMode || recognition.CallbackURL != "") && resp.StatusCode == http.StatusAccepted) {
+		statusErr := newStatusError(resp)
+		resp.Body.Close()
+		cancel()
+		return nil, statusErr
+	}
+	// The body is read by the caller, release the deadline when it closes it
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody returns the upload form with the audio as its file and the
+// form's length. Only the form framing is buffered, the audio itself is
+// read while the body is sent.
+func multipartBody(audio io.ReaderAt, size int64, req RecognitionRequest) (io.Reader, int64, string, error) {
+	var head bytes.Buffer
+	writer := multipart.NewWriter(&head)
+	if req.Language != "" {
+		if err := writer.WriteField("language", req.Language); err != nil {
+			return nil, 0, "", fmt.Errorf("write language field: %w", err)
+		}
+	}
+	if req.CallbackURL != "" {
+		if err := writer.WriteField("callback_url", req.CallbackURL); err != nil {
+			return nil, 0, "", fmt.Errorf("write callback URL field: %w", err)
+		}
+	}
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	// Quoted like multipart.Writer.CreateFormFile does
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(req.Filename)))
+	header.Set("Content-Type", contentType)
+	if _, err := writer.CreatePart(header); err != nil {
+		return nil, 0, "", fmt.Errorf("create form file: %w", err)
+	}
+	// The closing boundary, as multipart.Writer.Close would write it after the file
+	tail := "\r\n--" + writer.Boundary() + "--\r\n"
+
+	body := io.MultiReader(&head, io.NewSectionReader(audio, 0, size), strings.NewReader(tail))
+	return body, int64(head.Len()) + size + int64(len(tail)), writer.FormDataContentType(), nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// retryReason tells whether err is worth another attempt and why.
+func retryReason(err error) (string, bool) {
+	var statusErr *statusError
+	var fault *chaos.Fault
+	switch {
+	case err == nil:
+		return "", false
+	case errors.As(err, &statusErr):
+		return strconv.Itoa(statusErr.code), retryableStatus(statusErr.code)
+	case errors.As(err, &fault):
+		// Let injected status codes exercise the retries
+		return strconv.Itoa(fault.StatusCode), retryableStatus(fault.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "", false
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return "connection", true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return "connection", true
+	}
+	return "", false
+}
+
+// retryableStatus tells transient failures from permanent ones: the backend
+// being overloaded, or down behind its proxy, is worth waiting for. A
+// rejected file is not, and neither is a 500, the backend that choked on
+// the audio is likely to choke on it again.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay honors a Retry-After header and otherwise backs off
+// exponentially, with jitter so retries of many messages spread out.
+func retryDelay(attempt int, err error) time.Duration {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		if delay, ok := retryAfter(statusErr.retryAfter); ok {
+			return min(delay, maxRetryDelay)
+		}
+	}
+	delay := min(UploadRetryBackoff<<(attempt-1), maxRetryDelay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,188 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/failover"
+)
+
+// statusTransport answers every request with status.
+type statusTransport struct {
+	status int
+	calls  atomic.Int32
+}
+
+func (s *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.calls.Add(1)
+	io.Copy(io.Discard, req.Body)
+	req.Body.Close()
+	return &http.Response{
+		StatusCode: s.status,
+		Status:     http.StatusText(s.status),
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestRecognizeRetriesOnlyTransientStatuses(t *testing.T) {
+	setVar(t, &UploadAttempts, 3)
+	setVar(t, &UploadRetryBackoff, time.Millisecond)
+	for status, attempts := range map[int]int32{
+		http.StatusTooManyRequests:         3,
+		http.StatusBadGateway:              3,
+		http.StatusServiceUnavailable:      3,
+		http.StatusGatewayTimeout:          3,
+		http.StatusInternalServerError:     1,
+		http.StatusNotImplemented:          1,
+		http.StatusHTTPVersionNotSupported: 1,
+		http.StatusInsufficientStorage:     1,
+		http.StatusUnprocessableEntity:     1,
+	} {
+		transport := &statusTransport{status: status}
+		backends := failover.New([]string{"http://backend.invalid/recognize"}, failover.InOrder, 100, time.Minute)
+		recognizer := NewHTTPRecognizer(backends, &http.Client{Transport: transport})
+
+		_, err := recognizer.Recognize(context.Background(), bytes.NewReader(oggHead), RecognitionRequest{Filename: "voice.ogg"})
+		if err == nil {
+			t.Errorf("status %d: Recognize succeeded", status)
+		}
+		if got := transport.calls.Load(); got != attempts {
+			t.Errorf("status %d: %d attempts, want %d", status, got, attempts)
+		}
+		if failed := backendFailed(err); failed != (status >= 500 || status == http.StatusTooManyRequests) {
+			t.Errorf("status %d: backendFailed = %v", status, failed)
+		}
+	}
+}
+
+func TestMultipartBodyStreamsTheAudio(t *testing.T) {
+	audio := bytes.Repeat([]byte("audio"), 1000)
+	body, length, contentType, err := multipartBody(bytes.NewReader(audio), int64(len(audio)), RecognitionRequest{
+		Filename:    `voice "1".ogg`,
+		ContentType: "audio/ogg",
+		Language:    "ru",
+		CallbackURL: "https://bot.example/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(form)) != length {
+		t.Errorf("form of %d bytes announced as %d", len(form), length)
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := multipart.NewReader(bytes.NewReader(form), params["boundary"])
+	parsed, err := reader.ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Value["language"][0] != "ru" || parsed.Value["callback_url"][0] != "https://bot.example/callback" {
+		t.Errorf("form fields = %v", parsed.Value)
+	}
+	file := parsed.File["file"][0]
+	if file.Filename != `voice "1".ogg` {
+		t.Errorf("file name %q", file.Filename)
+	}
+	f, _ := file.Open()
+	defer f.Close()
+	if got, _ := io.ReadAll(f); !bytes.Equal(got, audio) {
+		t.Errorf("file part holds %d bytes, want the %d of the audio", len(got), len(audio))
+	}
+}
+
+func TestRecognizeSendsTheFormWithItsLength(t *testing.T) {
+	audio := bytes.Repeat(oggHead, 100)
+	var gotLength int64
+	var gotEncoding []string
+	var gotAudio []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLength, gotEncoding = r.ContentLength, r.TransferEncoding
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gotAudio, _ = io.ReadAll(file)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"recognized_text": "hello", "detected_language": "en"}`)
+	}))
+	defer server.Close()
+
+	backends := failover.New([]string{server.URL}, failover.InOrder, 100, time.Minute)
+	result, err := NewHTTPRecognizer(backends, server.Client()).Recognize(context.Background(), bytes.NewReader(audio), RecognitionRequest{Filename: "voice.ogg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RecognizedText != "hello" {
+		t.Errorf("recognized %+v", result)
+	}
+	if gotLength <= int64(len(audio)) || len(gotEncoding) != 0 {
+		t.Errorf("sent with length %d and encoding %v, want a length covering the form", gotLength, gotEncoding)
+	}
+	if !bytes.Equal(gotAudio, audio) {
+		t.Errorf("backend got %d bytes of audio, want %d", len(gotAudio), len(audio))
+	}
+}
+
+func TestMultipartBodyTypesTheFile(t *testing.T) {
+	for contentType, want := range map[string]string{"audio/mpeg": "audio/mpeg", "": "application/octet-stream"} {
+		body, _, formType, err := multipartBody(bytes.NewReader(oggHead), int64(len(oggHead)), RecognitionRequest{Filename: "talk.mp3", ContentType: contentType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, params, _ := mime.ParseMediaType(formType)
+		part, err := multipart.NewReader(body, params["boundary"]).NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want {
+			t.Errorf("content type %q sent as %q, want %q", contentType, got, want)
+		}
+	}
+}
+
+func TestRecognizeFailsOverToTheNextBackend(t *testing.T) {
+	setVar(t, &UploadAttempts, 2)
+	setVar(t, &UploadRetryBackoff, time.Millisecond)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"recognized_text": "hello", "detected_language": "en"}`)
+	}))
+	defer up.Close()
+
+	backends := failover.New([]string{down.URL, up.URL}, failover.InOrder, 1, time.Minute)
+	recognizer := NewHTTPRecognizer(backends, http.DefaultClient)
+	result, err := recognizer.Recognize(context.Background(), bytes.NewReader(oggHead), RecognitionRequest{Filename: "voice.ogg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RecognizedText != "hello" || result.Endpoint != up.URL {
+		t.Errorf("recognized %+v, want the answer of the second backend", result)
+	}
+	// The next upload goes straight to the healthy backend
+	if order := backends.Order(time.Now()); len(order) != 1 || order[0] != up.URL {
+		t.Errorf("order %v after the failure", order)
+	}
+}
@@ -0,0 +1,203 @@
+package handleAudio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/settings"
+)
+
+// PlaceholdersEnabled makes the handler post a placeholder message as soon
+// as it starts and edit it into the final reply, unless a chat overrides it.
+var PlaceholdersEnabled bool
+
+func placeholdersEnabled(chat settings.Settings) bool {
+	if chat.Placeholders != nil {
+		return *chat.Placeholders
+	}
+	return PlaceholdersEnabled
+}
+
+// maxMessageLength is the longest text Telegram accepts in one message.
+const maxMessageLength = 4096
+
+// chatActionInterval is how often the typing indicator is refreshed; Telegram
+// shows it for five seconds.
+const chatActionInterval = 4 * time.Second
+
+// replier delivers the outcome of handling a message to its chat. While the
+// message is processed it keeps a typing indicator up and, if enabled, shows
+// a placeholder that the final reply replaces.
+type replier struct {
+	bot           MessageSender
+	edits         *sender.EditThrottler
+	message       *tgbotapi.Message
+	logger        zerolog.Logger
+	chatID        int64
+	placeholderID int
+	stopTyping    context.CancelFunc
+	typingDone    chan struct{} // Closed once keepTyping has returned
+}
+
+// newReplier starts replying to message, posting placeholder unless it is
+// empty. The placeholder is edited through edits.
+func newReplier(ctx context.Context, bot MessageSender, edits *sender.EditThrottler, message *tgbotapi.Message, logger zerolog.Logger, placeholder string) *replier {
+	r := &replier{bot: bot, edits: edits, message: message, logger: logger, chatID: message.Chat.ID}
+
+	if placeholder != "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, placeholder)
+		msg.ReplyToMessageID = message.MessageID
+		msg.AllowSendingWithoutReply = true
+		if sent, err := sender.SendMessage(bot, msg); err != nil {
+			logger.Warn().Err(err).Msg("Failed to send placeholder message")
+		} else {
+			r.placeholderID = sent.MessageID
+			r.chatID = sent.Chat.ID
+			return r
+		}
+	}
+
+	ctx, r.stopTyping = context.WithCancel(ctx)
+	r.typingDone = make(chan struct{})
+	go r.keepTyping(ctx)
+	return r
+}
+
+func (r *replier) keepTyping(ctx context.Context) {
+	defer close(r.typingDone)
+	ticker := time.NewTicker(chatActionInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.bot.Request(tgbotapi.NewChatAction(r.chatID, tgbotapi.ChatTyping)); err != nil {
+			r.logger.Debug().Err(err).Msg("Failed to send typing action")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send delivers texts in order as replies to the message. The first one
+// replaces the placeholder when there is one and it fits into a single
+// message.
+func (r *replier) send(texts ...string) error {
+	replies := make([]formattedReply, len(texts))
+	for i, text := range texts {
+		replies[i] = formattedReply{plain: text}
+	}
+	return r.sendFormatted(nil, replies...)
+}
+
+// sendFormatted is send for replies with markup, keyboard is attached to
+// the last message if it is not nil. A reply Telegram refuses to parse is
+// sent as plain text instead.
+func (r *replier) sendFormatted(keyboard *tgbotapi.InlineKeyboardMarkup, replies ...formattedReply) error {
+	r.close()
+	chatID := r.chatID
+	if r.placeholderID != 0 {
+		placeholderID := r.placeholderID
+		r.placeholderID = 0
+		edited := false
+		if utf8.RuneCountInString(replies[0].plain) <= maxMessageLength {
+			_, err := withMarkup(r.logger, replies[0], func(text, parseMode string) (tgbotapi.Message, error) {
+				edit := tgbotapi.NewEditMessageText(chatID, placeholderID, text)
+				edit.ParseMode = parseMode
+				if len(replies) == 1 {
+					edit.ReplyMarkup = keyboard
+				}
+				return tgbotapi.Message{}, r.edits.Edit(edit)
+			})
+			if err != nil {
+				r.logger.Warn().Err(err).Msg("Failed to edit placeholder message, sending a new reply")
+			}
+			edited = err == nil
+		}
+		// The placeholder has its final text or is about to go
+		r.edits.Finish(chatID, placeholderID)
+		if edited {
+			replies = replies[1:]
+		} else {
+			// Replace the placeholder with regular messages
+			if _, err := r.bot.Request(tgbotapi.NewDeleteMessage(chatID, placeholderID)); err != nil {
+				r.logger.Warn().Err(err).Msg("Failed to delete placeholder message")
+			}
+		}
+	}
+
+	for i, reply := range replies {
+		_, err := withMarkup(r.logger, reply, func(text, parseMode string) (tgbotapi.Message, error) {
+			msg := tgbotapi.NewMessage(chatID, text)
+			msg.ParseMode = parseMode
+			msg.ReplyToMessageID = r.message.MessageID
+			msg.AllowSendingWithoutReply = true
+			if i == len(replies)-1 && keyboard != nil {
+				msg.ReplyMarkup = *keyboard
+			}
+			return sender.SendMessage(r.bot, msg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withMarkup sends reply through send as MarkdownV2, falling back to plain
+// text when Telegram rejects the request.
+func withMarkup(logger zerolog.Logger, reply formattedReply, send func(text, parseMode string) (tgbotapi.Message, error)) (tgbotapi.Message, error) {
+	if reply.markdown != "" {
+		sent, err := send(reply.markdown, tgbotapi.ModeMarkdownV2)
+		var apiErr *tgbotapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+			return sent, err
+		}
+		logger.Warn().Err(err).Msg("Telegram rejected the formatted reply, sending plain text")
+	}
+	return send(reply.plain, "")
+}
+
+// sendDocument delivers doc as a reply to the message, in place of the
+// placeholder.
+func (r *replier) sendDocument(doc tgbotapi.DocumentConfig) error {
+	r.close()
+	doc.ChatID = r.chatID
+	if r.placeholderID != 0 {
+		r.edits.Finish(r.chatID, r.placeholderID)
+		if _, err := r.bot.Request(tgbotapi.NewDeleteMessage(r.chatID, r.placeholderID)); err != nil {
+			r.logger.Warn().Err(err).Msg("Failed to delete placeholder message")
+		}
+		r.placeholderID = 0
+	}
+	doc.ReplyToMessageID = r.message.MessageID
+	doc.AllowSendingWithoutReply = true
+	_, err := r.bot.Send(doc)
+	return err
+}
+
+// progress replaces the text of the placeholder, if there is one, to show
+// the message is still being worked on. The edit is throttled and does not
+// hold up the caller.
+func (r *replier) progress(text string) {
+	if r.placeholderID == 0 {
+		return
+	}
+	r.edits.Submit(r.chatID, r.placeholderID, text)
+}
+
+// close stops the typing indicator and waits until no typing action can be
+// sent any more, so none follows the reply; it is safe to call more than
+// once.
+func (r *replier) close() {
+	if r.stopTyping != nil {
+		r.stopTyping()
+		<-r.typingDone
+	}
+}
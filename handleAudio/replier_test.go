@@ -0,0 +1,54 @@
+package handleAudio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"telegram-sr-bot/sender"
+)
+
+// slowTypingBot holds every chat action until it is released.
+type slowTypingBot struct {
+	fakeBot
+	typing  chan struct{}
+	release chan struct{}
+}
+
+func (b *slowTypingBot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	if _, ok := c.(tgbotapi.ChatActionConfig); ok {
+		b.typing <- struct{}{}
+		<-b.release
+	}
+	return b.fakeBot.Request(c)
+}
+
+func TestCloseWaitsForTheTypingAction(t *testing.T) {
+	bot := &slowTypingBot{typing: make(chan struct{}), release: make(chan struct{})}
+	r := newReplier(context.Background(), bot, sender.NewEditThrottler(bot, 0), voiceMessage(time.Second), zerolog.Nop(), "")
+	<-bot.typing
+
+	closed := make(chan struct{})
+	go func() {
+		r.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close returned while a typing action was being sent")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(bot.release)
+	<-closed
+
+	if err := r.send("done"); err != nil {
+		t.Fatal(err)
+	}
+	requests := bot.snapshot()
+	if _, ok := requests[len(requests)-1].chattable.(tgbotapi.MessageConfig); !ok {
+		t.Errorf("last request %T, want the reply after the typing action", requests[len(requests)-1].chattable)
+	}
+	r.close()
+}
@@ -0,0 +1,106 @@
+package handleAudio
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"telegram-sr-bot/sanitize"
+)
+
+// MaxResponseBytes caps how much of a recognition response body is read,
+// after decompression.
+var MaxResponseBytes int64 = 10 << 20
+
+var ResponseRejectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "recognition_responses_rejected_total",
+		Help: "Total number of recognition responses rejected before decoding.",
+	},
+	[]string{"reason"}, // Reason can be "too_large" or "content_type"
+)
+
+var (
+	errResponseTooLarge  = errors.New("recognition response exceeds the size limit")
+	errUnexpectedContent = errors.New("recognition response is not JSON")
+)
+
+// decodeRecognitionResponse decodes a JSON response body into v, refusing
+// non-JSON content types and bodies larger than MaxResponseBytes.
+func decodeRecognitionResponse(resp *http.Response, v any) error {
+	return decodeRecognitionBody(resp.Header, resp.Body, resp.Uncompressed, v)
+}
+
+// decodeRecognitionBody is decodeRecognitionResponse for a body with
+// header, which is still gzipped unless uncompressed; the backend posts
+// callbacks the same way it answers requests.
+func decodeRecognitionBody(header http.Header, reader io.ReadCloser, uncompressed bool, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		ResponseRejectedCounter.With(prometheus.Labels{"reason": "content_type"}).Inc()
+		return fmt.Errorf("%w: content type %q", errUnexpectedContent, header.Get("Content-Type"))
+	}
+
+	var body io.Reader = http.MaxBytesReader(nil, reader, MaxResponseBytes)
+	if !uncompressed && header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		// Cap the decompressed stream as well, a small body can inflate a lot
+		body = &limitedReader{r: gz, n: MaxResponseBytes}
+	}
+
+	err := json.NewDecoder(body).Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, errResponseTooLarge) {
+		ResponseRejectedCounter.With(prometheus.Labels{"reason": "too_large"}).Inc()
+		return errResponseTooLarge
+	}
+	return err
+}
+
+// maxErrorBytes caps how much of an error response body is read.
+const maxErrorBytes = 64 << 10
+
+// recognitionErrorMessage returns the backend's explanation from an error
+// response, or "" if the body is not a JSON RecognitionError.
+func recognitionErrorMessage(resp *http.Response) string {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" || (!resp.Uncompressed && resp.Header.Get("Content-Encoding") != "") {
+		return ""
+	}
+	var recognitionErr RecognitionError
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBytes)).Decode(&recognitionErr); err != nil {
+		return ""
+	}
+	return sanitize.String(recognitionErr.Error, sanitize.LogField)
+}
+
+// limitedReader is like io.LimitedReader but reports errResponseTooLarge
+// instead of a silent EOF once the limit is passed.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errResponseTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), errResponseTooLarge
+	}
+	return n, err
+}
@@ -1,6 +1,20 @@
 package handleAudio
 
 type RecognitionSuccess struct {
-	DetectedLang   string `json:"detected_language"`
-	RecognizedText string `json:"recognized_text"`
+	DetectedLang   string    `json:"detected_language"`
+	RecognizedText string    `json:"recognized_text"`
+	Segments       []Segment `json:"segments,omitempty"`
+}
+
+// Segment is a timed part of the transcription, in seconds from the start
+// of the audio. Backends that do not time their output leave them out.
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// RecognitionError is the body of a non-200 recognition response.
+type RecognitionError struct {
+	Error string `json:"error"`
 }
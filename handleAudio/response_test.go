@@ -0,0 +1,93 @@
+package handleAudio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecodeRecognitionBody(t *testing.T) {
+	setVar(t, &MaxResponseBytes, 128)
+	transcript := `{"recognized_text": "hello", "detected_language": "en"}`
+	padded := `{"recognized_text": "` + strings.Repeat("a", 200) + `"}`
+	for _, c := range []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		err         error
+		rejected    string
+	}{
+		{name: "json", contentType: "application/json", body: transcript},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", body: transcript},
+		{name: "gzipped", contentType: "application/json", encoding: "gzip", body: gzipped(t, transcript)},
+		{name: "html", contentType: "text/html", body: "<html>Bad Gateway</html>", err: errUnexpectedContent, rejected: "content_type"},
+		{name: "no content type", body: transcript, err: errUnexpectedContent, rejected: "content_type"},
+		{name: "too large", contentType: "application/json", body: padded, err: errResponseTooLarge, rejected: "too_large"},
+		// Small on the wire, too large once inflated
+		{name: "gzip bomb", contentType: "application/json", encoding: "gzip", body: gzipped(t, padded), err: errResponseTooLarge, rejected: "too_large"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			header := http.Header{}
+			if c.contentType != "" {
+				header.Set("Content-Type", c.contentType)
+			}
+			if c.encoding != "" {
+				header.Set("Content-Encoding", c.encoding)
+			}
+			var rejected float64
+			if c.rejected != "" {
+				rejected = testutil.ToFloat64(ResponseRejectedCounter.With(prometheus.Labels{"reason": c.rejected}))
+			}
+
+			var success RecognitionSuccess
+			err := decodeRecognitionBody(header, io.NopCloser(strings.NewReader(c.body)), false, &success)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("decode = %v, want %v", err, c.err)
+			}
+			if c.err == nil && success.RecognizedText != "hello" {
+				t.Errorf("decoded %+v", success)
+			}
+			if c.rejected != "" {
+				if got := testutil.ToFloat64(ResponseRejectedCounter.With(prometheus.Labels{"reason": c.rejected})) - rejected; got != 1 {
+					t.Errorf("rejections counted as %s: %v, want 1", c.rejected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRecognitionErrorMessage(t *testing.T) {
+	for _, c := range []struct {
+		contentType, body, want string
+	}{
+		{"application/json", `{"error": "unsupported codec"}`, "unsupported codec"},
+		{"text/plain", "unsupported codec", ""},
+		{"application/json", "not json", ""},
+	} {
+		resp := &http.Response{Header: http.Header{"Content-Type": {c.contentType}}, Body: io.NopCloser(strings.NewReader(c.body))}
+		if got := recognitionErrorMessage(resp); got != c.want {
+			t.Errorf("message of %s %q = %q, want %q", c.contentType, c.body, got, c.want)
+		}
+	}
+}
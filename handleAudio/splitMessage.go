@@ -0,0 +1,81 @@
+package handleAudio
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitTranscript lays out header and text as one or more messages of at
+// most limit characters each. Text is broken at sentence or word boundaries,
+// only a word longer than a whole message is cut. When more than one message
+// is needed every one of them starts with a "(i/n)" part counter and only
+// the first one carries the header.
+func splitTranscript(header, text string, limit int) []string {
+	if utf8.RuneCountInString(header)+utf8.RuneCountInString(text) <= limit {
+		return []string{header + text}
+	}
+	// The counter width depends on the number of parts, grow it until it fits
+	for digits := 1; ; digits++ {
+		prefix := len(fmt.Sprintf("(%[1]s/%[1]s) ", strings.Repeat("9", digits)))
+		chunks := splitText(text, limit-prefix, limit-prefix-utf8.RuneCountInString(header))
+		if len(fmt.Sprint(len(chunks))) > digits {
+			continue
+		}
+		parts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			if i == 0 {
+				chunk = header + chunk
+			}
+			parts[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(chunks), chunk)
+		}
+		return parts
+	}
+}
+
+// splitText breaks text into chunks of at most limit runes, the first one
+// at most firstLimit runes.
+func splitText(text string, limit, firstLimit int) []string {
+	var chunks []string
+	runes := []rune(strings.TrimSpace(text))
+	for max := firstLimit; len(runes) > 0; max = limit {
+		if max < 1 {
+			max = 1
+		}
+		n := len(runes)
+		if n > max {
+			n = breakPoint(runes[:max+1])
+		}
+		chunks = append(chunks, strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace))
+		runes = runes[n:]
+		for len(runes) > 0 && unicode.IsSpace(runes[0]) {
+			runes = runes[1:]
+		}
+	}
+	return chunks
+}
+
+// breakPoint returns where to end a chunk taken from window, whose last rune
+// is the first one that does not fit: after the last sentence if that keeps
+// at least half of the window, otherwise before the last word, otherwise
+// right before that rune.
+func breakPoint(window []rune) int {
+	limit := len(window) - 1
+	word := 0
+	for i := limit; i > 0; i-- {
+		if !unicode.IsSpace(window[i]) {
+			continue
+		}
+		if i >= limit/2 && (window[i] == '\n' || strings.ContainsRune(".!?…", window[i-1])) {
+			return i
+		}
+		if word == 0 {
+			word = i
+		}
+	}
+	if word > 0 {
+		return word
+	}
+	return limit
+}
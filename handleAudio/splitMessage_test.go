@@ -0,0 +1,83 @@
+package handleAudio
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitTranscriptFitsOneMessage(t *testing.T) {
+	parts := splitTranscript("Header\n", "short text", 100)
+	if len(parts) != 1 || parts[0] != "Header\nshort text" {
+		t.Errorf("parts = %q, want a single message without a counter", parts)
+	}
+}
+
+func TestSplitTranscriptKeepsEveryPartWithinTheLimit(t *testing.T) {
+	header := "🇬🇧 English\n"
+	text := strings.Repeat("Это предложение. And another one here! ", 300)
+	for _, limit := range []int{50, 200, 4096} {
+		parts := splitTranscript(header, text, limit)
+		if len(parts) < 2 {
+			t.Fatalf("limit %d: %d parts", limit, len(parts))
+		}
+		var words []string
+		for i, part := range parts {
+			if n := utf8.RuneCountInString(part); n > limit {
+				t.Errorf("limit %d: part %d has %d runes", limit, i+1, n)
+			}
+			counter := fmt.Sprintf("(%d/%d) ", i+1, len(parts))
+			if !strings.HasPrefix(part, counter) {
+				t.Errorf("limit %d: part %q does not start with %s", limit, part, counter)
+			}
+			body := strings.TrimPrefix(part, counter)
+			if i == 0 {
+				if !strings.HasPrefix(body, header) {
+					t.Errorf("limit %d: first part %q lacks the header", limit, part)
+				}
+				body = strings.TrimPrefix(body, header)
+			} else if strings.Contains(body, header) {
+				t.Errorf("limit %d: part %d repeats the header", limit, i+1)
+			}
+			words = append(words, strings.Fields(body)...)
+		}
+		if got := strings.Join(words, " "); got != strings.Join(strings.Fields(text), " ") {
+			t.Errorf("limit %d: words were lost or cut", limit)
+		}
+	}
+}
+
+func TestSplitTranscriptBreaksAtSentences(t *testing.T) {
+	parts := splitTranscript("", "The first sentence is here. The second one follows it", 40)
+	if len(parts) != 2 || parts[0] != "(1/2) The first sentence is here." {
+		t.Errorf("parts = %q, want a break after the first sentence", parts)
+	}
+}
+
+func TestSplitTranscriptCutsOnlyOverlongWords(t *testing.T) {
+	word := strings.Repeat("a", 25)
+	parts := splitTranscript("", "tiny "+word, 20)
+	if len(parts) < 3 || parts[0] != "(1/3) tiny" {
+		t.Fatalf("parts = %q, want the short word alone, then the long one cut", parts)
+	}
+	var rest string
+	for _, part := range parts[1:] {
+		rest += part[strings.Index(part, " ")+1:]
+	}
+	if rest != word {
+		t.Errorf("long word came out as %q", rest)
+	}
+}
+
+func TestSplitTranscriptWidensTheCounter(t *testing.T) {
+	parts := splitTranscript("", strings.Repeat("word ", 200), 20)
+	if len(parts) < 10 {
+		t.Fatalf("%d parts, want more than 9", len(parts))
+	}
+	for i, part := range parts {
+		if utf8.RuneCountInString(part) > 20 {
+			t.Errorf("part %d %q exceeds the limit with a two-digit counter", i+1, part)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handleAudio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// srtFileName is the name of the subtitle files sent to users.
+const srtFileName = "transcript.srt"
+
+// formatSRT renders segments as SubRip subtitles. Segments are ordered by
+// their start, an overlapping one ends where the next begins, and segments
+// without text are left out. It returns "" when nothing is left.
+func formatSRT(segments []Segment) string {
+	cues := make([]Segment, 0, len(segments))
+	for _, segment := range segments {
+		segment.Text = strings.TrimSpace(segment.Text)
+		if segment.Text == "" {
+			continue
+		}
+		segment.Start = math.Max(segment.Start, 0)
+		segment.End = math.Max(segment.End, segment.Start)
+		cues = append(cues, segment)
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+
+	var b strings.Builder
+	for i, cue := range cues {
+		if i+1 < len(cues) && cue.End > cues[i+1].Start {
+			cue.End = cues[i+1].Start
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTimestamp(cue.Start), srtTimestamp(cue.End), cue.Text)
+	}
+	return b.String()
+}
+
+// srtTimestamp formats seconds as HH:MM:SS,mmm.
+func srtTimestamp(seconds float64) string {
+	d := time.Duration(math.Round(seconds*1000)) * time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d,%03d",
+		int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second), int(d%time.Second/time.Millisecond))
+}
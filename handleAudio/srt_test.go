@@ -0,0 +1,102 @@
+package handleAudio
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/settings"
+)
+
+func TestFormatSRT(t *testing.T) {
+	got := formatSRT([]Segment{
+		{Start: 3.5, End: 7, Text: " second "},
+		// Overlaps the next one
+		{Start: 0, End: 4, Text: "first"},
+		{Start: 5, End: 6, Text: "  "},
+		{Start: 3661.25, End: -1, Text: "last"},
+	})
+	want := "1\n00:00:00,000 --> 00:00:03,500\nfirst\n\n" +
+		"2\n00:00:03,500 --> 00:00:07,000\nsecond\n\n" +
+		"3\n01:01:01,250 --> 01:01:01,250\nlast\n\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := formatSRT([]Segment{{Start: 1, End: 2, Text: " "}}); got != "" {
+		t.Errorf("segments without text rendered as %q", got)
+	}
+}
+
+func TestSRTTimestamp(t *testing.T) {
+	for seconds, want := range map[float64]string{
+		0:         "00:00:00,000",
+		0.0005:    "00:00:00,001",
+		59.9994:   "00:00:59,999",
+		61.5:      "00:01:01,500",
+		36000.042: "10:00:00,042",
+	} {
+		if got := srtTimestamp(seconds); got != want {
+			t.Errorf("srtTimestamp(%v) = %s, want %s", seconds, got, want)
+		}
+	}
+}
+
+// documents returns the documents sent, by file name.
+func (b *fakeBot) documents() map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	documents := make(map[string]string)
+	for _, r := range b.requests {
+		if doc, ok := r.chattable.(tgbotapi.DocumentConfig); ok {
+			if file, ok := doc.File.(tgbotapi.FileBytes); ok {
+				documents[file.Name] = string(file.Bytes)
+			}
+		}
+	}
+	return documents
+}
+
+func TestHandleSRTRepliesWithSubtitles(t *testing.T) {
+	result := recognized("hello there")
+	result.Segments = []Segment{{Start: 0, End: 1.5, Text: "hello there"}}
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: result})
+
+	message := voiceMessage(5 * time.Second)
+	handler.HandleSRT(context.Background(), message, message)
+
+	if got := bot.documents()[srtFileName]; got != "1\n00:00:00,000 --> 00:00:01,500\nhello there\n\n" {
+		t.Errorf("subtitles sent: %q", got)
+	}
+}
+
+func TestChatsAskingForSubtitlesGetThem(t *testing.T) {
+	result := recognized("hello there")
+	result.Segments = []Segment{{Start: 0, End: 1.5, Text: "hello there"}}
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: result})
+	if err := handler.settings.Set(7, settings.Settings{SRT: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	message := voiceMessage(5 * time.Second)
+	handler.Handle(context.Background(), message, message)
+	if _, ok := bot.documents()[srtFileName]; !ok {
+		t.Error("no subtitles for a chat that turned them on")
+	}
+}
+
+func TestSubtitlesFallBackToText(t *testing.T) {
+	handler, bot := newTestHandler(fakeFetcher{audio: oggHead}, &fakeRecognizer{result: recognized("hello there")})
+
+	message := voiceMessage(5 * time.Second)
+	handler.HandleSRT(context.Background(), message, message)
+
+	if len(bot.documents()) != 0 {
+		t.Errorf("documents %v sent without segments", bot.documents())
+	}
+	if !slices.ContainsFunc(bot.texts(), func(text string) bool { return strings.Contains(text, "hello there") }) {
+		t.Errorf("texts %q, want the transcription", bot.texts())
+	}
+}
@@ -0,0 +1,67 @@
+package handleAudio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	// errStageCreate is wrapped around failures to create the temp file,
+	// which are no fault of the download.
+	errStageCreate = errors.New("create temp file")
+	// errStageWrite is wrapped around failures to fill the temp file.
+	errStageWrite = errors.New("save to temp file")
+)
+
+// stagedAudio is a download made readable again for every upload attempt.
+type stagedAudio struct {
+	audio io.ReaderAt
+	file  *os.File // The temp file, nil when the audio is in memory
+	size  int64
+}
+
+// Close removes the temp file, if any.
+func (s stagedAudio) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// stageAudio reads content into memory when inMemory is set and it fits in
+// InMemoryUploadLimit, and into a temp file named with ext otherwise. No
+// more than maxBytes+1 bytes are saved when maxBytes > 0, enough for the
+// caller to tell the download is too large.
+func stageAudio(content io.Reader, inMemory bool, ext string, maxBytes int64) (stagedAudio, error) {
+	body := content
+	if inMemory {
+		data, err := io.ReadAll(io.LimitReader(content, InMemoryUploadLimit+1))
+		if err != nil {
+			return stagedAudio{}, err
+		}
+		if int64(len(data)) <= InMemoryUploadLimit {
+			return stagedAudio{audio: bytes.NewReader(data), size: int64(len(data))}, nil
+		}
+		// Telegram reported a smaller size, spill over to a temp file
+		body = io.MultiReader(bytes.NewReader(data), content)
+	}
+
+	file, err := os.CreateTemp("", "audio-*"+ext)
+	if err != nil {
+		return stagedAudio{}, fmt.Errorf("%w: %w", errStageCreate, err)
+	}
+	staged := stagedAudio{audio: file, file: file}
+	// Stop once the file is past the limit
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes+1)
+	}
+	if staged.size, err = io.Copy(file, body); err != nil {
+		staged.Close()
+		return stagedAudio{}, fmt.Errorf("%w: %w", errStageWrite, err)
+	}
+	return staged, nil
+}
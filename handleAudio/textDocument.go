@@ -0,0 +1,50 @@
+package handleAudio
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/settings"
+)
+
+// DocumentThreshold is the transcript length in characters above which it
+// is sent as a text file rather than split into messages, 0 always splits.
+var DocumentThreshold = 3000
+
+func documentThreshold(chat settings.Settings) int {
+	if chat.DocumentThreshold != nil {
+		return *chat.DocumentThreshold
+	}
+	return DocumentThreshold
+}
+
+// documentName names the text file after the audio file, or after the date
+// of the message for voice messages and videos that have no name.
+func documentName(source AudioSource, message *tgbotapi.Message) string {
+	name := strings.TrimSuffix(path.Base(source.FileName), path.Ext(source.FileName))
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." {
+		name = "transcript-" + message.Time().UTC().Format("2006-01-02-150405")
+	}
+	return name + ".txt"
+}
+
+// documentSummary is the caption of a transcript sent as a file.
+func documentSummary(texts *messages.Bundle, duration time.Duration, language string) string {
+	length := texts.Get(messages.DurationSeconds, int(duration.Round(time.Second)/time.Second))
+	if duration >= time.Minute {
+		length = texts.Get(messages.DurationMinutes, int(duration.Round(time.Minute)/time.Minute))
+	}
+	if duration <= 0 {
+		return texts.Get(messages.DocumentSummaryNoLength, language)
+	}
+	return texts.Get(messages.DocumentSummary, length, language)
+}
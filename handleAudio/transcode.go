@@ -0,0 +1,84 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AudioTranscoder converts audio to a format the recognition backend decodes
+// quickly, before it is uploaded.
+type AudioTranscoder interface {
+	// Transcode writes the audio of inputPath to a new file and returns its
+	// path, the caller removes it when done.
+	Transcode(ctx context.Context, inputPath string) (string, error)
+}
+
+// Transcoder converts every upload; nil uploads the audio as it was sent.
+var Transcoder AudioTranscoder
+
+// TranscodeContentType is the type of the audio FFmpegTranscoder produces.
+const TranscodeContentType = "audio/wav"
+
+// FFmpegTranscoder transcodes by running the ffmpeg binary at Path.
+type FFmpegTranscoder struct {
+	Path string
+}
+
+// Transcode decodes the first audio track of inputPath into 16 kHz mono
+// 16-bit PCM WAV, what speech recognition models take in. The process is
+// killed when ctx is done.
+func (t FFmpegTranscoder) Transcode(ctx context.Context, inputPath string) (string, error) {
+	out, err := os.CreateTemp("", "audio-*.wav")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	var stderr bytes.Buffer
+	// No shell is involved, the paths are passed as they are
+	cmd := exec.CommandContext(ctx, t.Path, transcodeArgs(inputPath, out.Name())...)
+	cmd.Stderr = &stderr
+	// Do not wait on pipes a killed ffmpeg may have left to a child
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Run(); err != nil {
+		os.Remove(out.Name())
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("ffmpeg: %w", ctx.Err())
+		}
+		return "", fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Name(), nil
+}
+
+// transcodeArgs are the ffmpeg arguments writing the first audio track of
+// inputPath to outputPath as 16 kHz mono WAV.
+func transcodeArgs(inputPath, outputPath string) []string {
+	return []string{"-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", inputPath, "-map", "0:a:0", "-vn", "-ac", "1", "-ar", "16000", "-c:a", "pcm_s16le", "-f", "wav", outputPath}
+}
+
+// transcode runs Transcoder on inputPath and opens the result, returning it
+// along with its size. The caller closes and removes the file.
+func transcode(ctx context.Context, inputPath string) (*os.File, int64, error) {
+	outputPath, err := Transcoder.Transcode(ctx, inputPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		os.Remove(outputPath)
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
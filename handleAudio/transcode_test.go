@@ -0,0 +1,141 @@
+package handleAudio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscodeArgs(t *testing.T) {
+	args := transcodeArgs("-in put.ogg", "/tmp/out.wav")
+	for _, want := range [][]string{
+		{"-i", "-in put.ogg"},
+		{"-map", "0:a:0"},
+		{"-ac", "1"},
+		{"-ar", "16000"},
+		{"-c:a", "pcm_s16le"},
+		{"-f", "wav"},
+	} {
+		i := slices.Index(args, want[0])
+		if i < 0 || i+1 >= len(args) || args[i+1] != want[1] {
+			t.Errorf("args %q lack %s %s", args, want[0], want[1])
+		}
+	}
+	if !slices.Contains(args, "-nostdin") || !slices.Contains(args, "-vn") {
+		t.Errorf("args %q may read stdin or keep the video", args)
+	}
+	if args[len(args)-1] != "/tmp/out.wav" {
+		t.Errorf("args %q do not end with the output", args)
+	}
+}
+
+// fakeFFmpeg writes a shell script standing in for ffmpeg and returns its
+// path.
+func fakeFFmpeg(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFFmpegTranscoderWritesTheOutput(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	// The output is the last argument
+	transcoder := FFmpegTranscoder{Path: fakeFFmpeg(t, `echo "$@" > `+argsFile+`
+for last; do :; done
+printf RIFF > "$last"
+`)}
+
+	output, err := transcoder.Transcode(context.Background(), "voice.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(output)
+	if data, _ := os.ReadFile(output); string(data) != "RIFF" {
+		t.Errorf("output %q, want what ffmpeg wrote", data)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if want := strings.Join(transcodeArgs("voice.ogg", output), " "); strings.TrimSpace(string(args)) != want {
+		t.Errorf("ffmpeg run with %s, want %s", args, want)
+	}
+}
+
+func TestFFmpegTranscoderFailureLeavesNothingBehind(t *testing.T) {
+	outputs := filepath.Join(t.TempDir(), "outputs")
+	transcoder := FFmpegTranscoder{Path: fakeFFmpeg(t, `for last; do :; done
+echo "$last" > `+outputs+`
+echo "voice.ogg: Invalid data found when processing input" >&2
+exit 1
+`)}
+
+	_, err := transcoder.Transcode(context.Background(), "voice.ogg")
+	if err == nil || !strings.Contains(err.Error(), "Invalid data found") {
+		t.Fatalf("Transcode = %v, want the error ffmpeg printed", err)
+	}
+	output, _ := os.ReadFile(outputs)
+	if _, err := os.Stat(strings.TrimSpace(string(output))); !os.IsNotExist(err) {
+		t.Errorf("output %s left behind: %v", output, err)
+	}
+}
+
+// fakeTranscoder turns every file into wav, or fails with err.
+type fakeTranscoder struct {
+	wav []byte
+	err error
+}
+
+func (f fakeTranscoder) Transcode(ctx context.Context, inputPath string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	out, err := os.CreateTemp("", "audio-*.wav")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	_, err = out.Write(f.wav)
+	return out.Name(), err
+}
+
+func TestHandlerUploadsTheTranscodedAudio(t *testing.T) {
+	wav := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range []struct {
+		name        string
+		transcoder  fakeTranscoder
+		upload      []byte
+		filename    string
+		contentType string
+	}{
+		{"transcoded", fakeTranscoder{wav: wav}, wav, "audio.wav", TranscodeContentType},
+		// The backend decodes the original as well
+		{"transcoding failed", fakeTranscoder{err: errBackend}, oggHead, "audio.ogg", "application/ogg"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			setVar(t, &Transcoder, AudioTranscoder(c.transcoder))
+			recognizer := &fakeRecognizer{result: recognized("hello")}
+			handler, _ := newTestHandler(fakeFetcher{audio: oggHead}, recognizer)
+
+			message := voiceMessage(5 * time.Second)
+			handler.Handle(context.Background(), message, message)
+			if len(recognizer.uploads) != 1 {
+				t.Fatalf("%d uploads, want 1", len(recognizer.uploads))
+			}
+			if string(recognizer.uploads[0]) != string(c.upload) {
+				t.Errorf("uploaded %q, want %q", recognizer.uploads[0], c.upload)
+			}
+			if req := recognizer.requests[0]; req.Filename != c.filename || req.ContentType != c.contentType {
+				t.Errorf("uploaded as %s of type %s, want %s of type %s", req.Filename, req.ContentType, c.filename, c.contentType)
+			}
+		})
+	}
+}
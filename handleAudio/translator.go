@@ -0,0 +1,90 @@
+package handleAudio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Translate translates transcripts on request; nil hides the translate
+// button.
+var Translate *Translator
+
+// TranslateTimeout bounds a single translation request.
+var TranslateTimeout = 30 * time.Second
+
+// Translator translates text with the translation API at Endpoint.
+type Translator struct {
+	Endpoint string
+	client   *http.Client
+}
+
+// NewTranslator returns a translator posting to endpoint through client.
+func NewTranslator(endpoint string, client *http.Client) *Translator {
+	return &Translator{Endpoint: endpoint, client: client}
+}
+
+type translationRequest struct {
+	Text           string `json:"text"`
+	SourceLanguage string `json:"source_language,omitempty"`
+	TargetLanguage string `json:"target_language"`
+}
+
+type translationResponse struct {
+	TranslatedText string `json:"translated_text"`
+}
+
+// Translate translates text from the source language, "" if unknown, into
+// target.
+func (t *Translator) Translate(ctx context.Context, text, source, target string) (string, error) {
+	ctx, span := otel.Tracer("telegram-sr-bot").Start(ctx, "translate")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, TranslateTimeout)
+	defer cancel()
+
+	translated, err := t.translate(ctx, translationRequest{Text: text, SourceLanguage: source, TargetLanguage: target})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Translation failed")
+	}
+	return translated, err
+}
+
+func (t *Translator) translate(ctx context.Context, translation translationRequest) (string, error) {
+	body, err := json.Marshal(translation)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var result translationResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, MaxResponseBytes)).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode translation: %w", err)
+	}
+	if result.TranslatedText == "" {
+		return "", errors.New("empty translation")
+	}
+	return result.TranslatedText, nil
+}
@@ -0,0 +1,159 @@
+// Package health answers the liveness and readiness probes of the
+// orchestrator. Readiness is worked out in the background, so the probes
+// are answered right away however slow the recognition backend is.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var ReachableGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "recognition_backend_reachable",
+		Help: "Whether the last health check reached the recognition backend (1) or not (0).",
+	},
+)
+
+// Probe checks once whether the recognition backend answers.
+type Probe func(ctx context.Context) error
+
+// Checker probes the recognition backend and keeps the outcome for the
+// readiness endpoint. The bot is ready once it is authorized with Telegram
+// and the backend answered a probe within maxAge. It is safe for
+// concurrent use.
+type Checker struct {
+	probe   Probe
+	timeout time.Duration
+	maxAge  time.Duration
+
+	mu          sync.Mutex
+	authorized  bool
+	checked     bool
+	reachable   bool
+	lastSuccess time.Time
+	lastErr     error
+	degraded    error
+}
+
+// NewChecker returns a checker giving probe timeout to answer. It is not
+// ready until authorized and probed.
+func NewChecker(probe Probe, timeout, maxAge time.Duration) *Checker {
+	return &Checker{probe: probe, timeout: timeout, maxAge: maxAge}
+}
+
+// SetAuthorized records whether the bot is authorized with Telegram.
+func (c *Checker) SetAuthorized(authorized bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authorized = authorized
+}
+
+// SetDegraded keeps the bot not ready because of err, a failure it keeps
+// running despite, such as settings kept in memory for want of their
+// database; nil clears it.
+func (c *Checker) SetDegraded(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.degraded = err
+}
+
+// Run probes the backend every interval until ctx is done. The first probe
+// is up to the caller, as Check at startup.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx)
+		}
+	}
+}
+
+// Check probes the backend once, records the outcome and returns the error
+// of the probe.
+func (c *Checker) Check(ctx context.Context) error {
+	probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := c.probe(probeCtx)
+	if ctx.Err() != nil {
+		// Shutting down says nothing about the backend
+		return err
+	}
+	c.record(err, time.Now())
+	return err
+}
+
+// record takes the outcome of a probe finished at now, logging only when
+// the backend turns reachable or unreachable.
+func (c *Checker) record(err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reachable := err == nil
+	if reachable {
+		c.lastSuccess = now
+		ReachableGauge.Set(1)
+	} else {
+		ReachableGauge.Set(0)
+	}
+	c.lastErr = err
+	if c.checked && reachable == c.reachable {
+		return
+	}
+	c.checked, c.reachable = true, reachable
+	if reachable {
+		log.Info().Msg("Recognition backend is reachable")
+	} else {
+		log.Warn().Err(err).Msg("Recognition backend is unreachable")
+	}
+}
+
+// Ready returns nil if the bot is ready at now, and otherwise why not.
+func (c *Checker) Ready(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.authorized {
+		return errors.New("not authorized with Telegram")
+	}
+	if c.degraded != nil {
+		return c.degraded
+	}
+	if c.lastSuccess.IsZero() || now.Sub(c.lastSuccess) > c.maxAge {
+		if c.lastErr == nil {
+			return errors.New("recognition backend not checked recently")
+		}
+		return fmt.Errorf("recognition backend unreachable: %w", c.lastErr)
+	}
+	return nil
+}
+
+// Handler answers the readiness probe: 200 when ready, 503 with the reason
+// otherwise.
+func (c *Checker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := c.Ready(time.Now()); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+}
+
+// Healthz answers the liveness probe, the process is alive as long as it
+// answers at all.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
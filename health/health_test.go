@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProbe answers with err, counting the probes.
+type fakeProbe struct {
+	err   error
+	calls int
+}
+
+func (p *fakeProbe) probe(ctx context.Context) error {
+	p.calls++
+	return p.err
+}
+
+// status returns the status code and body handler answers a probe with.
+func status(handler http.Handler, path string) (int, string) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestReadinessFollowsTheProbe(t *testing.T) {
+	probe := &fakeProbe{}
+	c := NewChecker(probe.probe, time.Second, time.Minute)
+	handler := c.Handler()
+
+	if code, body := status(handler, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "not authorized") {
+		t.Errorf("before authorization: %d %q", code, body)
+	}
+	c.SetAuthorized(true)
+	if code, body := status(handler, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "not checked") {
+		t.Errorf("before the first probe: %d %q", code, body)
+	}
+
+	if err := c.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := status(handler, "/readyz"); code != http.StatusOK {
+		t.Errorf("after a successful probe: %d", code)
+	}
+
+	probe.err = errors.New("connection refused")
+	if err := c.Check(context.Background()); err == nil {
+		t.Fatal("failed probe reported no error")
+	}
+	// A recent success still counts, the backend may only have hiccuped
+	if err := c.Ready(time.Now()); err != nil {
+		t.Errorf("ready = %v right after a success", err)
+	}
+	if err := c.Ready(time.Now().Add(2 * time.Minute)); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("ready = %v once the success is stale, want the failure", err)
+	}
+	c.record(nil, time.Now().Add(-2*time.Minute))
+	c.Check(context.Background())
+	if code, body := status(handler, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "connection refused") {
+		t.Errorf("failing without a recent success: %d %q", code, body)
+	}
+
+	probe.err = nil
+	c.Check(context.Background())
+	if code, _ := status(handler, "/readyz"); code != http.StatusOK {
+		t.Errorf("after recovering: %d", code)
+	}
+	if probe.calls != 4 {
+		t.Errorf("%d probes, want one per Check", probe.calls)
+	}
+}
+
+func TestCheckGivesTheProbeItsTimeout(t *testing.T) {
+	c := NewChecker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond, time.Minute)
+	c.SetAuthorized(true)
+	if err := c.Check(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Check = %v, want the probe timed out", err)
+	}
+	if c.Ready(time.Now()) == nil {
+		t.Error("ready after a probe that timed out")
+	}
+}
+
+func TestCheckIgnoresShutdown(t *testing.T) {
+	probe := &fakeProbe{err: context.Canceled}
+	c := NewChecker(probe.probe, time.Second, time.Minute)
+	c.SetAuthorized(true)
+	c.record(nil, time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Check(ctx)
+	if c.lastErr != nil {
+		t.Errorf("probe cut short by shutdown recorded as %v", c.lastErr)
+	}
+}
+
+func TestRunProbesPeriodically(t *testing.T) {
+	checked := make(chan struct{}, 10)
+	c := NewChecker(func(ctx context.Context) error {
+		checked <- struct{}{}
+		return nil
+	}, time.Second, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+	<-checked
+	<-checked
+	cancel()
+	<-done
+}
+
+func TestLivenessIgnoresReadiness(t *testing.T) {
+	probe := &fakeProbe{err: errors.New("connection refused")}
+	c := NewChecker(probe.probe, time.Second, time.Minute)
+	c.SetAuthorized(true)
+	c.Check(context.Background())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", Healthz)
+	mux.Handle("/readyz", c.Handler())
+	if code, _ := status(mux, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness = %d with the backend down", code)
+	}
+	// Restarting would not bring the backend back, so liveness must hold
+	if code, body := status(mux, "/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("liveness = %d %q while not ready", code, body)
+	}
+	c.SetAuthorized(false)
+	if code, _ := status(mux, "/healthz"); code != http.StatusOK {
+		t.Errorf("liveness = %d while not authorized", code)
+	}
+}
+
+func TestDegradedIsNotReady(t *testing.T) {
+	c := NewChecker((&fakeProbe{}).probe, time.Second, time.Minute)
+	c.SetAuthorized(true)
+	c.Check(context.Background())
+	c.SetDegraded(errors.New("settings database unavailable"))
+	if code, body := status(c.Handler(), "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "settings database") {
+		t.Errorf("degraded: %d %q", code, body)
+	}
+	c.SetDegraded(nil)
+	if err := c.Ready(time.Now()); err != nil {
+		t.Errorf("ready = %v once no longer degraded", err)
+	}
+}
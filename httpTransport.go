@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"telegram-sr-bot/config"
+	"telegram-sr-bot/netdial"
+)
+
+// newTransport returns a pooled transport dialing through dialer, tuned from
+// the HTTP_* settings. Clients sharing it reuse keep-alive connections
+// across messages.
+func newTransport(dialer *netdial.Dialer, c config.Network) *http.Transport {
+	transport := dialer.Transport()
+	transport.MaxIdleConns = c.MaxIdleConns
+	transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = c.MaxConnsPerHost
+	transport.IdleConnTimeout = c.IdleConnTimeout
+	transport.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	return transport
+}
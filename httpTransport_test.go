@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"telegram-sr-bot/config"
+	"telegram-sr-bot/netdial"
+)
+
+func TestNewTransportIsTunedFromTheEnvironment(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("HTTP_MAX_IDLE_CONNS", "7")
+	t.Setenv("HTTP_MAX_IDLE_CONNS_PER_HOST", "3")
+	t.Setenv("HTTP_MAX_CONNS_PER_HOST", "5")
+	t.Setenv("HTTP_IDLE_CONN_TIMEOUT", "42s")
+	t.Setenv("HTTP_TLS_HANDSHAKE_TIMEOUT", "4s")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := newTransport(netdial.New(nil, time.Minute, time.Second, time.Millisecond), cfg.Network)
+	if transport.MaxIdleConns != 7 || transport.MaxIdleConnsPerHost != 3 || transport.MaxConnsPerHost != 5 {
+		t.Errorf("pool limits %d, %d, %d; want 7, 3, 5", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 42*time.Second || transport.TLSHandshakeTimeout != 4*time.Second {
+		t.Errorf("timeouts %s, %s; want 42s, 4s", transport.IdleConnTimeout, transport.TLSHandshakeTimeout)
+	}
+	if !transport.ForceAttemptHTTP2 || transport.Proxy == nil {
+		t.Error("transport lost the defaults of http.DefaultTransport")
+	}
+}
+
+func TestNewTransportReusesConnections(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: newTransport(netdial.New(nil, time.Minute, time.Second, time.Millisecond), cfg.Network)}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if n := connections.Load(); n != 1 {
+		t.Errorf("%d connections for 3 requests, want one kept alive", n)
+	}
+}
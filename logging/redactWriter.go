@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"io"
+
+	"telegram-sr-bot/sanitize"
+)
+
+// RedactWriter scrubs the bot token from every log record before it reaches
+// Out, a safety net for the paths that do not redact their errors
+// themselves. zerolog hands it one whole record per Write.
+type RedactWriter struct {
+	Out      io.Writer
+	Redactor *sanitize.Redactor
+}
+
+func (w RedactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.Out, w.Redactor.String(string(p))); err != nil {
+		return 0, err
+	}
+	// Report the record as written in full, whatever its redacted length
+	return len(p), nil
+}
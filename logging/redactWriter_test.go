@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"telegram-sr-bot/sanitize"
+)
+
+func TestRedactWriterScrubsEveryRecord(t *testing.T) {
+	var out strings.Builder
+	logger := zerolog.New(RedactWriter{Out: &out, Redactor: sanitize.NewRedactor("123456:secret")})
+	logger.Error().Err(errors.New(`Get "https://api.telegram.org/bot123456:secret/getMe": EOF`)).Msg("Failed to reach the Bot API")
+
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("record %s still has the token", out.String())
+	}
+	if !strings.Contains(out.String(), "bot<redacted>/getMe") {
+		t.Errorf("record %s lost the rest of the URL", out.String())
+	}
+}
+
+func TestRedactWriterReportsTheWholeRecordWritten(t *testing.T) {
+	var out strings.Builder
+	w := RedactWriter{Out: &out, Redactor: sanitize.NewRedactor("a-rather-long-token")}
+	record := []byte("a-rather-long-token\n")
+	if n, err := w.Write(record); err != nil || n != len(record) {
+		t.Errorf("Write = %d, %v; want %d", n, err, len(record))
+	}
+}
@@ -0,0 +1,28 @@
+// Package logging holds zerolog extensions shared by the bot.
+package logging
+
+import (
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanHook mirrors warn and error records onto the span active in the
+// record's context (set with Ctx) as "log" events, so a trace shows the
+// log lines written while it was recorded. Records without a recording
+// span are left alone and cost nothing beyond the level check.
+type SpanHook struct{}
+
+func (SpanHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level < zerolog.WarnLevel || level == zerolog.NoLevel {
+		return
+	}
+	span := trace.SpanFromContext(e.GetCtx())
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent("log", trace.WithAttributes(
+		attribute.String("log.severity", level.String()),
+		attribute.String("log.message", msg),
+	))
+}
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpanHookMirrorsWarningsOntoTheSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	logger := zerolog.New(io.Discard).Hook(SpanHook{})
+
+	ctx, span := tracer.Start(context.Background(), "handle")
+	logger.Info().Ctx(ctx).Msg("Downloaded")
+	logger.Warn().Ctx(ctx).Msg("Slow backend")
+	logger.Error().Ctx(ctx).Msg("Upload failed")
+	logger.Log().Ctx(ctx).Msg("No level")
+	// Nothing to mirror onto without a span
+	logger.Error().Msg("Outside any span")
+	span.End()
+
+	events := recorder.Ended()[0].Events()
+	if len(events) != 2 {
+		t.Fatalf("%d events, want the warning and the error", len(events))
+	}
+	for i, want := range []struct{ severity, message string }{
+		{"warn", "Slow backend"},
+		{"error", "Upload failed"},
+	} {
+		got := map[string]string{}
+		for _, kv := range events[i].Attributes {
+			got[string(kv.Key)] = kv.Value.AsString()
+		}
+		if events[i].Name != "log" || got["log.severity"] != want.severity || got["log.message"] != want.message {
+			t.Errorf("event %d = %s %v, want a log event of %s %q", i, events[i].Name, got, want.severity, want.message)
+		}
+	}
+}
@@ -2,101 +2,462 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"telegram-sr-bot/access"
+	"telegram-sr-bot/breaker"
+	"telegram-sr-bot/cache"
+	"telegram-sr-bot/chaos"
+	"telegram-sr-bot/commands"
+	"telegram-sr-bot/config"
+	"telegram-sr-bot/failover"
 	"telegram-sr-bot/handleAudio"
+	"telegram-sr-bot/health"
+	"telegram-sr-bot/logging"
+	"telegram-sr-bot/maintenance"
+	"telegram-sr-bot/messages"
+	"telegram-sr-bot/netdial"
+	"telegram-sr-bot/offset"
+	"telegram-sr-bot/quota"
+	"telegram-sr-bot/ratelimit"
+	"telegram-sr-bot/sanitize"
+	"telegram-sr-bot/sender"
+	"telegram-sr-bot/status"
+	"telegram-sr-bot/transform"
+	"telegram-sr-bot/workerpool"
+	"time"
 )
 
 func init() {
 	prometheus.MustRegister(handleAudio.AudioMessageCounter)
-	// Set up zerolog
+	prometheus.MustRegister(handleAudio.ProcessingDuration, handleAudio.DownloadDuration, handleAudio.RecognitionDuration)
+	prometheus.MustRegister(handleAudio.AudioSizeBytes, handleAudio.AudioDurationSeconds)
+	prometheus.MustRegister(handleAudio.RecognitionsByLanguage)
+	prometheus.MustRegister(handleAudio.ResponseRejectedCounter, handleAudio.UploadRetryCounter)
+	prometheus.MustRegister(handleAudio.CacheHitCounter, handleAudio.AsyncJobCounter, handleAudio.CallbackCounter)
+	prometheus.MustRegister(sender.SendRetryCounter)
+	prometheus.MustRegister(updatesReceivedCounter, missedUpdatesCounter, handlerPanicsCounter)
+	prometheus.MustRegister(maintenance.Gauge)
+	prometheus.MustRegister(access.RejectedCounter, ratelimit.LimitedCounter)
+	prometheus.MustRegister(chaos.InjectedCounter)
+	prometheus.MustRegister(netdial.DialDuration, netdial.DialFallbackCounter, netdial.DNSFailureCounter)
+	prometheus.MustRegister(workerpool.QueueDepth, workerpool.InFlight)
+	prometheus.MustRegister(failover.HealthyGauge, breaker.StateGauge, health.ReachableGauge)
+	prometheus.MustRegister(offset.DuplicateCounter)
+	prometheus.MustRegister(quota.ExceededCounter)
+}
+
+// setupLogging configures the global logger, scrubbing the token redactor
+// knows from every record.
+func setupLogging(c config.Log, redactor *sanitize.Redactor) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	zerolog.SetGlobalLevel(c.Level)
+	// Whatever error quotes a Bot API URL, the token stays out of the logs
+	if c.Format == "json" {
+		log.Logger = zerolog.New(logging.RedactWriter{Out: os.Stderr, Redactor: redactor}).With().Timestamp().Logger()
+	} else {
+		log.Logger = log.Output(logging.RedactWriter{Out: zerolog.ConsoleWriter{Out: os.Stderr}, Redactor: redactor})
+	}
+	if c.SpanEvents {
+		log.Logger = log.Logger.Hook(logging.SpanHook{})
+	}
 }
 
 func main() {
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal().Msg("TELEGRAM_BOT_TOKEN environment variable is not set")
+	started := time.Now()
+	// Stop taking new updates on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load()
+	redactor := sanitize.NewRedactor(cfg.Token)
+	setupLogging(cfg.Log, redactor)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	for _, warning := range cfg.Warnings {
+		log.Warn().Msg(warning)
+	}
+	log.Debug().Strs("endpoints", cfg.Recognition.Endpoints).Msg("Recognition endpoints")
+	handleAudio.MaxResponseBytes = cfg.Recognition.ResponseMaxBytes
+	handleAudio.Fillers = cfg.Recognition.EmptyFillers
+	handleAudio.UploadTimeout = handleAudio.NewAdaptiveTimeout(
+		cfg.Upload.TimeoutBase, cfg.Upload.TimeoutFactor, cfg.Upload.TimeoutMin, cfg.Upload.TimeoutMax)
+	if cfg.TransformsPath != "" {
+		chain, err := transform.Load(cfg.TransformsPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load transcript transforms")
+		}
+		handleAudio.Transforms = chain
+		log.Info().Msgf("Loaded transcript transforms from %s", cfg.TransformsPath)
 	}
-	endpoint := os.Getenv("API_ENDPOINT")
-	if endpoint == "" {
-		log.Warn().Msg("API_ENDPOINT environment variable is " +
-			"not set, using default value: \"http://127.0.0.1:8787/upload\"")
-		endpoint = "http://127.0.0.1:8787/upload"
+	if cfg.Chaos.Enabled {
+		if cfg.Chaos.DeployEnv == "production" && !cfg.Chaos.AllowProduction {
+			log.Error().Msg("Refusing to enable chaos fault injection in production, set CHAOS_ALLOW_PRODUCTION=true to override")
+		} else {
+			handleAudio.Chaos = chaos.New(cfg.Chaos.Rules, cfg.Chaos.Duration)
+			log.Warn().Interface("rules", cfg.Chaos.Rules).Dur("duration", cfg.Chaos.Duration).Msg("Chaos fault injection enabled")
+		}
+	}
+	window := cfg.Maintenance
+	if window == nil {
+		// Nothing scheduled, but an operator may still start a window
+		window = &maintenance.Window{}
 	}
-	log.Debug().Msgf("Endpoint is %s", endpoint)
+	go window.Watch(ctx, 30*time.Second)
 
-	http.Handle("/metrics", promhttp.Handler())
-	go func() {
-		if err := http.ListenAndServe(":2112", nil); err != nil {
-			log.Fatal().Err(err).Msg("Failed to start metrics server")
+	if cfg.Debug.FlightRecorderSize > 0 {
+		handleAudio.Recorder = handleAudio.NewFlightRecorder(cfg.Debug.FlightRecorderSize)
+	}
+	handleAudio.RecordTranscripts = cfg.Debug.IncludeText
+	handleAudio.PlaceholdersEnabled = cfg.Limits.PlaceholderMessages
+	handleAudio.DocumentThreshold = cfg.Limits.DocumentThreshold
+	handleAudio.MaxVideoNoteDuration = cfg.Limits.VideoNoteMaxDuration
+	if cfg.Limits.VideoEnabled {
+		ffmpeg, err := exec.LookPath(cfg.Limits.FFmpegPath)
+		if err != nil {
+			log.Error().Err(err).Msg("ffmpeg not found, video transcription stays disabled")
+		} else {
+			handleAudio.Extractor = handleAudio.FFmpegExtractor{Path: ffmpeg}
+			log.Info().Msgf("Extracting audio from videos with %s", ffmpeg)
+		}
+	}
+	if cfg.Limits.TranscodeEnabled {
+		ffmpeg, err := exec.LookPath(cfg.Limits.FFmpegPath)
+		if err != nil {
+			log.Error().Err(err).Msg("ffmpeg not found, audio is uploaded without transcoding")
+		} else {
+			handleAudio.Transcoder = handleAudio.FFmpegTranscoder{Path: ffmpeg}
+			log.Info().Msgf("Transcoding audio to 16 kHz mono WAV with %s", ffmpeg)
 		}
-	}()
+	}
+	handleAudio.MaxVideoBytes = cfg.Limits.VideoMaxBytes
+	handleAudio.MaxVideoDuration = cfg.Limits.VideoMaxDuration
+	handleAudio.MaxAudioBytes = cfg.Limits.MaxAudioBytes
+	handleAudio.MaxAudioDuration = cfg.Limits.MaxAudioDuration
+
+	// Only what is registered here is exposed, not whatever lands on http.DefaultServeMux
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.Handler())
+	metricsMux.HandleFunc("/healthz", health.Healthz)
+	if cfg.Debug.Token != "" && handleAudio.Recorder != nil {
+		metricsMux.Handle("/debug/recent", handleAudio.Recorder.Handler(cfg.Debug.Token))
+	}
+	servers := []*http.Server{startServer("metrics", cfg.MetricsAddr, metricsMux)}
 
 	// Set up OpenTelemetry
-	tp := initTracing()
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatal().Err(err).Msg("Failed to shut down trace provider")
-		}
-	}()
+	tp := initTracing(cfg.Telemetry)
 
-	bot, err := tgbotapi.NewBotAPI(token)
+	dialer := netdial.New(net.DefaultResolver, cfg.Network.DNSCacheTTL, cfg.Network.DNSNegativeCacheTTL, cfg.Network.DialFallbackDelay)
+	handleAudio.RecognitionTimeout = cfg.Recognition.Timeout
+	handleAudio.DownloadTimeout = cfg.Telegram.DownloadTimeout
+	handleAudio.UploadAttempts = cfg.Upload.MaxAttempts
+	handleAudio.HealthPath = cfg.Recognition.HealthPath
+	handleAudio.UploadRetryBackoff = cfg.Upload.RetryBackoff
+	handleAudio.InMemoryUploadLimit = cfg.Upload.InMemoryMaxBytes
+	if cfg.Recognition.AuthToken != "" {
+		handleAudio.APIAuth = handleAudio.NewCredentials(cfg.Recognition.AuthToken, cfg.Recognition.AuthHeader)
+	}
+	// CIRCUIT_BREAKER_FAILURES=0 keeps trying the backend however often it fails
+	if cfg.Recognition.CircuitFailures > 0 {
+		handleAudio.Circuit = breaker.New(cfg.Recognition.CircuitFailures, cfg.Recognition.CircuitWindow, cfg.Recognition.CircuitCooldown)
+	}
+	if cfg.Recognition.Mode == "async" {
+		handleAudio.AsyncMode = true
+		handleAudio.AsyncPollInterval = cfg.Recognition.AsyncPollInterval
+		handleAudio.AsyncTimeout = cfg.Recognition.AsyncTimeout
+	}
+	// Forwarded audio is transcribed once, CACHE_MAX_ENTRIES=0 disables the in-memory cache
+	if cfg.Cache.RedisAddr != "" {
+		redisClient := redis.NewClient(&redis.Options{Addr: cfg.Cache.RedisAddr})
+		defer redisClient.Close()
+		handleAudio.Cache = cache.NewRedis(redisClient, cfg.Cache.TTL)
+	} else if cfg.Cache.MaxEntries > 0 {
+		handleAudio.Cache = cache.NewLRU(cfg.Cache.MaxEntries, cfg.Cache.TTL)
+	}
+	// Downloads from Telegram and recognition uploads share one connection pool.
+	// Every request carries its own deadline, a client-wide one would cut
+	// adaptive upload timeouts short.
+	client := &http.Client{Transport: newTransport(dialer, cfg.Network)}
+	if cfg.Recognition.TranslateEndpoint != "" {
+		handleAudio.Translate = handleAudio.NewTranslator(cfg.Recognition.TranslateEndpoint, client)
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithClient(cfg.Token, cfg.Telegram.APIEndpoint(), &http.Client{Transport: newTransport(dialer, cfg.Network)})
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create bot")
+		log.Fatal().Err(redactor.Error(err)).Msg("Failed to create bot")
 	}
 
-	bot.Debug = true
+	// BOT_DEBUG dumps every Bot API request and response
+	bot.Debug = cfg.Telegram.Debug
 
 	log.Info().Msgf("Authorized on account %s", bot.Self.UserName)
+	if cfg.Telegram.APIURL != "" {
+		log.Info().Str("url", cfg.Telegram.APIURL).Msg("Using a self-hosted Bot API server")
+	}
+	var mounted *handleAudio.MountedFileFetcher
+	if cfg.Telegram.LocalFileMount != "" {
+		mounted = handleAudio.NewMountedFileFetcher(bot, cfg.Telegram.LocalFileMount, cfg.Telegram.LocalPathPrefix)
+		log.Info().Msgf("Reading audio files from local mount %s", cfg.Telegram.LocalFileMount)
+	}
+
+	persisted := memoryStores()
+	var storageErr error
+	if cfg.SettingsDBPath != "" {
+		opened, db, err := openStores(cfg.SettingsDBPath, cfg.SettingsFile)
+		if err != nil {
+			// Transcribing matters more than remembering the settings, readiness tells
+			storageErr = fmt.Errorf("settings database unavailable, settings are kept in memory: %w", err)
+			log.Error().Err(err).Str("path", cfg.SettingsDBPath).Msg("Failed to open the settings database, keeping settings in memory")
+		} else {
+			defer db.Close()
+			persisted = opened
+		}
+	}
+	store, jobs, offsets, usage := persisted.settings, persisted.jobs, persisted.offsets, persisted.usage
+	// Settings and jobs of an upgraded group follow it to its supergroup ID
+	sender.ChatStores = []sender.ChatMigrator{store, jobs}
+	tracker, err := offset.NewTracker(offsets)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load the update offset")
+	}
+	go tracker.Run(ctx, cfg.Telegram.OffsetFlushInterval)
+
+	// Resume after the last handled update, Telegram delivers the rest again
+	updateConfig := tgbotapi.NewUpdate(tracker.Next(time.Now()))
+	updateConfig.Timeout = int(cfg.Telegram.PollTimeout.Seconds())
+	updateConfig.AllowedUpdates = allowedUpdates
+
+	// Replies are paced to stay under Telegram's limits, and retried when it asks to back off anyway
+	sender.SendAttempts = cfg.Telegram.SendMaxAttempts
+	// The topics of incoming messages, replies are posted in them
+	topics := sender.NewTopics()
+	out := sender.NewThrottled(bot, sender.NewRateLimiter(cfg.Telegram.SendsPerSecond, cfg.Telegram.ChatSendInterval), topics)
+
+	var recognizer handleAudio.Recognizer
+	if cfg.Recognition.Protocol == "grpc" {
+		conn, err := newGRPCConn(cfg.Recognition.GRPCTarget, cfg.Recognition.GRPCInsecure, dialer)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up the gRPC connection")
+		}
+		defer conn.Close()
+		recognizer = handleAudio.NewGRPCRecognizer(cfg.Recognition.GRPCTarget, conn)
+	} else {
+		// Uploads fail over between the backends, a single one behaves as before
+		backends := failover.New(cfg.Recognition.Endpoints, cfg.Recognition.Strategy,
+			cfg.Recognition.FailureThreshold, cfg.Recognition.UnhealthyCooldown)
+		recognizer = handleAudio.NewHTTPRecognizer(backends, client)
+	}
+	// Getting this far means the bot is authorized, readiness waits on the backend
+	checker := health.NewChecker(recognizer.Probe, cfg.Health.Timeout, cfg.Health.MaxAge)
+	checker.SetAuthorized(true)
+	checker.SetDegraded(storageErr)
+	// A mistyped API_ENDPOINT shows right away rather than with the first voice message
+	if err := checker.Check(ctx); err != nil {
+		if cfg.Recognition.StrictStartup {
+			log.Fatal().Err(err).Str("endpoint", recognizer.Endpoint()).Msg("Recognition backend is unreachable, refusing to start")
+		}
+		log.Warn().Err(err).Str("endpoint", recognizer.Endpoint()).
+			Msg("Recognition backend did not answer at startup, check API_ENDPOINT; messages fail until it does")
+	}
+	metricsMux.Handle("/readyz", checker.Handler())
+	go checker.Run(ctx, cfg.Health.Interval)
+	handler := handleAudio.NewHandler(
+		handleAudio.NewBotFileFetcher(bot, client, cfg.Telegram.FileEndpoint(), mounted),
+		recognizer,
+		out,
+		sender.NewEditThrottler(out, cfg.Telegram.EditInterval),
+		store,
+	)
+	if cfg.Limits.Reactions {
+		handleAudio.Reactions = handleAudio.NewReactor(bot)
+	}
+	if cfg.Recognition.Mode == "callback" {
+		receiver, err := handleAudio.NewCallbackReceiver(cfg.Recognition.CallbackURL, cfg.Recognition.CallbackSecret,
+			jobs, cfg.Recognition.CallbackTTL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid CALLBACK_URL or CALLBACK_SECRET")
+		}
+		handleAudio.Callbacks = receiver
+		// The backend posts here, away from the operator endpoints
+		callbackMux := http.NewServeMux()
+		callbackMux.Handle(receiver.Path(), handler.CallbackHandler())
+		servers = append(servers, startServer("callback", cfg.Recognition.CallbackAddr, callbackMux))
+		go handler.ExpireCallbacks(ctx)
+	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	allowlist := access.NewAllowlist(cfg.Access.AllowedUsers, cfg.Access.AllowedChats, cfg.Access.NoticeInterval)
+
+	dispatcher := commands.NewDispatcher(out, bot.Self.UserName, store)
+	// Handlers keep running after a signal until the grace period is over
+	pool := workerpool.New(context.Background(), cfg.Concurrency.Workers, cfg.Concurrency.MaxQueued)
+	router := &router{bot: out, dispatcher: dispatcher, handler: handler, pool: pool, window: window, allowlist: allowlist, settings: store, offsets: tracker,
+		botUserName: bot.Self.UserName}
+	// RATE_LIMIT_MESSAGES=0 turns the per-user limit off
+	if cfg.Access.RateLimitMessages > 0 {
+		router.limiter = ratelimit.New(cfg.Access.RateLimitMessages, cfg.Access.RateLimitWindow, cfg.Access.Admins)
+	}
+	// DAILY_QUOTA_SECONDS=0 leaves transcription time unlimited
+	if cfg.Access.DailyQuota > 0 {
+		handleAudio.Quota = quota.New(usage, cfg.Access.DailyQuota, cfg.Access.Admins)
+	}
 
-	updates := bot.GetUpdatesChan(u)
+	commands.RegisterHelp(dispatcher)
+	commands.RegisterLang(dispatcher, store)
+	commands.RegisterLanguage(dispatcher, store)
+	commands.RegisterSettings(dispatcher, store, commands.ChatAdmins(out))
+	commands.RegisterSRT(dispatcher, store, router.transcribeSRT)
+	commands.RegisterTranscribe(dispatcher, store, router.transcribeOnRequest)
+	if handleAudio.Quota != nil {
+		commands.RegisterQuota(dispatcher, handleAudio.Quota)
+	}
+	commands.RegisterStats(dispatcher, status.NewReporter(started, recognizer.Endpoint(),
+		handleAudio.AudioMessageCounter, handleAudio.CacheHitCounter, workerpool.InFlight, failover.HealthyGauge), cfg.Access.Admins)
+	admin := commands.RegisterAdmin(dispatcher, cfg.Access.Admins)
+	if handleAudio.Recorder != nil {
+		commands.RegisterLast(admin, handleAudio.Recorder)
+	}
+	commands.RegisterMaintenance(admin, window)
+	// The menu without a language code is shown to users whose language has no bundle
+	if _, err := bot.Request(tgbotapi.NewSetMyCommands(dispatcher.BotCommands(messages.For(messages.Fallback))...)); err != nil {
+		log.Error().Err(err).Msg("Failed to register bot commands")
+	}
+	for _, language := range messages.Languages() {
+		menu := tgbotapi.NewSetMyCommands(dispatcher.BotCommands(messages.For(language))...)
+		menu.LanguageCode = language
+		if _, err := bot.Request(menu); err != nil {
+			log.Error().Err(err).Str("language", language).Msg("Failed to register bot commands")
+		}
+	}
 
-	for update := range updates {
-		if update.Message != nil && (update.Message.Voice != nil || update.Message.Audio != nil) {
-			log.Info().Msg("Audio or voice message received")
-			_, span := otel.Tracer("telegram-sr-bot").Start(context.Background(), "processMessage")
-			span.SetAttributes(attribute.String("type", "audioMessage"))
+	var updates <-chan tgbotapi.Update
+	var gaps updateGaps
+	if cfg.Telegram.WebhookURL != "" {
+		// The secret only has to outlive this process, setWebhook replaces it on every start
+		secret := cfg.Telegram.WebhookSecret
+		if secret == "" {
+			secret = newWebhookSecret()
+		}
+		updates = serveWebhook(ctx, bot, cfg.Telegram.WebhookURL, secret, ":"+cfg.Telegram.WebhookPort, cfg.Telegram.UpdatesBuffer, topics)
+	} else {
+		// getUpdates fails while a webhook is set
+		if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Error().Err(err).Msg("Failed to delete the webhook")
+		}
+		updates = pollUpdates(ctx, bot, updateConfig, cfg.Telegram.UpdatesBuffer, topics, &gaps)
+	}
 
-			handleAudio.AudioMessageHandle(bot, update.Message, endpoint)
-			span.SetStatus(codes.Ok, "Processing succeeded")
-			span.End()
+	var reconnect backoff
+updateLoop:
+	for {
+		var update tgbotapi.Update
+		select {
+		case <-ctx.Done():
+			break updateLoop
+		case u, ok := <-updates:
+			if !ok {
+				if ctx.Err() != nil || cfg.Telegram.WebhookURL != "" {
+					break updateLoop
+				}
+				// Polling stopped while the bot is still running, start over where it left off
+				delay := reconnect.next()
+				log.Warn().Dur("retry_in", delay).Msg("Updates channel closed, reconnecting")
+				if !sleep(ctx, delay) {
+					break updateLoop
+				}
+				updateConfig.Offset = tracker.Next(time.Now())
+				updates = pollUpdates(ctx, bot, updateConfig, cfg.Telegram.UpdatesBuffer, topics, &gaps)
+				continue
+			}
+			reconnect.reset()
+			update = u
 		}
+		router.dispatch(ctx, update)
 	}
+	shutdown(pool, tracker, servers, tp, cfg.ShutdownGracePeriod)
 }
 
-func initTracing() *sdktrace.TracerProvider {
-	ctx := context.Background()
-	otelCollectorEndpoint := os.Getenv("TELEMETRY_GRPC_TARGET")
-	if otelCollectorEndpoint == "" {
-		log.Fatal().Msg("TELEMETRY_GRPC_TARGET environment variable is not set")
+// shutdown drains in-flight handlers for at most gracePeriod, then saves
+// the update offset, stops the metrics server and flushes pending traces.
+func shutdown(pool *workerpool.Pool, tracker *offset.Tracker, servers []*http.Server, tp *sdktrace.TracerProvider, gracePeriod time.Duration) {
+	log.Info().Dur("grace_period", gracePeriod).Msg("Shutting down, waiting for in-flight messages")
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	drained := pool.Shutdown(ctx)
+	if ctx.Err() != nil {
+		log.Warn().Int("drained", drained).Msg("Grace period expired, cancelled remaining messages")
+	} else {
+		log.Info().Int("drained", drained).Msg("Drained in-flight messages")
+	}
+	if err := tracker.Flush(); err != nil {
+		log.Error().Err(err).Msg("Failed to save the update offset")
 	}
 
-	// Initialize the OTLP exporter to send trace data to an OTel Collector over gRPC
-	exporter, err := otlptrace.New(ctx, otlptracegrpc.NewClient(
-		otlptracegrpc.WithEndpoint(otelCollectorEndpoint),
-		otlptracegrpc.WithInsecure(),
-	))
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create OTLP trace exporter")
+	// The grace period may be used up, the rest gets a short deadline of its own
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	for _, server := range servers {
+		if err := server.Shutdown(flushCtx); err != nil {
+			log.Error().Err(err).Str("addr", server.Addr).Msg("Failed to shut down server")
+		}
+	}
+	if err := tp.Shutdown(flushCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to shut down trace provider")
 	}
+}
+
+// initTracing sets up the global tracer provider. Spans are exported to the
+// collector at TELEMETRY_GRPC_TARGET, printed with TELEMETRY_DEBUG_STDOUT=1,
+// and otherwise only recorded in-process for log correlation.
+func initTracing(c config.Telemetry) *sdktrace.TracerProvider {
+	ctx := context.Background()
+	options := []sdktrace.TracerProviderOption{}
+
+	switch {
+	case c.GRPCTarget != "":
+		clientOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.GRPCTarget)}
+		if c.Insecure {
+			clientOptions = append(clientOptions, otlptracegrpc.WithInsecure())
+		}
+		// Initialize the OTLP exporter to send trace data to an OTel Collector over gRPC,
+		// it connects lazily and the batcher retries while the collector is unreachable
+		exporter, err := otlptrace.New(ctx, otlptracegrpc.NewClient(clientOptions...))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create OTLP trace exporter")
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case c.DebugStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create stdout trace exporter")
+		}
+		options = append(options, sdktrace.WithSyncer(exporter))
+		log.Warn().Msg("TELEMETRY_GRPC_TARGET environment variable is not set, printing traces to stdout")
+	default:
+		log.Warn().Msg("TELEMETRY_GRPC_TARGET environment variable is not set, traces are not exported")
+	}
+
+	options = append(options, sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))))
 
 	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
 		attribute.String("service.name", "telegram-sr-bot"),
@@ -104,13 +465,12 @@ func initTracing() *sdktrace.TracerProvider {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create resource")
 	}
+	options = append(options, sdktrace.WithResource(res))
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
+	tp := sdktrace.NewTracerProvider(options...)
 
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
 	return tp
 }
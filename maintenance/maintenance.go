@@ -0,0 +1,125 @@
+// Package maintenance implements scheduled maintenance windows during which
+// audio messages are answered with a notice instead of being processed.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var Gauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "maintenance_mode",
+		Help: "Whether a maintenance window is currently active (1) or not (0).",
+	},
+)
+
+// Window is a scheduled maintenance window with the operator's notice text
+// per language code, the bot's own notice being used for none. The zero value schedules none, an operator may still
+// Schedule one later.
+type Window struct {
+	Start    time.Time
+	End      time.Time
+	Messages map[string]string
+
+	mu     sync.Mutex // Guards Start and End once in use, and active
+	active bool
+}
+
+// FromEnv reads the window from MAINTENANCE_START and MAINTENANCE_END
+// (RFC 3339), MAINTENANCE_MESSAGE and per-language MAINTENANCE_MESSAGE_<LANG>
+// variables. It returns nil when no window is scheduled.
+func FromEnv() (*Window, error) {
+	startValue, endValue := os.Getenv("MAINTENANCE_START"), os.Getenv("MAINTENANCE_END")
+	if startValue == "" && endValue == "" {
+		return nil, nil
+	}
+	start, err := time.Parse(time.RFC3339, startValue)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_START: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, endValue)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_END: %w", err)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("MAINTENANCE_END must be after MAINTENANCE_START")
+	}
+
+	w := &Window{Start: start, End: end, Messages: make(map[string]string)}
+	if message := os.Getenv("MAINTENANCE_MESSAGE"); message != "" {
+		w.Messages[""] = message
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if lang, ok := strings.CutPrefix(name, "MAINTENANCE_MESSAGE_"); ok && value != "" {
+			w.Messages[strings.ToLower(lang)] = value
+		}
+	}
+	return w, nil
+}
+
+// Active reports whether the window covers now, logging and updating the
+// gauge when the bot enters or leaves it. A nil window is never active.
+func (w *Window) Active(now time.Time) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	active := !now.Before(w.Start) && now.Before(w.End)
+	if active != w.active {
+		w.active = active
+		if active {
+			Gauge.Set(1)
+			log.Warn().Time("until", w.End).Msg("Entering maintenance window")
+		} else {
+			Gauge.Set(0)
+			log.Info().Msg("Leaving maintenance window")
+		}
+	}
+	return active
+}
+
+// Schedule replaces the window by one from start to end, for reason. The
+// notice texts stay as configured.
+func (w *Window) Schedule(start, end time.Time, reason string) {
+	w.mu.Lock()
+	w.Start, w.End = start, end
+	w.mu.Unlock()
+	log.Warn().Time("start", start).Time("end", end).Str("reason", reason).Msg("Maintenance window scheduled")
+}
+
+// Watch re-evaluates the window periodically so entering and leaving it is
+// logged even while no messages arrive. It returns when ctx is cancelled.
+func (w *Window) Watch(ctx context.Context, interval time.Duration) {
+	if w == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.Active(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Message returns the operator's notice for the given language code,
+// falling back to the one for all languages, and "" if there is neither.
+func (w *Window) Message(lang string) string {
+	if message, ok := w.Messages[strings.ToLower(lang)]; ok {
+		return message
+	}
+	return w.Messages[""]
+}
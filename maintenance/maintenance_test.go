@@ -0,0 +1,125 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestActive(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	w := &Window{Start: start, End: start.Add(time.Hour)}
+	for _, c := range []struct {
+		now    time.Time
+		active bool
+	}{
+		{start.Add(-time.Nanosecond), false},
+		{start, true},
+		{start.Add(30 * time.Minute), true},
+		{start.Add(time.Hour - time.Nanosecond), true},
+		{start.Add(time.Hour), false},
+		{start.Add(2 * time.Hour), false},
+	} {
+		if got := w.Active(c.now); got != c.active {
+			t.Errorf("Active(%s) = %t", c.now.Format(time.RFC3339Nano), got)
+		}
+		if got := testutil.ToFloat64(Gauge); got != map[bool]float64{false: 0, true: 1}[c.active] {
+			t.Errorf("gauge = %v at %s", got, c.now.Format(time.RFC3339Nano))
+		}
+	}
+
+	var none *Window
+	if none.Active(start) {
+		t.Error("a nil window is active")
+	}
+	if (&Window{}).Active(start) {
+		t.Error("a window never scheduled is active")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := &Window{Messages: map[string]string{"": "later"}}
+	w.Schedule(now, now.Add(30*time.Minute), "backend upgrade")
+	if !w.Active(now.Add(time.Minute)) || w.Active(now.Add(30*time.Minute)) {
+		t.Error("the scheduled window does not cover the next 30 minutes")
+	}
+	if got := w.Message("en"); got != "later" {
+		t.Errorf("scheduling replaced the notice by %q", got)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	w := &Window{Messages: map[string]string{"": "later", "ru": "позже"}}
+	for lang, want := range map[string]string{"ru": "позже", "RU": "позже", "en": "later", "": "later"} {
+		if got := w.Message(lang); got != want {
+			t.Errorf("Message(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("MAINTENANCE_START", "2024-05-01T02:00:00Z")
+	t.Setenv("MAINTENANCE_END", "2024-05-01T03:00:00Z")
+	t.Setenv("MAINTENANCE_MESSAGE", "later")
+	t.Setenv("MAINTENANCE_MESSAGE_RU", "позже")
+	w, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Active(time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC)) || w.Message("ru") != "позже" || w.Message("de") != "later" {
+		t.Errorf("window read as %+v", w)
+	}
+	// Leave the window again, the gauge is shared with the other tests
+	w.Active(time.Time{})
+
+	t.Setenv("MAINTENANCE_END", "2024-05-01T01:00:00Z")
+	if _, err := FromEnv(); err == nil {
+		t.Error("a window ending before it starts was accepted")
+	}
+	t.Setenv("MAINTENANCE_END", "tomorrow")
+	if _, err := FromEnv(); err == nil {
+		t.Error("an unparsable end was accepted")
+	}
+	t.Setenv("MAINTENANCE_START", "")
+	t.Setenv("MAINTENANCE_END", "")
+	if w, err := FromEnv(); w != nil || err != nil {
+		t.Errorf("no window configured read as %+v, %v", w, err)
+	}
+}
+
+func TestWatchPicksUpAScheduledWindow(t *testing.T) {
+	Gauge.Set(0)
+	w := &Window{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Watch(ctx, time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	now := time.Now()
+	w.Schedule(now, now.Add(time.Hour), "test")
+	deadline := time.After(time.Second)
+	for testutil.ToFloat64(Gauge) != 1 {
+		select {
+		case <-deadline:
+			t.Fatal("Watch did not enter the scheduled window")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	w.Schedule(now.Add(-time.Hour), now.Add(-time.Minute), "test")
+	for testutil.ToFloat64(Gauge) != 0 {
+		select {
+		case <-deadline:
+			t.Fatal("Watch did not leave the window once it ended")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
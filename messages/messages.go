@@ -0,0 +1,229 @@
+// Package messages holds the texts the bot replies with in every language
+// it speaks. The texts live in YAML bundles embedded into the binary, one
+// per language, keyed by the constants below.
+package messages
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Key names a text in the bundles.
+type Key string
+
+const (
+	Placeholder             Key = "placeholder"
+	PlaceholderElapsed      Key = "placeholder_elapsed"
+	DownloadFailed          Key = "download_failed"
+	ServiceUnavailable      Key = "service_unavailable"
+	UnexpectedResponse      Key = "unexpected_response"
+	Rejected                Key = "rejected"
+	InternalError           Key = "internal_error"
+	TimedOut                Key = "timed_out"
+	NoSpeech                Key = "no_speech"
+	TooLarge                Key = "too_large"
+	TooLong                 Key = "too_long"
+	VideoNoteTooLong        Key = "video_note_too_long"
+	VideoDisabled           Key = "video_disabled"
+	ExtractFailed           Key = "extract_failed"
+	UnsupportedDocument     Key = "unsupported_document"
+	TranscriptHeader        Key = "transcript_header"
+	SubtitlesCaption        Key = "subtitles_caption"
+	DocumentSummary         Key = "document_summary"
+	DocumentSummaryNoLength Key = "document_summary_no_length"
+	DurationSeconds         Key = "duration_seconds"
+	DurationMinutes         Key = "duration_minutes"
+
+	RetryButton     Key = "retry_button"
+	TranslateButton Key = "translate_button"
+	Retrying        Key = "retrying"
+	Translating     Key = "translating"
+	ButtonExpired   Key = "button_expired"
+	Translation     Key = "translation"
+	TranslateFailed Key = "translate_failed"
+
+	Panic            Key = "panic"
+	Private          Key = "private"
+	RateLimited      Key = "rate_limited"
+	Maintenance      Key = "maintenance"
+	PermissionDenied Key = "permission_denied"
+
+	CommandStart      Key = "command_start"
+	CommandHelp       Key = "command_help"
+	CommandLang       Key = "command_lang"
+	CommandLanguage   Key = "command_language"
+	CommandSettings   Key = "command_settings"
+	CommandSRT        Key = "command_srt"
+	CommandTranscribe Key = "command_transcribe"
+	CommandStats      Key = "command_stats"
+	CommandQuota      Key = "command_quota"
+	CommandAdmin      Key = "command_admin"
+
+	Start           Key = "start"
+	HelpFormats     Key = "help_formats"
+	HelpVoice       Key = "help_voice"
+	HelpAudio       Key = "help_audio"
+	HelpVideoNotes  Key = "help_video_notes"
+	HelpVideos      Key = "help_videos"
+	HelpLimits      Key = "help_limits"
+	HelpMaxSize     Key = "help_max_size"
+	HelpMaxDuration Key = "help_max_duration"
+
+	LangReadFailed Key = "lang_read_failed"
+	LangSaveFailed Key = "lang_save_failed"
+	LangAuto       Key = "lang_auto"
+	LangCurrent    Key = "lang_current"
+	LangUnknown    Key = "lang_unknown"
+	LangCleared    Key = "lang_cleared"
+	LangSet        Key = "lang_set"
+
+	LanguageAuto    Key = "language_auto"
+	LanguageCurrent Key = "language_current"
+	LanguageUnknown Key = "language_unknown"
+	LanguageCleared Key = "language_cleared"
+	LanguageSet     Key = "language_set"
+
+	SettingsReadFailed     Key = "settings_read_failed"
+	SettingsSaveFailed     Key = "settings_save_failed"
+	SettingsUsage          Key = "settings_usage"
+	SettingsSummary        Key = "settings_summary"
+	SettingsDocumentsAbove Key = "settings_documents_above"
+	SettingsAdminsOnly     Key = "settings_admins_only"
+	AdminCheckFailed       Key = "admin_check_failed"
+	TranscriptionOff       Key = "transcription_off"
+	On                     Key = "on"
+	Off                    Key = "off"
+	Auto                   Key = "auto"
+
+	SRTNoAudio   Key = "srt_no_audio"
+	SRTPreparing Key = "srt_preparing"
+	SRTEnabled   Key = "srt_enabled"
+	SRTDisabled  Key = "srt_disabled"
+	SRTUsage     Key = "srt_usage"
+	SRTTurnedOn  Key = "srt_turned_on"
+	SRTTurnedOff Key = "srt_turned_off"
+
+	TranscribeUsage Key = "transcribe_usage"
+
+	QuotaExceeded   Key = "quota_exceeded"
+	QuotaRemaining  Key = "quota_remaining"
+	QuotaUnlimited  Key = "quota_unlimited"
+	QuotaReadFailed Key = "quota_read_failed"
+
+	AdminUsage     Key = "admin_usage"
+	AdminLastUsage Key = "admin_last_usage"
+	AdminLastEmpty Key = "admin_last_empty"
+
+	AdminMaintenanceUsage   Key = "admin_maintenance_usage"
+	AdminMaintenanceStarted Key = "admin_maintenance_started"
+)
+
+// Fallback is the language used for users whose language has no bundle, and
+// for keys missing from a bundle.
+const Fallback = "en"
+
+//go:embed bundles/*.yaml
+var files embed.FS
+
+// Bundle is the set of texts of one language.
+type Bundle struct {
+	language string
+	texts    map[Key]string
+	fallback *Bundle
+}
+
+var bundles = load()
+
+func load() map[string]*Bundle {
+	entries, err := files.ReadDir("bundles")
+	if err != nil {
+		panic(err)
+	}
+	bundles := make(map[string]*Bundle, len(entries))
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("bundles", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		language := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		bundle := &Bundle{language: language}
+		if err := yaml.Unmarshal(data, &bundle.texts); err != nil {
+			panic(fmt.Sprintf("messages: parse bundle %s: %v", entry.Name(), err))
+		}
+		bundles[language] = bundle
+	}
+	fallback, ok := bundles[Fallback]
+	if !ok {
+		panic("messages: no bundle for the fallback language " + Fallback)
+	}
+	for language, bundle := range bundles {
+		if language != Fallback {
+			bundle.fallback = fallback
+		}
+	}
+	return bundles
+}
+
+// For returns the bundle of the first of languages that has one, the
+// fallback bundle if none does. Languages are IETF tags as Telegram reports
+// them, so "ru-RU" gets the "ru" bundle; empty ones are skipped.
+func For(languages ...string) *Bundle {
+	for _, language := range languages {
+		if bundle, ok := Lookup(language); ok {
+			return bundle
+		}
+	}
+	return bundles[Fallback]
+}
+
+// Lookup returns the bundle of language and whether there is one.
+func Lookup(language string) (*Bundle, bool) {
+	language, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(language)), "-")
+	bundle, ok := bundles[language]
+	return bundle, ok
+}
+
+// UserLanguage is the language of user's Telegram app, "" if unknown.
+func UserLanguage(user *tgbotapi.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.LanguageCode
+}
+
+// Languages lists the languages with a bundle, sorted.
+func Languages() []string {
+	languages := make([]string, 0, len(bundles))
+	for language := range bundles {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Language is the language of the bundle.
+func (b *Bundle) Language() string {
+	return b.language
+}
+
+// Get returns the text of key formatted with args, falling back to the
+// fallback language and then to the key itself when the text is missing.
+func (b *Bundle) Get(key Key, args ...any) string {
+	text, ok := b.texts[key]
+	if !ok {
+		if b.fallback != nil {
+			return b.fallback.Get(key, args...)
+		}
+		text = string(key)
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
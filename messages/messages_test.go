@@ -0,0 +1,117 @@
+package messages
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// keys parses the Key constants declared in this package.
+func keys(t *testing.T) []Key {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "messages.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []Key
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ValueSpec)
+			if ident, ok := spec.Type.(*ast.Ident); !ok || ident.Name != "Key" {
+				continue
+			}
+			for _, value := range spec.Values {
+				key, err := strconv.Unquote(value.(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, Key(key))
+			}
+		}
+	}
+	return keys
+}
+
+// verbs matches the formatting verbs of a text.
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestBundlesHaveEveryText(t *testing.T) {
+	keys := keys(t)
+	if len(keys) == 0 {
+		t.Fatal("no keys found")
+	}
+	fallback := bundles[Fallback]
+	for _, key := range keys {
+		if _, ok := fallback.texts[key]; !ok {
+			t.Errorf("%s missing from the fallback bundle", key)
+		}
+	}
+	for language, bundle := range bundles {
+		for key, text := range bundle.texts {
+			if !slices.Contains(keys, key) {
+				t.Errorf("%s: %s is no key", language, key)
+			}
+			// A translation takes the same arguments in the same order
+			if got, want := verbs.FindAllString(text, -1), verbs.FindAllString(fallback.texts[key], -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %s formats %v, the fallback %v", language, key, got, want)
+			}
+		}
+		for _, key := range keys {
+			if _, ok := bundle.texts[key]; !ok {
+				t.Errorf("%s: %s not translated", language, key)
+			}
+		}
+	}
+}
+
+func TestForPicksTheFirstKnownLanguage(t *testing.T) {
+	for _, c := range []struct {
+		languages []string
+		want      string
+	}{
+		{[]string{"ru"}, "ru"},
+		{[]string{"ru-RU"}, "ru"},
+		{[]string{" RU "}, "ru"},
+		{[]string{"", "ru"}, "ru"},
+		{[]string{"de", "ru"}, "ru"},
+		{[]string{"de"}, Fallback},
+		{nil, Fallback},
+	} {
+		if got := For(c.languages...).Language(); got != c.want {
+			t.Errorf("For(%q) = %s, want %s", c.languages, got, c.want)
+		}
+	}
+}
+
+func TestGetFallsBack(t *testing.T) {
+	ru := &Bundle{language: "ru", texts: map[Key]string{Start: "Привет"}, fallback: bundles[Fallback]}
+	if got := ru.Get(Start); got != "Привет" {
+		t.Errorf("translated text %q", got)
+	}
+	if got, want := ru.Get(TooLarge, 20), bundles[Fallback].Get(TooLarge, 20); got != want {
+		t.Errorf("untranslated text %q, want the fallback %q", got, want)
+	}
+	if got := ru.Get("no_such_key"); got != "no_such_key" {
+		t.Errorf("unknown key %q, want the key itself", got)
+	}
+	if got := bundles[Fallback].Get(TooLarge, 20); got != "Sorry, this file is too large. I can transcribe files of up to 20 MB." {
+		t.Errorf("formatted text %q", got)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	if got := Languages(); !slices.Equal(got, []string{"en", "ru"}) {
+		t.Errorf("Languages() = %v", got)
+	}
+	if UserLanguage(nil) != "" {
+		t.Error("language of no user")
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// startServer serves mux on addr in the background and returns the server,
+// for shutdown to stop it. name tells the servers apart in the logs.
+func startServer(name, addr string, mux *http.ServeMux) *http.Server {
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		// Shutdown makes ListenAndServe return ErrServerClosed, which is no failure
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Str("server", name).Str("addr", addr).Msg("Failed to start server")
+		}
+	}()
+	log.Info().Str("server", name).Str("addr", addr).Msg("Serving")
+	return server
+}
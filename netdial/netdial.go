@@ -0,0 +1,252 @@
+// Package netdial provides a dialer for outbound HTTP clients that caches
+// DNS answers and races IPv6 and IPv4 addresses so that an unreachable
+// address family does not stall connections.
+package netdial
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var DialDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "dial_duration_seconds",
+		Help:    "Time taken to establish outbound connections.",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	},
+	[]string{"host", "status"},
+)
+
+var DialFallbackCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "dial_fallbacks_total",
+		Help: "Total number of connections established over the fallback address family.",
+	},
+	[]string{"host"},
+)
+
+var DNSFailureCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "dns_failures_total",
+		Help: "Total number of failed DNS lookups.",
+	},
+	[]string{"host"},
+)
+
+// Resolver looks up the addresses of a host; *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Dialer dials TCP connections through a DNS cache, starting a connection
+// attempt on the other address family when the preferred one has not
+// connected within the fallback delay (RFC 8305 "Happy Eyeballs").
+type Dialer struct {
+	dialer        net.Dialer
+	fallbackDelay time.Duration
+	cache         *dnsCache
+}
+
+// New returns a dialer that caches successful lookups for ttl and failed
+// ones for negativeTTL. The standard resolver does not expose record TTLs,
+// so ttl acts as an upper bound on how stale an answer can get.
+func New(resolver Resolver, ttl, negativeTTL, fallbackDelay time.Duration) *Dialer {
+	return &Dialer{
+		dialer:        net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		fallbackDelay: fallbackDelay,
+		cache: &dnsCache{
+			resolver:    resolver,
+			ttl:         ttl,
+			negativeTTL: negativeTTL,
+			entries:     make(map[string]dnsEntry),
+		},
+	}
+}
+
+// Transport returns a clone of http.DefaultTransport that dials through d.
+func (d *Dialer) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	return transport
+}
+
+// DialContext connects to address on the named network.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	start := time.Now()
+	addrs, err := d.cache.lookup(ctx, host)
+	if err != nil {
+		DNSFailureCounter.WithLabelValues(host).Inc()
+		return nil, err
+	}
+	primaries, fallbacks := partition(filterNetwork(network, addrs))
+	if len(primaries) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	conn, fallback, err := d.dialParallel(ctx, network, port, primaries, fallbacks)
+	status := "success"
+	if err != nil {
+		status = "error"
+	} else if fallback {
+		DialFallbackCounter.WithLabelValues(host).Inc()
+	}
+	DialDuration.WithLabelValues(host, status).Observe(time.Since(start).Seconds())
+	return conn, err
+}
+
+type dialResult struct {
+	conn     net.Conn
+	err      error
+	fallback bool
+}
+
+// dialParallel races the primary addresses against the fallback ones, which
+// start after the fallback delay or as soon as the primaries have failed.
+func (d *Dialer) dialParallel(ctx context.Context, network, port string, primaries, fallbacks []net.IPAddr) (net.Conn, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	race := func(addrs []net.IPAddr, fallback bool) {
+		conn, err := d.dialSerial(ctx, network, port, addrs)
+		select {
+		case results <- dialResult{conn, err, fallback}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	go race(primaries, false)
+	pending := 1
+	fallbackStarted := len(fallbacks) == 0
+	startFallback := func() {
+		fallbackStarted = true
+		pending++
+		go race(fallbacks, true)
+	}
+	timer := time.NewTimer(d.fallbackDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				startFallback()
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, res.fallback, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallbackStarted {
+				startFallback()
+			}
+			if pending == 0 {
+				return nil, false, firstErr
+			}
+		}
+	}
+}
+
+func (d *Dialer) dialSerial(ctx context.Context, network, port string, addrs []net.IPAddr) (net.Conn, error) {
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+func filterNetwork(network string, addrs []net.IPAddr) []net.IPAddr {
+	if network != "tcp4" && network != "tcp6" {
+		return addrs
+	}
+	var filtered []net.IPAddr
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == (network == "tcp4") {
+			filtered = append(filtered, addr)
+		}
+	}
+	return filtered
+}
+
+// partition splits addrs into those of the same family as the first one,
+// which the resolver prefers, and the rest.
+func partition(addrs []net.IPAddr) (primaries, fallbacks []net.IPAddr) {
+	for _, addr := range addrs {
+		if len(primaries) == 0 || (addr.IP.To4() != nil) == (primaries[0].IP.To4() != nil) {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	return primaries, fallbacks
+}
+
+type dnsEntry struct {
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+type dnsCache struct {
+	resolver         Resolver
+	ttl, negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, entry.err
+	}
+
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller gave up; that says nothing about the host
+		return nil, err
+	}
+	ttl := c.ttl
+	if err != nil {
+		ttl = c.negativeTTL
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, err: err, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+	return addrs, err
+}
@@ -0,0 +1,132 @@
+package netdial
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeResolver answers every lookup with addrs and err, counting them.
+type fakeResolver struct {
+	addrs   []net.IPAddr
+	err     error
+	lookups atomic.Int32
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups.Add(1)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.addrs, r.err
+}
+
+func ips(addrs ...string) []net.IPAddr {
+	var ipAddrs []net.IPAddr
+	for _, addr := range addrs {
+		ipAddrs = append(ipAddrs, net.IPAddr{IP: net.ParseIP(addr)})
+	}
+	return ipAddrs
+}
+
+func TestDNSCacheKeepsAnswersForTheirTTL(t *testing.T) {
+	resolver := &fakeResolver{addrs: ips("192.0.2.1")}
+	cache := &dnsCache{resolver: resolver, ttl: time.Hour, negativeTTL: time.Hour, entries: make(map[string]dnsEntry)}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.lookup(context.Background(), "api.example"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := resolver.lookups.Load(); got != 1 {
+		t.Errorf("%d lookups, want the answer cached", got)
+	}
+
+	cache.ttl = 0
+	cache.entries = make(map[string]dnsEntry)
+	cache.lookup(context.Background(), "api.example")
+	cache.lookup(context.Background(), "api.example")
+	if got := resolver.lookups.Load(); got != 3 {
+		t.Errorf("%d lookups, want expired answers looked up again", got)
+	}
+}
+
+func TestDNSCacheKeepsFailures(t *testing.T) {
+	resolver := &fakeResolver{}
+	cache := &dnsCache{resolver: resolver, ttl: time.Hour, negativeTTL: time.Hour, entries: make(map[string]dnsEntry)}
+	for i := 0; i < 2; i++ {
+		var dnsErr *net.DNSError
+		if _, err := cache.lookup(context.Background(), "gone.example"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Fatalf("lookup of a host without addresses = %v, want not found", err)
+		}
+	}
+	if got := resolver.lookups.Load(); got != 1 {
+		t.Errorf("%d lookups, want the failure cached", got)
+	}
+
+	// A lookup the caller gave up on says nothing about the host
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.lookup(ctx, "slow.example"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled lookup = %v", err)
+	}
+	resolver.addrs = ips("192.0.2.1")
+	if _, err := cache.lookup(context.Background(), "slow.example"); err != nil {
+		t.Errorf("lookup after a cancelled one = %v, want it retried", err)
+	}
+}
+
+func TestPartitionPrefersTheFirstFamily(t *testing.T) {
+	primaries, fallbacks := partition(ips("2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2"))
+	if len(primaries) != 2 || primaries[1].IP.String() != "2001:db8::2" {
+		t.Errorf("primaries = %v, want the IPv6 addresses", primaries)
+	}
+	if len(fallbacks) != 2 || fallbacks[0].IP.String() != "192.0.2.1" {
+		t.Errorf("fallbacks = %v, want the IPv4 addresses", fallbacks)
+	}
+
+	if got := filterNetwork("tcp4", ips("2001:db8::1", "192.0.2.1")); len(got) != 1 || got[0].IP.String() != "192.0.2.1" {
+		t.Errorf("tcp4 addresses = %v", got)
+	}
+	if got := filterNetwork("tcp", ips("2001:db8::1", "192.0.2.1")); len(got) != 2 {
+		t.Errorf("tcp addresses = %v, want both families", got)
+	}
+}
+
+func TestDialerFallsBackToTheOtherFamily(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// Nothing listens on the IPv6 loopback, the preferred family fails
+	dialer := New(&fakeResolver{addrs: ips("::1", "127.0.0.1")}, time.Hour, time.Minute, 10*time.Second)
+	fallbacks := testutil.ToFloat64(DialFallbackCounter.WithLabelValues("dual.example"))
+	start := time.Now()
+	conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("dual.example", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial took %s, want the fallback started once the primary failed", elapsed)
+	}
+	if got := testutil.ToFloat64(DialFallbackCounter.WithLabelValues("dual.example")) - fallbacks; got != 1 {
+		t.Errorf("%v fallbacks counted, want 1", got)
+	}
+}
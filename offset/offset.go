@@ -0,0 +1,171 @@
+// Package offset remembers which Telegram updates were handled, so
+// updates Telegram delivers again after a restart are not answered twice.
+package offset
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var DuplicateCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "duplicate_updates_total",
+		Help: "Total number of updates skipped because they were handled before.",
+	},
+)
+
+// sequenceReset is how long Telegram keeps counting update IDs up. After a
+// week without updates the next ID is random, and may be lower.
+const sequenceReset = 7 * 24 * time.Hour
+
+// Store keeps the ID of the last handled update along with when it was
+// received. Implementations are safe for concurrent use.
+type Store interface {
+	// Load returns the stored update ID, 0 if none was stored.
+	Load() (int, time.Time, error)
+	// Save replaces the stored update ID.
+	Save(updateID int, received time.Time) error
+}
+
+// Memory is a Store that forgets everything on restart.
+type Memory struct {
+	mu       sync.Mutex
+	updateID int
+	received time.Time
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Load() (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.updateID, m.received, nil
+}
+
+func (m *Memory) Save(updateID int, received time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateID, m.received = updateID, received
+	return nil
+}
+
+// Tracker follows updates from Begin until their last Done and works out
+// the last update up to which everything is handled, which it saves to the
+// store every so often. Updates finish out of order on the worker pool, so
+// that is the one before the oldest update still held. It is safe for
+// concurrent use.
+type Tracker struct {
+	store   Store
+	flushMu sync.Mutex // One save at a time
+
+	mu     sync.Mutex
+	last   int // Highest update begun
+	lastAt time.Time
+	held   map[int]int // Holds by update
+	saved  int
+}
+
+// NewTracker returns a tracker resuming after the update saved in store.
+func NewTracker(store Store) (*Tracker, error) {
+	saved, received, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{store: store, last: saved, lastAt: received, held: make(map[int]int), saved: saved}, nil
+}
+
+// Next is the first update to ask Telegram for as of now, 0 when nothing
+// was saved or Telegram has restarted the sequence since.
+func (t *Tracker) Next(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.saved == 0 || now.Sub(t.lastAt) > sequenceReset {
+		return 0
+	}
+	return t.saved + 1
+}
+
+// Begin holds updateID, received at now, and reports true, unless
+// updateID was begun before, here or before the restart, in which case the
+// update is to be skipped.
+func (t *Tracker) Begin(updateID int, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if updateID <= t.last && now.Sub(t.lastAt) <= sequenceReset {
+		DuplicateCounter.Inc()
+		return false
+	}
+	t.last, t.lastAt = updateID, now
+	t.held[updateID]++
+	return true
+}
+
+// Hold holds the begun updateID once more, for work that goes on after the
+// dispatch. Each Hold needs its own Done.
+func (t *Tracker) Hold(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.held[updateID]++
+}
+
+// Done releases a hold of updateID.
+func (t *Tracker) Done(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.held[updateID]--; t.held[updateID] <= 0 {
+		delete(t.held, updateID)
+	}
+}
+
+// handled returns the last update up to which everything is handled.
+func (t *Tracker) handled() int {
+	handled := t.last
+	for updateID := range t.held {
+		handled = min(handled, updateID-1)
+	}
+	return handled
+}
+
+// Flush saves the last handled update if it changed since the last save.
+func (t *Tracker) Flush() error {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+	t.mu.Lock()
+	handled, saved, received := t.handled(), t.saved, t.lastAt
+	t.mu.Unlock()
+	if handled == saved {
+		return nil
+	}
+	// Updates keep being tracked while the store writes
+	if err := t.store.Save(handled, received); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.saved = handled
+	t.mu.Unlock()
+	return nil
+}
+
+// Run flushes every interval until ctx is done, so handling an update
+// never waits on the disk. The caller flushes a last time on shutdown.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Flush(); err != nil {
+				log.Error().Err(err).Msg("Failed to save the update offset")
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package offset
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	_ "modernc.org/sqlite"
+)
+
+var start = time.Unix(1700000000, 0)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "offset.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStoresKeepTheLastSave(t *testing.T) {
+	sqlite, err := NewSQLite(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]Store{"memory": NewMemory(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			if updateID, _, err := store.Load(); err != nil || updateID != 0 {
+				t.Fatalf("empty store Load = %d, %v", updateID, err)
+			}
+			for _, updateID := range []int{10, 12} {
+				if err := store.Save(updateID, start); err != nil {
+					t.Fatal(err)
+				}
+			}
+			updateID, received, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updateID != 12 || !received.Equal(start) {
+				t.Errorf("Load = %d at %s, want 12 at %s", updateID, received, start)
+			}
+		})
+	}
+}
+
+func TestTrackerSavesUpToTheOldestHeldUpdate(t *testing.T) {
+	store := NewMemory()
+	tracker, err := NewTracker(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for updateID := 1; updateID <= 3; updateID++ {
+		if !tracker.Begin(updateID, start) {
+			t.Fatalf("update %d skipped", updateID)
+		}
+	}
+	// Update 2 goes on on the worker pool after its dispatch
+	tracker.Hold(2)
+	tracker.Done(1)
+	tracker.Done(2)
+	tracker.Done(3)
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _, _ := store.Load(); saved != 1 {
+		t.Errorf("saved %d while update 2 is held, want 1", saved)
+	}
+
+	tracker.Done(2)
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _, _ := store.Load(); saved != 3 {
+		t.Errorf("saved %d with everything done, want 3", saved)
+	}
+}
+
+func TestTrackerSkipsUpdatesHandledBeforeARestart(t *testing.T) {
+	store := NewMemory()
+	store.Save(41, start)
+	tracker, err := NewTracker(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := tracker.Next(start.Add(time.Hour)); next != 42 {
+		t.Errorf("Next = %d, want the update after the saved one", next)
+	}
+
+	duplicates := testutil.ToFloat64(DuplicateCounter)
+	if tracker.Begin(41, start.Add(time.Hour)) {
+		t.Error("update handled before the restart begun again")
+	}
+	if got := testutil.ToFloat64(DuplicateCounter) - duplicates; got != 1 {
+		t.Errorf("%v duplicates counted, want 1", got)
+	}
+	if !tracker.Begin(42, start.Add(time.Hour)) {
+		t.Error("new update skipped")
+	}
+	if tracker.Begin(42, start.Add(time.Hour)) {
+		t.Error("update begun twice")
+	}
+}
+
+func TestTrackerFollowsTelegramRestartingTheSequence(t *testing.T) {
+	store := NewMemory()
+	store.Save(41, start)
+	tracker, err := NewTracker(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := start.Add(sequenceReset + time.Hour)
+	if next := tracker.Next(later); next != 0 {
+		t.Errorf("Next = %d a week later, want no offset", next)
+	}
+	if !tracker.Begin(7, later) {
+		t.Error("update of the new sequence skipped")
+	}
+}
+
+func TestTrackerWithNothingSavedStartsWithoutOffset(t *testing.T) {
+	tracker, err := NewTracker(NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := tracker.Next(start); next != 0 {
+		t.Errorf("Next = %d, want no offset", next)
+	}
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
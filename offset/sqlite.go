@@ -0,0 +1,45 @@
+package offset
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLite is a Store kept in a table of a SQLite database shared with other
+// stores.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite keeps the offset in db, creating its table if needed.
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	// A single row, the check keeps it that way
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS update_offset (
+		id        INTEGER PRIMARY KEY CHECK (id = 1),
+		update_id INTEGER NOT NULL,
+		received  INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("create update offset table: %w", err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Load() (int, time.Time, error) {
+	var updateID int
+	var received int64
+	err := s.db.QueryRow("SELECT update_id, received FROM update_offset WHERE id = 1").Scan(&updateID, &received)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, nil
+	}
+	return updateID, time.Unix(received, 0), err
+}
+
+func (s *SQLite) Save(updateID int, received time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO update_offset (id, update_id, received) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET update_id = excluded.update_id, received = excluded.received`,
+		updateID, received.Unix())
+	return err
+}
@@ -0,0 +1,100 @@
+// Package pending keeps the recognition jobs whose result the backend
+// delivers later, so the reply can be completed when it arrives.
+package pending
+
+import (
+	"sync"
+	"time"
+
+	"telegram-sr-bot/quota"
+)
+
+// Job is a message waiting for its transcription.
+type Job struct {
+	// Token identifies the job in the callback.
+	Token         string
+	ChatID        int64
+	MessageID     int
+	PlaceholderID int // 0 when no placeholder was posted
+	// Language is the language of the replies.
+	Language string
+	// CacheKey caches the result, "" does not.
+	CacheKey string
+	// FileName, Duration and Sent describe the audio, to name and caption
+	// transcripts sent as files. Source is its kind, for the metrics.
+	FileName string
+	Source   string
+	Duration time.Duration
+	Sent     time.Time
+	// SRT asks for subtitles.
+	SRT     bool
+	Expires time.Time
+	// Charge is refunded if no transcription comes of the job.
+	Charge quota.Charge
+}
+
+// Store keeps pending jobs. Implementations are safe for concurrent use and
+// hand every job out at most once.
+type Store interface {
+	// Add stores job.
+	Add(job Job) error
+	// Take removes the job of token and returns it, reporting false if there
+	// is none, because it was taken before or never existed.
+	Take(token string) (Job, bool, error)
+	// TakeExpired removes the jobs that expired by now and returns them.
+	TakeExpired(now time.Time) ([]Job, error)
+	// MigrateChat moves the jobs of fromChatID to toChatID, the ID the group
+	// continues under as a supergroup.
+	MigrateChat(fromChatID, toChatID int64) error
+}
+
+// Memory is a Store that forgets everything on restart.
+type Memory struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{jobs: make(map[string]Job)}
+}
+
+func (m *Memory) Add(job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.Token] = job
+	return nil
+}
+
+func (m *Memory) Take(token string) (Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[token]
+	delete(m.jobs, token)
+	return job, ok, nil
+}
+
+func (m *Memory) TakeExpired(now time.Time) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []Job
+	for token, job := range m.jobs {
+		if !now.Before(job.Expires) {
+			expired = append(expired, job)
+			delete(m.jobs, token)
+		}
+	}
+	return expired, nil
+}
+
+func (m *Memory) MigrateChat(fromChatID, toChatID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, job := range m.jobs {
+		if job.ChatID == fromChatID {
+			job.ChatID = toChatID
+			m.jobs[token] = job
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package pending
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+	"telegram-sr-bot/quota"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "pending.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStoresHandOutJobsOnce(t *testing.T) {
+	sqlite, err := NewSQLite(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	job := Job{
+		Token: "a", ChatID: -100, MessageID: 5, PlaceholderID: 6, Language: "ru", CacheKey: "unique/",
+		FileName: "talk.ogg", Source: "voice", Duration: 90 * time.Second, Sent: now, SRT: true, Expires: now.Add(time.Hour),
+		Charge: quota.Charge{UserID: 7, Day: "2023-11-14", Seconds: 90},
+	}
+	expiring := Job{Token: "b", Sent: now, Expires: now.Add(time.Minute)}
+	for name, store := range map[string]Store{"memory": NewMemory(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			for _, j := range []Job{job, expiring} {
+				if err := store.Add(j); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expired, err := store.TakeExpired(now.Add(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(expired) != 1 || expired[0].Token != "b" {
+				t.Errorf("TakeExpired = %+v, want job b", expired)
+			}
+			got, ok, err := store.Take("a")
+			if err != nil || !ok {
+				t.Fatalf("Take = %v, %v", ok, err)
+			}
+			if !reflect.DeepEqual(got, job) {
+				t.Errorf("Take = %+v, want %+v", got, job)
+			}
+			if _, ok, _ := store.Take("a"); ok {
+				t.Error("job handed out twice")
+			}
+		})
+	}
+}
+
+func TestSQLiteAddsColumnsToOldTables(t *testing.T) {
+	db := openDB(t)
+	// The table as its first release created it
+	_, err := db.Exec(`CREATE TABLE pending_jobs (
+		token TEXT PRIMARY KEY, chat_id INTEGER NOT NULL, message_id INTEGER NOT NULL,
+		placeholder_id INTEGER NOT NULL, language TEXT NOT NULL, cache_key TEXT NOT NULL,
+		file_name TEXT NOT NULL, duration INTEGER NOT NULL, sent INTEGER NOT NULL,
+		srt INTEGER NOT NULL, expires INTEGER NOT NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO pending_jobs VALUES ('old', 1, 2, 0, 'en', '', '', 0, 0, 0, 0)`); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, ok, err := store.Take("old")
+	if err != nil || !ok {
+		t.Fatalf("Take = %v, %v", ok, err)
+	}
+	if job.Charge != (quota.Charge{}) {
+		t.Errorf("old job charged %+v", job.Charge)
+	}
+	if _, err := NewSQLite(db); err != nil {
+		t.Errorf("opening the table again: %v", err)
+	}
+}
+
+func TestStoresMigrateChats(t *testing.T) {
+	sqlite, err := NewSQLite(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]Store{"memory": NewMemory(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			for _, j := range []Job{{Token: "group", ChatID: -5}, {Token: "other", ChatID: -6}} {
+				if err := store.Add(j); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.MigrateChat(-5, -1005); err != nil {
+				t.Fatal(err)
+			}
+			for token, chatID := range map[string]int64{"group": -1005, "other": -6} {
+				job, ok, err := store.Take(token)
+				if err != nil || !ok {
+					t.Fatalf("Take(%q) = %v, %v", token, ok, err)
+				}
+				if job.ChatID != chatID {
+					t.Errorf("job %q in chat %d, want %d", token, job.ChatID, chatID)
+				}
+			}
+		})
+	}
+}
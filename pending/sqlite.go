@@ -0,0 +1,107 @@
+package pending
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// addedColumns were added to the table after its first release, tables
+// created before get them on start.
+var addedColumns = []string{
+	"quota_user INTEGER NOT NULL DEFAULT 0",
+	"quota_day TEXT NOT NULL DEFAULT ''",
+	"quota_seconds INTEGER NOT NULL DEFAULT 0",
+	"source TEXT NOT NULL DEFAULT ''",
+}
+
+// SQLite is a Store kept in a table of a SQLite database shared with other
+// stores.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite keeps jobs in db, creating their table if needed.
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS pending_jobs (
+		token          TEXT PRIMARY KEY,
+		chat_id        INTEGER NOT NULL,
+		message_id     INTEGER NOT NULL,
+		placeholder_id INTEGER NOT NULL,
+		language       TEXT NOT NULL,
+		cache_key      TEXT NOT NULL,
+		file_name      TEXT NOT NULL,
+		duration       INTEGER NOT NULL,
+		sent           INTEGER NOT NULL,
+		srt            INTEGER NOT NULL,
+		expires        INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("create pending jobs table: %w", err)
+	}
+	for _, column := range addedColumns {
+		_, err := db.Exec("ALTER TABLE pending_jobs ADD COLUMN " + column)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, fmt.Errorf("add pending jobs column: %w", err)
+		}
+	}
+	return &SQLite{db: db}, nil
+}
+
+const columns = "token, chat_id, message_id, placeholder_id, language, cache_key, file_name, duration, sent, srt, expires, " +
+	"quota_user, quota_day, quota_seconds, source"
+
+func (s *SQLite) Add(job Job) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO pending_jobs ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		job.Token, job.ChatID, job.MessageID, job.PlaceholderID, job.Language, job.CacheKey, job.FileName,
+		int64(job.Duration), job.Sent.Unix(), job.SRT, job.Expires.UnixNano(),
+		job.Charge.UserID, job.Charge.Day, job.Charge.Seconds, job.Source)
+	return err
+}
+
+func (s *SQLite) Take(token string) (Job, bool, error) {
+	// Deleting and returning in one statement hands every job out once
+	job, err := scan(s.db.QueryRow("DELETE FROM pending_jobs WHERE token = ? RETURNING "+columns, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	return job, true, nil
+}
+
+func (s *SQLite) TakeExpired(now time.Time) ([]Job, error) {
+	rows, err := s.db.Query("DELETE FROM pending_jobs WHERE expires <= ? RETURNING "+columns, now.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var expired []Job
+	for rows.Next() {
+		job, err := scan(rows)
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, job)
+	}
+	return expired, rows.Err()
+}
+
+func (s *SQLite) MigrateChat(fromChatID, toChatID int64) error {
+	_, err := s.db.Exec("UPDATE pending_jobs SET chat_id = ? WHERE chat_id = ?", toChatID, fromChatID)
+	return err
+}
+
+func scan(row interface{ Scan(dest ...any) error }) (Job, error) {
+	var job Job
+	var duration, sent, expires int64
+	err := row.Scan(&job.Token, &job.ChatID, &job.MessageID, &job.PlaceholderID, &job.Language, &job.CacheKey,
+		&job.FileName, &duration, &sent, &job.SRT, &expires, &job.Charge.UserID, &job.Charge.Day, &job.Charge.Seconds, &job.Source)
+	job.Duration = time.Duration(duration)
+	job.Sent = time.Unix(sent, 0)
+	job.Expires = time.Unix(0, expires)
+	return job, err
+}
@@ -0,0 +1,154 @@
+// The gRPC interface of the recognition service. The Go code in
+// recognitionpb is generated from this file with protoc-gen-go and
+// protoc-gen-go-grpc, regenerate it after changing the file:
+//
+//	protoc --go_out=. --go_opt=module=telegram-sr-bot \
+//	    --go-grpc_out=. --go-grpc_opt=module=telegram-sr-bot proto/recognition.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: proto/recognition.proto
+
+package recognitionpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Recognizer_Recognize_FullMethodName = "/recognition.v1.Recognizer/Recognize"
+)
+
+// RecognizerClient is the client API for Recognizer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RecognizerClient interface {
+	// Recognize transcribes audio streamed in chunks. The first chunk carries
+	// the metadata, every chunk some of the audio.
+	Recognize(ctx context.Context, opts ...grpc.CallOption) (Recognizer_RecognizeClient, error)
+}
+
+type recognizerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRecognizerClient(cc grpc.ClientConnInterface) RecognizerClient {
+	return &recognizerClient{cc}
+}
+
+func (c *recognizerClient) Recognize(ctx context.Context, opts ...grpc.CallOption) (Recognizer_RecognizeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Recognizer_ServiceDesc.Streams[0], Recognizer_Recognize_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &recognizerRecognizeClient{stream}
+	return x, nil
+}
+
+type Recognizer_RecognizeClient interface {
+	Send(*AudioChunk) error
+	CloseAndRecv() (*RecognitionResult, error)
+	grpc.ClientStream
+}
+
+type recognizerRecognizeClient struct {
+	grpc.ClientStream
+}
+
+func (x *recognizerRecognizeClient) Send(m *AudioChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *recognizerRecognizeClient) CloseAndRecv() (*RecognitionResult, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(RecognitionResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RecognizerServer is the server API for Recognizer service.
+// All implementations must embed UnimplementedRecognizerServer
+// for forward compatibility
+type RecognizerServer interface {
+	// Recognize transcribes audio streamed in chunks. The first chunk carries
+	// the metadata, every chunk some of the audio.
+	Recognize(Recognizer_RecognizeServer) error
+	mustEmbedUnimplementedRecognizerServer()
+}
+
+// UnimplementedRecognizerServer must be embedded to have forward compatible implementations.
+type UnimplementedRecognizerServer struct {
+}
+
+func (UnimplementedRecognizerServer) Recognize(Recognizer_RecognizeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Recognize not implemented")
+}
+func (UnimplementedRecognizerServer) mustEmbedUnimplementedRecognizerServer() {}
+
+// UnsafeRecognizerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RecognizerServer will
+// result in compilation errors.
+type UnsafeRecognizerServer interface {
+	mustEmbedUnimplementedRecognizerServer()
+}
+
+func RegisterRecognizerServer(s grpc.ServiceRegistrar, srv RecognizerServer) {
+	s.RegisterService(&Recognizer_ServiceDesc, srv)
+}
+
+func _Recognizer_Recognize_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RecognizerServer).Recognize(&recognizerRecognizeServer{stream})
+}
+
+type Recognizer_RecognizeServer interface {
+	SendAndClose(*RecognitionResult) error
+	Recv() (*AudioChunk, error)
+	grpc.ServerStream
+}
+
+type recognizerRecognizeServer struct {
+	grpc.ServerStream
+}
+
+func (x *recognizerRecognizeServer) SendAndClose(m *RecognitionResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *recognizerRecognizeServer) Recv() (*AudioChunk, error) {
+	m := new(AudioChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Recognizer_ServiceDesc is the grpc.ServiceDesc for Recognizer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Recognizer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "recognition.v1.Recognizer",
+	HandlerType: (*RecognizerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Recognize",
+			Handler:       _Recognizer_Recognize_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/recognition.proto",
+}
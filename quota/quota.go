@@ -0,0 +1,192 @@
+// Package quota caps how much audio every user has transcribed a day. The
+// day is the UTC one, so everyone's allowance renews at midnight UTC.
+package quota
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ExceededCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "quota_exceeded_messages_total",
+		Help: "Total number of messages refused because their sender used up the daily quota.",
+	},
+)
+
+// Store keeps the seconds each user used on the day they last used any.
+// Implementations are safe for concurrent use.
+type Store interface {
+	// Take adds seconds to what userID used on day, unless that would go
+	// over limit. It returns the seconds used on day after the call and
+	// whether they were taken.
+	Take(userID int64, day string, seconds, limit int) (used int, taken bool, err error)
+	// Used returns the seconds userID used on day.
+	Used(userID int64, day string) (int, error)
+	// Refund gives seconds taken on day back to userID, what was used on
+	// another day stays as it is.
+	Refund(userID int64, day string, seconds int) error
+}
+
+// Memory is a Store that forgets everything on restart.
+type Memory struct {
+	mu    sync.Mutex
+	usage map[int64]usage
+}
+
+// usage is what a user used on day.
+type usage struct {
+	day     string
+	seconds int
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{usage: make(map[int64]usage)}
+}
+
+func (m *Memory) Take(userID int64, day string, seconds, limit int) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.usage[userID]
+	if u.day != day {
+		u = usage{day: day}
+	}
+	if u.seconds+seconds > limit {
+		return u.seconds, false, nil
+	}
+	u.seconds += seconds
+	m.usage[userID] = u
+	return u.seconds, true, nil
+}
+
+func (m *Memory) Refund(userID int64, day string, seconds int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u := m.usage[userID]; u.day == day {
+		u.seconds = max(u.seconds-seconds, 0)
+		m.usage[userID] = u
+	}
+	return nil
+}
+
+func (m *Memory) Used(userID int64, day string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u := m.usage[userID]; u.day == day {
+		return u.seconds, nil
+	}
+	return 0, nil
+}
+
+// Decision is the verdict on one message, or the standing of a user.
+type Decision struct {
+	Allowed bool
+	// Unlimited is set for users the quota does not apply to.
+	Unlimited bool
+	// Remaining is what is left of the day's quota.
+	Remaining time.Duration
+	// ResetsAt is the next midnight UTC.
+	ResetsAt time.Time
+	// Charge is what was taken, to be refunded if the message is not
+	// transcribed after all.
+	Charge Charge
+}
+
+// Charge is the seconds a user was charged on a day. The zero Charge is
+// nothing charged.
+type Charge struct {
+	UserID  int64
+	Day     string
+	Seconds int
+}
+
+// RemainingSeconds is Remaining in whole seconds.
+func (d Decision) RemainingSeconds() int {
+	return int(d.Remaining / time.Second)
+}
+
+// ResetsIn is how long until the quota resets as of now, in hours and
+// minutes rounded up.
+func (d Decision) ResetsIn(now time.Time) (hours, minutes int) {
+	total := int(math.Ceil(d.ResetsAt.Sub(now).Minutes()))
+	return total / 60, total % 60
+}
+
+// Quota allows every user but the exempt ones daily worth of audio a day.
+type Quota struct {
+	store  Store
+	daily  int // Seconds
+	exempt map[int64]bool
+}
+
+// New returns a quota of daily audio per user and day, kept in store.
+func New(store Store, daily time.Duration, exempt []int64) *Quota {
+	q := &Quota{store: store, daily: int(daily / time.Second), exempt: make(map[int64]bool)}
+	for _, id := range exempt {
+		q.exempt[id] = true
+	}
+	return q
+}
+
+// Take charges userID for duration of audio sent at now, refusing it if it
+// does not fit into what is left of the day. Durations count in whole
+// seconds, rounded up.
+func (q *Quota) Take(userID int64, duration time.Duration, now time.Time) (Decision, error) {
+	if q.exempt[userID] {
+		return Decision{Allowed: true, Unlimited: true}, nil
+	}
+	day, resets := today(now)
+	seconds := int(math.Ceil(duration.Seconds()))
+	used, taken, err := q.store.Take(userID, day, seconds, q.daily)
+	if err != nil {
+		return Decision{}, err
+	}
+	decision := Decision{Allowed: taken, Remaining: q.remaining(used), ResetsAt: resets}
+	if taken {
+		decision.Charge = Charge{UserID: userID, Day: day, Seconds: seconds}
+	}
+	return decision, nil
+}
+
+// Refund gives charge back. Refunding nothing, or on a nil Quota, does
+// nothing.
+func (q *Quota) Refund(charge Charge) error {
+	if q == nil || charge.Seconds == 0 {
+		return nil
+	}
+	return q.store.Refund(charge.UserID, charge.Day, charge.Seconds)
+}
+
+// Check returns the standing of userID at now without charging anything.
+func (q *Quota) Check(userID int64, now time.Time) (Decision, error) {
+	if q.exempt[userID] {
+		return Decision{Allowed: true, Unlimited: true}, nil
+	}
+	day, resets := today(now)
+	used, err := q.store.Used(userID, day)
+	if err != nil {
+		return Decision{}, err
+	}
+	remaining := q.remaining(used)
+	return Decision{Allowed: remaining > 0, Remaining: remaining, ResetsAt: resets}, nil
+}
+
+// Daily returns the quota of a day.
+func (q *Quota) Daily() time.Duration {
+	return time.Duration(q.daily) * time.Second
+}
+
+func (q *Quota) remaining(used int) time.Duration {
+	return time.Duration(max(q.daily-used, 0)) * time.Second
+}
+
+// today names the UTC day of now and returns when it ends.
+func today(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return now.Format(time.DateOnly), midnight.AddDate(0, 0, 1)
+}
@@ -0,0 +1,188 @@
+package quota
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// stores returns every Store implementation, empty.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "quota.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	sqlite, err := NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemory(), "sqlite": sqlite}
+}
+
+func TestQuotaLimit(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			q := New(store, time.Minute, nil)
+			steps := []struct {
+				duration      time.Duration
+				wantAllowed   bool
+				wantRemaining time.Duration
+			}{
+				{40 * time.Second, true, 20 * time.Second},
+				{30 * time.Second, false, 20 * time.Second},
+				{19500 * time.Millisecond, true, 0}, // Rounded up to 20 s
+				{time.Second, false, 0},
+				{0, true, 0},
+			}
+			for i, step := range steps {
+				decision, err := q.Take(1, step.duration, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decision.Allowed != step.wantAllowed || decision.Remaining != step.wantRemaining {
+					t.Errorf("step %d: Take(%s) = %v, %s; want %v, %s", i, step.duration,
+						decision.Allowed, decision.Remaining, step.wantAllowed, step.wantRemaining)
+				}
+			}
+			if decision, _ := q.Take(2, 2*time.Minute, now); decision.Allowed {
+				t.Error("a message longer than the whole quota was allowed")
+			}
+			if decision, _ := q.Take(2, time.Minute, now); !decision.Allowed {
+				t.Error("another user's usage counted against user 2")
+			}
+		})
+	}
+}
+
+func TestQuotaResetsAtMidnightUTC(t *testing.T) {
+	// 23:59:59 UTC is the morning of the next day in Moscow, still the same UTC day
+	lastSecond := time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC)
+	moscow := time.FixedZone("MSK", 3*60*60)
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			q := New(store, time.Minute, nil)
+			if decision, _ := q.Take(1, time.Minute, lastSecond.In(moscow)); !decision.Allowed {
+				t.Fatal("first message refused")
+			}
+			decision, err := q.Check(1, lastSecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Allowed || decision.Remaining != 0 {
+				t.Errorf("Check before midnight = %v, %s; want the quota used up", decision.Allowed, decision.Remaining)
+			}
+			if want := lastSecond.Add(time.Second); !decision.ResetsAt.Equal(want) {
+				t.Errorf("ResetsAt = %s, want %s", decision.ResetsAt, want)
+			}
+			if hours, minutes := decision.ResetsIn(lastSecond); hours != 0 || minutes != 1 {
+				t.Errorf("ResetsIn = %d h %d min, want 0 h 1 min", hours, minutes)
+			}
+
+			midnight := lastSecond.Add(time.Second)
+			decision, err = q.Take(1, time.Minute, midnight)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !decision.Allowed {
+				t.Error("quota did not reset at midnight UTC")
+			}
+			if want := midnight.AddDate(0, 0, 1); !decision.ResetsAt.Equal(want) {
+				t.Errorf("ResetsAt = %s, want %s", decision.ResetsAt, want)
+			}
+		})
+	}
+}
+
+func TestQuotaRefund(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			q := New(store, time.Minute, nil)
+			first, _ := q.Take(1, 45*time.Second, now)
+			if err := q.Refund(first.Charge); err != nil {
+				t.Fatal(err)
+			}
+			if decision, _ := q.Check(1, now); decision.Remaining != time.Minute {
+				t.Errorf("Remaining after refund = %s, want the whole minute", decision.Remaining)
+			}
+
+			// A charge of yesterday is not refunded into today
+			late, _ := q.Take(1, 45*time.Second, now)
+			tomorrow := now.Add(2 * time.Hour)
+			if decision, _ := q.Take(1, 50*time.Second, tomorrow); !decision.Allowed {
+				t.Fatal("quota did not reset")
+			}
+			if err := q.Refund(late.Charge); err != nil {
+				t.Fatal(err)
+			}
+			if decision, _ := q.Check(1, tomorrow); decision.Remaining != 10*time.Second {
+				t.Errorf("Remaining = %s, want 10s, the refund belonged to the day before", decision.Remaining)
+			}
+
+			refused, _ := q.Take(1, time.Minute, tomorrow)
+			if refused.Charge != (Charge{}) {
+				t.Errorf("refused message charged %+v", refused.Charge)
+			}
+			var none *Quota
+			if err := none.Refund(Charge{UserID: 1, Day: "2024-03-02", Seconds: 5}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestQuotaExemptUsers(t *testing.T) {
+	q := New(NewMemory(), time.Second, []int64{42})
+	now := time.Now()
+	decision, err := q.Take(42, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Allowed || !decision.Unlimited || decision.Charge != (Charge{}) {
+		t.Errorf("Take for an exempt user = %+v, want allowed without charge", decision)
+	}
+}
+
+func TestQuotaConcurrentTakes(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			q := New(store, 100*time.Second, nil)
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			allowed := 0
+			for i := 0; i < 40; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					decision, err := q.Take(1, 7*time.Second, now)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if decision.Allowed {
+						mu.Lock()
+						allowed++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			// 14 × 7 s fit into 100 s, the 15th would overdraw
+			if allowed != 14 {
+				t.Errorf("%d messages allowed, want 14", allowed)
+			}
+			if decision, _ := q.Check(1, now); decision.Remaining != 2*time.Second {
+				t.Errorf("Remaining = %s, want 2s", decision.Remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package quota
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQLite is a Store kept in a table of a SQLite database shared with other
+// stores.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite keeps the usage in db, creating its table if needed.
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	// A row per user, replaced on their first use of a day
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS quota_usage (
+		user_id INTEGER PRIMARY KEY,
+		day     TEXT NOT NULL,
+		seconds INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("create quota usage table: %w", err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// Take checks and adds in a single statement, so concurrent handlers never
+// both take the last seconds of a user.
+func (s *SQLite) Take(userID int64, day string, seconds, limit int) (int, bool, error) {
+	if seconds > limit {
+		used, err := s.Used(userID, day)
+		return used, false, err
+	}
+	var used int
+	err := s.db.QueryRow(`INSERT INTO quota_usage (user_id, day, seconds) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			seconds = CASE WHEN day = excluded.day THEN seconds + excluded.seconds ELSE excluded.seconds END,
+			day = excluded.day
+		WHERE CASE WHEN day = excluded.day THEN seconds ELSE 0 END + excluded.seconds <= ?
+		RETURNING seconds`,
+		userID, day, seconds, limit).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The condition refused the update
+		used, err := s.Used(userID, day)
+		return used, false, err
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return used, true, nil
+}
+
+func (s *SQLite) Refund(userID int64, day string, seconds int) error {
+	_, err := s.db.Exec("UPDATE quota_usage SET seconds = MAX(seconds - ?, 0) WHERE user_id = ? AND day = ?", seconds, userID, day)
+	return err
+}
+
+func (s *SQLite) Used(userID int64, day string) (int, error) {
+	var used int
+	err := s.db.QueryRow("SELECT seconds FROM quota_usage WHERE user_id = ? AND day = ?", userID, day).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return used, err
+}
@@ -0,0 +1,114 @@
+// Package ratelimit keeps single users from monopolizing the recognition
+// backend.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var LimitedCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "rate_limited_messages_total",
+		Help: "Total number of messages dropped because their sender exceeded the rate limit.",
+	},
+)
+
+// Decision is the verdict on one message.
+type Decision struct {
+	Allowed bool
+	// Notify is set on the first rejection since the user was last allowed,
+	// later ones are dropped silently.
+	Notify bool
+	// RetryAfter is how long until the next message is allowed.
+	RetryAfter time.Duration
+}
+
+// RetryMinutes is RetryAfter rounded up to whole minutes, at least one.
+func (d Decision) RetryMinutes() int {
+	return max(1, int(math.Ceil(d.RetryAfter.Minutes())))
+}
+
+// Limiter is a token bucket per user: each holds up to burst messages and
+// refills at burst per window. Buckets that refilled completely are
+// forgotten, so idle users take no memory.
+type Limiter struct {
+	burst  float64
+	window time.Duration
+	exempt map[int64]bool
+
+	mu        sync.Mutex
+	buckets   map[int64]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	notified bool
+}
+
+// New returns a limiter allowing burst messages per window to every user
+// but the exempt ones.
+func New(burst int, window time.Duration, exempt []int64) *Limiter {
+	l := &Limiter{
+		burst:   float64(burst),
+		window:  window,
+		exempt:  make(map[int64]bool),
+		buckets: make(map[int64]*bucket),
+	}
+	for _, id := range exempt {
+		l.exempt[id] = true
+	}
+	return l
+}
+
+// Allow takes a token from the bucket of userID.
+func (l *Limiter) Allow(userID int64, now time.Time) Decision {
+	if l.exempt[userID] {
+		return Decision{Allowed: true}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= l.window {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[userID]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[userID] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.notified = false
+		return Decision{Allowed: true}
+	}
+	decision := Decision{Notify: !b.notified, RetryAfter: time.Duration((1 - b.tokens) / l.rate())}
+	b.notified = true
+	return decision
+}
+
+// rate is the refill rate in tokens per nanosecond.
+func (l *Limiter) rate() float64 {
+	return l.burst / float64(l.window)
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	return min(l.burst, b.tokens+float64(now.Sub(b.updated))*l.rate())
+}
+
+// sweep forgets the buckets that are full again.
+func (l *Limiter) sweep(now time.Time) {
+	for id, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, id)
+		}
+	}
+	l.lastSweep = now
+}
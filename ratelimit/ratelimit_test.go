@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var start = time.Unix(1700000000, 0)
+
+func TestLimiterAllowsABurstThenRefills(t *testing.T) {
+	l := New(3, 3*time.Minute, nil)
+	for i := 0; i < 3; i++ {
+		if d := l.Allow(7, start); !d.Allowed {
+			t.Fatalf("message %d of the burst refused", i+1)
+		}
+	}
+	d := l.Allow(7, start)
+	if d.Allowed || !d.Notify || d.RetryAfter != time.Minute || d.RetryMinutes() != 1 {
+		t.Errorf("over the burst: %+v, want refused and told to wait a minute", d)
+	}
+	if d := l.Allow(7, start.Add(30*time.Second)); d.Allowed || d.Notify || d.RetryAfter != 30*time.Second {
+		t.Errorf("second refusal: %+v, want dropped silently", d)
+	}
+	// One token back per minute
+	if d := l.Allow(7, start.Add(time.Minute)); !d.Allowed {
+		t.Errorf("refused after a minute of refill: %+v", d)
+	}
+	if d := l.Allow(7, start.Add(time.Minute)); d.Allowed || !d.Notify {
+		t.Errorf("after being allowed again: %+v, want told once more", d)
+	}
+	// Other users have buckets of their own
+	if d := l.Allow(8, start); !d.Allowed {
+		t.Error("another user refused")
+	}
+}
+
+func TestLimiterExemptsAdmins(t *testing.T) {
+	l := New(1, time.Hour, []int64{1})
+	for i := 0; i < 10; i++ {
+		if !l.Allow(1, start).Allowed {
+			t.Fatal("exempt user refused")
+		}
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("%d buckets kept for exempt users", len(l.buckets))
+	}
+}
+
+func TestLimiterForgetsIdleUsers(t *testing.T) {
+	l := New(2, time.Minute, nil)
+	l.Allow(7, start)
+	l.Allow(8, start.Add(30*time.Second))
+	l.Allow(8, start.Add(30*time.Second))
+
+	// 7 is full again a minute later, 8 has a token and a half back
+	l.Allow(9, start.Add(time.Minute+15*time.Second))
+	if _, ok := l.buckets[7]; ok {
+		t.Error("bucket of an idle user kept")
+	}
+	if _, ok := l.buckets[8]; !ok {
+		t.Error("bucket of a user still refilling forgotten")
+	}
+	// A forgotten user starts with a full bucket
+	if d := l.Allow(7, start.Add(2*time.Minute)); !d.Allowed {
+		t.Errorf("forgotten user refused: %+v", d)
+	}
+}
+
+func TestRetryMinutesRoundsUp(t *testing.T) {
+	for after, want := range map[time.Duration]int{0: 1, time.Second: 1, time.Minute: 1, 61 * time.Second: 2} {
+		if got := (Decision{RetryAfter: after}).RetryMinutes(); got != want {
+			t.Errorf("RetryMinutes of %s = %d, want %d", after, got, want)
+		}
+	}
+}
+
+func TestLimiterIsSafeForConcurrentUse(t *testing.T) {
+	l := New(100, time.Hour, []int64{1})
+	var mu sync.Mutex
+	allowed := 0
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				// Shared user 7, a user of its own and the exempt admin
+				ok := l.Allow(7, start).Allowed
+				l.Allow(int64(100+g), start.Add(time.Duration(i)*time.Minute))
+				l.Allow(1, start)
+				if ok {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if allowed != 100 {
+		t.Errorf("%d of 400 messages allowed, want the burst of 100", allowed)
+	}
+}
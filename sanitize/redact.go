@@ -0,0 +1,57 @@
+package sanitize
+
+import "strings"
+
+// RedactedToken stands in for the bot token wherever it would be shown.
+const RedactedToken = "<redacted>"
+
+// Redactor removes the bot token from strings headed for logs and span
+// attributes. The Bot API and the files it serves are reached at URLs
+// embedding the token, https://api.telegram.org/file/bot<token>/..., and
+// errors quoting them are easily logged. A nil Redactor leaves strings
+// alone.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// NewRedactor returns a redactor for token, nil if token is empty.
+func NewRedactor(token string) *Redactor {
+	if token == "" {
+		return nil
+	}
+	return &Redactor{replacer: strings.NewReplacer("bot"+token, "bot"+RedactedToken, token, RedactedToken)}
+}
+
+// String returns s with the token replaced.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Error returns err with the token replaced in its message. The result
+// still unwraps to err, so errors.Is and errors.As see through it.
+func (r *Redactor) Error(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	message := err.Error()
+	if redacted := r.replacer.Replace(message); redacted != message {
+		return &redactedError{message: redacted, err: err}
+	}
+	return err
+}
+
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
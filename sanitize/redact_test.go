@@ -0,0 +1,59 @@
+package sanitize
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const token = "123456:secret"
+
+func TestRedactorReplacesTheToken(t *testing.T) {
+	r := NewRedactor(token)
+	for in, want := range map[string]string{
+		"GET https://api.telegram.org/bot123456:secret/getMe": "GET https://api.telegram.org/bot<redacted>/getMe",
+		"token 123456:secret": "token <redacted>",
+		"nothing to hide":     "nothing to hide",
+	} {
+		if got := r.String(in); got != want {
+			t.Errorf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactedErrorsStillUnwrap(t *testing.T) {
+	r := NewRedactor(token)
+	err := &url.Error{Op: "Get", URL: "https://api.telegram.org/file/bot" + token + "/voice.ogg", Err: fs.ErrNotExist}
+	redacted := r.Error(err)
+	if strings.Contains(redacted.Error(), "secret") {
+		t.Errorf("error %q still has the token", redacted)
+	}
+	var urlErr *url.Error
+	if !errors.As(redacted, &urlErr) || !errors.Is(redacted, fs.ErrNotExist) {
+		t.Errorf("redacted error %v does not unwrap to the original", redacted)
+	}
+
+	clean := errors.New("no token here")
+	if r.Error(clean) != clean {
+		t.Error("error without the token was wrapped")
+	}
+	if r.Error(nil) != nil {
+		t.Error("nil error redacted into an error")
+	}
+}
+
+func TestNilRedactorLeavesStringsAlone(t *testing.T) {
+	r := NewRedactor("")
+	if r != nil {
+		t.Fatal("redactor for an empty token")
+	}
+	if got := r.String("bot" + token); got != "bot"+token {
+		t.Errorf("String = %q", got)
+	}
+	err := errors.New(token)
+	if r.Error(err) != err {
+		t.Error("nil redactor wrapped the error")
+	}
+}
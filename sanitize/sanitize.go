@@ -0,0 +1,79 @@
+// Package sanitize bounds and cleans user-controlled strings before they
+// reach logs, span attributes, metric labels or the recognition backend.
+// Replies sent back to Telegram keep the original text.
+package sanitize
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Class describes where a string is headed, which decides its length cap
+// and whether it may span several lines.
+type Class struct {
+	MaxRunes  int
+	MultiLine bool
+}
+
+var (
+	// Label is for metric label values.
+	Label = Class{MaxRunes: 64}
+	// LogField is for single-line log fields and span attributes.
+	LogField = Class{MaxRunes: 256}
+	// FormField is for values sent to the backend as form fields.
+	FormField = Class{MaxRunes: 1024}
+	// Text is for multi-line free text such as captions and transcripts.
+	Text = Class{MaxRunes: 16384, MultiLine: true}
+)
+
+// TruncationMarker is appended to strings cut at their class limit.
+const TruncationMarker = "…[truncated]"
+
+// ansiEscape matches CSI and OSC terminal escape sequences.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)?`)
+
+// String returns s with invalid UTF-8 replaced, terminal escape sequences
+// and control characters removed, line breaks folded into spaces unless the
+// class is multi-line, and the result cut to the class length.
+func String(s string, class Class) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if strings.IndexByte(s, 0x1b) >= 0 {
+		s = ansiEscape.ReplaceAllString(s, "")
+	}
+	if !class.MultiLine {
+		s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+	}
+
+	var b strings.Builder
+	b.Grow(min(len(s), class.MaxRunes*utf8.UTFMax))
+	runes := 0
+	for _, r := range s {
+		if !keep(r, class) {
+			continue
+		}
+		if runes == class.MaxRunes {
+			b.WriteString(TruncationMarker)
+			break
+		}
+		b.WriteRune(r)
+		runes++
+	}
+	return b.String()
+}
+
+func keep(r rune, class Class) bool {
+	switch {
+	case r == '\t':
+		return true
+	case r == '\n':
+		return class.MultiLine
+	case unicode.IsControl(r):
+		return false
+	case r >= '\u202a' && r <= '\u202e', r >= '\u2066' && r <= '\u2069':
+		// Bidirectional overrides can disguise what a log line says
+		return false
+	}
+	return true
+}
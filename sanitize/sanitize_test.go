@@ -0,0 +1,74 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func TestString(t *testing.T) {
+	short := Class{MaxRunes: 5}
+	for _, c := range []struct {
+		in    string
+		class Class
+		want  string
+	}{
+		{"voice.ogg", LogField, "voice.ogg"},
+		{"red\x1b[31m alert\x1b[0m", LogField, "red alert"},
+		{"title\x1b]0;pwned\x07!", LogField, "title!"},
+		{"a\x00b\x07c\td", LogField, "abc\td"},
+		{"line one\r\nline two\nthree", LogField, "line one line two three"},
+		{"line one\nline two", Text, "line one\nline two"},
+		{"file‮gnp.exe", LogField, "filegnp.exe"},
+		{"bad \xff byte", LogField, "bad � byte"},
+		{"привет мир", short, "приве" + TruncationMarker},
+		{"12345", short, "12345"},
+		// Dropped characters do not count against the limit
+		{"\x00\x001234\x005", short, "12345"},
+	} {
+		if got := String(c.in, c.class); got != c.want {
+			t.Errorf("String(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestStringCapsEveryClass(t *testing.T) {
+	long := strings.Repeat("я", 20000)
+	for name, class := range map[string]Class{"label": Label, "log field": LogField, "form field": FormField, "text": Text} {
+		got := String(long, class)
+		if runes := len([]rune(strings.TrimSuffix(got, TruncationMarker))); runes != class.MaxRunes {
+			t.Errorf("%s: kept %d runes, want %d", name, runes, class.MaxRunes)
+		}
+	}
+}
+
+func FuzzString(f *testing.F) {
+	for _, seed := range []string{
+		"voice.ogg", "red\x1b[31m alert\x1b[0m", "title\x1b]0;pwned\x07!", "a\x00b\r\nc", "file‮gnp.exe", "bad \xff byte",
+		strings.Repeat("я", 300),
+	} {
+		f.Add(seed)
+	}
+	classes := map[string]Class{"label": Label, "log field": LogField, "form field": FormField, "text": Text}
+	markerRunes := utf8.RuneCountInString(TruncationMarker)
+	f.Fuzz(func(t *testing.T, s string) {
+		for name, class := range classes {
+			got := String(s, class)
+			if !utf8.ValidString(got) {
+				t.Fatalf("%s: %q is not valid UTF-8", name, got)
+			}
+			for _, r := range got {
+				if r == '\n' && class.MultiLine || r == '\t' {
+					continue
+				}
+				if unicode.IsControl(r) {
+					t.Fatalf("%s: %q keeps control character %U", name, got, r)
+				}
+			}
+			if runes := utf8.RuneCountInString(got); runes > class.MaxRunes+markerRunes {
+				t.Fatalf("%s: %d runes, over the cap of %d", name, runes, class.MaxRunes)
+			}
+		}
+	})
+}
@@ -0,0 +1,249 @@
+// Package sender wraps outgoing Telegram requests.
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Requester is the part of tgbotapi.BotAPI used to issue edits.
+type Requester interface {
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+// editStateTTL is how long the state of a message nobody finished is kept
+// after its last edit, as long as the buttons under a transcription work.
+const editStateTTL = 24 * time.Hour
+
+// errMessageGone is returned by Edit once Telegram said the message is gone.
+var errMessageGone = errors.New("message to edit not found")
+
+type messageKey struct {
+	chatID    int64
+	messageID int
+}
+
+type editState struct {
+	desired  tgbotapi.EditMessageTextConfig
+	sent     string // Signature of the last edit Telegram applied
+	lastEdit time.Time
+	updated  time.Time
+	pending  bool
+	inFlight bool
+	running  bool
+	gone     bool
+}
+
+// EditThrottler coalesces repeated edits of the same message. Callers submit
+// the latest text they want shown; per message the throttler edits at most
+// once per interval, never issues two edits concurrently and skips edits
+// that would not change the message. What it knows about a message is kept
+// until Finish, or editStateTTL after the last edit.
+type EditThrottler struct {
+	bot      Requester
+	interval time.Duration
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	messages  map[messageKey]*editState
+	lastSweep time.Time
+}
+
+// NewEditThrottler returns a throttler editing through bot at most once per
+// interval and message.
+func NewEditThrottler(bot Requester, interval time.Duration) *EditThrottler {
+	t := &EditThrottler{bot: bot, interval: interval, messages: make(map[messageKey]*editState)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Submit sets the text the message should eventually show, without waiting
+// for it.
+func (t *EditThrottler) Submit(chatID int64, messageID int, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := messageKey{chatID, messageID}
+	state := t.state(key, time.Now())
+	if state.gone {
+		return
+	}
+	state.desired = tgbotapi.NewEditMessageText(chatID, messageID, text)
+	state.pending = true
+	if !state.running {
+		state.running = true
+		go t.run(key, state)
+	}
+}
+
+// Edit applies edit right away, only waiting for the interval since the
+// last edit of the message, and returns what Telegram answered. Any text
+// submitted before and not sent yet is dropped, edit supersedes it. An edit
+// that changes nothing is skipped.
+func (t *EditThrottler) Edit(edit tgbotapi.EditMessageTextConfig) error {
+	key := messageKey{edit.ChatID, edit.MessageID}
+	t.mu.Lock()
+	state := t.state(key, time.Now())
+	for state.inFlight {
+		t.cond.Wait()
+	}
+	if state.gone {
+		t.mu.Unlock()
+		return errMessageGone
+	}
+	state.pending = false
+	signature := editSignature(edit)
+	if signature == state.sent {
+		t.cond.Broadcast()
+		t.mu.Unlock()
+		return nil
+	}
+	wait := time.Until(state.lastEdit.Add(t.interval))
+	state.inFlight = true
+	t.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	_, err := t.bot.Request(edit)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err = t.applied(key, state, signature, err)
+	t.cond.Broadcast()
+	return err
+}
+
+// Wait blocks until every text submitted for the message so far has been
+// applied or given up on.
+func (t *EditThrottler) Wait(chatID int64, messageID int) {
+	key := messageKey{chatID, messageID}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		state, ok := t.messages[key]
+		if !ok || !(state.pending || state.inFlight) {
+			return
+		}
+		t.cond.Wait()
+	}
+}
+
+// Finish drops the edits of the message not sent yet, waits for the one in
+// flight and forgets the message. It is called once the message got its
+// final text or was deleted.
+func (t *EditThrottler) Finish(chatID int64, messageID int) {
+	key := messageKey{chatID, messageID}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.messages[key]
+	if !ok {
+		return
+	}
+	state.pending = false
+	for state.inFlight {
+		t.cond.Wait()
+	}
+	if t.messages[key] == state {
+		delete(t.messages, key)
+	}
+	t.cond.Broadcast()
+}
+
+// state returns the state of key, creating it if needed, and forgets the
+// states of messages left alone for editStateTTL. t.mu must be held.
+func (t *EditThrottler) state(key messageKey, now time.Time) *editState {
+	if now.Sub(t.lastSweep) >= time.Minute {
+		t.lastSweep = now
+		for k, s := range t.messages {
+			if !s.running && !s.inFlight && now.Sub(s.updated) > editStateTTL {
+				delete(t.messages, k)
+			}
+		}
+	}
+	state, ok := t.messages[key]
+	if !ok {
+		state = &editState{}
+		t.messages[key] = state
+	}
+	state.updated = now
+	return state
+}
+
+// applied records the answer err of Telegram to an edit with signature,
+// returning the error the caller sees. t.mu must be held.
+func (t *EditThrottler) applied(key messageKey, state *editState, signature string, err error) error {
+	state.inFlight = false
+	state.lastEdit = time.Now()
+	switch {
+	case err == nil || isNotModified(err):
+		state.sent = signature
+		return nil
+	case isNotFound(err):
+		log.Debug().Int64("chat_id", key.chatID).Int("message_id", key.messageID).Msg("Message to edit is gone, dropping further edits")
+		state.gone = true
+	}
+	return err
+}
+
+func (t *EditThrottler) run(key messageKey, state *editState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		for state.inFlight {
+			t.cond.Wait()
+		}
+		if !state.pending || state.gone {
+			state.running = false
+			t.cond.Broadcast()
+			return
+		}
+		if wait := time.Until(state.lastEdit.Add(t.interval)); wait > 0 {
+			// Later submissions replace the text meanwhile
+			t.mu.Unlock()
+			time.Sleep(wait)
+			t.mu.Lock()
+			continue
+		}
+		edit := state.desired
+		state.pending = false
+		signature := editSignature(edit)
+		if signature == state.sent {
+			t.cond.Broadcast()
+			continue
+		}
+		state.inFlight = true
+		t.mu.Unlock()
+
+		_, err := t.bot.Request(edit)
+
+		t.mu.Lock()
+		if err = t.applied(key, state, signature, err); err != nil && !state.gone {
+			log.Error().Err(err).Int64("chat_id", key.chatID).Int("message_id", key.messageID).Msg("Failed to edit message")
+		}
+		t.cond.Broadcast()
+	}
+}
+
+// editSignature tells apart edits that change what the message shows.
+func editSignature(edit tgbotapi.EditMessageTextConfig) string {
+	markup := ""
+	if edit.ReplyMarkup != nil {
+		encoded, _ := json.Marshal(edit.ReplyMarkup)
+		markup = string(encoded)
+	}
+	return edit.ParseMode + "\x00" + markup + "\x00" + edit.Text
+}
+
+func isNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), "message to edit not found")
+}
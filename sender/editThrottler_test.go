@@ -0,0 +1,158 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeEditor records the edits it is asked for, failing those whose text
+// has an error set.
+type fakeEditor struct {
+	mu       sync.Mutex
+	texts    []string
+	errs     map[string]error
+	inFlight int
+	overlap  bool
+}
+
+func (f *fakeEditor) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	edit := c.(tgbotapi.EditMessageTextConfig)
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > 1 {
+		f.overlap = true
+	}
+	f.texts = append(f.texts, edit.Text)
+	err := f.errs[edit.Text]
+	f.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	return &tgbotapi.APIResponse{Ok: err == nil}, err
+}
+
+func (f *fakeEditor) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.texts...)
+}
+
+func TestEditThrottlerBoundsEditsUnderContention(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	bot := &fakeEditor{}
+	throttler := NewEditThrottler(bot, interval)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				throttler.Submit(1, 2, fmt.Sprintf("%d/%d", g, i))
+				time.Sleep(time.Millisecond)
+			}
+		}(g)
+	}
+	wg.Wait()
+	throttler.Submit(1, 2, "final")
+	throttler.Wait(1, 2)
+	elapsed := time.Since(start)
+
+	calls := bot.calls()
+	if limit := int(elapsed/interval) + 2; len(calls) > limit {
+		t.Errorf("%d edits in %s, want at most %d", len(calls), elapsed, limit)
+	}
+	if last := calls[len(calls)-1]; last != "final" {
+		t.Errorf("last edit = %q, want the last submitted text", last)
+	}
+	if bot.overlap {
+		t.Error("two edits of the message were in flight at once")
+	}
+}
+
+func TestEditThrottlerSkipsUnchangedText(t *testing.T) {
+	bot := &fakeEditor{errs: map[string]error{"b": errors.New("Bad Request: message is not modified")}}
+	throttler := NewEditThrottler(bot, time.Millisecond)
+
+	throttler.Submit(1, 2, "a")
+	throttler.Wait(1, 2)
+	// Long enough for the worker to go idle, the message is remembered anyway
+	time.Sleep(10 * time.Millisecond)
+	throttler.Submit(1, 2, "a")
+	throttler.Wait(1, 2)
+	if calls := bot.calls(); len(calls) != 1 {
+		t.Fatalf("edits = %q, want the unchanged text sent once", calls)
+	}
+
+	// Not modified means Telegram already shows the text
+	throttler.Submit(1, 2, "b")
+	throttler.Wait(1, 2)
+	time.Sleep(10 * time.Millisecond)
+	if err := throttler.Edit(tgbotapi.NewEditMessageText(1, 2, "b")); err != nil {
+		t.Errorf("Edit of the text shown = %v, want nil", err)
+	}
+	if calls := bot.calls(); len(calls) != 2 {
+		t.Errorf("edits = %q, want the not modified text sent once", calls)
+	}
+}
+
+func TestEditThrottlerStopsEditingGoneMessages(t *testing.T) {
+	bot := &fakeEditor{errs: map[string]error{"a": errors.New("Bad Request: message to edit not found")}}
+	throttler := NewEditThrottler(bot, time.Millisecond)
+
+	throttler.Submit(1, 2, "a")
+	throttler.Wait(1, 2)
+	time.Sleep(10 * time.Millisecond)
+	throttler.Submit(1, 2, "b")
+	throttler.Wait(1, 2)
+	if err := throttler.Edit(tgbotapi.NewEditMessageText(1, 2, "c")); err == nil {
+		t.Error("Edit of a gone message succeeded")
+	}
+	if calls := bot.calls(); len(calls) != 1 {
+		t.Errorf("edits = %q, want none after the message was gone", calls)
+	}
+}
+
+func TestEditThrottlerEditSupersedesSubmitted(t *testing.T) {
+	bot := &fakeEditor{}
+	throttler := NewEditThrottler(bot, 50*time.Millisecond)
+
+	throttler.Submit(1, 2, "progress 1")
+	throttler.Wait(1, 2)
+	// Waits for the interval, the worker holds it back as well
+	throttler.Submit(1, 2, "progress 2")
+	if err := throttler.Edit(tgbotapi.NewEditMessageText(1, 2, "done")); err != nil {
+		t.Fatal(err)
+	}
+	throttler.Finish(1, 2)
+	throttler.Submit(3, 4, "other")
+	throttler.Wait(3, 4)
+
+	want := []string{"progress 1", "done", "other"}
+	if calls := bot.calls(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("edits = %q, want %q", calls, want)
+	}
+}
+
+func TestEditThrottlerFinishDropsPending(t *testing.T) {
+	bot := &fakeEditor{}
+	throttler := NewEditThrottler(bot, 30*time.Millisecond)
+
+	throttler.Submit(1, 2, "a")
+	throttler.Wait(1, 2)
+	throttler.Submit(1, 2, "b")
+	throttler.Finish(1, 2)
+	time.Sleep(60 * time.Millisecond)
+	if calls := bot.calls(); len(calls) != 1 {
+		t.Errorf("edits = %q, want nothing sent after Finish", calls)
+	}
+}
@@ -0,0 +1,59 @@
+package sender
+
+import (
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Sender is the part of tgbotapi.BotAPI used to send messages.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// MigratedChatID returns the supergroup ID carried by err when the request
+// failed because the group was upgraded to a supergroup, or 0.
+func MigratedChatID(err error) int64 {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.MigrateToChatID
+	}
+	return 0
+}
+
+// ChatMigrator is a store keyed by chat that can move a chat to a new ID.
+type ChatMigrator interface {
+	MigrateChat(fromChatID, toChatID int64) error
+}
+
+// ChatStores are moved to the new ID of every upgraded group, so that its
+// settings and pending transcriptions follow it.
+var ChatStores []ChatMigrator
+
+// ChatMigrated records that a group chat continues as a supergroup under a
+// new ID. It is shared by the migration service message and by sends that
+// fail with a migration error, so it may be told about a chat more than once.
+func ChatMigrated(fromChatID, toChatID int64) {
+	log.Info().Int64("chat_id", fromChatID).Int64("migrate_to_chat_id", toChatID).Msg("Group chat was upgraded to a supergroup")
+	for _, store := range ChatStores {
+		if err := store.MigrateChat(fromChatID, toChatID); err != nil {
+			log.Error().Err(err).Int64("chat_id", fromChatID).Int64("migrate_to_chat_id", toChatID).Msg("Failed to move chat to its new ID")
+		}
+	}
+}
+
+// SendMessage sends msg, retrying once against the new chat ID when the
+// group was upgraded to a supergroup while the message was being prepared.
+func SendMessage(bot Sender, msg tgbotapi.MessageConfig) (tgbotapi.Message, error) {
+	sent, err := bot.Send(msg)
+	newChatID := MigratedChatID(err)
+	if newChatID == 0 {
+		return sent, err
+	}
+	ChatMigrated(msg.ChatID, newChatID)
+	msg.ChatID = newChatID
+	// The original message stays in the old chat, so it cannot be replied to
+	msg.ReplyToMessageID = 0
+	return bot.Send(msg)
+}
@@ -0,0 +1,57 @@
+package sender
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeChatStore records the migrations it is told about.
+type fakeChatStore struct {
+	moves [][2]int64
+}
+
+func (f *fakeChatStore) MigrateChat(fromChatID, toChatID int64) error {
+	f.moves = append(f.moves, [2]int64{fromChatID, toChatID})
+	return nil
+}
+
+// migratingSender fails sends to chat from with a migration error.
+type migratingSender struct {
+	from, to int64
+	sent     []tgbotapi.MessageConfig
+}
+
+func (s *migratingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg := c.(tgbotapi.MessageConfig)
+	s.sent = append(s.sent, msg)
+	if msg.ChatID == s.from {
+		return tgbotapi.Message{}, &tgbotapi.Error{Message: "Bad Request: group chat was upgraded to a supergroup chat",
+			ResponseParameters: tgbotapi.ResponseParameters{MigrateToChatID: s.to}}
+	}
+	return tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: msg.ChatID}}, nil
+}
+
+func TestSendMessageFollowsMigratedChat(t *testing.T) {
+	store := &fakeChatStore{}
+	old := ChatStores
+	ChatStores = []ChatMigrator{store}
+	t.Cleanup(func() { ChatStores = old })
+
+	bot := &migratingSender{from: -5, to: -1005}
+	msg := tgbotapi.NewMessage(-5, "text")
+	msg.ReplyToMessageID = 3
+	sent, err := SendMessage(bot, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Chat.ID != -1005 {
+		t.Errorf("sent to %d, want the supergroup", sent.Chat.ID)
+	}
+	if len(bot.sent) != 2 || bot.sent[1].ReplyToMessageID != 0 {
+		t.Errorf("sends = %+v, want one retry that replies to nothing", bot.sent)
+	}
+	if len(store.moves) != 1 || store.moves[0] != [2]int64{-5, -1005} {
+		t.Errorf("stores moved %v, want the group moved to the supergroup", store.moves)
+	}
+}
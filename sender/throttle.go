@@ -0,0 +1,167 @@
+package sender
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var SendRetryCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "telegram_send_retries_total",
+		Help: "Total number of Telegram requests retried after a 429.",
+	},
+)
+
+// SendAttempts is how often a request rejected with 429 is tried in total.
+var SendAttempts = 3
+
+// maxRetryAfter caps how long a single retry waits, longer requests to back
+// off fail instead of stalling the handler.
+const maxRetryAfter = time.Minute
+
+// Bot is the part of tgbotapi.BotAPI used to talk to Telegram.
+type Bot interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+// Limiter paces outgoing messages. Wait blocks until a message may be sent
+// to chatID.
+type Limiter interface {
+	Wait(chatID int64)
+}
+
+// Throttled sends through bot, pacing messages with a Limiter and retrying
+// requests Telegram rejects with a retry_after. Messages and documents
+// replying to a message in a forum topic are posted in that topic.
+type Throttled struct {
+	bot     API
+	limiter Limiter
+	topics  *Topics
+}
+
+// NewThrottled wraps bot so that messages go through limiter and stay in
+// the topics of the messages they reply to, nil knows no topics.
+func NewThrottled(bot API, limiter Limiter, topics *Topics) *Throttled {
+	return &Throttled{bot: bot, limiter: limiter, topics: topics}
+}
+
+func (t *Throttled) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var sent tgbotapi.Message
+	threadID := t.topics.threadOf(c)
+	err := t.retry(c, func() (err error) {
+		if threadID != 0 {
+			sent, err = sendInTopic(t.bot, c, threadID)
+		} else {
+			sent, err = t.bot.Send(c)
+		}
+		return err
+	})
+	if err == nil && sent.Chat != nil {
+		// Later parts of a transcription reply to the first one
+		t.topics.Remember(sent.Chat.ID, sent.MessageID, threadID)
+	}
+	return sent, err
+}
+
+func (t *Throttled) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := t.retry(c, func() (err error) {
+		resp, err = t.bot.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+func (t *Throttled) retry(c tgbotapi.Chattable, do func() error) error {
+	chatID, paced := pacedChat(c)
+	for attempt := 1; ; attempt++ {
+		if paced {
+			t.limiter.Wait(chatID)
+		}
+		err := do()
+		var apiErr *tgbotapi.Error
+		if !errors.As(err, &apiErr) || apiErr.RetryAfter <= 0 || attempt >= SendAttempts {
+			return err
+		}
+		delay := time.Duration(apiErr.RetryAfter) * time.Second
+		if delay > maxRetryAfter {
+			return err
+		}
+		SendRetryCounter.Inc()
+		log.Warn().Int64("chat_id", chatID).Dur("retry_after", delay).Int("attempt", attempt).
+			Msg("Telegram asked to slow down, retrying")
+		time.Sleep(delay)
+	}
+}
+
+// pacedChat returns the chat a request posts or edits a message in. Chat
+// actions, deletions and requests not aimed at a chat are not paced.
+func pacedChat(c tgbotapi.Chattable) (int64, bool) {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return c.ChatID, true
+	case tgbotapi.EditMessageTextConfig:
+		return c.ChatID, true
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return c.ChatID, true
+	case tgbotapi.DocumentConfig:
+		return c.ChatID, true
+	}
+	return 0, false
+}
+
+// RateLimiter spaces messages evenly: at most one per globalInterval
+// overall and one per chatInterval in each chat.
+type RateLimiter struct {
+	globalInterval time.Duration
+	chatInterval   time.Duration
+
+	mu         sync.Mutex
+	globalNext time.Time
+	chatNext   map[int64]time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond messages overall and
+// one per chatInterval within a chat.
+func NewRateLimiter(perSecond int, chatInterval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		globalInterval: time.Second / time.Duration(perSecond),
+		chatInterval:   chatInterval,
+		chatNext:       make(map[int64]time.Time),
+	}
+}
+
+func (l *RateLimiter) Wait(chatID int64) {
+	if delay := l.reserve(chatID, time.Now()); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// reserve books the next free slot for chatID and returns how long until
+// it starts.
+func (l *RateLimiter) reserve(chatID int64, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slot := now
+	if l.globalNext.After(slot) {
+		slot = l.globalNext
+	}
+	if next := l.chatNext[chatID]; next.After(slot) {
+		slot = next
+	}
+	l.globalNext = slot.Add(l.globalInterval)
+	// Chats whose slot has passed are unconstrained, forget them
+	for id, next := range l.chatNext {
+		if !next.After(now) {
+			delete(l.chatNext, id)
+		}
+	}
+	l.chatNext[chatID] = slot.Add(l.chatInterval)
+	return slot.Sub(now)
+}
@@ -0,0 +1,72 @@
+package sender
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRateLimiterSpacesMessagesInAChat(t *testing.T) {
+	l := NewRateLimiter(1000, time.Second)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second} {
+		if got := l.reserve(7, now); got != want {
+			t.Errorf("message %d waits %s, want %s", i+1, got, want)
+		}
+	}
+	// Once the chat's slots have passed it is unconstrained again
+	if got := l.reserve(7, now.Add(time.Minute)); got != 0 {
+		t.Errorf("a message a minute later waits %s", got)
+	}
+}
+
+func TestRateLimiterBoundsTheGlobalRate(t *testing.T) {
+	l := NewRateLimiter(30, time.Second)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	interval := time.Second / 30
+	for chatID := int64(1); chatID <= 5; chatID++ {
+		want := time.Duration(chatID-1) * interval
+		if got := l.reserve(chatID, now); got != want {
+			t.Errorf("message to chat %d waits %s, want %s", chatID, got, want)
+		}
+	}
+	// The chat interval still applies on top of the global spacing
+	if got := l.reserve(1, now); got != time.Second {
+		t.Errorf("second message to chat 1 waits %s, want a second", got)
+	}
+	if got := l.reserve(6, now.Add(time.Second)); got != interval {
+		t.Errorf("a new chat waits %s behind the booked slots, want %s", got, interval)
+	}
+}
+
+func TestRateLimiterForgetsIdleChats(t *testing.T) {
+	l := NewRateLimiter(1000, time.Second)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for chatID := int64(1); chatID <= 100; chatID++ {
+		l.reserve(chatID, now)
+	}
+	l.reserve(0, now.Add(time.Hour))
+	if len(l.chatNext) != 1 {
+		t.Errorf("%d chats remembered, want only the latest", len(l.chatNext))
+	}
+}
+
+// countingLimiter records the chats it was asked to pace.
+type countingLimiter struct {
+	chats []int64
+}
+
+func (l *countingLimiter) Wait(chatID int64) { l.chats = append(l.chats, chatID) }
+
+func TestThrottledPacesOnlyMessages(t *testing.T) {
+	limiter := &countingLimiter{}
+	throttled := NewThrottled(&fakeAPI{}, limiter, nil)
+	throttled.Send(tgbotapi.NewMessage(7, "transcript"))
+	throttled.Send(tgbotapi.NewEditMessageText(7, 1, "edited"))
+	throttled.Request(tgbotapi.NewChatAction(7, tgbotapi.ChatTyping))
+	throttled.Request(tgbotapi.NewDeleteMessage(7, 1))
+	if len(limiter.chats) != 2 || limiter.chats[0] != 7 || limiter.chats[1] != 7 {
+		t.Errorf("paced %v, want the message and the edit in chat 7", limiter.chats)
+	}
+}
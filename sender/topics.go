@@ -0,0 +1,172 @@
+package sender
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// API is the part of tgbotapi.BotAPI Throttled sends through. The raw
+// requests carry what the library's configs have no field for.
+type API interface {
+	Bot
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error)
+}
+
+// topicTTL is how long the topic of a message is remembered, as long as the
+// buttons under a transcription work.
+const topicTTL = 24 * time.Hour
+
+type topic struct {
+	threadID int
+	seen     time.Time
+}
+
+// Topics remembers the forum topic of messages, which the Bot API library
+// drops, so that replies are posted in the topic of the message they answer.
+// Replying alone is not enough: a reply to a message deleted meanwhile
+// lands in the General topic. A nil Topics knows no topics.
+type Topics struct {
+	mu        sync.Mutex
+	threads   map[messageKey]topic
+	lastSweep time.Time
+}
+
+// NewTopics returns a Topics that knows no message yet.
+func NewTopics() *Topics {
+	return &Topics{threads: make(map[messageKey]topic)}
+}
+
+// topicUpdate is the part of an update the library does not decode.
+type topicUpdate struct {
+	Message *struct {
+		MessageID int `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		ThreadID       int  `json:"message_thread_id"`
+		IsTopicMessage bool `json:"is_topic_message"`
+	} `json:"message"`
+}
+
+// RememberUpdate records the topic of the message in the update raw, as
+// Telegram sent it. Threads of replies outside forums are no topics and
+// are left out, Telegram refuses to post in them.
+func (t *Topics) RememberUpdate(raw []byte) error {
+	var update topicUpdate
+	if err := json.Unmarshal(raw, &update); err != nil {
+		return err
+	}
+	if message := update.Message; message != nil && message.IsTopicMessage {
+		t.Remember(message.Chat.ID, message.MessageID, message.ThreadID)
+	}
+	return nil
+}
+
+// Remember records that the message is in the topic threadID, 0 is none.
+func (t *Topics) Remember(chatID int64, messageID, threadID int) {
+	if t == nil || threadID == 0 {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.lastSweep) >= time.Minute {
+		t.lastSweep = now
+		for key, topic := range t.threads {
+			if now.Sub(topic.seen) > topicTTL {
+				delete(t.threads, key)
+			}
+		}
+	}
+	t.threads[messageKey{chatID, messageID}] = topic{threadID: threadID, seen: now}
+}
+
+// Thread returns the topic the message is in, 0 if it is in none or was
+// never seen.
+func (t *Topics) Thread(chatID int64, messageID int) int {
+	if t == nil || messageID == 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.threads[messageKey{chatID, messageID}].threadID
+}
+
+// threadOf returns the topic c should be posted in, the one of the message
+// it replies to, or 0.
+func (t *Topics) threadOf(c tgbotapi.Chattable) int {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return t.Thread(c.ChatID, c.ReplyToMessageID)
+	case tgbotapi.DocumentConfig:
+		return t.Thread(c.ChatID, c.ReplyToMessageID)
+	}
+	return 0
+}
+
+// sendInTopic sends c, a config threadOf returned a topic for, in topic
+// threadID. The library's configs cannot carry message_thread_id, so the
+// request is made by hand with the parameters they would send.
+func sendInTopic(bot API, c tgbotapi.Chattable, threadID int) (tgbotapi.Message, error) {
+	var resp *tgbotapi.APIResponse
+	var err error
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		resp, err = sendMessageInTopic(bot, c, threadID)
+	case tgbotapi.DocumentConfig:
+		resp, err = sendDocumentInTopic(bot, c, threadID)
+	default:
+		return bot.Send(c)
+	}
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	var sent tgbotapi.Message
+	err = json.Unmarshal(resp.Result, &sent)
+	return sent, err
+}
+
+func sendMessageInTopic(bot API, c tgbotapi.MessageConfig, threadID int) (*tgbotapi.APIResponse, error) {
+	params, err := chatParams(c.BaseChat, threadID)
+	if err != nil {
+		return nil, err
+	}
+	params.AddNonEmpty("text", c.Text)
+	params.AddBool("disable_web_page_preview", c.DisableWebPagePreview)
+	params.AddNonEmpty("parse_mode", c.ParseMode)
+	if err := params.AddInterface("entities", c.Entities); err != nil {
+		return nil, err
+	}
+	return bot.MakeRequest("sendMessage", params)
+}
+
+func sendDocumentInTopic(bot API, c tgbotapi.DocumentConfig, threadID int) (*tgbotapi.APIResponse, error) {
+	params, err := chatParams(c.BaseChat, threadID)
+	if err != nil {
+		return nil, err
+	}
+	params.AddNonEmpty("caption", c.Caption)
+	params.AddNonEmpty("parse_mode", c.ParseMode)
+	params.AddBool("disable_content_type_detection", c.DisableContentTypeDetection)
+	files := []tgbotapi.RequestFile{{Name: "document", Data: c.File}}
+	if c.Thumb != nil {
+		files = append(files, tgbotapi.RequestFile{Name: "thumb", Data: c.Thumb})
+	}
+	return bot.UploadFiles("sendDocument", params, files)
+}
+
+// chatParams are the parameters of chat in topic threadID.
+func chatParams(chat tgbotapi.BaseChat, threadID int) (tgbotapi.Params, error) {
+	params := make(tgbotapi.Params)
+	params.AddFirstValid("chat_id", chat.ChatID, chat.ChannelUsername)
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonZero("reply_to_message_id", chat.ReplyToMessageID)
+	params.AddBool("disable_notification", chat.DisableNotification)
+	params.AddBool("allow_sending_without_reply", chat.AllowSendingWithoutReply)
+	err := params.AddInterface("reply_markup", chat.ReplyMarkup)
+	return params, err
+}
@@ -0,0 +1,132 @@
+package sender
+
+import (
+	"encoding/json"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeAPI records how messages were sent: through the library's configs or
+// as raw requests with their parameters.
+type fakeAPI struct {
+	sent    []tgbotapi.Chattable
+	raw     []tgbotapi.Params
+	uploads []string
+	nextID  int
+}
+
+func (f *fakeAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.sent = append(f.sent, c)
+	f.nextID++
+	chatID, _ := pacedChat(c)
+	return tgbotapi.Message{MessageID: f.nextID, Chat: &tgbotapi.Chat{ID: chatID}}, nil
+}
+
+func (f *fakeAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	f.sent = append(f.sent, c)
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeAPI) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	f.raw = append(f.raw, params)
+	return f.answer(params)
+}
+
+func (f *fakeAPI) UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error) {
+	f.raw = append(f.raw, params)
+	for _, file := range files {
+		f.uploads = append(f.uploads, file.Name)
+	}
+	return f.answer(params)
+}
+
+func (f *fakeAPI) answer(params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	f.nextID++
+	result, err := json.Marshal(map[string]any{"message_id": f.nextID, "chat": map[string]any{"id": json.RawMessage(params["chat_id"])}})
+	return &tgbotapi.APIResponse{Ok: true, Result: result}, err
+}
+
+// noLimit lets every message through right away.
+type noLimit struct{}
+
+func (noLimit) Wait(chatID int64) {}
+
+func TestRememberUpdateKeepsOnlyForumTopics(t *testing.T) {
+	topics := NewTopics()
+	for _, update := range []string{
+		`{"update_id": 1, "message": {"message_id": 5, "chat": {"id": -100}, "message_thread_id": 42, "is_topic_message": true}}`,
+		// A reply thread outside a forum
+		`{"update_id": 2, "message": {"message_id": 6, "chat": {"id": -100}, "message_thread_id": 3}}`,
+		`{"update_id": 3, "callback_query": {"id": "q"}}`,
+	} {
+		if err := topics.RememberUpdate([]byte(update)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := topics.Thread(-100, 5); got != 42 {
+		t.Errorf("thread of the topic message = %d, want 42", got)
+	}
+	if got := topics.Thread(-100, 6); got != 0 {
+		t.Errorf("thread of a plain reply = %d, want none", got)
+	}
+}
+
+func TestThrottledPostsRepliesInTheirTopic(t *testing.T) {
+	bot := &fakeAPI{}
+	topics := NewTopics()
+	topics.Remember(-100, 5, 42)
+	throttled := NewThrottled(bot, noLimit{}, topics)
+
+	reply := tgbotapi.NewMessage(-100, "transcript")
+	reply.ReplyToMessageID = 5
+	reply.AllowSendingWithoutReply = true
+	reply.ParseMode = tgbotapi.ModeHTML
+	sent, err := throttled.Send(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.raw) != 1 {
+		t.Fatalf("raw requests = %v, want the reply sent by hand", bot.raw)
+	}
+	params := bot.raw[0]
+	for key, want := range map[string]string{
+		"chat_id": "-100", "message_thread_id": "42", "reply_to_message_id": "5",
+		"allow_sending_without_reply": "true", "text": "transcript", "parse_mode": tgbotapi.ModeHTML,
+	} {
+		if params[key] != want {
+			t.Errorf("%s = %q, want %q", key, params[key], want)
+		}
+	}
+
+	// The continuation replies to the first part, not to the audio
+	doc := tgbotapi.NewDocument(-100, tgbotapi.FileBytes{Name: "transcript.txt", Bytes: []byte("text")})
+	doc.ReplyToMessageID = sent.MessageID
+	doc.Caption = "caption"
+	if _, err := throttled.Send(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.raw) != 2 || bot.raw[1]["message_thread_id"] != "42" || bot.raw[1]["caption"] != "caption" {
+		t.Errorf("document params = %v, want it in topic 42", bot.raw[1:])
+	}
+	if len(bot.uploads) != 1 || bot.uploads[0] != "document" {
+		t.Errorf("uploads = %v, want the document", bot.uploads)
+	}
+}
+
+func TestThrottledLeavesMessagesOutsideTopicsAlone(t *testing.T) {
+	bot := &fakeAPI{}
+	throttled := NewThrottled(bot, noLimit{}, NewTopics())
+
+	reply := tgbotapi.NewMessage(7, "transcript")
+	reply.ReplyToMessageID = 5
+	if _, err := throttled.Send(reply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewThrottled(bot, noLimit{}, nil).Send(reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.raw) != 0 || len(bot.sent) != 2 {
+		t.Errorf("raw = %v, sent = %d; want both sent through the library without a thread", bot.raw, len(bot.sent))
+	}
+}
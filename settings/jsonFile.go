@@ -0,0 +1,47 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// jsonFile is the layout of the settings file of older releases, read from
+// SETTINGS_FILE.
+type jsonFile struct {
+	Languages map[int64]string `json:"languages"`
+}
+
+// ImportJSONFile copies the languages of the settings file at path into
+// store, leaving alone the chats that have settings already, and renames
+// the file so it is imported once. It returns the number of chats imported,
+// 0 when there is no file.
+func ImportJSONFile(store Store, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var content jsonFile
+	if err := json.Unmarshal(data, &content); err != nil {
+		return 0, fmt.Errorf("parse settings file %s: %w", path, err)
+	}
+	imported := 0
+	for chatID, lang := range content.Languages {
+		current, err := store.Get(chatID)
+		if err != nil {
+			return imported, err
+		}
+		if current != (Settings{}) || lang == "" {
+			continue
+		}
+		if err := store.Set(chatID, Settings{Language: lang}); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	// A file left in place would bring back languages cleared later on
+	return imported, os.Rename(path, path+".imported")
+}
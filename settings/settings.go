@@ -0,0 +1,111 @@
+// Package settings keeps per-chat preferences such as a forced recognition
+// language.
+package settings
+
+import (
+	"sync"
+)
+
+// Settings are the preferences of one chat. The zero value keeps the bot's
+// defaults.
+type Settings struct {
+	// Language forces the recognition language, "" detects it.
+	Language string
+	// Placeholders overrides whether a placeholder reply is shown while
+	// transcribing, nil keeps the bot's default.
+	Placeholders *bool
+	// SRT sends transcriptions as subtitle files when the backend returns
+	// timestamps.
+	SRT bool
+	// DocumentThreshold overrides the length above which transcriptions are
+	// sent as a text file, 0 never sends files and nil keeps the bot's
+	// default.
+	DocumentThreshold *int
+	// UILanguage forces the language of the bot's replies, "" follows the
+	// Telegram app of whoever writes.
+	UILanguage string
+	// Mode chooses which audio messages are transcribed, "" keeps the
+	// default of the chat type.
+	Mode string
+}
+
+// Transcription modes.
+const (
+	// ModeAlways transcribes every audio message.
+	ModeAlways = "always"
+	// ModeOnCommand transcribes audio only when asked to in a reply.
+	ModeOnCommand = "on_command"
+	// ModeOff transcribes nothing.
+	ModeOff = "off"
+)
+
+// Modes lists the transcription modes.
+var Modes = []string{ModeAlways, ModeOnCommand, ModeOff}
+
+// TranscriptionMode returns Mode or, when it is unset, ModeOnCommand in
+// groups and ModeAlways in private chats.
+func (s Settings) TranscriptionMode(group bool) string {
+	if s.Mode != "" {
+		return s.Mode
+	}
+	if group {
+		return ModeOnCommand
+	}
+	return ModeAlways
+}
+
+// Store keeps per-chat settings. Implementations are safe for concurrent
+// use.
+type Store interface {
+	// Get returns the settings of chatID, the zero Settings if none were
+	// stored.
+	Get(chatID int64) (Settings, error)
+	// Set replaces the settings of chatID.
+	Set(chatID int64, settings Settings) error
+	// MigrateChat moves the settings of fromChatID to toChatID, the ID the
+	// group continues under as a supergroup. Settings already made in the
+	// new chat are kept.
+	MigrateChat(fromChatID, toChatID int64) error
+}
+
+// Memory is a Store that forgets everything on restart.
+type Memory struct {
+	mu    sync.RWMutex
+	chats map[int64]Settings
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{chats: make(map[int64]Settings)}
+}
+
+func (m *Memory) Get(chatID int64) (Settings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.chats[chatID], nil
+}
+
+func (m *Memory) Set(chatID int64, settings Settings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if settings == (Settings{}) {
+		delete(m.chats, chatID)
+	} else {
+		m.chats[chatID] = settings
+	}
+	return nil
+}
+
+func (m *Memory) MigrateChat(fromChatID, toChatID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	settings, ok := m.chats[fromChatID]
+	if !ok {
+		return nil
+	}
+	if _, ok := m.chats[toChatID]; !ok {
+		m.chats[toChatID] = settings
+	}
+	delete(m.chats, fromChatID)
+	return nil
+}
@@ -0,0 +1,125 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "settings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStoresMigrateChats(t *testing.T) {
+	for name, store := range map[string]Store{"memory": NewMemory(), "sqlite": openSQLite(t)} {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Set(-5, Settings{Language: "ru"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.MigrateChat(-5, -1005); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.Get(-1005); got.Language != "ru" {
+				t.Errorf("new chat has %+v, want the settings of the group", got)
+			}
+			if got, _ := store.Get(-5); got != (Settings{}) {
+				t.Errorf("old chat still has %+v", got)
+			}
+
+			// Told again, settings made in the supergroup meanwhile win
+			if err := store.Set(-1005, Settings{Language: "en"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Set(-5, Settings{Language: "de"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.MigrateChat(-5, -1005); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.Get(-1005); got.Language != "en" {
+				t.Errorf("new chat has %+v, want its own settings kept", got)
+			}
+			if got, _ := store.Get(-5); got != (Settings{}) {
+				t.Errorf("old chat still has %+v", got)
+			}
+		})
+	}
+}
+
+func TestStoresRoundTripSettings(t *testing.T) {
+	off, threshold := false, 0
+	want := Settings{Language: "ru", Placeholders: &off, SRT: true, DocumentThreshold: &threshold, UILanguage: "en", Mode: ModeOnCommand}
+	path := filepath.Join(t.TempDir(), "settings.db")
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for name, store := range map[string]Store{"memory": NewMemory(), "sqlite": db} {
+		t.Run(name, func(t *testing.T) {
+			if got, err := store.Get(1); err != nil || got != (Settings{}) {
+				t.Fatalf("Get of a new chat = %+v, %v", got, err)
+			}
+			if err := store.Set(1, want); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.Get(1); err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("Get = %+v, %v, want %+v", got, err, want)
+			}
+			if err := store.Set(2, Settings{Language: "de"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Set(2, Settings{}); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.Get(2); got != (Settings{}) {
+				t.Errorf("Get after reset = %+v", got)
+			}
+		})
+	}
+
+	db.Close()
+	reopened, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got, err := reopened.Get(1); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Get after reopening = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func TestImportJSONFile(t *testing.T) {
+	store := openSQLite(t)
+	if err := store.Set(2, Settings{Language: "en"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte(`{"languages": {"1": "ru", "2": "de"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ImportJSONFile(store, path)
+	if err != nil || imported != 1 {
+		t.Fatalf("ImportJSONFile = %d, %v, want 1 chat", imported, err)
+	}
+	if got, _ := store.Get(1); got.Language != "ru" {
+		t.Errorf("chat 1 has %+v, want the language of the file", got)
+	}
+	if got, _ := store.Get(2); got.Language != "en" {
+		t.Errorf("chat 2 has %+v, want its stored settings kept", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("settings file left in place: %v", err)
+	}
+	if imported, err := ImportJSONFile(store, path); err != nil || imported != 0 {
+		t.Errorf("second ImportJSONFile = %d, %v, want nothing to import", imported, err)
+	}
+}
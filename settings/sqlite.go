@@ -0,0 +1,135 @@
+package settings
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite" // Registers the pure-Go "sqlite" driver
+)
+
+// migrations bring the schema up to date in order; the number of applied
+// ones is kept in the user_version pragma. Only ever append to this list.
+var migrations = []string{
+	`CREATE TABLE chat_settings (
+		chat_id      INTEGER PRIMARY KEY,
+		language     TEXT NOT NULL DEFAULT '',
+		placeholders INTEGER
+	)`,
+	`ALTER TABLE chat_settings ADD COLUMN srt INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE chat_settings ADD COLUMN document_threshold INTEGER`,
+	`ALTER TABLE chat_settings ADD COLUMN ui_language TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE chat_settings ADD COLUMN mode TEXT NOT NULL DEFAULT ''`,
+}
+
+// SQLite is a Store persisted in a SQLite database.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database at path and migrates its schema.
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, serializing connections avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate settings database %s: %w", path, err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this binary knows (%d)", version, len(migrations))
+	}
+	for i, migration := range migrations[version:] {
+		if _, err := tx.Exec(migration); err != nil {
+			return fmt.Errorf("migration %d: %w", version+i+1, err)
+		}
+	}
+	// Pragmas do not take placeholders
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) Get(chatID int64) (Settings, error) {
+	var settings Settings
+	var placeholders sql.NullBool
+	var documentThreshold sql.NullInt64
+	err := s.db.QueryRow("SELECT language, placeholders, srt, document_threshold, ui_language, mode FROM chat_settings WHERE chat_id = ?", chatID).
+		Scan(&settings.Language, &placeholders, &settings.SRT, &documentThreshold, &settings.UILanguage, &settings.Mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, err
+	}
+	if placeholders.Valid {
+		settings.Placeholders = &placeholders.Bool
+	}
+	if documentThreshold.Valid {
+		threshold := int(documentThreshold.Int64)
+		settings.DocumentThreshold = &threshold
+	}
+	return settings, nil
+}
+
+func (s *SQLite) Set(chatID int64, settings Settings) error {
+	var placeholders sql.NullBool
+	if settings.Placeholders != nil {
+		placeholders = sql.NullBool{Bool: *settings.Placeholders, Valid: true}
+	}
+	var documentThreshold sql.NullInt64
+	if settings.DocumentThreshold != nil {
+		documentThreshold = sql.NullInt64{Int64: int64(*settings.DocumentThreshold), Valid: true}
+	}
+	_, err := s.db.Exec(`INSERT INTO chat_settings (chat_id, language, placeholders, srt, document_threshold, ui_language, mode) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			language = excluded.language, placeholders = excluded.placeholders, srt = excluded.srt,
+			document_threshold = excluded.document_threshold, ui_language = excluded.ui_language, mode = excluded.mode`,
+		chatID, settings.Language, placeholders, settings.SRT, documentThreshold, settings.UILanguage, settings.Mode)
+	return err
+}
+
+func (s *SQLite) MigrateChat(fromChatID, toChatID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// OR IGNORE leaves the row alone when the new chat has settings of its own
+	if _, err := tx.Exec("UPDATE OR IGNORE chat_settings SET chat_id = ? WHERE chat_id = ?", toChatID, fromChatID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM chat_settings WHERE chat_id = ?", fromChatID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DB is the database, for other stores that keep their tables next to the
+// settings.
+func (s *SQLite) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
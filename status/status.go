@@ -0,0 +1,162 @@
+// Package status sums up how the running bot is doing, for operators who
+// ask the bot itself rather than the dashboards.
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Reporter reads the status back from the bot's own metrics.
+type Reporter struct {
+	started   time.Time
+	endpoint  string
+	messages  prometheus.Collector // Counter of processed messages with a "status" label
+	cacheHits prometheus.Collector
+	inFlight  prometheus.Collector
+	backends  prometheus.Collector // Gauge of backend health with an "endpoint" label
+}
+
+// NewReporter returns a reporter for a bot started at started, sending
+// audio to endpoint.
+func NewReporter(started time.Time, endpoint string, messages, cacheHits, inFlight, backends prometheus.Collector) *Reporter {
+	return &Reporter{started: started, endpoint: endpoint, messages: messages, cacheHits: cacheHits, inFlight: inFlight, backends: backends}
+}
+
+// Snapshot is the status at one point in time.
+type Snapshot struct {
+	Uptime time.Duration
+	// Messages counts processed messages by status, such as "success" or
+	// "error".
+	Messages  map[string]int
+	InFlight  int
+	CacheHits int
+	Endpoint  string
+	// Backends tells the health of every recognition backend by endpoint.
+	Backends map[string]bool
+}
+
+// Processed returns the number of messages processed, whatever their
+// status.
+func (s Snapshot) Processed() int {
+	total := 0
+	for _, n := range s.Messages {
+		total += n
+	}
+	return total
+}
+
+// CacheHitRatio is the share of processed messages answered from the
+// cache.
+func (s Snapshot) CacheHitRatio() float64 {
+	if processed := s.Processed(); processed > 0 {
+		return float64(s.CacheHits) / float64(processed)
+	}
+	return 0
+}
+
+// String formats the snapshot as a chat message.
+func (s Snapshot) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Uptime: %s\n", s.Uptime.Round(time.Second))
+	fmt.Fprintf(&b, "Messages processed: %d\n", s.Processed())
+	statuses := make([]string, 0, len(s.Messages))
+	for status := range s.Messages {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "• %s: %d\n", status, s.Messages[status])
+	}
+	fmt.Fprintf(&b, "In flight: %d\n", s.InFlight)
+	fmt.Fprintf(&b, "Cache hit ratio: %.1f%%\n", 100*s.CacheHitRatio())
+	if len(s.Backends) <= 1 {
+		fmt.Fprintf(&b, "Recognition endpoint: %s", s.Endpoint)
+		if healthy, ok := s.Backends[s.Endpoint]; ok && !healthy {
+			b.WriteString(" (unhealthy)")
+		}
+		return b.String()
+	}
+	b.WriteString("Recognition endpoints:")
+	endpoints := make([]string, 0, len(s.Backends))
+	for endpoint := range s.Backends {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		health := "healthy"
+		if !s.Backends[endpoint] {
+			health = "unhealthy"
+		}
+		fmt.Fprintf(&b, "\n• %s: %s", endpoint, health)
+	}
+	return b.String()
+}
+
+// Snapshot gathers the status as of now.
+func (r *Reporter) Snapshot(now time.Time) Snapshot {
+	messages := make(map[string]int)
+	for _, m := range collect(r.messages) {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "status" {
+				messages[label.GetValue()] += int(value(m))
+			}
+		}
+	}
+	backends := make(map[string]bool)
+	for _, m := range collect(r.backends) {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "endpoint" {
+				backends[label.GetValue()] = value(m) > 0
+			}
+		}
+	}
+	return Snapshot{
+		Uptime:    now.Sub(r.started),
+		Messages:  messages,
+		InFlight:  int(sum(r.inFlight)),
+		CacheHits: int(sum(r.cacheHits)),
+		Endpoint:  r.endpoint,
+		Backends:  backends,
+	}
+}
+
+// collect reads the current values of every series of collector.
+func collect(collector prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	var metrics []*dto.Metric
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err == nil {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+func sum(collector prometheus.Collector) float64 {
+	total := 0.0
+	for _, m := range collect(collector) {
+		total += value(m)
+	}
+	return total
+}
+
+func value(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	}
+	return 0
+}
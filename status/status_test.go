@@ -0,0 +1,76 @@
+package status
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSnapshotReadsTheMetrics(t *testing.T) {
+	messages := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "messages"}, []string{"status", "source"})
+	messages.WithLabelValues("success", "voice").Add(3)
+	messages.WithLabelValues("success", "audio").Add(1)
+	messages.WithLabelValues("error", "voice").Add(2)
+	cacheHits := prometheus.NewCounter(prometheus.CounterOpts{Name: "cache_hits"})
+	cacheHits.Add(3)
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight"})
+	inFlight.Set(2)
+	backends := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "backends"}, []string{"endpoint"})
+	backends.WithLabelValues("http://a").Set(1)
+	backends.WithLabelValues("http://b").Set(0)
+
+	started := time.Unix(1700000000, 0)
+	reporter := NewReporter(started, "http://a", messages, cacheHits, inFlight, backends)
+	s := reporter.Snapshot(started.Add(90 * time.Minute))
+
+	if s.Uptime != 90*time.Minute {
+		t.Errorf("uptime %s", s.Uptime)
+	}
+	if s.Messages["success"] != 4 || s.Messages["error"] != 2 || s.Processed() != 6 {
+		t.Errorf("messages %v", s.Messages)
+	}
+	if s.InFlight != 2 || s.CacheHits != 3 || s.CacheHitRatio() != 0.5 {
+		t.Errorf("in flight %d, cache hits %d, ratio %v", s.InFlight, s.CacheHits, s.CacheHitRatio())
+	}
+	if !s.Backends["http://a"] || s.Backends["http://b"] {
+		t.Errorf("backends %v", s.Backends)
+	}
+}
+
+func TestSnapshotString(t *testing.T) {
+	s := Snapshot{
+		Uptime:    time.Hour + 1500*time.Millisecond,
+		Messages:  map[string]int{"success": 3, "error": 1},
+		InFlight:  1,
+		CacheHits: 1,
+		Endpoint:  "http://a",
+	}
+	want := "Uptime: 1h0m2s\n" +
+		"Messages processed: 4\n" +
+		"• error: 1\n" +
+		"• success: 3\n" +
+		"In flight: 1\n" +
+		"Cache hit ratio: 25.0%\n" +
+		"Recognition endpoint: http://a"
+	if got := s.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	s.Backends = map[string]bool{"http://a": false}
+	if got := s.String(); !strings.HasSuffix(got, "Recognition endpoint: http://a (unhealthy)") {
+		t.Errorf("unhealthy endpoint shown as\n%s", got)
+	}
+
+	s.Backends = map[string]bool{"http://b": false, "http://a": true}
+	if got := s.String(); !strings.HasSuffix(got, "Recognition endpoints:\n• http://a: healthy\n• http://b: unhealthy") {
+		t.Errorf("endpoints shown as\n%s", got)
+	}
+}
+
+func TestCacheHitRatioWithoutMessages(t *testing.T) {
+	if ratio := (Snapshot{}).CacheHitRatio(); ratio != 0 {
+		t.Errorf("ratio %v before any message", ratio)
+	}
+}
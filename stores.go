@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/offset"
+	"telegram-sr-bot/pending"
+	"telegram-sr-bot/quota"
+	"telegram-sr-bot/settings"
+)
+
+// stores keep what outlives the handling of a single message.
+type stores struct {
+	settings settings.Store
+	jobs     pending.Store
+	offsets  offset.Store
+	usage    quota.Store
+}
+
+// memoryStores returns stores that forget everything on restart.
+func memoryStores() stores {
+	return stores{settings: settings.NewMemory(), jobs: pending.NewMemory(), offsets: offset.NewMemory(), usage: quota.NewMemory()}
+}
+
+// openStores keeps every store in the SQLite database at path, importing
+// settingsFile into it first if set. The database is closed again if any
+// of its tables cannot be opened.
+func openStores(path, settingsFile string) (stores, *settings.SQLite, error) {
+	db, err := settings.OpenSQLite(path)
+	if err != nil {
+		return stores{}, nil, err
+	}
+	s := stores{settings: db}
+	if settingsFile != "" {
+		imported, err := settings.ImportJSONFile(db, settingsFile)
+		if err != nil {
+			db.Close()
+			return stores{}, nil, fmt.Errorf("import the settings file %s: %w", settingsFile, err)
+		}
+		log.Info().Int("chats", imported).Str("path", settingsFile).Msg("Imported the settings file into the settings database")
+	}
+	// Jobs awaiting a callback survive restarts next to the settings
+	if s.jobs, err = pending.NewSQLite(db.DB()); err != nil {
+		db.Close()
+		return stores{}, nil, fmt.Errorf("open the pending jobs table: %w", err)
+	}
+	if s.offsets, err = offset.NewSQLite(db.DB()); err != nil {
+		db.Close()
+		return stores{}, nil, fmt.Errorf("open the update offset table: %w", err)
+	}
+	if s.usage, err = quota.NewSQLite(db.DB()); err != nil {
+		db.Close()
+		return stores{}, nil, fmt.Errorf("open the quota usage table: %w", err)
+	}
+	return s, db, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenStores(t *testing.T) {
+	dir := t.TempDir()
+	opened, db, err := openStores(filepath.Join(dir, "settings.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if opened.settings == nil || opened.jobs == nil || opened.offsets == nil || opened.usage == nil {
+		t.Errorf("stores %+v, want all of them in the database", opened)
+	}
+}
+
+func TestOpenStoresFails(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := openStores(filepath.Join(dir, "missing", "settings.db"), ""); err == nil {
+		t.Error("opened a database in a missing directory")
+	}
+	broken := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(broken, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := openStores(filepath.Join(dir, "settings.db"), broken); err == nil {
+		t.Error("a broken settings file was imported")
+	}
+}
@@ -0,0 +1,268 @@
+// Package transform implements operator-configured post-processing of
+// recognized text, such as regex replacements or removal of filler words.
+package transform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBudget bounds the total time spent in a chain when the config does
+// not set one.
+const DefaultBudget = 50 * time.Millisecond
+
+// Transform rewrites a transcript recognized in the given language.
+type Transform interface {
+	Name() string
+	Apply(text, lang string) string
+}
+
+// Chain applies transforms in order within a time budget.
+type Chain struct {
+	transforms []Transform
+	budget     time.Duration
+}
+
+type config struct {
+	Budget     string            `yaml:"budget"`
+	Transforms []transformConfig `yaml:"transforms"`
+}
+
+type transformConfig struct {
+	Type        string              `yaml:"type"`
+	Pattern     string              `yaml:"pattern"`
+	Replacement string              `yaml:"replacement"`
+	Dictionary  map[string]string   `yaml:"dictionary"`
+	Fillers     map[string][]string `yaml:"fillers"`
+}
+
+// Load reads a chain definition from a YAML file.
+func Load(path string) (*Chain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse builds a chain from its YAML definition, reporting every invalid
+// entry at once.
+func Parse(data []byte) (*Chain, error) {
+	var cfg config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid transform config: %w", err)
+	}
+
+	chain := &Chain{budget: DefaultBudget}
+	var errs []error
+	if cfg.Budget != "" {
+		budget, err := time.ParseDuration(cfg.Budget)
+		if err != nil || budget <= 0 {
+			errs = append(errs, fmt.Errorf("budget: invalid duration %q", cfg.Budget))
+		}
+		chain.budget = budget
+	}
+	for i, tc := range cfg.Transforms {
+		t, err := newTransform(tc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transforms[%d] (%s): %w", i, tc.Type, err))
+			continue
+		}
+		chain.transforms = append(chain.transforms, t)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func newTransform(tc transformConfig) (Transform, error) {
+	switch tc.Type {
+	case "regex_replace":
+		if tc.Pattern == "" {
+			return nil, errors.New("pattern is required")
+		}
+		re, err := regexp.Compile(tc.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &regexReplace{re: re, replacement: tc.Replacement}, nil
+	case "dictionary_replace":
+		if len(tc.Dictionary) == 0 {
+			return nil, errors.New("dictionary is required")
+		}
+		words := make(map[string]string, len(tc.Dictionary))
+		for from, to := range tc.Dictionary {
+			words[strings.ToLower(from)] = to
+		}
+		return &dictionaryReplace{words: words}, nil
+	case "collapse_fillers":
+		if len(tc.Fillers) == 0 {
+			return nil, errors.New("fillers is required")
+		}
+		fillers := make(map[string]map[string]bool, len(tc.Fillers))
+		for lang, list := range tc.Fillers {
+			set := make(map[string]bool, len(list))
+			for _, word := range list {
+				set[strings.ToLower(word)] = true
+			}
+			fillers[strings.ToLower(lang)] = set
+		}
+		return &collapseFillers{fillers: fillers}, nil
+	case "trim_whitespace":
+		return trimWhitespace{}, nil
+	default:
+		return nil, fmt.Errorf("unknown transform type %q", tc.Type)
+	}
+}
+
+// Apply runs the chain over text. Each transform is timed on the span in
+// ctx, and the remaining transforms are skipped once the budget is spent.
+// A nil chain returns text unchanged.
+func (c *Chain) Apply(ctx context.Context, text, lang string) string {
+	if c == nil {
+		return text
+	}
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+	for i, t := range c.transforms {
+		if elapsed := time.Since(start); elapsed > c.budget {
+			span.AddEvent("Transform budget exceeded", trace.WithAttributes(
+				attribute.Int("transform.skipped", len(c.transforms)-i),
+				attribute.Float64("transform.elapsed_seconds", elapsed.Seconds()),
+			))
+			break
+		}
+		stepStart := time.Now()
+		text = t.Apply(text, lang)
+		span.AddEvent("Transform applied", trace.WithAttributes(
+			attribute.String("transform.name", t.Name()),
+			attribute.Float64("transform.duration_seconds", time.Since(stepStart).Seconds()),
+		))
+	}
+	return text
+}
+
+type regexReplace struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+func (*regexReplace) Name() string { return "regex_replace" }
+
+func (t *regexReplace) Apply(text, _ string) string {
+	return t.re.ReplaceAllString(text, t.replacement)
+}
+
+// dictionaryReplace swaps whole words, matched case-insensitively, for
+// their canonical spelling.
+type dictionaryReplace struct {
+	words map[string]string
+}
+
+func (*dictionaryReplace) Name() string { return "dictionary_replace" }
+
+func (t *dictionaryReplace) Apply(text, _ string) string {
+	return mapWords(text, func(word string) (string, bool) {
+		canonical, ok := t.words[strings.ToLower(word)]
+		return canonical, ok
+	})
+}
+
+// collapseFillers drops filler words listed for the detected language, or
+// under "*" for every language, together with a comma directly after them.
+type collapseFillers struct {
+	fillers map[string]map[string]bool
+}
+
+func (*collapseFillers) Name() string { return "collapse_fillers" }
+
+func (t *collapseFillers) Apply(text, lang string) string {
+	forLang, forAll := t.fillers[strings.ToLower(lang)], t.fillers["*"]
+	if forLang == nil && forAll == nil {
+		return text
+	}
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := strings.ToLower(string(runes[i:j]))
+		if !forLang[word] && !forAll[word] {
+			b.WriteString(string(runes[i:j]))
+			i = j
+			continue
+		}
+		if j < len(runes) && runes[j] == ',' {
+			j++
+		}
+		for j < len(runes) && runes[j] == ' ' {
+			j++
+		}
+		i = j
+	}
+	return trimWhitespace{}.Apply(b.String(), lang)
+}
+
+// trimWhitespace collapses runs of spaces and tabs and trims every line.
+type trimWhitespace struct{}
+
+func (trimWhitespace) Name() string { return "trim_whitespace" }
+
+func (trimWhitespace) Apply(text, _ string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '\'' || r == '-'
+}
+
+// mapWords calls replace for every word in text and substitutes the word
+// when replace reports a match.
+func mapWords(text string, replace func(word string) (string, bool)) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if replacement, ok := replace(word); ok {
+			word = replacement
+		}
+		b.WriteString(word)
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package transform
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const chainConfig = `
+budget: 1s
+transforms:
+  - type: collapse_fillers
+    fillers:
+      en: [um, uh]
+      ru: [ну]
+      "*": [hmm]
+  - type: dictionary_replace
+    dictionary:
+      kubernetes: Kubernetes
+      postgres: PostgreSQL
+  - type: regex_replace
+    pattern: '(\d+) percent'
+    replacement: '$1%'
+  - type: trim_whitespace
+`
+
+func TestChainAppliesTransformsInOrder(t *testing.T) {
+	chain, err := Parse([]byte(chainConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		text, lang, want string
+	}{
+		{"Um, we moved KUBERNETES to postgres", "en", "we moved Kubernetes to PostgreSQL"},
+		{"uh  it is   90 percent\n  done  ", "en", "it is 90%\ndone"},
+		{"hmm, ну да", "ru", "да"},
+		// Fillers of another language are words here
+		{"ну um", "de", "ну um"},
+		// Only whole words are replaced
+		{"postgresql", "en", "postgresql"},
+	} {
+		if got := chain.Apply(context.Background(), c.text, c.lang); got != c.want {
+			t.Errorf("Apply(%q, %s) = %q, want %q", c.text, c.lang, got, c.want)
+		}
+	}
+}
+
+func TestParseReportsEveryInvalidEntry(t *testing.T) {
+	_, err := Parse([]byte(`
+budget: soon
+transforms:
+  - type: regex_replace
+    pattern: '('
+  - type: dictionary_replace
+  - type: shout
+`))
+	if err == nil {
+		t.Fatal("invalid config parsed")
+	}
+	for _, want := range []string{"budget", "transforms[0] (regex_replace)", "transforms[1] (dictionary_replace)", "transforms[2] (shout)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+
+	if _, err := Parse([]byte("transforms:\n  - type: trim_whitespace\n    patern: x\n")); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestEmptyAndNilChainsKeepTheText(t *testing.T) {
+	chain, err := Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.Apply(context.Background(), " text ", "en"); got != " text " {
+		t.Errorf("empty chain returned %q", got)
+	}
+	var none *Chain
+	if got := none.Apply(context.Background(), " text ", "en"); got != " text " {
+		t.Errorf("nil chain returned %q", got)
+	}
+}
+
+// slowTransform appends its mark after taking its time.
+type slowTransform struct {
+	mark string
+}
+
+func (slowTransform) Name() string { return "slow" }
+
+func (s slowTransform) Apply(text, _ string) string {
+	time.Sleep(5 * time.Millisecond)
+	return text + s.mark
+}
+
+func TestChainStopsOnceTheBudgetIsSpent(t *testing.T) {
+	chain := &Chain{transforms: []Transform{slowTransform{"a"}, slowTransform{"b"}}, budget: time.Millisecond}
+	if got := chain.Apply(context.Background(), "", "en"); got != "a" {
+		t.Errorf("Apply = %q, want the transforms after the budget skipped", got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/sender"
+)
+
+var updatesReceivedCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "telegram_updates_received_total",
+		Help: "Total number of updates received from Telegram.",
+	},
+)
+
+var missedUpdatesCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "missed_updates_total",
+		Help: "Estimated number of updates Telegram discarded, from gaps in the update IDs received since startup; update types the bot did not ask for also leave gaps.",
+	},
+)
+
+// allowedUpdates are the only update types the bot asks Telegram for,
+// whether polling or through the webhook.
+var allowedUpdates = []string{"message", "callback_query"}
+
+const (
+	pollRetryDelay    = 3 * time.Second
+	maxPollRetryDelay = time.Minute
+)
+
+// backoff is a retry delay doubling from pollRetryDelay up to
+// maxPollRetryDelay with every failure in a row.
+type backoff struct {
+	delay time.Duration
+}
+
+func (b *backoff) next() time.Duration {
+	b.delay = min(max(2*b.delay, pollRetryDelay), maxPollRetryDelay)
+	return b.delay
+}
+
+func (b *backoff) reset() {
+	b.delay = 0
+}
+
+// sleep waits for d and reports true, or false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// updateGaps follows the update IDs received in this process to spot the
+// ones Telegram discarded. It outlives a poller, so that one resuming
+// where the previous left off carries on its sequence.
+type updateGaps struct {
+	lastID int
+}
+
+// seen records update id and returns how many IDs it skipped. The first ID
+// seen only establishes the baseline: an offset stored by an earlier
+// process says nothing about the updates that expired meanwhile.
+func (g *updateGaps) seen(id int) int {
+	missed := 0
+	if g.lastID != 0 && id > g.lastID+1 {
+		missed = id - g.lastID - 1
+	}
+	g.lastID = max(g.lastID, id)
+	return missed
+}
+
+// getUpdates is bot.GetUpdates recording the forum topics of the updates,
+// which the library does not decode, in topics.
+func getUpdates(bot *tgbotapi.BotAPI, config tgbotapi.UpdateConfig, topics *sender.Topics) ([]tgbotapi.Update, error) {
+	params := make(tgbotapi.Params)
+	params.AddNonZero("offset", config.Offset)
+	params.AddNonZero("limit", config.Limit)
+	params.AddNonZero("timeout", config.Timeout)
+	if err := params.AddInterface("allowed_updates", config.AllowedUpdates); err != nil {
+		return nil, err
+	}
+	resp, err := bot.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &raw); err != nil {
+		return nil, err
+	}
+	updates := make([]tgbotapi.Update, len(raw))
+	for i := range raw {
+		if err := json.Unmarshal(raw[i], &updates[i]); err != nil {
+			return nil, err
+		}
+		topics.RememberUpdate(raw[i])
+	}
+	return updates, nil
+}
+
+// pollUpdates long-polls Telegram with getUpdates and delivers every update
+// on the returned channel, whose capacity is buffer, recording their forum
+// topics in topics. Delivery blocks when
+// the channel is full, so updates are never dropped locally.
+//
+// Update IDs grow by one per update, so a jump in the sequence, followed in
+// gaps, means Telegram likely discarded updates before we fetched them.
+// The channel is closed when ctx is cancelled.
+func pollUpdates(ctx context.Context, bot *tgbotapi.BotAPI, config tgbotapi.UpdateConfig, buffer int, topics *sender.Topics, gaps *updateGaps) <-chan tgbotapi.Update {
+	ch := make(chan tgbotapi.Update, buffer)
+	go func() {
+		defer close(ch)
+		var retry backoff
+		for ctx.Err() == nil {
+			updates, err := getUpdates(bot, config, topics)
+			if err != nil {
+				delay := retry.next()
+				log.Error().Err(err).Dur("retry_in", delay).Msg("Failed to get updates, retrying")
+				sleep(ctx, delay)
+				continue
+			}
+			retry.reset()
+			for _, update := range updates {
+				if update.UpdateID < config.Offset {
+					continue
+				}
+				updatesReceivedCounter.Inc()
+				if missed := gaps.seen(update.UpdateID); missed > 0 {
+					missedUpdatesCounter.Add(float64(missed))
+					log.Warn().Int("missed", missed).Int("update_id", update.UpdateID).Msg("Gap in received update IDs")
+				}
+				config.Offset = update.UpdateID + 1
+				select {
+				case ch <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"telegram-sr-bot/sender"
+)
+
+func TestUpdateGapsCountsOnlyWithinTheProcess(t *testing.T) {
+	var gaps updateGaps
+	// Resumed from an offset stored before a restart, updates that expired
+	// meanwhile are not known to be missed
+	if missed := gaps.seen(500); missed != 0 {
+		t.Errorf("first update missed %d, want the baseline", missed)
+	}
+	for _, c := range []struct {
+		id, missed int
+	}{
+		{501, 0},
+		{504, 2},
+		// Delivered again to a poller resuming from the last processed offset
+		{503, 0},
+		{504, 0},
+		{505, 0},
+	} {
+		if missed := gaps.seen(c.id); missed != c.missed {
+			t.Errorf("update %d missed %d, want %d", c.id, missed, c.missed)
+		}
+	}
+}
+
+// fakeTelegram serves getUpdates from batches, one per request, and records
+// the offsets asked for. Once the batches run out it answers with none.
+type fakeTelegram struct {
+	mu      sync.Mutex
+	batches []string
+	offsets []string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/getMe"):
+		fmt.Fprint(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "bot"}}`)
+	case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+		r.ParseForm()
+		f.mu.Lock()
+		f.offsets = append(f.offsets, r.Form.Get("offset"))
+		batch := "[]"
+		if len(f.batches) > 0 {
+			batch, f.batches = f.batches[0], f.batches[1:]
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"ok": true, "result": %s}`, batch)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestPollUpdatesDeliversEachUpdateOnce(t *testing.T) {
+	telegram := &fakeTelegram{batches: []string{
+		`[{"update_id": 3}, {"update_id": 4, "message": {"message_id": 5, "chat": {"id": -100}, "message_thread_id": 9, "is_topic_message": true}}]`,
+		// Delivered again along with the next ones, and two discarded
+		`[{"update_id": 4}, {"update_id": 7}]`,
+	}}
+	server := httptest.NewServer(telegram)
+	defer server.Close()
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topics := sender.NewTopics()
+	missed := testutil.ToFloat64(missedUpdatesCounter)
+	updates := pollUpdates(ctx, bot, tgbotapi.UpdateConfig{Offset: 3, Timeout: 1}, 0, topics, &updateGaps{})
+	var got []int
+	for len(got) < 3 {
+		got = append(got, (<-updates).UpdateID)
+	}
+	cancel()
+	for range updates {
+	}
+
+	if !reflect.DeepEqual(got, []int{3, 4, 7}) {
+		t.Errorf("delivered updates %v, want 3, 4 and 7", got)
+	}
+	if n := testutil.ToFloat64(missedUpdatesCounter) - missed; n != 2 {
+		t.Errorf("%v updates counted missed, want 2", n)
+	}
+	telegram.mu.Lock()
+	defer telegram.mu.Unlock()
+	if len(telegram.offsets) < 3 || !reflect.DeepEqual(telegram.offsets[:3], []string{"3", "5", "8"}) {
+		t.Errorf("asked for offsets %v, want 3, 5 and 8", telegram.offsets)
+	}
+	if thread := topics.Thread(-100, 5); thread != 9 {
+		t.Errorf("topic of the polled message = %d, want 9", thread)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"telegram-sr-bot/sender"
+)
+
+// secretTokenHeader carries the secret_token given to setWebhook on every
+// webhook request, proving it comes from Telegram.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// setWebhook points Telegram at webhookURL. The bot API version we use
+// predates secret tokens, so the request is made by hand.
+func setWebhook(bot *tgbotapi.BotAPI, webhookURL, secret string) error {
+	params := tgbotapi.Params{"url": webhookURL, "secret_token": secret}
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+	_, err := bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// newWebhookSecret returns a random secret token, Telegram accepts up to 256
+// characters out of A-Z, a-z, 0-9, _ and -.
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal().Err(err).Msg("Failed to generate the webhook secret")
+	}
+	return hex.EncodeToString(secret)
+}
+
+// webhookHandler accepts updates posted by Telegram and delivers them on
+// updates, recording their forum topics in topics. The request is only
+// answered once the update is queued, so Telegram retries whatever could
+// not be taken while ctx is done.
+func webhookHandler(ctx context.Context, secret string, updates chan<- tgbotapi.Update, topics *sender.Topics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(secret)) != 1 {
+			log.Warn().Str("remote_addr", r.RemoteAddr).Msg("Rejected webhook request with a wrong secret token")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read webhook update")
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+		var update tgbotapi.Update
+		if err := json.Unmarshal(body, &update); err != nil {
+			log.Warn().Err(err).Msg("Failed to decode webhook update")
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+		// Decoded fine once already
+		topics.RememberUpdate(body)
+		updatesReceivedCounter.Inc()
+		select {
+		case updates <- update:
+		case <-ctx.Done():
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// serveWebhook registers webhookURL with Telegram and serves it on addr,
+// delivering updates on the returned channel, whose capacity is buffer, and
+// their forum topics to topics.
+// The server stops when ctx is cancelled.
+func serveWebhook(ctx context.Context, bot *tgbotapi.BotAPI, webhookURL, secret, addr string, buffer int, topics *sender.Topics) <-chan tgbotapi.Update {
+	endpoint, err := url.Parse(webhookURL)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		log.Fatal().Err(err).Msg("WEBHOOK_URL must be an https URL")
+	}
+	path := endpoint.Path
+	if path == "" {
+		path = "/"
+	}
+
+	ch := make(chan tgbotapi.Update, buffer)
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler(ctx, secret, ch, topics))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Failed to start webhook server")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Failed to shut down webhook server")
+		}
+	}()
+
+	if err := setWebhook(bot, webhookURL, secret); err != nil {
+		log.Fatal().Err(err).Msg("Failed to set the webhook")
+	}
+	log.Info().Str("addr", addr).Str("path", path).Msg("Receiving updates through the webhook")
+	return ch
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"telegram-sr-bot/sender"
+)
+
+const topicUpdate = `{"update_id": 9, "message": {"message_id": 5, "chat": {"id": -100}, "message_thread_id": 3, "is_topic_message": true, "text": "hi"}}`
+
+func postUpdate(handler http.Handler, method, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/hook", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(secretTokenHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookHandlerDeliversUpdates(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	topics := sender.NewTopics()
+	handler := webhookHandler(context.Background(), "secret", updates, topics)
+
+	if rec := postUpdate(handler, http.MethodPost, "secret", topicUpdate); rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want the update taken", rec.Code)
+	}
+	update := <-updates
+	if update.UpdateID != 9 || update.Message.Text != "hi" {
+		t.Errorf("delivered %+v", update)
+	}
+	if thread := topics.Thread(-100, 5); thread != 3 {
+		t.Errorf("topic of the message = %d, want 3", thread)
+	}
+}
+
+func TestWebhookHandlerRejectsBadRequests(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := webhookHandler(context.Background(), "secret", updates, nil)
+	for _, c := range []struct {
+		name, method, secret, body string
+		status                     int
+	}{
+		{"GET", http.MethodGet, "secret", "", http.StatusMethodNotAllowed},
+		{"no secret", http.MethodPost, "", topicUpdate, http.StatusUnauthorized},
+		{"wrong secret", http.MethodPost, "secrets", topicUpdate, http.StatusUnauthorized},
+		{"not JSON", http.MethodPost, "secret", "update", http.StatusBadRequest},
+		{"too large", http.MethodPost, "secret", `{"update_id": 1, "x": "` + strings.Repeat("a", 1<<20) + `"}`, http.StatusBadRequest},
+	} {
+		if rec := postUpdate(handler, c.method, c.secret, c.body); rec.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.status)
+		}
+	}
+	if len(updates) != 0 {
+		t.Errorf("%d rejected updates delivered", len(updates))
+	}
+}
+
+func TestWebhookHandlerLetsTelegramRetryOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Nobody takes the update any more
+	handler := webhookHandler(ctx, "secret", make(chan tgbotapi.Update), nil)
+	if rec := postUpdate(handler, http.MethodPost, "secret", topicUpdate); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d while shutting down, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSetWebhookSendsTheSecret(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/setWebhook") {
+			r.ParseForm()
+			form = r.Form
+		}
+		fmt.Fprint(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "bot"}}`)
+	}))
+	defer server.Close()
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setWebhook(bot, "https://bot.example/hook", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("url") != "https://bot.example/hook" || form.Get("secret_token") != "secret" {
+		t.Errorf("setWebhook sent %v", form)
+	}
+	if form.Get("allowed_updates") != `["message","callback_query"]` {
+		t.Errorf("allowed_updates = %s", form.Get("allowed_updates"))
+	}
+}
+
+func TestNewWebhookSecretIsAcceptedByTelegram(t *testing.T) {
+	secret := newWebhookSecret()
+	if len(secret) == 0 || len(secret) > 256 || strings.Trim(secret, "0123456789abcdef") != "" {
+		t.Errorf("secret %q is not made of the characters Telegram accepts", secret)
+	}
+	if secret == newWebhookSecret() {
+		t.Error("two secrets alike")
+	}
+}
@@ -0,0 +1,91 @@
+// Package workerpool runs message handlers on a fixed number of goroutines
+// fed by a bounded queue.
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var QueueDepth = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "handler_queue_depth",
+		Help: "Number of updates waiting for a free handler.",
+	},
+)
+
+var InFlight = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "handlers_in_flight",
+		Help: "Number of updates currently being handled.",
+	},
+)
+
+// Job is a unit of work run by the pool.
+type Job func(ctx context.Context)
+
+// Pool runs jobs on a fixed set of workers. Submit blocks while the queue
+// is full, which pushes back on whoever produces the jobs.
+type Pool struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	jobs     chan Job
+	wg       sync.WaitGroup
+	finished atomic.Int64
+}
+
+// New starts workers goroutines taking jobs from a queue of queueSize. Jobs
+// receive a context derived from ctx, so cancelling it tells running
+// handlers to give up.
+func New(ctx context.Context, workers, queueSize int) *Pool {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pool{ctx: ctx, cancel: cancel, jobs: make(chan Job, queueSize)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		QueueDepth.Dec()
+		InFlight.Inc()
+		job(p.ctx)
+		InFlight.Dec()
+		p.finished.Add(1)
+	}
+}
+
+// Submit queues job, blocking until there is room in the queue.
+func (p *Pool) Submit(job Job) {
+	QueueDepth.Inc()
+	p.jobs <- job
+}
+
+// Shutdown stops accepting jobs and waits until every queued and running
+// job has finished. If ctx is done first, the jobs' context is cancelled and
+// Shutdown keeps waiting for them to return. It reports how many jobs
+// finished while shutting down. Submit must not be called after Shutdown.
+func (p *Pool) Shutdown(ctx context.Context) int {
+	before := p.finished.Load()
+	close(p.jobs)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+	return int(p.finished.Load() - before)
+}
@@ -0,0 +1,126 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolBoundsParallelism(t *testing.T) {
+	const workers = 3
+	p := New(context.Background(), workers, 20)
+	var running, peak atomic.Int64
+	for i := 0; i < 20; i++ {
+		p.Submit(func(ctx context.Context) {
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	p.Shutdown(context.Background())
+	if peak.Load() > workers {
+		t.Errorf("%d jobs ran at once on %d workers", peak.Load(), workers)
+	}
+	if p.finished.Load() != 20 {
+		t.Errorf("%d of 20 jobs ran", p.finished.Load())
+	}
+}
+
+func TestSubmitBlocksWhileTheQueueIsFull(t *testing.T) {
+	p := New(context.Background(), 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.Submit(func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+	// The worker is busy and this fills the queue
+	p.Submit(func(ctx context.Context) {})
+
+	submitted := make(chan struct{})
+	go func() {
+		p.Submit(func(ctx context.Context) {})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("a full queue took another job")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("Submit still blocked once the worker freed up")
+	}
+	p.Shutdown(context.Background())
+}
+
+func TestShutdownDrainsQueuedJobs(t *testing.T) {
+	p := New(context.Background(), 2, 10)
+	var ran atomic.Int64
+	release := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		p.Submit(func(ctx context.Context) {
+			<-release
+			if ctx.Err() == nil {
+				ran.Add(1)
+			}
+		})
+	}
+	close(release)
+	p.Shutdown(context.Background())
+	if ran.Load() != 10 {
+		t.Errorf("%d of 10 jobs ran to completion before Shutdown returned", ran.Load())
+	}
+}
+
+func TestShutdownCancelsJobsPastTheGracePeriod(t *testing.T) {
+	p := New(context.Background(), 1, 1)
+	started := make(chan struct{})
+	var cancelled atomic.Bool
+	p.Submit(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		cancelled.Store(true)
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if finished := p.Shutdown(ctx); finished != 1 {
+		t.Errorf("%d jobs finished while shutting down, want 1", finished)
+	}
+	if !cancelled.Load() {
+		t.Error("Shutdown returned before the cancelled job did")
+	}
+}
+
+func TestSubmitFromManyGoroutines(t *testing.T) {
+	p := New(context.Background(), 4, 2)
+	var ran atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				p.Submit(func(ctx context.Context) { ran.Add(1) })
+			}
+		}()
+	}
+	wg.Wait()
+	p.Shutdown(context.Background())
+	if ran.Load() != 200 {
+		t.Errorf("%d of 200 jobs ran", ran.Load())
+	}
+}